@@ -0,0 +1,41 @@
+package v1
+
+import (
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 子域委派，zone内的NS主机需要同时给出胶水地址
+type Delegation struct {
+	DomainName  string       `json:"domainName"`
+	TTL         string       `json:"ttl,omitempty"`
+	NameServers []NameServer `json:"nameServers"`
+	DS          []string     `json:"ds,omitempty"`
+}
+
+type NameServer struct {
+	Name      string   `json:"name" v:"required"`
+	Addresses []string `json:"addresses,omitempty" dc:"胶水地址，IPv4、IPv6或IPv9"`
+}
+
+type DelegationListReq struct {
+	g.Meta     `path:"/delegations" tags:"Delegation" method:"get" summary:"查询子域委派"`
+	DomainName string `json:"domainName" in:"query"`
+}
+type DelegationListRes struct {
+	TotalCount  int          `json:"totalCount"`
+	Delegations []Delegation `json:"delegations"`
+}
+
+type DelegationSetReq struct {
+	g.Meta      `path:"/delegations/{domainName}" tags:"Delegation" method:"put" summary:"设置子域的NS集合，替换原有的NS和胶水"`
+	DomainName  string       `json:"domainName" in:"path" v:"required"`
+	TTL         string       `json:"ttl" v:"integer|min:1"`
+	NameServers []NameServer `json:"nameServers" v:"required"`
+}
+type DelegationSetRes struct{}
+
+type DelegationDeleteReq struct {
+	g.Meta     `path:"/delegations/{domainName}" tags:"Delegation" method:"delete" summary:"删除子域委派，连同DS和不再被引用的胶水"`
+	DomainName string `json:"domainName" in:"path" v:"required"`
+}
+type DelegationDeleteRes struct{}
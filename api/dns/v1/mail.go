@@ -0,0 +1,48 @@
+package v1
+
+import (
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 按参数生成的邮件认证记录，替换同一名字上原有的同类记录
+type MailRecordRes struct {
+	Record Record `json:"record"`
+}
+
+type SPFSetReq struct {
+	g.Meta     `path:"/domains/{domainName}/spf" tags:"Mail" method:"put" summary:"发布SPF记录"`
+	DomainName string   `json:"domainName" in:"path" v:"required"`
+	TTL        string   `json:"ttl" v:"integer|min:1"`
+	A          bool     `json:"a"`
+	MX         bool     `json:"mx"`
+	IP4        []string `json:"ip4"`
+	IP6        []string `json:"ip6"`
+	Include    []string `json:"include"`
+	All        string   `json:"all" v:"in:-all,~all,?all" d:"~all"`
+}
+type SPFSetRes = MailRecordRes
+
+type DMARCSetReq struct {
+	g.Meta          `path:"/domains/{domainName}/dmarc" tags:"Mail" method:"put" summary:"发布DMARC记录"`
+	DomainName      string   `json:"domainName" in:"path" v:"required"`
+	TTL             string   `json:"ttl" v:"integer|min:1"`
+	Policy          string   `json:"policy" v:"required|in:none,quarantine,reject"`
+	SubdomainPolicy string   `json:"subdomainPolicy" v:"in:none,quarantine,reject"`
+	Percent         *int     `json:"pct" v:"between:0,100"`
+	Rua             []string `json:"rua" dc:"汇总报告地址"`
+	Ruf             []string `json:"ruf" dc:"失败报告地址"`
+	Adkim           string   `json:"adkim" v:"in:r,s"`
+	Aspf            string   `json:"aspf" v:"in:r,s"`
+}
+type DMARCSetRes = MailRecordRes
+
+type DKIMSetReq struct {
+	g.Meta     `path:"/domains/{domainName}/dkim/{selector}" tags:"Mail" method:"put" summary:"发布DKIM公钥"`
+	DomainName string `json:"domainName" in:"path" v:"required"`
+	Selector   string `json:"selector" in:"path" v:"required"`
+	TTL        string `json:"ttl" v:"integer|min:1"`
+	KeyType    string `json:"keyType" v:"in:rsa,ed25519" d:"rsa"`
+	PublicKey  string `json:"publicKey" v:"required" dc:"base64或PEM格式的公钥"`
+	Testing    bool   `json:"testing"`
+}
+type DKIMSetRes = MailRecordRes
@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// DNS记录，名字可以用U-label或A-label、相对或绝对写法，zone中保存为相对于$ORIGIN的小写A-label
+type Record struct {
+	ID          string   `json:"id" dc:"记录ID，修改记录时不变"`
+	DomainName  string   `json:"domainName" dc:"owner，@为zone apex"`
+	TTL         string   `json:"ttl,omitempty"`
+	Type        string   `json:"type"`
+	Priority    string   `json:"priority,omitempty" dc:"MX优先级"`
+	Data        string   `json:"data"`
+	Strings     []string `json:"strings,omitempty" dc:"TXT的character-string，每个不超过255字节"`
+	UnicodeName string   `json:"unicodeName,omitempty" dc:"owner的U-label写法，非IDN时为空"`
+	UnicodeData string   `json:"unicodeData,omitempty" dc:"目标的U-label写法，非IDN时为空"`
+}
+
+// 记录的查询条件和分页参数，各条件同时满足。名字条件不区分大小写，可以用U-label
+type RecordFilter struct {
+	DomainName   string `json:"domainName" in:"query" dc:"名字完全相同"`
+	Type         string `json:"type" in:"query" v:"in:A,AAAA,A9,NS,MX,PTR,CNAME,TXT,DS"`
+	Data         string `json:"data" in:"query" dc:"数据完全相同"`
+	Types        string `json:"types" in:"query" dc:"逗号分隔的类型，属于其中之一，如A,AAAA"`
+	NamePrefix   string `json:"namePrefix" in:"query" dc:"相对于zone的名字前缀"`
+	NameSuffix   string `json:"nameSuffix" in:"query" dc:"相对于zone的名字后缀，按字符匹配"`
+	NameGlob     string `json:"nameGlob" in:"query" dc:"通配，*匹配任意字符，?匹配一个字符"`
+	Subtree      string `json:"subtree" in:"query" dc:"名字本身及其下的所有名字"`
+	TTLMin       int    `json:"ttlMin" in:"query" v:"min:0"`
+	TTLMax       int    `json:"ttlMax" in:"query" v:"min:0" dc:"0为不限"`
+	DataContains string `json:"dataContains" in:"query" dc:"数据包含的子串"`
+	Sort         string `json:"sort" in:"query" dc:"逗号分隔的name、type、ttl、data，前加-为降序，默认name,type"`
+	Offset       int    `json:"offset" in:"query" v:"min:0"`
+	Limit        int    `json:"limit" in:"query" d:"100" v:"between:1,1000"`
+	Cursor       string `json:"cursor" in:"query" dc:"上一页返回的nextCursor，不能与offset同时使用"`
+}
+
+type RecordListReq struct {
+	g.Meta `path:"/records" tags:"Record" method:"get" summary:"查询DNS记录，支持过滤、排序和分页"`
+	RecordFilter
+}
+type RecordListRes struct {
+	TotalCount int      `json:"totalCount" dc:"满足条件的记录总数"`
+	Records    []Record `json:"records"`
+	NextCursor string   `json:"nextCursor,omitempty" dc:"下一页的cursor，没有下一页时为空"`
+}
+
+type RecordReverseReq struct {
+	g.Meta     `path:"/records/reverse" tags:"Record" method:"get" summary:"反查引用地址、网段或目标的记录，四个参数只能给出一个"`
+	IP         string `json:"ip" in:"query" v:"ip" dc:"A、AAAA记录的地址"`
+	CIDR       string `json:"cidr" in:"query" dc:"IPv4或IPv6网段，如10.0.0.0/8"`
+	IPv9Prefix string `json:"ipv9Prefix" in:"query" dc:"A9地址的前几段，如32768[86，查询串中[和]需编码为%5B、%5D"`
+	Target     string `json:"target" in:"query" dc:"CNAME、MX、NS、PTR的目标，如www.chn996.cn"`
+}
+type RecordReverseRes struct {
+	TotalCount int      `json:"totalCount"`
+	Records    []Record `json:"records"`
+}
+
+type RecordCreateReq struct {
+	g.Meta     `path:"/records" tags:"Record" method:"post" summary:"添加DNS记录"`
+	DomainName string   `json:"domainName" v:"required"`
+	TTL        string   `json:"ttl" v:"required|integer|min:1"`
+	Type       string   `json:"type" v:"required|in:A,AAAA,A9,NS,MX,PTR,CNAME,TXT,DS"`
+	Priority   string   `json:"priority" v:"required-if:type,MX|integer|between:0,65535"`
+	Data       string   `json:"data" v:"required-without:strings"`
+	Strings    []string `json:"strings" dc:"TXT记录可以只给出strings"`
+	Override   string   `json:"override" dc:"注册局override口令，可以在保留、禁止的名字下添加记录"`
+}
+type RecordCreateRes struct {
+	Record Record `json:"record"`
+}
+
+type RecordDeleteReq struct {
+	g.Meta     `path:"/records" tags:"Record" method:"delete" summary:"删除DNS记录，给出id时按ID删除"`
+	ID         string `json:"id"`
+	DomainName string `json:"domainName" v:"required-without:id"`
+	Type       string `json:"type" v:"required-without:id|in:A,AAAA,A9,NS,MX,PTR,CNAME,TXT,DS"`
+	Data       string `json:"data" v:"required-without:id"`
+}
+type RecordDeleteRes struct{}
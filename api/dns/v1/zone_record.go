@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 按ID访问的记录接口，zone为zone的名字，如chn
+
+type ZoneRecordListReq struct {
+	g.Meta `path:"/zones/{zone}/records" tags:"ZoneRecord" method:"get" summary:"查询zone中的记录，支持过滤、排序和分页"`
+	Zone   string `json:"zone" in:"path" v:"required"`
+	RecordFilter
+}
+type ZoneRecordListRes struct {
+	TotalCount int      `json:"totalCount"`
+	Records    []Record `json:"records"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+type ZoneRecordCreateReq struct {
+	g.Meta     `path:"/zones/{zone}/records" tags:"ZoneRecord" method:"post" summary:"添加记录，返回分配的ID"`
+	Zone       string   `json:"zone" in:"path" v:"required"`
+	DomainName string   `json:"domainName" v:"required"`
+	TTL        string   `json:"ttl" v:"required|integer|min:1"`
+	Type       string   `json:"type" v:"required|in:A,AAAA,A9,NS,MX,PTR,CNAME,TXT,DS"`
+	Priority   string   `json:"priority" v:"required-if:type,MX|integer|between:0,65535"`
+	Data       string   `json:"data" v:"required-without:strings"`
+	Strings    []string `json:"strings"`
+	Override   string   `json:"override"`
+}
+type ZoneRecordCreateRes struct {
+	Record Record `json:"record"`
+}
+
+type ZoneRecordGetReq struct {
+	g.Meta `path:"/zones/{zone}/records/{id}" tags:"ZoneRecord" method:"get" summary:"按ID查询记录"`
+	Zone   string `json:"zone" in:"path" v:"required"`
+	ID     string `json:"id" in:"path" v:"required"`
+}
+type ZoneRecordGetRes struct {
+	Record Record `json:"record"`
+}
+
+type ZoneRecordUpdateReq struct {
+	g.Meta     `path:"/zones/{zone}/records/{id}" tags:"ZoneRecord" method:"put" summary:"替换记录的全部字段，ID不变。委派的NS、DS和胶水不能修改"`
+	Zone       string   `json:"zone" in:"path" v:"required"`
+	ID         string   `json:"id" in:"path" v:"required"`
+	DomainName string   `json:"domainName" v:"required"`
+	TTL        string   `json:"ttl" v:"required|integer|min:1"`
+	Type       string   `json:"type" v:"required|in:A,AAAA,A9,NS,MX,PTR,CNAME,TXT,DS"`
+	Priority   string   `json:"priority" v:"required-if:type,MX|integer|between:0,65535"`
+	Data       string   `json:"data" v:"required-without:strings"`
+	Strings    []string `json:"strings"`
+	Override   string   `json:"override"`
+}
+type ZoneRecordUpdateRes struct {
+	Record Record `json:"record"`
+}
+
+// 只修改给出的字段，没有给出的字段保持原值
+type ZoneRecordPatchReq struct {
+	g.Meta     `path:"/zones/{zone}/records/{id}" tags:"ZoneRecord" method:"patch" summary:"修改记录的部分字段，ID不变。委派的NS、DS和胶水不能修改"`
+	Zone       string   `json:"zone" in:"path" v:"required"`
+	ID         string   `json:"id" in:"path" v:"required"`
+	DomainName *string  `json:"domainName,omitempty"`
+	TTL        *string  `json:"ttl,omitempty" v:"integer|min:1"`
+	Type       *string  `json:"type,omitempty" v:"in:A,AAAA,A9,NS,MX,PTR,CNAME,TXT,DS"`
+	Priority   *string  `json:"priority,omitempty" v:"integer|between:0,65535"`
+	Data       *string  `json:"data,omitempty"`
+	Strings    []string `json:"strings,omitempty"`
+	Override   string   `json:"override,omitempty"`
+}
+type ZoneRecordPatchRes struct {
+	Record Record `json:"record"`
+}
+
+type ZoneRecordDeleteReq struct {
+	g.Meta `path:"/zones/{zone}/records/{id}" tags:"ZoneRecord" method:"delete" summary:"按ID删除记录。委派的NS、DS和胶水需要通过委派接口删除"`
+	Zone   string `json:"zone" in:"path" v:"required"`
+	ID     string `json:"id" in:"path" v:"required"`
+}
+type ZoneRecordDeleteRes struct{}
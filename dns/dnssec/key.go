@@ -0,0 +1,212 @@
+package dnssec
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gogf/gf/v2/os/gfile"
+	"github.com/miekg/dns"
+)
+
+const (
+	RoleKSK = "KSK"
+	RoleZSK = "ZSK"
+)
+
+// 一个DNSSEC密钥，时间字段决定密钥当前是否发布在DNSKEY中、是否用于签名
+type Key struct {
+	Tag       uint16    `json:"tag"`
+	Algorithm uint8     `json:"algorithm"`
+	Role      string    `json:"role"`
+	Created   time.Time `json:"created"`
+	// 发布到DNSKEY的时间
+	Publish time.Time `json:"publish"`
+	// 开始签名的时间
+	Activate time.Time `json:"activate"`
+	// 停止签名的时间，零值表示未安排
+	Retire time.Time `json:"retire,omitempty"`
+	// 从DNSKEY中移除的时间，零值表示未安排
+	Remove time.Time `json:"remove,omitempty"`
+	// 轮换中接替本密钥的密钥
+	Successor uint16 `json:"successor,omitempty"`
+	// KSK的DS在父区发布的时间，由运维确认
+	DSPublished time.Time `json:"dsPublished,omitempty"`
+
+	dnskey  *dns.DNSKEY
+	private crypto.Signer
+}
+
+func (k *Key) DNSKEY() *dns.DNSKEY {
+	return k.dnskey
+}
+
+// 在t时刻是否发布在DNSKEY RRset中
+func (k *Key) IsPublished(t time.Time) bool {
+	if k.Publish.IsZero() || t.Before(k.Publish) {
+		return false
+	}
+	return k.Remove.IsZero() || t.Before(k.Remove)
+}
+
+// 在t时刻是否参与签名
+func (k *Key) IsActive(t time.Time) bool {
+	if k.Activate.IsZero() || t.Before(k.Activate) {
+		return false
+	}
+	return k.Retire.IsZero() || t.Before(k.Retire)
+}
+
+// 密钥文件名，与BIND的dnssec-keygen保持一致：K<zone>+<alg>+<tag>
+func (k *Key) baseName(zone string) string {
+	return fmt.Sprintf("K%s+%03d+%05d", dns.Fqdn(zone), k.Algorithm, k.Tag)
+}
+
+// 密钥存储，公私钥以BIND格式保存，时间等元数据保存在keys.json
+type KeyStore struct {
+	dir  string
+	zone string
+	keys []*Key
+}
+
+func NewKeyStore(dir string, zone string) *KeyStore {
+	return &KeyStore{dir: dir, zone: dns.Fqdn(zone)}
+}
+
+func (s *KeyStore) Keys() []*Key {
+	return s.keys
+}
+
+func (s *KeyStore) metaFile() string {
+	return filepath.Join(s.dir, "keys.json")
+}
+
+// 从keyDir读取所有密钥
+func (s *KeyStore) Load() error {
+	s.keys = nil
+	if !gfile.Exists(s.metaFile()) {
+		return nil
+	}
+	var keys []*Key
+	if err := json.Unmarshal(gfile.GetBytes(s.metaFile()), &keys); err != nil {
+		return fmt.Errorf("读取密钥元数据失败: %v", err)
+	}
+	for _, k := range keys {
+		pubFile := filepath.Join(s.dir, k.baseName(s.zone)+".key")
+		rr, err := dns.NewRR(gfile.GetContents(pubFile))
+		if err != nil || rr == nil {
+			return fmt.Errorf("读取公钥%s失败: %v", pubFile, err)
+		}
+		dnskey, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			return fmt.Errorf("%s 不是DNSKEY记录", pubFile)
+		}
+		privFile := filepath.Join(s.dir, k.baseName(s.zone)+".private")
+		f, err := os.Open(privFile)
+		if err != nil {
+			return err
+		}
+		priv, err := dnskey.ReadPrivateKey(f, privFile)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("读取私钥%s失败: %v", privFile, err)
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("%s 不支持签名", privFile)
+		}
+		k.dnskey = dnskey
+		k.private = signer
+		s.keys = append(s.keys, k)
+	}
+	return nil
+}
+
+// 保存密钥元数据
+func (s *KeyStore) Save() error {
+	data, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return gfile.PutBytes(s.metaFile(), data)
+}
+
+// 生成一个新密钥并写入keyDir，生成后的密钥尚未发布，需要调用方设置时间后Save
+func (s *KeyStore) Generate(role string, algorithm uint8, bits int, ttl uint32) (*Key, error) {
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: s.zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: ttl},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}
+	if role == RoleKSK {
+		dnskey.Flags |= dns.SEP
+	}
+	switch algorithm {
+	case dns.ECDSAP256SHA256, dns.ED25519:
+		bits = 256
+	case dns.ECDSAP384SHA384:
+		bits = 384
+	}
+	priv, err := dnskey.Generate(bits)
+	if err != nil {
+		return nil, fmt.Errorf("生成%s失败: %v", role, err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("不支持的算法 %d", algorithm)
+	}
+	k := &Key{
+		Tag:       dnskey.KeyTag(),
+		Algorithm: algorithm,
+		Role:      role,
+		Created:   time.Now().UTC(),
+		dnskey:    dnskey,
+		private:   signer,
+	}
+	for _, old := range s.keys {
+		if k.Tag == 0 || (old.Tag == k.Tag && old.Algorithm == k.Algorithm) {
+			// keytag冲突，重新生成
+			return s.Generate(role, algorithm, bits, ttl)
+		}
+	}
+
+	base := filepath.Join(s.dir, k.baseName(s.zone))
+	if err = writePrivateKey(base+".private", dnskey.PrivateKeyString(priv)); err != nil {
+		return nil, err
+	}
+	if err = gfile.PutContents(base+".key", dnskey.String()+"\n"); err != nil {
+		_ = os.Remove(base + ".private")
+		return nil, err
+	}
+	s.keys = append(s.keys, k)
+	sort.SliceStable(s.keys, func(i, j int) bool {
+		return s.keys[i].Created.Before(s.keys[j].Created)
+	})
+	return k, nil
+}
+
+// 私钥文件创建时即为0600，已存在时不覆盖
+func writePrivateKey(path string, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("写私钥文件失败: %v", err)
+	}
+	if _, err = f.WriteString(content); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("写私钥文件失败: %v", err)
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("写私钥文件失败: %v", err)
+	}
+	return nil
+}
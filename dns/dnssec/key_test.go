@@ -0,0 +1,54 @@
+package dnssec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// 私钥文件只有属主可读写，重新加载后密钥可用
+func TestGenerateKey(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	s := NewKeyStore(dir, "chn")
+	k, err := s.Generate(RoleKSK, dns.ECDSAP256SHA256, 0, 3600)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	base := filepath.Join(dir, k.baseName("chn"))
+	info, err := os.Stat(base + ".private")
+	if err != nil {
+		t.Fatalf("私钥文件: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("私钥文件权限为%o，应为600", mode)
+	}
+	if _, err = os.Stat(base + ".key"); err != nil {
+		t.Errorf("公钥文件: %v", err)
+	}
+	if err = s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded := NewKeyStore(dir, "chn")
+	if err = loaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Keys()) != 1 || loaded.Keys()[0].Tag != k.Tag || loaded.Keys()[0].private == nil {
+		t.Errorf("重新加载的密钥为 %+v", loaded.Keys())
+	}
+}
+
+// 已存在的私钥文件不会被覆盖
+func TestWritePrivateKeyExists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "K.private")
+	if err := writePrivateKey(path, "first"); err != nil {
+		t.Fatalf("writePrivateKey: %v", err)
+	}
+	if err := writePrivateKey(path, "second"); err == nil {
+		t.Error("已存在的私钥文件应返回错误")
+	}
+	if content, _ := os.ReadFile(path); string(content) != "first" {
+		t.Errorf("私钥文件内容为 %q", content)
+	}
+}
@@ -0,0 +1,285 @@
+package dnssec
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 密钥轮换配置，对应dnssec.rollover节点
+type RolloverConfig struct {
+	Enabled     bool   `json:"enabled"`
+	ZSKLifetime string `json:"zskLifetime"`
+	KSKLifetime string `json:"kskLifetime"`
+	// 主从同步所需时间，空表示使用SOA的refresh+retry
+	PropagationDelay       string `json:"propagationDelay"`
+	ParentDSTTL            string `json:"parentDSTTL"`
+	ParentPropagationDelay string `json:"parentPropagationDelay"`
+
+	zskLifetime            time.Duration
+	kskLifetime            time.Duration
+	propagationDelay       time.Duration
+	parentDSTTL            time.Duration
+	parentPropagationDelay time.Duration
+}
+
+func (c *RolloverConfig) parse() error {
+	var err error
+	if c.zskLifetime, err = time.ParseDuration(c.ZSKLifetime); err != nil {
+		return fmt.Errorf("rollover.zskLifetime 格式错误: %v", err)
+	}
+	if c.kskLifetime, err = time.ParseDuration(c.KSKLifetime); err != nil {
+		return fmt.Errorf("rollover.kskLifetime 格式错误: %v", err)
+	}
+	if c.PropagationDelay != "" {
+		if c.propagationDelay, err = time.ParseDuration(c.PropagationDelay); err != nil {
+			return fmt.Errorf("rollover.propagationDelay 格式错误: %v", err)
+		}
+	}
+	if c.parentDSTTL, err = time.ParseDuration(c.ParentDSTTL); err != nil {
+		return fmt.Errorf("rollover.parentDSTTL 格式错误: %v", err)
+	}
+	if c.parentPropagationDelay, err = time.ParseDuration(c.ParentPropagationDelay); err != nil {
+		return fmt.Errorf("rollover.parentPropagationDelay 格式错误: %v", err)
+	}
+	return nil
+}
+
+// 轮换时间计算所需的zone参数
+type ZoneTiming struct {
+	// zone中最大的TTL
+	MaxTTL  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+// 密钥当前所处阶段及下一步动作
+type KeyStatus struct {
+	Tag            uint16    `json:"tag"`
+	Algorithm      uint8     `json:"algorithm"`
+	Role           string    `json:"role"`
+	Phase          string    `json:"phase"`
+	Publish        time.Time `json:"publish"`
+	Activate       time.Time `json:"activate"`
+	Retire         time.Time `json:"retire"`
+	Remove         time.Time `json:"remove"`
+	DSPublished    time.Time `json:"dsPublished"`
+	Successor      uint16    `json:"successor,omitempty"`
+	NextAction     string    `json:"nextAction"`
+	NextActionTime time.Time `json:"nextActionTime"`
+}
+
+// 主从同步时间
+func (s *Signer) propagationDelay() time.Duration {
+	if s.cfg.Rollover.PropagationDelay != "" {
+		return s.cfg.Rollover.propagationDelay
+	}
+	return time.Duration(s.timing.Refresh+s.timing.Retry) * time.Second
+}
+
+// 新DNSKEY发布后到可以使用所需等待的时间
+func (s *Signer) publishInterval() time.Duration {
+	return time.Duration(s.cfg.DNSKEYTTL)*time.Second + s.propagationDelay()
+}
+
+// ZSK停止签名后，旧签名在缓存中过期所需的时间
+func (s *Signer) retireInterval() time.Duration {
+	return time.Duration(s.timing.MaxTTL)*time.Second + s.propagationDelay()
+}
+
+func (s *Signer) findKey(tag uint16) *Key {
+	for _, k := range s.store.Keys() {
+		if k.Tag == tag {
+			return k
+		}
+	}
+	return nil
+}
+
+func (s *Signer) predecessor(k *Key) *Key {
+	for _, old := range s.store.Keys() {
+		if old.Successor == k.Tag && old.Role == k.Role {
+			return old
+		}
+	}
+	return nil
+}
+
+// 当前正在使用、尚未开始轮换的密钥
+func (s *Signer) currentKey(role string, t time.Time) *Key {
+	var cur *Key
+	for _, k := range s.store.Keys() {
+		if k.Role != role || k.Successor != 0 || !k.Retire.IsZero() || !k.IsActive(t) {
+			continue
+		}
+		if cur == nil || k.Activate.After(cur.Activate) {
+			cur = k
+		}
+	}
+	return cur
+}
+
+// 按照密钥生命周期推进轮换，返回密钥状态是否发生变化
+func (s *Signer) Rollover(t time.Time, timing ZoneTiming) (bool, error) {
+	s.timing = timing
+	if !s.cfg.Rollover.Enabled {
+		return false, nil
+	}
+	changed := false
+	if cur := s.currentKey(RoleZSK, t); cur != nil && !t.Before(cur.Activate.Add(s.cfg.Rollover.zskLifetime-s.publishInterval())) {
+		if _, err := s.startRollover(cur, t); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	if cur := s.currentKey(RoleKSK, t); cur != nil && !t.Before(cur.Activate.Add(s.cfg.Rollover.kskLifetime)) {
+		if _, err := s.startRollover(cur, t); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	for _, k := range s.store.Keys() {
+		if k.Role == RoleKSK && k.Successor != 0 && k.Retire.IsZero() {
+			if succ := s.findKey(k.Successor); succ != nil && !succ.DSPublished.IsZero() {
+				s.scheduleKSKRemoval(k, succ)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		return true, s.store.Save()
+	}
+	return false, nil
+}
+
+// ZSK使用预发布方式：新密钥先发布，等待publishInterval后启用，旧密钥随之停用，再等待retireInterval后移除
+// KSK使用双签名方式：新密钥立即发布并与旧密钥共同签名DNSKEY，父区DS替换并过期后移除旧密钥
+func (s *Signer) startRollover(cur *Key, t time.Time) (*Key, error) {
+	bits := s.cfg.ZSKBits
+	if cur.Role == RoleKSK {
+		bits = s.cfg.KSKBits
+	}
+	k, err := s.store.Generate(cur.Role, s.cfg.Algorithm, bits, s.cfg.DNSKEYTTL)
+	if err != nil {
+		return nil, err
+	}
+	k.Publish = t
+	if cur.Role == RoleZSK {
+		k.Activate = t.Add(s.publishInterval())
+		cur.Retire = k.Activate
+		cur.Remove = cur.Retire.Add(s.retireInterval())
+	} else {
+		k.Activate = t
+	}
+	cur.Successor = k.Tag
+	fmt.Printf("start %s rollover %d -> %d\n", cur.Role, cur.Tag, k.Tag)
+	return k, nil
+}
+
+func (s *Signer) scheduleKSKRemoval(old *Key, succ *Key) {
+	old.Retire = succ.DSPublished.Add(s.cfg.Rollover.parentDSTTL + s.cfg.Rollover.parentPropagationDelay)
+	old.Remove = old.Retire
+}
+
+// 手动开始一次轮换
+func (s *Signer) StartRollover(role string, t time.Time) (*Key, error) {
+	if role != RoleKSK && role != RoleZSK {
+		return nil, fmt.Errorf("role 必须是KSK或ZSK")
+	}
+	cur := s.currentKey(role, t)
+	if cur == nil {
+		return nil, fmt.Errorf("%s 正在轮换中", role)
+	}
+	k, err := s.startRollover(cur, t)
+	if err != nil {
+		return nil, err
+	}
+	return k, s.store.Save()
+}
+
+// 运维确认新KSK的DS已在父区发布（旧DS已撤下）
+func (s *Signer) ConfirmDSPublished(tag uint16, t time.Time) error {
+	k := s.findKey(tag)
+	if k == nil || k.Role != RoleKSK {
+		return fmt.Errorf("没有找到KSK %d", tag)
+	}
+	old := s.predecessor(k)
+	if old == nil {
+		return fmt.Errorf("KSK %d 不在轮换中", tag)
+	}
+	if !k.DSPublished.IsZero() {
+		return fmt.Errorf("KSK %d 的DS已确认", tag)
+	}
+	if ready := k.Publish.Add(s.publishInterval()); t.Before(ready) {
+		return fmt.Errorf("KSK %d 的DNSKEY尚未传播完成，请在%s之后提交DS", tag, ready.Format(time.RFC3339))
+	}
+	k.DSPublished = t
+	s.scheduleKSKRemoval(old, k)
+	return s.store.Save()
+}
+
+// 所有密钥的阶段和下一步动作
+func (s *Signer) KeyStatus(t time.Time, timing ZoneTiming) []KeyStatus {
+	s.timing = timing
+	var list []KeyStatus
+	for _, k := range s.store.Keys() {
+		st := KeyStatus{
+			Tag:         k.Tag,
+			Algorithm:   k.Algorithm,
+			Role:        k.Role,
+			Publish:     k.Publish,
+			Activate:    k.Activate,
+			Retire:      k.Retire,
+			Remove:      k.Remove,
+			DSPublished: k.DSPublished,
+			Successor:   k.Successor,
+		}
+		st.Phase, st.NextAction, st.NextActionTime = s.keyPhase(k, t)
+		list = append(list, st)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Role < list[j].Role })
+	return list
+}
+
+func (s *Signer) keyPhase(k *Key, t time.Time) (string, string, time.Time) {
+	switch {
+	case !k.Remove.IsZero() && !t.Before(k.Remove):
+		return "removed", "", time.Time{}
+	case t.Before(k.Publish):
+		return "generated", "publish", k.Publish
+	case !k.IsActive(t) && t.Before(k.Activate):
+		return "published", "activate", k.Activate
+	case !k.IsActive(t):
+		return "retired", "remove", k.Remove
+	}
+
+	if k.Role == RoleZSK {
+		if !k.Retire.IsZero() {
+			return "retiring", "retire", k.Retire
+		}
+		if !s.cfg.Rollover.Enabled {
+			return "active", "", time.Time{}
+		}
+		return "active", "rollover", k.Activate.Add(s.cfg.Rollover.zskLifetime - s.publishInterval())
+	}
+
+	if s.predecessor(k) != nil && k.DSPublished.IsZero() {
+		ready := k.Publish.Add(s.publishInterval())
+		if t.Before(ready) {
+			return "ds-pending", "wait-dnskey-propagation", ready
+		}
+		return "ds-pending", "submit-ds-and-confirm", ready
+	}
+	if k.Successor != 0 {
+		if k.Retire.IsZero() {
+			return "active", "wait-successor-ds", time.Time{}
+		}
+		return "retiring", "remove", k.Remove
+	}
+	if !s.cfg.Rollover.Enabled {
+		return "active", "", time.Time{}
+	}
+	return "active", "rollover", k.Activate.Add(s.cfg.Rollover.kskLifetime)
+}
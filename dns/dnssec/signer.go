@@ -0,0 +1,490 @@
+package dnssec
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/miekg/dns"
+)
+
+// DNSSEC配置，对应config.yaml中的dnssec节点
+type Config struct {
+	Enabled           bool   `json:"enabled"`
+	KeyDir            string `json:"keyDir"`
+	SignedFile        string `json:"signedFile"`
+	Algorithm         uint8  `json:"algorithm"`
+	KSKBits           int    `json:"kskBits"`
+	ZSKBits           int    `json:"zskBits"`
+	DNSKEYTTL         uint32 `json:"dnskeyTTL"`
+	SignatureValidity string `json:"signatureValidity"`
+	ResignBefore      string `json:"resignBefore"`
+	CheckInterval     string `json:"checkInterval"`
+	A9TypeCode        uint16 `json:"a9TypeCode"`
+	NSEC3             struct {
+		Enabled    bool   `json:"enabled"`
+		Iterations uint16 `json:"iterations"`
+		Salt       string `json:"salt"`
+		OptOut     bool   `json:"optOut"`
+	} `json:"nsec3"`
+	Rollover RolloverConfig `json:"rollover"`
+
+	validity      time.Duration
+	resignBefore  time.Duration
+	checkInterval time.Duration
+}
+
+// 读取dnssec配置并补齐默认值
+func LoadConfig(ctx context.Context) (Config, error) {
+	cfg := Config{
+		KeyDir:            "/var/named/keys",
+		SignedFile:        "/var/named/chn.zone.signed",
+		Algorithm:         dns.ECDSAP256SHA256,
+		KSKBits:           2048,
+		ZSKBits:           1024,
+		DNSKEYTTL:         3600,
+		SignatureValidity: "336h",
+		ResignBefore:      "72h",
+		CheckInterval:     "1h",
+		A9TypeCode:        65281,
+		Rollover: RolloverConfig{
+			ZSKLifetime:            "720h",
+			KSKLifetime:            "8760h",
+			ParentDSTTL:            "86400s",
+			ParentPropagationDelay: "1h",
+		},
+	}
+	v, err := g.Cfg().Get(ctx, "dnssec")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.validity, err = time.ParseDuration(cfg.SignatureValidity); err != nil {
+		return cfg, fmt.Errorf("signatureValidity 格式错误: %v", err)
+	}
+	if cfg.resignBefore, err = time.ParseDuration(cfg.ResignBefore); err != nil {
+		return cfg, fmt.Errorf("resignBefore 格式错误: %v", err)
+	}
+	if cfg.checkInterval, err = time.ParseDuration(cfg.CheckInterval); err != nil {
+		return cfg, fmt.Errorf("checkInterval 格式错误: %v", err)
+	}
+	if cfg.resignBefore >= cfg.validity {
+		return cfg, fmt.Errorf("resignBefore 必须小于 signatureValidity")
+	}
+	if _, err = hex.DecodeString(cfg.NSEC3.Salt); err != nil {
+		return cfg, fmt.Errorf("nsec3.salt 必须是十六进制: %v", err)
+	}
+	if _, ok := dns.AlgorithmToString[cfg.Algorithm]; !ok {
+		return cfg, fmt.Errorf("不支持的DNSSEC算法 %d", cfg.Algorithm)
+	}
+	if err = cfg.Rollover.parse(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c Config) CheckIntervalDuration() time.Duration {
+	return c.checkInterval
+}
+
+// 对zone进行签名，负责DNSKEY、RRSIG以及NSEC/NSEC3链的生成
+type Signer struct {
+	cfg   Config
+	zone  string
+	store *KeyStore
+	// 最近一次签名的时间和签名过期时间
+	lastSigned time.Time
+	expireAt   time.Time
+	// 最近一次轮换检查时的zone参数
+	timing ZoneTiming
+}
+
+func NewSigner(cfg Config, zone string) (*Signer, error) {
+	s := &Signer{
+		cfg:   cfg,
+		zone:  dns.CanonicalName(zone),
+		store: NewKeyStore(cfg.KeyDir, zone),
+	}
+	if err := s.store.Load(); err != nil {
+		return nil, err
+	}
+	if err := s.ensureKeys(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Signer) Config() Config {
+	return s.cfg
+}
+
+func (s *Signer) KeyStore() *KeyStore {
+	return s.store
+}
+
+// keyDir中没有可用的KSK或ZSK时自动生成并立即启用
+func (s *Signer) ensureKeys() error {
+	now := time.Now().UTC()
+	changed := false
+	for _, role := range []string{RoleKSK, RoleZSK} {
+		if len(s.activeKeys(role, now)) > 0 {
+			continue
+		}
+		bits := s.cfg.ZSKBits
+		if role == RoleKSK {
+			bits = s.cfg.KSKBits
+		}
+		k, err := s.store.Generate(role, s.cfg.Algorithm, bits, s.cfg.DNSKEYTTL)
+		if err != nil {
+			return err
+		}
+		k.Publish = now
+		k.Activate = now
+		changed = true
+		fmt.Printf("generated %s %d for %s\n", role, k.Tag, s.zone)
+	}
+	if changed {
+		return s.store.Save()
+	}
+	return nil
+}
+
+func (s *Signer) activeKeys(role string, t time.Time) []*Key {
+	var keys []*Key
+	for _, k := range s.store.Keys() {
+		if k.Role == role && k.IsActive(t) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (s *Signer) publishedKeys(t time.Time) []*Key {
+	var keys []*Key
+	for _, k := range s.store.Keys() {
+		if k.IsPublished(t) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// 是否需要重新签名：从未签名过、签名即将过期，或上次签名后有密钥发布/启用/停用/移除
+func (s *Signer) NeedsResign(t time.Time) bool {
+	if s.lastSigned.IsZero() {
+		return true
+	}
+	for _, k := range s.store.Keys() {
+		for _, event := range []time.Time{k.Publish, k.Activate, k.Retire, k.Remove} {
+			if event.After(s.lastSigned) && !event.After(t) {
+				return true
+			}
+		}
+	}
+	return !t.Before(s.expireAt.Add(-s.cfg.resignBefore))
+}
+
+// 父区需要发布的DS记录，对每个已发布的KSK给出SHA-256摘要
+func (s *Signer) DSRecords() []*dns.DS {
+	var dsList []*dns.DS
+	for _, k := range s.publishedKeys(time.Now().UTC()) {
+		if k.Role != RoleKSK {
+			continue
+		}
+		if ds := k.DNSKEY().ToDS(dns.SHA256); ds != nil {
+			dsList = append(dsList, ds)
+		}
+	}
+	return dsList
+}
+
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+// 对整个zone签名，返回按规范顺序排列、SOA在最前的全部记录
+func (s *Signer) SignZone(soa *dns.SOA, rrs []dns.RR) ([]dns.RR, error) {
+	now := time.Now().UTC()
+	if dns.CanonicalName(soa.Hdr.Name) != s.zone {
+		return nil, fmt.Errorf("SOA %s 与签名zone %s 不一致", soa.Hdr.Name, s.zone)
+	}
+	zsks := s.activeKeys(RoleZSK, now)
+	ksks := s.activeKeys(RoleKSK, now)
+	if len(zsks) == 0 || len(ksks) == 0 {
+		return nil, fmt.Errorf("没有可用于签名的KSK或ZSK")
+	}
+
+	// 按owner+type组成RRset，忽略输入中已有的DNSSEC记录
+	sets := map[rrsetKey][]dns.RR{}
+	names := map[string]map[uint16]bool{}
+	addRR := func(rr dns.RR) {
+		h := rr.Header()
+		h.Name = dns.CanonicalName(h.Name)
+		key := rrsetKey{h.Name, h.Rrtype}
+		sets[key] = append(sets[key], rr)
+		if names[h.Name] == nil {
+			names[h.Name] = map[uint16]bool{}
+		}
+		names[h.Name][h.Rrtype] = true
+	}
+	addRR(dns.Copy(soa))
+	for _, rr := range rrs {
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA, dns.TypeDNSKEY, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM:
+			continue
+		}
+		if !dns.IsSubDomain(s.zone, dns.CanonicalName(rr.Header().Name)) {
+			return nil, fmt.Errorf("记录 %s 不在zone %s 内", rr.Header().Name, s.zone)
+		}
+		addRR(dns.Copy(rr))
+	}
+	for _, k := range s.publishedKeys(now) {
+		dnskey := dns.Copy(k.DNSKEY()).(*dns.DNSKEY)
+		dnskey.Hdr.Ttl = s.cfg.DNSKEYTTL
+		addRR(dnskey)
+	}
+	if s.cfg.NSEC3.Enabled {
+		addRR(&dns.NSEC3PARAM{
+			Hdr:        dns.RR_Header{Name: s.zone, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: 0},
+			Hash:       dns.SHA1,
+			Iterations: s.cfg.NSEC3.Iterations,
+			SaltLength: uint8(len(s.cfg.NSEC3.Salt) / 2),
+			Salt:       strings.ToUpper(s.cfg.NSEC3.Salt),
+		})
+	}
+	// 同一RRset的TTL统一取最小值
+	for _, set := range sets {
+		minTTL := set[0].Header().Ttl
+		for _, rr := range set {
+			if rr.Header().Ttl < minTTL {
+				minTTL = rr.Header().Ttl
+			}
+		}
+		for _, rr := range set {
+			rr.Header().Ttl = minTTL
+		}
+	}
+
+	// 区分委派点与被遮蔽的胶水记录
+	cuts := map[string]bool{}
+	for name, types := range names {
+		if name != s.zone && types[dns.TypeNS] {
+			cuts[name] = true
+		}
+	}
+	occluded := func(name string) bool {
+		for cut := range cuts {
+			if name != cut && dns.IsSubDomain(cut, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var out []dns.RR
+	var authNames []string
+	for name := range names {
+		if !occluded(name) {
+			authNames = append(authNames, name)
+		}
+	}
+	sort.Slice(authNames, func(i, j int) bool { return canonicalLess(authNames[i], authNames[j]) })
+
+	denialTTL := soa.Minttl
+	if soa.Hdr.Ttl < denialTTL {
+		denialTTL = soa.Hdr.Ttl
+	}
+	var denial []dns.RR
+	if s.cfg.NSEC3.Enabled {
+		denial = s.nsec3Chain(authNames, names, cuts, denialTTL)
+	} else {
+		denial = s.nsecChain(authNames, names, denialTTL)
+	}
+
+	inception := uint32(now.Add(-time.Hour).Unix())
+	expiration := uint32(now.Add(s.cfg.validity).Unix())
+	sign := func(set []dns.RR, keys []*Key) error {
+		for _, k := range keys {
+			sig := &dns.RRSIG{
+				Hdr:        dns.RR_Header{Ttl: set[0].Header().Ttl},
+				Algorithm:  k.Algorithm,
+				KeyTag:     k.Tag,
+				SignerName: s.zone,
+				Inception:  inception,
+				Expiration: expiration,
+			}
+			if err := sig.Sign(k.private, set); err != nil {
+				return fmt.Errorf("签名 %s/%s 失败: %v", set[0].Header().Name, dns.TypeToString[set[0].Header().Rrtype], err)
+			}
+			out = append(out, sig)
+		}
+		return nil
+	}
+
+	for key, set := range sets {
+		out = append(out, set...)
+		if occluded(key.name) {
+			// 胶水记录不签名
+			continue
+		}
+		if cuts[key.name] && key.rtype != dns.TypeDS {
+			// 委派点只对DS签名
+			continue
+		}
+		keys := zsks
+		if key.rtype == dns.TypeDNSKEY {
+			keys = ksks
+		}
+		if err := sign(set, keys); err != nil {
+			return nil, err
+		}
+	}
+	for _, rr := range denial {
+		out = append(out, rr)
+		if err := sign([]dns.RR{rr}, zsks); err != nil {
+			return nil, err
+		}
+	}
+
+	sortZone(out)
+	s.lastSigned = now
+	s.expireAt = now.Add(s.cfg.validity)
+	return out, nil
+}
+
+func (s *Signer) nsecChain(authNames []string, names map[string]map[uint16]bool, ttl uint32) []dns.RR {
+	var chain []dns.RR
+	for i, name := range authNames {
+		types := []uint16{dns.TypeNSEC, dns.TypeRRSIG}
+		for t := range names[name] {
+			types = append(types, t)
+		}
+		chain = append(chain, &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: ttl},
+			NextDomain: authNames[(i+1)%len(authNames)],
+			TypeBitMap: sortTypes(types),
+		})
+	}
+	return chain
+}
+
+func (s *Signer) nsec3Chain(authNames []string, names map[string]map[uint16]bool, cuts map[string]bool, ttl uint32) []dns.RR {
+	type entry struct {
+		hash  string
+		types []uint16
+	}
+	seen := map[string]bool{}
+	var entries []entry
+	add := func(name string, types []uint16) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		entries = append(entries, entry{
+			hash:  dns.HashName(name, dns.SHA1, s.cfg.NSEC3.Iterations, s.cfg.NSEC3.Salt),
+			types: sortTypes(types),
+		})
+	}
+	for _, name := range authNames {
+		types := names[name]
+		if cuts[name] && !types[dns.TypeDS] && s.cfg.NSEC3.OptOut {
+			// opt-out时不为无DS的委派生成NSEC3
+			continue
+		}
+		var list []uint16
+		for t := range types {
+			list = append(list, t)
+		}
+		if !cuts[name] || types[dns.TypeDS] {
+			list = append(list, dns.TypeRRSIG)
+		}
+		add(name, list)
+		// 空的非终结节点也需要NSEC3
+		for parent := parentName(name); parent != "" && parent != s.zone && dns.IsSubDomain(s.zone, parent); parent = parentName(parent) {
+			if names[parent] == nil {
+				add(parent, nil)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].hash < entries[j].hash })
+
+	var flags uint8
+	if s.cfg.NSEC3.OptOut {
+		flags = 1
+	}
+	var chain []dns.RR
+	for i, e := range entries {
+		chain = append(chain, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(e.hash) + "." + s.zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: ttl},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			Iterations: s.cfg.NSEC3.Iterations,
+			SaltLength: uint8(len(s.cfg.NSEC3.Salt) / 2),
+			Salt:       strings.ToUpper(s.cfg.NSEC3.Salt),
+			HashLength: 20,
+			NextDomain: entries[(i+1)%len(entries)].hash,
+			TypeBitMap: e.types,
+		})
+	}
+	return chain
+}
+
+func parentName(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return ""
+	}
+	return name[off:]
+}
+
+func sortTypes(types []uint16) []uint16 {
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// RFC 4034 6.1 规范顺序：从最右侧label开始逐个比较
+func canonicalLess(a, b string) bool {
+	la := dns.SplitDomainName(a)
+	lb := dns.SplitDomainName(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		x, y := strings.ToLower(la[i]), strings.ToLower(lb[j])
+		if x != y {
+			return x < y
+		}
+	}
+	return len(la) < len(lb)
+}
+
+// 按owner规范顺序排序，同一owner下SOA最前，其余按类型排列，RRSIG紧随其覆盖的类型
+func sortZone(rrs []dns.RR) {
+	typeOrder := func(rr dns.RR) (uint16, int) {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			return sig.TypeCovered, 1
+		}
+		return rr.Header().Rrtype, 0
+	}
+	sort.SliceStable(rrs, func(i, j int) bool {
+		ni, nj := rrs[i].Header().Name, rrs[j].Header().Name
+		if ni != nj {
+			return canonicalLess(ni, nj)
+		}
+		ti, si := typeOrder(rrs[i])
+		tj, sj := typeOrder(rrs[j])
+		if ti != tj {
+			if ti == dns.TypeSOA || tj == dns.TypeSOA {
+				return ti == dns.TypeSOA
+			}
+			return ti < tj
+		}
+		return si < sj
+	})
+}
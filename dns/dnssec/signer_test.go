@@ -0,0 +1,285 @@
+package dnssec
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func newTestSigner(t *testing.T, nsec3 bool, optOut bool) *Signer {
+	t.Helper()
+	cfg := Config{
+		KeyDir:     t.TempDir(),
+		Algorithm:  dns.ECDSAP256SHA256,
+		DNSKEYTTL:  3600,
+		A9TypeCode: 65281,
+		validity:   14 * 24 * time.Hour,
+	}
+	cfg.NSEC3.Enabled = nsec3
+	cfg.NSEC3.OptOut = optOut
+	cfg.NSEC3.Iterations = 0
+	cfg.NSEC3.Salt = "ab12"
+	s, err := NewSigner(cfg, "chn.")
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	return s
+}
+
+// 测试用zone：apex、普通主机、空的非终结节点x.deep、无DS的委派unsigned、有DS的委派signed和它的胶水
+func testZone(t *testing.T) (*dns.SOA, []dns.RR) {
+	t.Helper()
+	soa, err := dns.NewRR("chn. 86400 IN SOA a.gtld-servers.chn. master.hostname.com. 2024010101 3600 600 604800 120")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rrs []dns.RR
+	for _, s := range []string{
+		"chn. 86400 IN NS a.gtld-servers.chn.",
+		"a.gtld-servers.chn. 600 IN A 192.0.2.1",
+		"www.chn. 600 IN A 192.0.2.2",
+		"www.chn. 300 IN A 192.0.2.3",
+		"host.x.deep.chn. 600 IN AAAA 2001:db8::1",
+		"unsigned.chn. 600 IN NS ns1.example.net.",
+		"signed.chn. 600 IN NS ns1.signed.chn.",
+		"signed.chn. 600 IN DS 12345 13 2 " + strings.Repeat("AB", 32),
+		"ns1.signed.chn. 600 IN A 192.0.2.53",
+	} {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return soa.(*dns.SOA), rrs
+}
+
+// 按owner和类型分组，RRSIG按覆盖的类型单独分组
+func splitSigned(out []dns.RR) (map[rrsetKey][]dns.RR, map[rrsetKey][]*dns.RRSIG, []*dns.DNSKEY) {
+	sets := map[rrsetKey][]dns.RR{}
+	sigs := map[rrsetKey][]*dns.RRSIG{}
+	var keys []*dns.DNSKEY
+	for _, rr := range out {
+		h := rr.Header()
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key := rrsetKey{h.Name, sig.TypeCovered}
+			sigs[key] = append(sigs[key], sig)
+			continue
+		}
+		if k, ok := rr.(*dns.DNSKEY); ok {
+			keys = append(keys, k)
+		}
+		key := rrsetKey{h.Name, h.Rrtype}
+		sets[key] = append(sets[key], rr)
+	}
+	return sets, sigs, keys
+}
+
+// 每个RRSIG都必须能用zone中的DNSKEY验证且在有效期内
+func verifySignatures(t *testing.T, out []dns.RR) map[rrsetKey][]*dns.RRSIG {
+	t.Helper()
+	sets, sigs, keys := splitSigned(out)
+	now := time.Now().UTC()
+	for key, list := range sigs {
+		set := sets[key]
+		if len(set) == 0 {
+			t.Errorf("RRSIG %s/%s 没有对应的RRset", key.name, dns.TypeToString[key.rtype])
+			continue
+		}
+		for _, sig := range list {
+			if !sig.ValidityPeriod(now) {
+				t.Errorf("RRSIG %s/%s 不在有效期内", key.name, dns.TypeToString[key.rtype])
+			}
+			verified := false
+			for _, k := range keys {
+				if k.KeyTag() == sig.KeyTag && sig.Verify(k, set) == nil {
+					verified = true
+				}
+			}
+			if !verified {
+				t.Errorf("RRSIG %s/%s keytag %d 验证失败", key.name, dns.TypeToString[key.rtype], sig.KeyTag)
+			}
+		}
+	}
+	return sigs
+}
+
+func TestSignZoneNSEC(t *testing.T) {
+	s := newTestSigner(t, false, false)
+	soa, rrs := testZone(t)
+	out, err := s.SignZone(soa, rrs)
+	if err != nil {
+		t.Fatalf("SignZone: %v", err)
+	}
+	sigs := verifySignatures(t, out)
+	if out[0].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("第一条记录是 %s，应为SOA", dns.TypeToString[out[0].Header().Rrtype])
+	}
+
+	tests := []struct {
+		name   string
+		rtype  uint16
+		signed bool
+	}{
+		{"chn.", dns.TypeSOA, true},
+		{"chn.", dns.TypeDNSKEY, true},
+		{"www.chn.", dns.TypeA, true},
+		{"unsigned.chn.", dns.TypeNS, false},
+		{"signed.chn.", dns.TypeNS, false},
+		{"signed.chn.", dns.TypeDS, true},
+		{"ns1.signed.chn.", dns.TypeA, false},
+	}
+	for _, tt := range tests {
+		if got := len(sigs[rrsetKey{tt.name, tt.rtype}]) > 0; got != tt.signed {
+			t.Errorf("%s/%s 签名=%v，应为%v", tt.name, dns.TypeToString[tt.rtype], got, tt.signed)
+		}
+	}
+
+	// NSEC链按规范顺序覆盖全部权威名字并首尾相接，胶水不在链中
+	var chain []*dns.NSEC
+	for _, rr := range out {
+		if nsec, ok := rr.(*dns.NSEC); ok {
+			chain = append(chain, nsec)
+		}
+	}
+	want := []string{"chn.", "host.x.deep.chn.", "a.gtld-servers.chn.", "signed.chn.", "unsigned.chn.", "www.chn."}
+	if len(chain) != len(want) {
+		t.Fatalf("NSEC链有%d条，应为%d条", len(chain), len(want))
+	}
+	for i, nsec := range chain {
+		if nsec.Hdr.Name != want[i] {
+			t.Errorf("第%d条NSEC为 %s，应为 %s", i, nsec.Hdr.Name, want[i])
+		}
+		if next := want[(i+1)%len(want)]; nsec.NextDomain != next {
+			t.Errorf("%s 的NSEC指向 %s，应为 %s", nsec.Hdr.Name, nsec.NextDomain, next)
+		}
+		if nsec.Hdr.Ttl != soa.Minttl {
+			t.Errorf("%s 的NSEC TTL为%d，应为%d", nsec.Hdr.Name, nsec.Hdr.Ttl, soa.Minttl)
+		}
+	}
+	if types := chain[3].TypeBitMap; !hasType(types, dns.TypeNS) || !hasType(types, dns.TypeDS) {
+		t.Errorf("signed.chn. 的NSEC类型为 %v，应包含NS和DS", types)
+	}
+	// 同一RRset的TTL取最小值
+	for _, rr := range out {
+		if a, ok := rr.(*dns.A); ok && a.Hdr.Name == "www.chn." && a.Hdr.Ttl != 300 {
+			t.Errorf("www.chn. A 的TTL为%d，应为300", a.Hdr.Ttl)
+		}
+	}
+}
+
+func TestSignZoneNSEC3(t *testing.T) {
+	tests := []struct {
+		name    string
+		optOut  bool
+		entries int
+	}{
+		// 6个权威名字加上空的非终结节点deep、x.deep和gtld-servers
+		{"without opt-out", false, 9},
+		// opt-out时跳过无DS的委派unsigned
+		{"with opt-out", true, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSigner(t, true, tt.optOut)
+			soa, rrs := testZone(t)
+			out, err := s.SignZone(soa, rrs)
+			if err != nil {
+				t.Fatalf("SignZone: %v", err)
+			}
+			verifySignatures(t, out)
+
+			var chain []*dns.NSEC3
+			params := 0
+			for _, rr := range out {
+				switch v := rr.(type) {
+				case *dns.NSEC3:
+					chain = append(chain, v)
+				case *dns.NSEC3PARAM:
+					params++
+				case *dns.NSEC:
+					t.Errorf("启用NSEC3时不应生成NSEC: %s", v.Hdr.Name)
+				}
+			}
+			if params != 1 {
+				t.Errorf("NSEC3PARAM有%d条，应为1条", params)
+			}
+			if len(chain) != tt.entries {
+				t.Fatalf("NSEC3链有%d条，应为%d条", len(chain), tt.entries)
+			}
+			hashes := map[string]bool{}
+			var owners []string
+			for _, nsec3 := range chain {
+				label := strings.ToUpper(strings.TrimSuffix(nsec3.Hdr.Name, ".chn."))
+				hashes[label] = true
+				owners = append(owners, label)
+				if (nsec3.Flags&1 == 1) != tt.optOut {
+					t.Errorf("%s 的opt-out标志为%d", nsec3.Hdr.Name, nsec3.Flags)
+				}
+			}
+			sort.Strings(owners)
+			for i, owner := range owners {
+				var nsec3 *dns.NSEC3
+				for _, n := range chain {
+					if strings.EqualFold(strings.TrimSuffix(n.Hdr.Name, ".chn."), owner) {
+						nsec3 = n
+					}
+				}
+				if next := owners[(i+1)%len(owners)]; nsec3.NextDomain != next {
+					t.Errorf("%s 的NSEC3指向 %s，应为 %s", owner, nsec3.NextDomain, next)
+				}
+			}
+			for _, name := range []string{"chn.", "deep.chn.", "x.deep.chn.", "gtld-servers.chn.", "signed.chn."} {
+				if h := dns.HashName(name, dns.SHA1, 0, "ab12"); !hashes[h] {
+					t.Errorf("NSEC3链中没有 %s", name)
+				}
+			}
+			if h := dns.HashName("unsigned.chn.", dns.SHA1, 0, "ab12"); hashes[h] == tt.optOut {
+				t.Errorf("unsigned.chn. 在NSEC3链中=%v，opt-out=%v", hashes[h], tt.optOut)
+			}
+			if h := dns.HashName("ns1.signed.chn.", dns.SHA1, 0, "ab12"); hashes[h] {
+				t.Errorf("胶水 ns1.signed.chn. 不应在NSEC3链中")
+			}
+		})
+	}
+}
+
+func TestSignZoneRejectsOutOfZone(t *testing.T) {
+	s := newTestSigner(t, false, false)
+	soa, rrs := testZone(t)
+	rr, _ := dns.NewRR("www.example.com. 600 IN A 192.0.2.9")
+	if _, err := s.SignZone(soa, append(rrs, rr)); err == nil {
+		t.Error("zone外的记录应返回错误")
+	}
+}
+
+func TestCanonicalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"chn.", "a.chn.", true},
+		{"a.chn.", "chn.", false},
+		{"a.chn.", "B.chn.", true},
+		{"z.chn.", "a.z.chn.", true},
+		{"a.z.chn.", "zz.chn.", true},
+		{"www.chn.", "www.chn.", false},
+	}
+	for _, tt := range tests {
+		if got := canonicalLess(tt.a, tt.b); got != tt.less {
+			t.Errorf("canonicalLess(%q, %q) = %v，应为%v", tt.a, tt.b, got, tt.less)
+		}
+	}
+}
+
+func hasType(types []uint16, t uint16) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package eppstatus
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 域名状态，取值与EPP(RFC 5731)一致，registry和zonefile共用
+const (
+	OK         = "ok"
+	ServerHold = "serverHold"
+	Inactive   = "inactive"
+	// 转移申请等待处理
+	PendingTransfer = "pendingTransfer"
+	// 到期自动续费后的宽限期，期间删除可退回续费，委派仍发布
+	AutoRenewPeriod = "autoRenewPeriod"
+	// 删除后的赎回期，可以恢复，委派撤下
+	RedemptionPeriod = "redemptionPeriod"
+	// 等待最终清除，不能恢复，委派撤下
+	PendingDelete = "pendingDelete"
+	// 注册商设置的暂停解析，委派撤下但数据保留
+	ClientHold = "clientHold"
+	// 注册商设置的禁止修改、删除、转移、续费
+	ClientUpdateProhibited   = "clientUpdateProhibited"
+	ClientDeleteProhibited   = "clientDeleteProhibited"
+	ClientTransferProhibited = "clientTransferProhibited"
+	ClientRenewProhibited    = "clientRenewProhibited"
+	// 注册局设置的禁止状态，前三个组成注册局锁定，只能凭解锁码解除
+	ServerUpdateProhibited   = "serverUpdateProhibited"
+	ServerDeleteProhibited   = "serverDeleteProhibited"
+	ServerTransferProhibited = "serverTransferProhibited"
+	ServerRenewProhibited    = "serverRenewProhibited"
+)
+
+func Contains(list []string, status string) bool {
+	for _, s := range list {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// 16个字符的随机解锁码，由注册局通过带外方式交给域名持有人
+func NewUnlockCode() string {
+	b := make([]byte, 10)
+	_, _ = rand.Read(b)
+	return base32.StdEncoding.EncodeToString(b)
+}
+
+// 解锁码用bcrypt保存，首尾空白不计
+func HashUnlockCode(code string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(strings.TrimSpace(code)), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func CheckUnlockCode(hash string, code string) bool {
+	return hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(strings.TrimSpace(code))) == nil
+}
@@ -0,0 +1,33 @@
+package eppstatus
+
+import (
+	"testing"
+)
+
+func TestUnlockCode(t *testing.T) {
+	code := NewUnlockCode()
+	if len(code) != 16 || code == NewUnlockCode() {
+		t.Fatalf("解锁码 %q 长度不是16或不随机", code)
+	}
+	hash, err := HashUnlockCode(code)
+	if err != nil {
+		t.Fatalf("HashUnlockCode: %v", err)
+	}
+	tests := []struct {
+		hash string
+		code string
+		ok   bool
+	}{
+		{hash, code, true},
+		{hash, " " + code + "\n", true},
+		{hash, code[1:], false},
+		{hash, "", false},
+		{"", "", false},
+		{"not a hash", code, false},
+	}
+	for _, tt := range tests {
+		if got := CheckUnlockCode(tt.hash, tt.code); got != tt.ok {
+			t.Errorf("CheckUnlockCode(%q, %q) = %v，应为%v", tt.hash, tt.code, got, tt.ok)
+		}
+	}
+}
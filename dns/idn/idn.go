@@ -0,0 +1,264 @@
+package idn
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.org/x/net/idna"
+)
+
+// 常用的简繁体变体，每组中的字符互为变体
+var defaultVariants = []string{
+	"国國", "华華", "网網", "电電", "东東", "长長", "门門", "书書", "车車",
+	"马馬", "鱼魚", "鸟鳥", "龙龍", "云雲", "发發髮", "台臺檯", "万萬", "与與", "业業",
+	"广廣", "厂廠", "实實", "学學", "汉漢", "语語", "说說", "财財", "银銀", "贸貿",
+	"购購", "务務", "游遊", "戏戲", "乐樂", "爱愛", "宝寶", "时時",
+	"开開", "关關", "机機", "汇匯", "质質", "证證", "体體", "医醫", "药藥", "区區",
+}
+
+// IDN配置，对应config.yaml中的idn节点
+type Config struct {
+	// 各顶级域允许的文字，key为不带点的顶级域，值为Unicode文字名，如Han、Latin。
+	// 字母、数字、连字符总是允许，没有配置的顶级域不接受IDN
+	Tables map[string][]string `json:"tables"`
+	// 变体字符组，同一组中的字符互为变体，为空时使用内置的简繁体对照
+	Variants []string `json:"variants"`
+	// 一个label最多展开的变体数，超过时只检查前面的组合
+	MaxVariants int `json:"maxVariants"`
+}
+
+// 读取idn配置并补齐默认值
+func LoadConfig(ctx context.Context) (Config, error) {
+	cfg := Config{
+		Tables:      map[string][]string{"chn": {"Han"}},
+		MaxVariants: 64,
+	}
+	v, err := g.Cfg().Get(ctx, "idn")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if len(cfg.Variants) == 0 {
+		cfg.Variants = defaultVariants
+	}
+	return cfg, nil
+}
+
+// IDN字符表，由registry和zonefile共用
+type Table struct {
+	scripts     map[string][]*unicode.RangeTable
+	variants    map[rune][]rune
+	maxVariants int
+}
+
+// 同一名字的两种写法，非IDN时两者相同
+type Name struct {
+	ALabel string `json:"aLabel"`
+	ULabel string `json:"uLabel"`
+}
+
+func New(cfg Config) (*Table, error) {
+	t := &Table{scripts: map[string][]*unicode.RangeTable{}, variants: map[rune][]rune{}, maxVariants: cfg.MaxVariants}
+	for tld, names := range cfg.Tables {
+		tld = strings.ToLower(strings.Trim(tld, "."))
+		for _, name := range names {
+			script := unicode.Scripts[name]
+			if script == nil {
+				return nil, fmt.Errorf("idn.tables.%s: 不支持的文字 %s", tld, name)
+			}
+			t.scripts[tld] = append(t.scripts[tld], script)
+		}
+	}
+	for _, group := range cfg.Variants {
+		chars := []rune(group)
+		for _, c := range chars {
+			for _, v := range chars {
+				if v != c && !containsRune(t.variants[c], v) {
+					t.variants[c] = append(t.variants[c], v)
+				}
+			}
+		}
+	}
+	if t.maxVariants <= 0 {
+		t.maxVariants = 64
+	}
+	return t, nil
+}
+
+func containsRune(list []rune, c rune) bool {
+	for _, v := range list {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// 字母、数字、连字符
+func isLDH(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-'
+}
+
+// 是否为IDN label，包括U-label和xn--开头的A-label
+func IsIDN(label string) bool {
+	return !isASCII(label) || strings.HasPrefix(strings.ToLower(label), "xn--")
+}
+
+// 把一个label转换为A-label和U-label并按IDNA2008和顶级域的字符表检查。
+// 非IDN的ASCII label（包括*、_开头的label）原样返回，由调用方按记录类型检查
+func (t *Table) Label(tld string, label string) (Name, error) {
+	if !IsIDN(label) {
+		return Name{ALabel: label, ULabel: label}, nil
+	}
+	label = strings.ToLower(label)
+	a, err := idna.Registration.ToASCII(label)
+	if err != nil {
+		return Name{}, fmt.Errorf("%s 不是合法的IDN: %v", label, err)
+	}
+	u, err := idna.Registration.ToUnicode(a)
+	if err != nil {
+		return Name{}, fmt.Errorf("%s 不是合法的IDN: %v", label, err)
+	}
+	// xn--开头的ASCII label必须是规范的punycode
+	if isASCII(label) && a != label {
+		return Name{}, fmt.Errorf("%s 不是规范的A-label，应为 %s", label, a)
+	}
+	if err = t.checkScript(tld, u); err != nil {
+		return Name{}, err
+	}
+	return Name{ALabel: a, ULabel: u}, nil
+}
+
+// U-label的每个字符必须是LDH或顶级域允许的文字
+func (t *Table) checkScript(tld string, u string) error {
+	tld = strings.ToLower(strings.Trim(tld, "."))
+	scripts := t.scripts[tld]
+	if len(scripts) == 0 {
+		return fmt.Errorf("顶级域 %s 不接受IDN", tld)
+	}
+	for _, c := range u {
+		if isLDH(c) || unicode.IsOneOf(scripts, c) {
+			continue
+		}
+		return fmt.Errorf("字符 %q (U+%04X) 不在顶级域 %s 允许的文字中", c, c, tld)
+	}
+	return nil
+}
+
+// 逐个label转换名字，保留末尾的点，@等特殊写法原样返回
+func (t *Table) Name(tld string, name string) (Name, error) {
+	if name == "" || name == "@" || name == "." {
+		return Name{ALabel: name, ULabel: name}, nil
+	}
+	absolute := strings.HasSuffix(name, ".")
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	a := make([]string, len(labels))
+	u := make([]string, len(labels))
+	for i, label := range labels {
+		res, err := t.Label(tld, label)
+		if err != nil {
+			return Name{}, err
+		}
+		a[i] = res.ALabel
+		u[i] = res.ULabel
+	}
+	res := Name{ALabel: strings.Join(a, "."), ULabel: strings.Join(u, ".")}
+	if absolute {
+		res.ALabel += "."
+		res.ULabel += "."
+	}
+	return res, nil
+}
+
+// label的全部变体，返回A-label，不包括label本身。非IDN或没有变体字符时返回nil
+func (t *Table) Variants(label string) []string {
+	if !IsIDN(label) {
+		return nil
+	}
+	u, err := idna.Registration.ToUnicode(label)
+	if err != nil {
+		return nil
+	}
+	results := []string{""}
+	for _, c := range u {
+		chars := append([]rune{c}, t.variants[c]...)
+		var next []string
+		for _, prefix := range results {
+			for _, v := range chars {
+				if len(next) >= t.maxVariants+1 {
+					break
+				}
+				next = append(next, prefix+string(v))
+			}
+		}
+		results = next
+	}
+	self, _ := idna.Registration.ToASCII(u)
+	var res []string
+	for _, v := range results {
+		a, err := idna.Registration.ToASCII(v)
+		if err == nil && a != self && !containsString(res, a) {
+			res = append(res, a)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// 尽量转换为A-label，用于查询和删除时与zone中的名字比较，转换失败时原样返回
+func ToASCII(name string) string {
+	if isASCII(name) {
+		return name
+	}
+	absolute := strings.HasSuffix(name, ".")
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i, label := range labels {
+		if a, err := idna.Lookup.ToASCII(label); err == nil {
+			labels[i] = a
+		}
+	}
+	res := strings.Join(labels, ".")
+	if absolute {
+		res += "."
+	}
+	return res
+}
+
+// 转换为U-label用于显示，不含A-label或转换失败时返回空字符串
+func ToUnicode(name string) string {
+	if !strings.Contains(strings.ToLower(name), "xn--") {
+		return ""
+	}
+	u, err := idna.Lookup.ToUnicode(name)
+	if err != nil || u == name {
+		return ""
+	}
+	return u
+}
@@ -0,0 +1,141 @@
+package idn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestTable(t *testing.T) *Table {
+	t.Helper()
+	table, err := New(Config{Tables: map[string][]string{"chn": {"Han"}, "test": {"Latin", "Cyrillic"}}, Variants: defaultVariants})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return table
+}
+
+func TestLabel(t *testing.T) {
+	table := newTestTable(t)
+	tests := []struct {
+		tld     string
+		label   string
+		want    Name
+		wantErr bool
+	}{
+		{"chn", "www", Name{"www", "www"}, false},
+		// 非IDN的ASCII label原样返回，由调用方检查
+		{"chn", "_dmarc", Name{"_dmarc", "_dmarc"}, false},
+		{"chn", "*", Name{"*", "*"}, false},
+		{"chn", "中国", Name{"xn--fiqs8s", "中国"}, false},
+		{"chn", "xn--fiqs8s", Name{"xn--fiqs8s", "中国"}, false},
+		{"chn", "XN--FIQS8S", Name{"xn--fiqs8s", "中国"}, false},
+		{"chn", "中国abc-1", Name{"xn--abc-1-4n1hm04c", "中国abc-1"}, false},
+		{"CHN.", "中国", Name{"xn--fiqs8s", "中国"}, false},
+		// 不在顶级域的字符表中
+		{"chn", "привет", Name{}, true},
+		{"test", "привет", Name{"xn--b1agh1afp", "привет"}, false},
+		{"test", "中国", Name{}, true},
+		// 没有配置字符表的顶级域不接受IDN
+		{"com", "中国", Name{}, true},
+		// 不规范的punycode、IDNA2008不允许的字符
+		{"chn", "xn--abc", Name{}, true},
+		{"chn", "xn--FIQS8S-", Name{}, true},
+		{"chn", "中国☺", Name{}, true},
+	}
+	for _, tt := range tests {
+		got, err := table.Label(tt.tld, tt.label)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Label(%s, %q) error = %v, wantErr %v", tt.tld, tt.label, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Label(%s, %q) = %+v，应为 %+v", tt.tld, tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	table := newTestTable(t)
+	tests := []struct {
+		name    string
+		want    Name
+		wantErr bool
+	}{
+		{"@", Name{"@", "@"}, false},
+		{"", Name{"", ""}, false},
+		{"www.中国", Name{"www.xn--fiqs8s", "www.中国"}, false},
+		{"www.中国.chn.", Name{"www.xn--fiqs8s.chn.", "www.中国.chn."}, false},
+		{"邮件.xn--fiqs8s", Name{"xn--5nq051n.xn--fiqs8s", "邮件.中国"}, false},
+		{"www.привет", Name{}, true},
+	}
+	for _, tt := range tests {
+		got, err := table.Name("chn", tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Name(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Name(%q) = %+v，应为 %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	table := newTestTable(t)
+	tests := []struct {
+		label string
+		want  []string
+	}{
+		{"中国", []string{"xn--fiqz9s"}},
+		{"xn--fiqz9s", []string{"xn--fiqs8s"}},
+		// 两个字符都有变体时展开全部组合
+		{"国华", []string{"xn--9csq85h", "xn--vcsw95h", "xn--xkrv0g"}},
+		{"中文", nil},
+		{"www", nil},
+	}
+	for _, tt := range tests {
+		if got := table.Variants(tt.label); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Variants(%q) = %v，应为 %v", tt.label, got, tt.want)
+		}
+	}
+	// 超过maxVariants时只展开前面的组合
+	small, err := New(Config{Tables: map[string][]string{"chn": {"Han"}}, Variants: defaultVariants, MaxVariants: 2})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := small.Variants("国华网电"); len(got) > 2 {
+		t.Errorf("maxVariants为2时返回%d个变体", len(got))
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name      string
+		ascii     string
+		unicodeOf string
+	}{
+		{"www.chn.", "www.chn.", ""},
+		{"www.中国.chn.", "www.xn--fiqs8s.chn.", ""},
+		{"xn--fiqs8s.chn", "xn--fiqs8s.chn", "中国.chn"},
+		{"XN--FIQS8S.chn", "XN--FIQS8S.chn", "中国.chn"},
+		// 转换失败时原样返回或返回空字符串
+		{"xn--abc.chn", "xn--abc.chn", ""},
+	}
+	for _, tt := range tests {
+		if got := ToASCII(tt.name); got != tt.ascii {
+			t.Errorf("ToASCII(%q) = %q，应为 %q", tt.name, got, tt.ascii)
+		}
+		if got := ToUnicode(tt.name); got != tt.unicodeOf {
+			t.Errorf("ToUnicode(%q) = %q，应为 %q", tt.name, got, tt.unicodeOf)
+		}
+	}
+	if !IsIDN("中国") || !IsIDN("XN--fiqs8s") || IsIDN("www") {
+		t.Error("IsIDN 判断错误")
+	}
+}
+
+func TestNewUnknownScript(t *testing.T) {
+	if _, err := New(Config{Tables: map[string][]string{"chn": {"Klingon"}}}); err == nil {
+		t.Error("不支持的文字应返回错误")
+	}
+}
@@ -0,0 +1,154 @@
+package name
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RFC 1035的长度限制，名字长度按wire格式计算
+const (
+	MaxLabelLength = 63
+	MaxNameLength  = 255
+)
+
+// 没有末尾点时按绝对域名处理的目标类型，与zone中原有的写法一致
+var absoluteTargets = map[string]bool{"CNAME": true, "NS": true}
+
+// owner可以使用下划线label的记录类型，如_dmarc、_domainkey
+var serviceOwners = map[string]bool{"TXT": true, "CNAME": true}
+
+// 目标可以使用下划线label的记录类型
+var serviceTargets = map[string]bool{"CNAME": true, "PTR": true}
+
+// 补全为小写的绝对域名，@为origin，没有末尾点的名字相对于origin
+func Fqdn(name string, origin string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	origin = strings.ToLower(dns.Fqdn(origin))
+	if name == "@" || name == "" {
+		return origin
+	}
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "." + origin
+}
+
+// 转换为相对于origin的小写写法，zone apex为@，不在zone内时返回错误
+func Relative(name string, origin string) (string, error) {
+	fqdn := Fqdn(name, origin)
+	origin = strings.ToLower(dns.Fqdn(origin))
+	if fqdn == origin {
+		return "@", nil
+	}
+	if !strings.HasSuffix(fqdn, "."+origin) {
+		return "", fmt.Errorf("%s 不在zone %s 内", name, origin)
+	}
+	return strings.TrimSuffix(fqdn, "."+origin), nil
+}
+
+// 两个名字相对于origin是否相同，不区分大小写和相对、绝对写法
+func Equal(a string, b string, origin string) bool {
+	return Fqdn(a, origin) == Fqdn(b, origin)
+}
+
+// 检查并规范化记录的owner，返回相对于origin的小写写法。
+// 通配符只能是最左边的label，TXT、CNAME的owner可以使用下划线label，其他类型按主机名规则检查
+func Owner(name string, origin string, recordType string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("域名不能为空")
+	}
+	fqdn := Fqdn(name, origin)
+	if err := checkLength(fqdn); err != nil {
+		return "", fmt.Errorf("%s %v", name, err)
+	}
+	rel, err := Relative(name, origin)
+	if err != nil {
+		return "", err
+	}
+	if rel == "@" {
+		return rel, nil
+	}
+	labels := dns.SplitDomainName(rel)
+	wildcard := recordType != "NS" && recordType != "DS"
+	if err = checkLabels(labels, serviceOwners[recordType], wildcard); err != nil {
+		return "", fmt.Errorf("域名 %s 不合法: %v", name, err)
+	}
+	return rel, nil
+}
+
+// 检查并规范化CNAME、NS、MX、PTR的目标，返回小写的绝对域名。
+// CNAME、NS的目标没有末尾点时按绝对域名处理，MX、PTR按zone文件的规则相对于origin
+func Target(name string, origin string, recordType string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "@" {
+		return "", fmt.Errorf("%s记录的目标不能为空", recordType)
+	}
+	fqdn := TargetFqdn(name, origin, recordType)
+	if err := checkLength(fqdn); err != nil {
+		return "", fmt.Errorf("%s %v", name, err)
+	}
+	if err := checkLabels(dns.SplitDomainName(fqdn), serviceTargets[recordType], false); err != nil {
+		return "", fmt.Errorf("%s记录的目标 %s 不合法: %v", recordType, name, err)
+	}
+	return fqdn, nil
+}
+
+// 按记录类型把目标补全为小写的绝对域名，不做检查，用于和zone中已有的目标比较
+func TargetFqdn(name string, origin string, recordType string) string {
+	name = strings.TrimSpace(name)
+	if absoluteTargets[recordType] && name != "@" && !strings.HasSuffix(name, ".") {
+		return strings.ToLower(name) + "."
+	}
+	return Fqdn(name, origin)
+}
+
+// 绝对域名的wire格式长度不能超过255
+func checkLength(fqdn string) error {
+	labels := dns.SplitDomainName(fqdn)
+	length := 1
+	for _, label := range labels {
+		if len(label) == 0 {
+			return fmt.Errorf("不能有空label")
+		}
+		if len(label) > MaxLabelLength {
+			return fmt.Errorf("label %s 超过%d个字符", label, MaxLabelLength)
+		}
+		length += len(label) + 1
+	}
+	if length > MaxNameLength {
+		return fmt.Errorf("长度%d超过%d", length, MaxNameLength)
+	}
+	return nil
+}
+
+// 主机名规则：字母、数字、连字符，不以连字符开头或结尾。underscore为true时允许下划线开头的label，
+// wildcard为true时最左边的label可以是*
+func checkLabels(labels []string, underscore bool, wildcard bool) error {
+	for i, label := range labels {
+		if label == "*" {
+			if !wildcard || i != 0 {
+				return fmt.Errorf("通配符*只能是最左边的label")
+			}
+			continue
+		}
+		body := label
+		if underscore && strings.HasPrefix(label, "_") {
+			body = label[1:]
+		}
+		if body == "" {
+			return fmt.Errorf("label %s 不合法", label)
+		}
+		if strings.HasPrefix(body, "-") || strings.HasSuffix(body, "-") {
+			return fmt.Errorf("label %s 不能以连字符开头或结尾", label)
+		}
+		for _, c := range body {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("label %s 含有非法字符 %q", label, c)
+			}
+		}
+	}
+	return nil
+}
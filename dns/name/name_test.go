@@ -0,0 +1,110 @@
+package name
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFqdnRelative(t *testing.T) {
+	tests := []struct {
+		name    string
+		fqdn    string
+		rel     string
+		wantErr bool
+	}{
+		{"@", "chn.", "@", false},
+		{"", "chn.", "@", false},
+		{"WWW", "www.chn.", "www", false},
+		{" www.a ", "www.a.chn.", "www.a", false},
+		{"www.chn.", "www.chn.", "www", false},
+		{"CHN.", "chn.", "@", false},
+		{"www.example.com.", "www.example.com.", "", true},
+		// 只是后缀相同，不在zone内
+		{"xchn.", "xchn.", "", true},
+	}
+	for _, tt := range tests {
+		if got := Fqdn(tt.name, "CHN"); got != tt.fqdn {
+			t.Errorf("Fqdn(%q) = %q，应为 %q", tt.name, got, tt.fqdn)
+		}
+		rel, err := Relative(tt.name, "chn.")
+		if (err != nil) != tt.wantErr || rel != tt.rel {
+			t.Errorf("Relative(%q) = %q, %v，应为 %q", tt.name, rel, err, tt.rel)
+		}
+	}
+	if !Equal("WWW", "www.chn.", "chn") || Equal("www", "www.", "chn") {
+		t.Error("Equal 判断错误")
+	}
+}
+
+func TestOwner(t *testing.T) {
+	long := strings.Repeat("a", 63)
+	tests := []struct {
+		name       string
+		recordType string
+		want       string
+		wantErr    bool
+	}{
+		{"www", "A", "www", false},
+		{"WWW.chn.", "A", "www", false},
+		{"@", "MX", "@", false},
+		{"*", "A", "*", false},
+		{"*.sub", "TXT", "*.sub", false},
+		{"sub.*", "A", "", true},
+		// NS、DS的owner不能是通配符
+		{"*", "NS", "", true},
+		{"*.a", "DS", "", true},
+		{"_dmarc", "TXT", "_dmarc", false},
+		{"sel._domainkey", "TXT", "sel._domainkey", false},
+		{"_sip._tcp", "CNAME", "_sip._tcp", false},
+		{"_dmarc", "A", "", true},
+		{"_", "TXT", "", true},
+		{"-www", "A", "", true},
+		{"www-", "A", "", true},
+		{"w_w", "A", "", true},
+		{"a..b", "A", "", true},
+		{"", "A", "", true},
+		{"www.example.com.", "A", "", true},
+		{long, "A", long, false},
+		{long + "a", "A", "", true},
+		// wire格式超过255
+		{strings.Repeat(long+".", 4), "A", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Owner(tt.name, "chn", tt.recordType)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Owner(%q, %s) = %q, %v，应为 %q wantErr %v", tt.name, tt.recordType, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		want       string
+		wantErr    bool
+	}{
+		// CNAME、NS没有末尾点时按绝对域名处理
+		{"www.example.com", "CNAME", "www.example.com.", false},
+		{"NS1.Example.NET", "NS", "ns1.example.net.", false},
+		// MX、PTR相对于origin
+		{"mail", "MX", "mail.chn.", false},
+		{"mail.example.com.", "MX", "mail.example.com.", false},
+		{"host", "PTR", "host.chn.", false},
+		{"_sip._tcp.example.com.", "CNAME", "_sip._tcp.example.com.", false},
+		{"_x.example.com.", "MX", "", true},
+		{"*.example.com.", "CNAME", "", true},
+		{"", "CNAME", "", true},
+		{"@", "MX", "", true},
+		{"-bad.example.com.", "NS", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Target(tt.name, "chn.", tt.recordType)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Target(%q, %s) = %q, %v，应为 %q wantErr %v", tt.name, tt.recordType, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if got := TargetFqdn("@", "chn", "CNAME"); got != "chn." {
+		t.Errorf("TargetFqdn(@) = %q", got)
+	}
+}
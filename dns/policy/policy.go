@@ -0,0 +1,314 @@
+package policy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gfile"
+	"golang.org/x/net/idna"
+)
+
+// 条目类别，同一个名字匹配多个条目时按blocked、reserved、premium的顺序取第一个
+const (
+	KindBlocked  = "blocked"
+	KindReserved = "reserved"
+	KindPremium  = "premium"
+)
+
+// 匹配方式
+const (
+	MatchExact    = "exact"
+	MatchWildcard = "wildcard"
+	MatchRegex    = "regex"
+)
+
+// 条目来源，config中的条目不能通过接口删除
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+// 名字策略配置，对应config.yaml中的policy节点
+type Config struct {
+	// 通过接口添加的条目保存在此文件
+	DataFile string `json:"dataFile"`
+	// 注册局人员越过保留、禁止名单时提供的口令，为空时不允许越过
+	OverrideToken string  `json:"overrideToken"`
+	Entries       []Entry `json:"entries"`
+}
+
+// 一个策略条目，Pattern匹配二级label，A-label和U-label两种写法都会比较
+type Entry struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+	// 为空时按pattern推断：含*或?为wildcard，否则为exact
+	Match string `json:"match,omitempty"`
+	// premium的价格档
+	Tier      string    `json:"tier,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// 读取policy配置，配置中的条目在New时校验
+func LoadConfig(ctx context.Context) (Config, error) {
+	cfg := Config{
+		DataFile: "/var/named/registry/policy.json",
+	}
+	v, err := g.Cfg().Get(ctx, "policy")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// 策略表，由registry和zonefile共用
+type Table struct {
+	lock          sync.RWMutex
+	dataFile      string
+	overrideToken string
+	entries       []*Entry
+}
+
+func New(cfg Config) (*Table, error) {
+	t := &Table{dataFile: cfg.DataFile, overrideToken: cfg.OverrideToken}
+	for _, e := range cfg.Entries {
+		e.Source = SourceConfig
+		if err := t.add(e); err != nil {
+			return nil, fmt.Errorf("policy.entries: %v", err)
+		}
+	}
+	if cfg.DataFile == "" || !gfile.Exists(cfg.DataFile) {
+		return t, nil
+	}
+	var list []Entry
+	if err := json.Unmarshal(gfile.GetBytes(cfg.DataFile), &list); err != nil {
+		return nil, fmt.Errorf("读取策略表%s失败: %v", cfg.DataFile, err)
+	}
+	for _, e := range list {
+		e.Source = SourceAPI
+		if err := t.add(e); err != nil {
+			return nil, fmt.Errorf("%s: %v", cfg.DataFile, err)
+		}
+	}
+	return t, nil
+}
+
+// 校验并补齐条目
+func (e *Entry) compile() error {
+	e.Pattern = strings.ToLower(strings.TrimSpace(e.Pattern))
+	if e.Pattern == "" {
+		return fmt.Errorf("pattern不能为空")
+	}
+	if e.Kind != KindBlocked && e.Kind != KindReserved && e.Kind != KindPremium {
+		return fmt.Errorf("不支持的类别 %s", e.Kind)
+	}
+	if e.Kind == KindPremium && e.Tier == "" {
+		return fmt.Errorf("premium条目 %s 必须指定tier", e.Pattern)
+	}
+	if e.Match == "" {
+		e.Match = MatchExact
+		if strings.ContainsAny(e.Pattern, "*?") {
+			e.Match = MatchWildcard
+		}
+	}
+	switch e.Match {
+	case MatchExact:
+	case MatchWildcard:
+		if _, err := path.Match(e.Pattern, ""); err != nil {
+			return fmt.Errorf("通配符 %s 格式错误: %v", e.Pattern, err)
+		}
+	case MatchRegex:
+		re, err := regexp.Compile("^(?:" + e.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("正则表达式 %s 格式错误: %v", e.Pattern, err)
+		}
+		e.re = re
+	default:
+		return fmt.Errorf("不支持的匹配方式 %s", e.Match)
+	}
+	return nil
+}
+
+func (e *Entry) matches(label string) bool {
+	switch e.Match {
+	case MatchExact:
+		return e.Pattern == label
+	case MatchWildcard:
+		ok, _ := path.Match(e.Pattern, label)
+		return ok
+	default:
+		return e.re.MatchString(label)
+	}
+}
+
+func (t *Table) add(e Entry) error {
+	if err := e.compile(); err != nil {
+		return err
+	}
+	for _, old := range t.entries {
+		if old.Kind == e.Kind && old.Pattern == e.Pattern && old.Match == e.Match {
+			return fmt.Errorf("%s条目 %s 已存在", e.Kind, e.Pattern)
+		}
+	}
+	t.entries = append(t.entries, &e)
+	return nil
+}
+
+// 查找label匹配的条目，label可以是A-label或U-label，没有匹配时返回nil
+func (t *Table) Match(label string) *Entry {
+	if t == nil {
+		return nil
+	}
+	labels := []string{strings.ToLower(label)}
+	if ldh, err := idna.Lookup.ToASCII(label); err == nil && ldh != labels[0] {
+		labels = append(labels, ldh)
+	}
+	if u, err := idna.Lookup.ToUnicode(label); err == nil && u != labels[0] {
+		labels = append(labels, u)
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	for _, kind := range []string{KindBlocked, KindReserved, KindPremium} {
+		for _, e := range t.entries {
+			if e.Kind != kind {
+				continue
+			}
+			for _, l := range labels {
+				if e.matches(l) {
+					c := *e
+					return &c
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 保留或禁止注册时返回错误，premium不受限制
+func (t *Table) Check(label string) error {
+	e := t.Match(label)
+	if e == nil || e.Kind == KindPremium {
+		return nil
+	}
+	msg := "注册局保留"
+	if e.Kind == KindBlocked {
+		msg = "禁止注册"
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return fmt.Errorf("%s %s", label, msg)
+}
+
+// 校验注册局人员的越过口令
+func (t *Table) Override(token string) bool {
+	if t == nil || t.overrideToken == "" || token == "" {
+		return false
+	}
+	a := sha256.Sum256([]byte(token))
+	b := sha256.Sum256([]byte(t.overrideToken))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+// 添加条目并保存到数据文件
+func (t *Table) Add(e Entry) (*Entry, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	e.Source = SourceAPI
+	e.CreatedAt = time.Now().UTC()
+	if err := t.add(e); err != nil {
+		return nil, err
+	}
+	if err := t.save(); err != nil {
+		t.entries = t.entries[:len(t.entries)-1]
+		return nil, err
+	}
+	c := *t.entries[len(t.entries)-1]
+	return &c, nil
+}
+
+// 删除通过接口添加的条目，match为空时按pattern推断
+func (t *Table) Remove(kind string, pattern string, match string) error {
+	probe := Entry{Kind: kind, Pattern: pattern, Match: match, Tier: "-"}
+	if err := probe.compile(); err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for i, e := range t.entries {
+		if e.Kind != probe.Kind || e.Pattern != probe.Pattern || e.Match != probe.Match {
+			continue
+		}
+		if e.Source == SourceConfig {
+			return fmt.Errorf("%s条目 %s 来自配置文件，不能通过接口删除", kind, probe.Pattern)
+		}
+		entries := append(append([]*Entry{}, t.entries[:i]...), t.entries[i+1:]...)
+		old := t.entries
+		t.entries = entries
+		if err := t.save(); err != nil {
+			t.entries = old
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("%s条目 %s 不存在", kind, probe.Pattern)
+}
+
+// 列出条目，kind为空时列出全部
+func (t *Table) List(kind string) []Entry {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	res := []Entry{}
+	for _, e := range t.entries {
+		if kind == "" || e.Kind == kind {
+			res = append(res, *e)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Kind < res[j].Kind })
+	return res
+}
+
+// 只保存通过接口添加的条目，先写临时文件再改名
+func (t *Table) save() error {
+	if t.dataFile == "" {
+		return fmt.Errorf("policy.dataFile 为空，不能通过接口修改策略表")
+	}
+	list := []*Entry{}
+	for _, e := range t.entries {
+		if e.Source == SourceAPI {
+			list = append(list, e)
+		}
+	}
+	content, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = gfile.Mkdir(filepath.Dir(t.dataFile)); err != nil {
+		return err
+	}
+	tmp := t.dataFile + ".tmp"
+	if err = gfile.PutBytes(tmp, content); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.dataFile)
+}
@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestTable(t *testing.T, entries ...Entry) *Table {
+	t.Helper()
+	table, err := New(Config{DataFile: filepath.Join(t.TempDir(), "policy.json"), OverrideToken: "token", Entries: entries})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return table
+}
+
+func TestMatch(t *testing.T) {
+	table := newTestTable(t,
+		Entry{Kind: KindReserved, Pattern: "nic"},
+		Entry{Kind: KindPremium, Pattern: "a?", Tier: "A"},
+		Entry{Kind: KindBlocked, Pattern: "ab"},
+		Entry{Kind: KindPremium, Pattern: "[0-9]{3}", Match: MatchRegex, Tier: "B"},
+		Entry{Kind: KindReserved, Pattern: "中国"},
+		Entry{Kind: KindBlocked, Pattern: "xn--fiq228c"},
+		Entry{Kind: KindPremium, Pattern: "shop*", Tier: "C"},
+	)
+	tests := []struct {
+		label string
+		kind  string
+		// 匹配条目的pattern
+		pattern string
+	}{
+		{"nic", KindReserved, "nic"},
+		{"NIC", KindReserved, "nic"},
+		{"nics", "", ""},
+		{"ax", KindPremium, "a?"},
+		{"ab", KindBlocked, "ab"},
+		{"abc", "", ""},
+		{"123", KindPremium, "[0-9]{3}"},
+		{"1234", "", ""},
+		{"a123", "", ""},
+		{"shop", KindPremium, "shop*"},
+		{"shopping", KindPremium, "shop*"},
+		{"中国", KindReserved, "中国"},
+		{"xn--fiqs8s", KindReserved, "中国"},
+		{"中文", KindBlocked, "xn--fiq228c"},
+		{"xn--fiq228c", KindBlocked, "xn--fiq228c"},
+		{"xn--", "", ""},
+	}
+	for _, tt := range tests {
+		e := table.Match(tt.label)
+		if tt.kind == "" {
+			if e != nil {
+				t.Errorf("Match(%q) = %s %s，应没有匹配", tt.label, e.Kind, e.Pattern)
+			}
+			continue
+		}
+		if e == nil || e.Kind != tt.kind || e.Pattern != tt.pattern {
+			t.Errorf("Match(%q) = %+v，应为 %s %s", tt.label, e, tt.kind, tt.pattern)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	table := newTestTable(t,
+		Entry{Kind: KindReserved, Pattern: "nic", Reason: "registry"},
+		Entry{Kind: KindBlocked, Pattern: "bad*"},
+		Entry{Kind: KindPremium, Pattern: "vip", Tier: "A"},
+	)
+	tests := []struct {
+		label   string
+		wantErr bool
+	}{
+		{"nic", true},
+		{"badname", true},
+		{"vip", false},
+		{"free", false},
+	}
+	for _, tt := range tests {
+		if err := table.Check(tt.label); (err != nil) != tt.wantErr {
+			t.Errorf("Check(%q) error = %v, wantErr %v", tt.label, err, tt.wantErr)
+		}
+	}
+	var none *Table
+	if none.Match("nic") != nil || none.Check("nic") != nil || none.Override("token") {
+		t.Error("nil策略表不应有任何限制或口令")
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   Entry
+		match   string
+		wantErr bool
+	}{
+		{name: "exact", entry: Entry{Kind: KindReserved, Pattern: " NIC "}, match: MatchExact},
+		{name: "wildcard inferred", entry: Entry{Kind: KindReserved, Pattern: "a*"}, match: MatchWildcard},
+		{name: "regex", entry: Entry{Kind: KindReserved, Pattern: "a+", Match: MatchRegex}, match: MatchRegex},
+		{name: "empty pattern", entry: Entry{Kind: KindReserved, Pattern: " "}, wantErr: true},
+		{name: "bad kind", entry: Entry{Kind: "other", Pattern: "a"}, wantErr: true},
+		{name: "premium without tier", entry: Entry{Kind: KindPremium, Pattern: "a"}, wantErr: true},
+		{name: "bad wildcard", entry: Entry{Kind: KindReserved, Pattern: "[a*"}, wantErr: true},
+		{name: "bad regex", entry: Entry{Kind: KindReserved, Pattern: "(a", Match: MatchRegex}, wantErr: true},
+		{name: "bad match", entry: Entry{Kind: KindReserved, Pattern: "a", Match: "prefix"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.entry
+			err := e.compile()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compile error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && e.Match != tt.match {
+				t.Errorf("匹配方式为%s，应为%s", e.Match, tt.match)
+			}
+		})
+	}
+}
+
+func TestOverride(t *testing.T) {
+	table := newTestTable(t)
+	for token, want := range map[string]bool{"token": true, "Token": false, "": false, "token ": false} {
+		if got := table.Override(token); got != want {
+			t.Errorf("Override(%q) = %v，应为%v", token, got, want)
+		}
+	}
+	empty, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if empty.Override("") {
+		t.Error("没有配置口令时不能越过")
+	}
+}
+
+// 接口添加的条目保存到数据文件并在重新加载后保留，配置文件中的条目不能删除
+func TestAddRemove(t *testing.T) {
+	cfg := Config{
+		DataFile: filepath.Join(t.TempDir(), "policy.json"),
+		Entries:  []Entry{{Kind: KindReserved, Pattern: "nic"}},
+	}
+	table, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	e, err := table.Add(Entry{Kind: KindBlocked, Pattern: "spam*"})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if e.Source != SourceAPI || e.Match != MatchWildcard || e.CreatedAt.IsZero() {
+		t.Errorf("添加的条目为 %+v", e)
+	}
+	if _, err = table.Add(Entry{Kind: KindBlocked, Pattern: "SPAM*"}); err == nil {
+		t.Error("重复条目应返回错误")
+	}
+	if err = table.Remove(KindReserved, "nic", ""); err == nil {
+		t.Error("配置文件中的条目不应能删除")
+	}
+	reloaded, err := New(cfg)
+	if err != nil {
+		t.Fatalf("重新加载: %v", err)
+	}
+	if e := reloaded.Match("spammer"); e == nil || e.Source != SourceAPI {
+		t.Errorf("重新加载后 Match(spammer) = %+v", e)
+	}
+	if err = reloaded.Remove(KindBlocked, "spam*", ""); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err = reloaded.Remove(KindBlocked, "spam*", ""); err == nil {
+		t.Error("删除不存在的条目应返回错误")
+	}
+	if len(reloaded.List("")) != 1 || len(reloaded.List(KindBlocked)) != 0 {
+		t.Errorf("删除后条目为 %+v", reloaded.List(""))
+	}
+}
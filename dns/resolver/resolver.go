@@ -0,0 +1,58 @@
+package resolver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// 向指定的DNS服务器发起查询，address格式为host:port
+type Resolver struct {
+	Address string
+	Timeout time.Duration
+}
+
+func New(address string, timeout time.Duration) *Resolver {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &Resolver{Address: address, Timeout: timeout}
+}
+
+// 递归查询，设置DO位以便获取DNSSEC记录和AD标志，响应被截断时改用TCP重试
+func (r *Resolver) Query(name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.SetEdns0(4096, true)
+	m.AuthenticatedData = true
+	return r.exchange(m)
+}
+
+// 非递归查询，用于直接询问权威服务器
+func (r *Resolver) QueryAuthoritative(server string, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(4096, false)
+	return (&Resolver{Address: server, Timeout: r.Timeout}).exchange(m)
+}
+
+func (r *Resolver) exchange(m *dns.Msg) (*dns.Msg, error) {
+	c := &dns.Client{Timeout: r.Timeout}
+	in, _, err := c.Exchange(m, r.Address)
+	if err != nil {
+		return nil, err
+	}
+	if in.Truncated {
+		c.Net = "tcp"
+		in, _, err = c.Exchange(m, r.Address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		return in, fmt.Errorf("%s 查询 %s/%s 失败: %s", r.Address, m.Question[0].Name, dns.TypeToString[m.Question[0].Qtype], dns.RcodeToString[in.Rcode])
+	}
+	return in, nil
+}
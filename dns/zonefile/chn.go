@@ -7,27 +7,61 @@ import (
 	"os"
 	"strconv"
 
+	"newCHNTLDManager/dns/dnssec"
+	"newCHNTLDManager/dns/idn"
+	dnsname "newCHNTLDManager/dns/name"
+	"newCHNTLDManager/dns/policy"
+
 	"github.com/gogf/gf/v2/container/glist"
 	"github.com/gogf/gf/v2/os/gfile"
 	"github.com/gogf/gf/v2/text/gstr"
 )
 
 // 创建一个zone文件对象
+// zone文件的默认路径
+const defaultZoneFile = "/var/named/chn.zone"
+
 type ChnZone struct {
+	// zone文件路径，为空时使用defaultZoneFile
+	zoneFile string
 	// zone文件List
 	// 初始化默认zone文件content
 	defaultZoneFileList *glist.List
 	// 运行时zone文件content
 	runtimeZoneFileList *glist.List
+	// DNSSEC签名器，为nil时不签名
+	signer *dnssec.Signer
+	// DS管理配置
+	dsConfig DSConfig
+	// 委派健康检查配置和最近一次检查结果
+	healthConfig HealthConfig
+	health       healthStore
+	// 域名状态（暂停解析、锁定），key为相对于$ORIGIN的名字
+	statuses map[string]*domainStatus
+	// PurgeDomain清除了状态但还没有保存，Commit时写入状态文件，Rollback时从状态文件恢复
+	statusesChanged bool
+	// 保留、禁止的名字，为nil时不限制
+	policy *policy.Table
+	// IDN字符表和变体，为nil时只转换写法不检查
+	idn *idn.Table
+	// 按数据反查记录的索引，随每行修改增量更新，为nil时在查询时建立
+	reverse *reverseIndex
 }
 
 type dnsRecord struct {
+	// 记录ID，保存在zone文件中记录所在行的注释里，修改记录时不变
+	ID         string `json:"id,omitempty"`
 	DomainName string `json:"domainName"`
 	TTL        string `json:"ttl,omitempty"`
 	IN         string `json:"-"`
 	Type       string `json:"type"`
 	Priority   string `json:"priority,omitempty"`
 	Data       string `json:"data"`
+	// TXT记录的character-string，每个不超过255字节，拼接后与data相同。为空时按255字节拆分data
+	Strings []string `json:"strings,omitempty"`
+	// 查询结果中名字和目标的U-label写法，非IDN时为空
+	UnicodeName string `json:"unicodeName,omitempty"`
+	UnicodeData string `json:"unicodeData,omitempty"`
 }
 
 // type domainRecord struct {
@@ -76,7 +110,11 @@ func (p *ChnZone) Init() {
 	p.initDefaultZoneFileList(p.defaultZoneFileList)
 
 	// 读取chn.zone文件，填充druntimeZoneFileList
-	p.readZoneContentFromFile("/var/named/chn.zone", p.runtimeZoneFileList)
+	p.readZoneContentFromFile(p.zonePath(), p.runtimeZoneFileList)
+	p.invalidateIndex()
+
+	// 读取域名状态
+	p.loadStatuses()
 }
 
 func (p *ChnZone) initDefaultZoneFileList(defaultZoneFileList *glist.List) {
@@ -101,6 +139,13 @@ func (p *ChnZone) initDefaultZoneFileList(defaultZoneFileList *glist.List) {
 	defaultZoneFileList.PushBack("; HOST RECORDS\n\n")
 }
 
+func (p *ChnZone) zonePath() string {
+	if p.zoneFile == "" {
+		return defaultZoneFile
+	}
+	return p.zoneFile
+}
+
 func (p *ChnZone) readZoneContentFromFile(filePath string, runtimeZoneFileList *glist.List) error {
 
 	// 读取chn.zone文件，填充defaultZoneFileList
@@ -148,14 +193,51 @@ func (p *ChnZone) WriteDefaultZoneFile() {
 }
 
 func (p *ChnZone) AddDNSRecord(jsonRecord string) error {
+	_, err := p.CreateRecord(jsonRecord)
+	return err
+}
+
+// 添加记录并分配ID，返回保存的记录
+func (p *ChnZone) CreateRecord(jsonRecord string) (dnsRecord, error) {
 	// 反序列化jsonRecord
 	var record dnsRecord
 	err := json.Unmarshal([]byte(jsonRecord), &record)
 	if err != nil {
 		fmt.Println("Error unmarshal jsonRecord:", err)
-		return err
+		return dnsRecord{}, err
+	}
+	err = p.checkRecordInput(&record, jsonRecord)
+	if err != nil {
+		return dnsRecord{}, err
+	}
+
+	//先检查是否已经存在相同的记录
+	if p.findRecord(record) {
+		return dnsRecord{}, errorf(ErrExists, "已存在相同的记录")
+	}
+
+	//增加DNS记录
+	record.ID = p.newRecordID()
+	err = p.insertRecord(record)
+	if err != nil {
+		return dnsRecord{}, err
 	}
+	// 递增serial
+	err = p.incrementSerial()
+	if err != nil {
+		fmt.Println("Error increment serial:", err)
+		return dnsRecord{}, err
+	}
+	return storedView(record), p.WriteZoneFile()
+}
+
+// 检查新增或修改的记录：必填项和类型，再规范化名字并按记录类型检查
+func (p *ChnZone) checkRecordInput(record *dnsRecord, jsonRecord string) error {
 	//增加DNS记录时，需要输入的信息包括：域名、TTL、类型、优先级、数据，其中优先级是MX记录特有的
+	//TXT记录可以只给出strings
+	if record.Type == "TXT" && record.Data == "" {
+		record.Data = gstr.Join(record.Strings, "")
+	}
 	//检查输入的数据是否合法
 	if gstr.Trim(record.DomainName) == "" || gstr.Trim(record.TTL) == "" || gstr.Trim(record.Type) == "" || gstr.Trim(record.Data) == "" {
 		return fmt.Errorf("域名、TTL、类型、数据不能为空")
@@ -164,9 +246,55 @@ func (p *ChnZone) AddDNSRecord(jsonRecord string) error {
 		return fmt.Errorf("MX记录必须指定优先级")
 	}
 	//检查输入的数据是否合法
-	if record.Type != "MX" && record.Type != "A" && record.Type != "A9" && record.Type != "NS" && record.Type != "PTR" && record.Type != "CNAME" && record.Type != "TXT" {
+	if record.Type != "MX" && record.Type != "A" && record.Type != "AAAA" && record.Type != "A9" && record.Type != "NS" && record.Type != "PTR" && record.Type != "CNAME" && record.Type != "TXT" && record.Type != "DS" {
 		return fmt.Errorf("不支持的类型")
 	}
+	// 注册局人员提供override口令时可以在保留、禁止的名字下添加记录
+	var opt struct {
+		Override string `json:"override"`
+	}
+	_ = json.Unmarshal([]byte(jsonRecord), &opt)
+	return p.checkNewRecord(record, p.policy.Override(opt.Override))
+}
+
+// 按类型把记录插入zone中对应的区域
+func (p *ChnZone) insertRecord(record dnsRecord) error {
+	switch record.Type {
+	case "NS":
+		return p.addNSRecord(record)
+	case "MX":
+		return p.addMXRecord(record)
+	case "PTR":
+		return p.addPTRRecord(record)
+	case "CNAME":
+		return p.addCNAMERecord(record)
+	case "TXT":
+		return p.addTXTRecord(record)
+	case "A", "A9", "AAAA":
+		return p.addDomainRecord(record)
+	case "DS":
+		return p.addDSRecord(record)
+	}
+	return fmt.Errorf("不支持的类型")
+}
+
+// 规范化并检查新增的记录，override为true时跳过保留、禁止名字的检查
+func (p *ChnZone) checkNewRecord(record *dnsRecord, override bool) error {
+	// 名字可以是U-label或A-label、相对或绝对写法，zone中统一保存为相对于$ORIGIN的小写A-label
+	err := p.normalizeRecord(record)
+	if err != nil {
+		return err
+	}
+	err = p.checkDomainStatus(record.DomainName)
+	if err != nil {
+		return err
+	}
+	if !override {
+		err = p.checkPolicy(record.DomainName)
+		if err != nil {
+			return err
+		}
+	}
 	err = p.checkTTL(record.TTL)
 	if err != nil {
 		return err
@@ -183,46 +311,33 @@ func (p *ChnZone) AddDNSRecord(jsonRecord string) error {
 			return err
 		}
 	}
+	if record.Type == "AAAA" {
+		err = p.checkIPv6Address(record.Data)
+		if err != nil {
+			return err
+		}
+	}
 	if record.Type == "A9" {
 		err = p.checkIPv9Address(record.Data)
 		if err != nil {
 			return err
 		}
 	}
-
-	//先检查是否已经存在相同的记录
-	if p.findRecord(record) {
-		return fmt.Errorf("已存在相同的记录")
-	}
-
-	//增加DNS记录
-	switch record.Type {
-	case "NS":
-		err = p.addNSRecord(record)
-	case "MX":
-		err = p.addMXRecord(record)
-	case "PTR":
-		err = p.addPTRRecord(record)
-	case "CNAME":
-		err = p.addCNAMERecord(record)
-	case "TXT":
-		err = p.addTXTRecord(record)
-	case "A":
-		err = p.addDomainRecord(record)
-	case "A9":
-		err = p.addDomainRecord(record)
-	default:
-		err = fmt.Errorf("不支持的类型")
+	err = p.checkDelegationConflict(*record)
+	if err != nil {
+		return err
 	}
-	// 递增serial
-	err = p.incrementSerial()
+	err = p.checkVariants(record.DomainName)
 	if err != nil {
-		fmt.Println("Error increment serial:", err)
 		return err
 	}
-	err = p.WriteZoneFile()
-
-	return err
+	if record.Type == "DS" {
+		err = p.checkDSRecord(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // func (p *ChnZone) AddRecord(jsonRecord string) error {
@@ -287,6 +402,10 @@ func (p *ChnZone) DelDNSRecord(jsonRecord string) error {
 		fmt.Println("Error unmarshal jsonRecord:", err)
 		return err
 	}
+	//给出记录ID时按ID删除
+	if record.ID != "" {
+		return p.DeleteRecord(record.ID)
+	}
 	//删除DNS记录时，需要输入的信息包括：域名、类型、数据
 	//检查输入的数据是否合法
 	if gstr.Trim(record.DomainName) == "" || gstr.Trim(record.Type) == "" || gstr.Trim(record.Data) == "" {
@@ -294,14 +413,32 @@ func (p *ChnZone) DelDNSRecord(jsonRecord string) error {
 	}
 
 	//检查输入的数据是否合法
-	if record.Type != "MX" && record.Type != "A" && record.Type != "A9" && record.Type != "NS" && record.Type != "PTR" && record.Type != "CNAME" && record.Type != "TXT" {
+	if record.Type != "MX" && record.Type != "A" && record.Type != "AAAA" && record.Type != "A9" && record.Type != "NS" && record.Type != "PTR" && record.Type != "CNAME" && record.Type != "TXT" && record.Type != "DS" {
 		return fmt.Errorf("不支持的类型")
 	}
+	lookupALabel(&record)
+	err = p.checkDomainStatus(record.DomainName)
+	if err != nil {
+		return err
+	}
+	if record.Type == "DS" {
+		ds, err := parseDSData(record.Data)
+		if err != nil {
+			return err
+		}
+		record.Data = dsData(ds)
+	}
 
 	err = p.findDNSRecordAndDelete(record)
 	if err != nil {
 		return err
 	}
+	if record.Type == "NS" {
+		// 委派变化后清理不再被引用的胶水
+		if _, err = p.pruneOrphanGlue(); err != nil {
+			return err
+		}
+	}
 	// 递增serial
 	err = p.incrementSerial()
 	if err != nil {
@@ -406,206 +543,37 @@ func (p *ChnZone) QueryDNSRecord(jsonReq string) ([]dnsRecord, error) {
 	var dnsRecords []dnsRecord
 	if jsonReq == "" {
 		//jsonReq == "" 时，获取所有记录
-		start := false
-		for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
-			if e.Value.(string) == "; Nameservers" {
-				start = true
-			}
-			if start {
-				items := gstr.SplitAndTrim(e.Value.(string), " ")
-				if len(items) == 0 || items[0] == ";" {
-					continue
-				}
-				switch items[3] {
-				case "MX":
-					//MX 记录特殊处理，多一项优先级
-					dnsRecords = append(dnsRecords, dnsRecord{
-						DomainName: items[0],
-						TTL:        items[1],
-						IN:         items[2],
-						Type:       items[3],
-						Priority:   items[4],
-						Data:       items[5],
-					})
-				case "TXT":
-					//TXT 记录特殊处理，最后的data有引号
-					data := gstr.SplitAndTrim(e.Value.(string), `"`)[1]
-					dnsRecords = append(dnsRecords, dnsRecord{
-						DomainName: items[0],
-						TTL:        items[1],
-						IN:         items[2],
-						Type:       items[3],
-						Data:       data,
-					})
-				default:
-					dnsRecords = append(dnsRecords, dnsRecord{
-						DomainName: items[0],
-						TTL:        items[1],
-						IN:         items[2],
-						Type:       items[3],
-						Data:       items[4],
-					})
-				}
-			}
+		for _, record := range p.listDNSRecords() {
+			dnsRecords = append(dnsRecords, withUnicode(record))
 		}
 		return dnsRecords, nil
-	} else {
-		var req dnsRecord
-		err := json.Unmarshal([]byte(jsonReq), &req)
-		if err != nil {
-			fmt.Println("Error unmarshal jsonRecord:", err)
-			return nil, err
-		}
-		//获取指定域名的记录，有多种组合查询模式
-		// 1.查询指定Type所有记录
-		if req.DomainName == "" && req.Type != "" && req.Data == "" {
-			start := false
-			for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
-				if e.Value.(string) == "; Nameservers" {
-					start = true
-				}
-				if start {
-					items := gstr.SplitAndTrim(e.Value.(string), " ")
-					if len(items) == 0 || items[0] == ";" || items[3] != req.Type {
-						continue
-					}
-
-					switch items[3] {
-					case "MX":
-						//MX 记录特殊处理，多一项优先级
-						dnsRecords = append(dnsRecords, dnsRecord{
-							DomainName: items[0],
-							TTL:        items[1],
-							IN:         items[2],
-							Type:       items[3],
-							Priority:   items[4],
-							Data:       items[5],
-						})
-					case "TXT":
-						//TXT 记录特殊处理，最后的data有引号
-						data := gstr.SplitAndTrim(e.Value.(string), `"`)[1]
-						dnsRecords = append(dnsRecords, dnsRecord{
-							DomainName: items[0],
-							TTL:        items[1],
-							IN:         items[2],
-							Type:       items[3],
-							Data:       data,
-						})
-					default:
-						dnsRecords = append(dnsRecords, dnsRecord{
-							DomainName: items[0],
-							TTL:        items[1],
-							IN:         items[2],
-							Type:       items[3],
-							Data:       items[4],
-						})
-					}
-				}
-			}
-			return dnsRecords, nil
+	}
+	var req dnsRecord
+	err := json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonRecord:", err)
+		return nil, err
+	}
+	//获取指定域名的记录，有多种组合查询模式
+	// 1.查询指定Type所有记录
+	// 2.查询指定Type + DomainName 记录
+	// 3.查询指定Type + DomainName + data 记录
+	if req.Type == "" || (req.DomainName == "" && req.Data != "") {
+		return dnsRecords, nil
+	}
+	lookupALabel(&req)
+	origin := p.getOrigin()
+	for _, record := range p.listDNSRecords() {
+		if record.Type != req.Type {
+			continue
 		}
-
-		// 2.查询指定Type + DomainName 记录
-		if req.DomainName != "" && req.Type != "" && req.Data == "" {
-			start := false
-			for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
-				if e.Value.(string) == "; Nameservers" {
-					start = true
-				}
-				if start {
-					items := gstr.SplitAndTrim(e.Value.(string), " ")
-					if len(items) == 0 || items[0] == ";" || items[3] != req.Type || items[0] != req.DomainName {
-						continue
-					}
-
-					switch items[3] {
-					case "MX":
-						//MX 记录特殊处理，多一项优先级
-						dnsRecords = append(dnsRecords, dnsRecord{
-							DomainName: items[0],
-							TTL:        items[1],
-							IN:         items[2],
-							Type:       items[3],
-							Priority:   items[4],
-							Data:       items[5],
-						})
-					case "TXT":
-						//TXT 记录特殊处理，最后的data有引号
-						data := gstr.SplitAndTrim(e.Value.(string), `"`)[1]
-						dnsRecords = append(dnsRecords, dnsRecord{
-							DomainName: items[0],
-							TTL:        items[1],
-							IN:         items[2],
-							Type:       items[3],
-							Data:       data,
-						})
-					default:
-						dnsRecords = append(dnsRecords, dnsRecord{
-							DomainName: items[0],
-							TTL:        items[1],
-							IN:         items[2],
-							Type:       items[3],
-							Data:       items[4],
-						})
-					}
-				}
-			}
-			return dnsRecords, nil
+		if req.DomainName != "" && !dnsname.Equal(record.DomainName, req.DomainName, origin) {
+			continue
 		}
-
-		// 3.查询指定Type + DomainName + data 记录
-		if req.DomainName != "" && req.Type != "" && req.Data != "" {
-			start := false
-			for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
-				if e.Value.(string) == "; Nameservers" {
-					start = true
-				}
-				if start {
-					items := gstr.SplitAndTrim(e.Value.(string), " ")
-					if len(items) == 0 || items[0] == ";" || items[3] != req.Type || items[0] != req.DomainName {
-						continue
-					}
-
-					switch items[3] {
-					case "MX":
-						//MX 记录特殊处理，多一项优先级
-						if req.Data == items[5] {
-							dnsRecords = append(dnsRecords, dnsRecord{
-								DomainName: items[0],
-								TTL:        items[1],
-								IN:         items[2],
-								Type:       items[3],
-								Priority:   items[4],
-								Data:       items[5],
-							})
-						}
-					case "TXT":
-						//TXT 记录特殊处理，最后的data有引号
-						data := gstr.SplitAndTrim(e.Value.(string), `"`)[1]
-						if req.Data == data {
-							dnsRecords = append(dnsRecords, dnsRecord{
-								DomainName: items[0],
-								TTL:        items[1],
-								IN:         items[2],
-								Type:       items[3],
-								Data:       data,
-							})
-						}
-					default:
-						if req.Data == items[4] {
-							dnsRecords = append(dnsRecords, dnsRecord{
-								DomainName: items[0],
-								TTL:        items[1],
-								IN:         items[2],
-								Type:       items[3],
-								Data:       items[4],
-							})
-						}
-					}
-				}
-			}
-			return dnsRecords, nil
+		if req.Data != "" && !sameData(record, req, origin) {
+			continue
 		}
+		dnsRecords = append(dnsRecords, withUnicode(record))
 	}
 	return dnsRecords, nil
 }
@@ -911,10 +879,13 @@ func (p *ChnZone) QueryDNSRecord(jsonReq string) ([]dnsRecord, error) {
 // }
 
 func (p *ChnZone) addPTRRecord(record dnsRecord) error {
-	strRecord := record.DomainName + " " + record.TTL + " " + "IN" + " " + record.Type + " " + record.Data
+	strRecord, err := p.renderRecord(record)
+	if err != nil {
+		return err
+	}
 	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
 		if e.Value.(string) == "; Reverse DNS Records (PTR)" {
-			p.runtimeZoneFileList.InsertAfter(e, strRecord)
+			p.insertLine(e, strRecord)
 			return nil
 		}
 	}
@@ -922,10 +893,13 @@ func (p *ChnZone) addPTRRecord(record dnsRecord) error {
 }
 
 func (p *ChnZone) addCNAMERecord(record dnsRecord) error {
-	strRecord := record.DomainName + " " + record.TTL + " " + "IN" + " " + record.Type + " " + record.Data + "."
+	strRecord, err := p.renderRecord(record)
+	if err != nil {
+		return err
+	}
 	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
 		if e.Value.(string) == "; CNAME" {
-			p.runtimeZoneFileList.InsertAfter(e, strRecord)
+			p.insertLine(e, strRecord)
 			return nil
 		}
 	}
@@ -933,10 +907,13 @@ func (p *ChnZone) addCNAMERecord(record dnsRecord) error {
 }
 
 func (p *ChnZone) addTXTRecord(record dnsRecord) error {
-	strRecord := record.DomainName + " " + record.TTL + " " + "IN" + " " + record.Type + " " + strconv.Quote(record.Data)
+	strRecord, err := p.renderRecord(record)
+	if err != nil {
+		return err
+	}
 	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
 		if e.Value.(string) == "; TXT" {
-			p.runtimeZoneFileList.InsertAfter(e, strRecord)
+			p.insertLine(e, strRecord)
 			return nil
 		}
 	}
@@ -944,10 +921,13 @@ func (p *ChnZone) addTXTRecord(record dnsRecord) error {
 }
 
 func (p *ChnZone) addNSRecord(record dnsRecord) error {
-	strRecord := record.DomainName + " " + record.TTL + " " + "IN" + " " + record.Type + " " + record.Data + "."
+	strRecord, err := p.renderRecord(record)
+	if err != nil {
+		return err
+	}
 	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
 		if e.Value.(string) == "; Nameservers" {
-			p.runtimeZoneFileList.InsertAfter(e, strRecord)
+			p.insertLine(e, strRecord)
 			return nil
 		}
 	}
@@ -955,10 +935,13 @@ func (p *ChnZone) addNSRecord(record dnsRecord) error {
 }
 
 func (p *ChnZone) addDomainRecord(record dnsRecord) error {
-	strRecord := record.DomainName + " " + record.TTL + " " + "IN" + " " + record.Type + " " + record.Data
+	strRecord, err := p.renderRecord(record)
+	if err != nil {
+		return err
+	}
 	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
 		if e.Value.(string) == "; HOST RECORDS" {
-			p.runtimeZoneFileList.InsertAfter(e, strRecord)
+			p.insertLine(e, strRecord)
 			return nil
 		}
 	}
@@ -966,10 +949,13 @@ func (p *ChnZone) addDomainRecord(record dnsRecord) error {
 }
 
 func (p *ChnZone) addMXRecord(record dnsRecord) error {
-	strRecord := record.DomainName + " " + record.TTL + " " + "IN" + " " + record.Type + " " + record.Priority + " " + record.Data
+	strRecord, err := p.renderRecord(record)
+	if err != nil {
+		return err
+	}
 	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
 		if e.Value.(string) == "; Mailservers" {
-			p.runtimeZoneFileList.InsertAfter(e, strRecord)
+			p.insertLine(e, strRecord)
 			return nil
 		}
 	}
@@ -1012,15 +998,19 @@ func (p *ChnZone) incrementSerial() error {
 // }
 
 func (p *ChnZone) WriteZoneFile() error {
+	p.assignRecordIDs()
 	strContent := ""
 	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
 		strContent += e.Value.(string) + "\n"
 	}
 	// 把strContent写入文件
-	err := os.WriteFile("/var/named/chn.zone", []byte(strContent), 0644)
+	err := os.WriteFile(p.zonePath(), []byte(strContent), 0644)
 	if err != nil {
 		fmt.Println("Error writing file:", err)
-		return err
+		return internalError(err)
+	}
+	if p.signer != nil {
+		return internalError(p.writeSignedZoneFile())
 	}
 	return nil
 }
@@ -1252,81 +1242,42 @@ func (p *ChnZone) checkIPv9Address(address string) error {
 // }
 
 func (p *ChnZone) findRecord(record dnsRecord) bool {
-	start := false
-	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
-		if e.Value.(string) == "; Nameservers" {
-			start = true
-		}
-		if start {
-			items := gstr.SplitAndTrim(e.Value.(string), " ")
-			if len(items) == 0 || items[0] == ";" {
-				continue
-			}
-			if items[0] == record.DomainName {
-				if items[3] == record.Type {
-					if record.Type == "MX" {
-						if items[5] == record.Data {
-							return true
-						}
-					} else if record.Type == "TXT" {
-						if gstr.SplitAndTrim(e.Value.(string), `"`)[1] == record.Data {
-							return true
-						}
-					} else if record.Type == "NS" {
-						if items[4] == record.Data+"." {
-							return true
-						}
-					} else {
-						if items[4] == record.Data {
-							return true
-						}
-					}
-				}
-			}
-		}
-	}
-	return false
+	return p.findRecordElement(record) != nil
 }
 
 func (p *ChnZone) findDNSRecordAndDelete(record dnsRecord) error {
+	e := p.findRecordElement(record)
+	if e == nil {
+		return errorf(ErrNotFound, "not found record")
+	}
+	p.removeLine(e)
+	return nil
+}
+
+// 删除从zone中读出的记录，与findDNSRecordAndDelete不同，data按原样比较
+func (p *ChnZone) removeStoredRecord(stored dnsRecord) error {
+	if stored.Type == "NS" {
+		stored.Data = gstr.TrimRight(stored.Data, ".")
+	}
+	return p.findDNSRecordAndDelete(stored)
+}
+
+// 查找域名、类型、数据都相同的记录所在的行
+func (p *ChnZone) findRecordElement(record dnsRecord) *glist.Element {
 	start := false
 	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
 		if e.Value.(string) == "; Nameservers" {
 			start = true
 		}
-		if start {
-			items := gstr.SplitAndTrim(e.Value.(string), " ")
-			if len(items) == 0 || items[0] == ";" {
-				continue
-			}
-			if items[0] == record.DomainName {
-				if items[3] == record.Type {
-					if record.Type == "MX" {
-						if items[5] == record.Data {
-							p.runtimeZoneFileList.Remove(e)
-							return nil
-						}
-					} else if record.Type == "TXT" {
-						if gstr.SplitAndTrim(e.Value.(string), `"`)[1] == record.Data {
-							p.runtimeZoneFileList.Remove(e)
-							return nil
-						}
-					} else if record.Type == "NS" {
-						if items[4] == record.Data+"." {
-							p.runtimeZoneFileList.Remove(e)
-							return nil
-						}
-					} else {
-						if items[4] == record.Data {
-							p.runtimeZoneFileList.Remove(e)
-							return nil
-						}
-					}
-				}
-			}
+		if !start {
+			continue
+		}
+		stored, ok := parseRecordLine(e.Value.(string))
+		if ok && p.sameRecord(stored, record) {
+			return e
 		}
 	}
-	return fmt.Errorf("not found record")
+	return nil
 }
 
 // func (p *ChnZone) findMXRecord(record mxRecord) error {
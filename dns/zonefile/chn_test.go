@@ -0,0 +1,69 @@
+package zonefile
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogf/gf/v2/container/glist"
+	"github.com/miekg/dns"
+)
+
+// 测试用zone的文件头和各段标题，与chn.zone的格式一致
+var testZoneHeader = []string{
+	"$ORIGIN chn.",
+	"$TTL 120",
+	"@ IN SOA a.gtld-servers.chn. master.hostname.com. (",
+	"\t\t\t2024010101 ; serial",
+	"\t\t\t60 ; refresh",
+	"\t\t\t3600 ; retry",
+	"\t\t\t604800 ; expiry",
+	"\t\t\t120 ; minimum ttl",
+	"\t\t)",
+	"",
+	"; Nameservers",
+	"",
+	"@ 86400 IN NS a.gtld-servers.chn.",
+	"",
+	"; Mailservers",
+	"",
+	"; Reverse DNS Records (PTR)",
+	"",
+	"; TXT",
+	"",
+	"; CNAME",
+	"",
+	"; HOST RECORDS",
+	"",
+}
+
+// 测试用zone，lines追加在HOST RECORDS之后，zone文件写在临时目录中
+func newTestZone(t testing.TB, lines ...string) *ChnZone {
+	t.Helper()
+	p := &ChnZone{
+		zoneFile:            filepath.Join(t.TempDir(), "chn.zone"),
+		runtimeZoneFileList: glist.New(),
+	}
+	for _, line := range testZoneHeader {
+		p.runtimeZoneFileList.PushBack(line)
+	}
+	for _, line := range lines {
+		p.runtimeZoneFileList.PushBack(line)
+	}
+	return p
+}
+
+// 在127.0.0.1上启动一个测试用DNS服务器，返回地址
+func startTestDNS(t *testing.T, handler dns.HandlerFunc) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: conn, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return conn.LocalAddr().String()
+}
@@ -0,0 +1,482 @@
+package zonefile
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"newCHNTLDManager/dns/idn"
+	dnsname "newCHNTLDManager/dns/name"
+
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/miekg/dns"
+)
+
+// 子域委派，NameServers为子域的NS集合，zone内的NS主机需要同时给出胶水地址
+type delegation struct {
+	DomainName  string       `json:"domainName"`
+	TTL         string       `json:"ttl,omitempty"`
+	NameServers []nameServer `json:"nameServers"`
+	DS          []string     `json:"ds,omitempty"`
+}
+
+type nameServer struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// 设置子域的NS集合，替换原有的NS和胶水记录，并清理不再被引用的胶水
+func (p *ChnZone) SetDelegation(jsonReq string) error {
+	var req delegation
+	err := json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonRecord:", err)
+		return err
+	}
+	err = p.checkDomainStatus(req.DomainName)
+	if err != nil {
+		return err
+	}
+	err = p.setDelegation(req)
+	if err != nil {
+		return err
+	}
+	// 递增serial
+	err = p.incrementSerial()
+	if err != nil {
+		fmt.Println("Error increment serial:", err)
+		return err
+	}
+	return p.WriteZoneFile()
+}
+
+func (p *ChnZone) setDelegation(req delegation) error {
+	req.DomainName = gstr.Trim(req.DomainName)
+	if req.DomainName == "" || req.DomainName == "@" {
+		return fmt.Errorf("域名不能为空，且不能委派zone apex")
+	}
+	owner := dnsRecord{DomainName: req.DomainName, Type: "NS"}
+	if err := p.toALabel(&owner); err != nil {
+		return err
+	}
+	rel, err := dnsname.Owner(owner.DomainName, p.getOrigin(), "NS")
+	if err != nil {
+		return err
+	}
+	req.DomainName = rel
+	if gstr.Trim(req.TTL) == "" {
+		req.TTL = "86400"
+	}
+	if err := p.checkTTL(req.TTL); err != nil {
+		return err
+	}
+	if len(req.NameServers) == 0 {
+		return fmt.Errorf("至少需要一个NS")
+	}
+	records := p.listDNSRecords()
+	set := p.delegationSet(records)
+	if cut := set.findCut(req.DomainName); cut != "" && cut != req.DomainName {
+		return fmt.Errorf("%s 位于委派点 %s 之下，不能再次委派", req.DomainName, cut)
+	}
+
+	// 只有位于委派点（包括本次的委派点）之下的NS主机需要胶水，zone内其他主机的地址记录是普通记录，不由委派维护
+	needsGlue := func(host string) bool {
+		return set.findCut(host) != "" || p.isSubName(req.DomainName, host)
+	}
+
+	// 检查NS主机和胶水地址
+	hosts := map[string]bool{}
+	for i, ns := range req.NameServers {
+		ns.Name = strings.ToLower(strings.TrimSuffix(idn.ToASCII(gstr.Trim(ns.Name)), "."))
+		if ns.Name == "" {
+			return fmt.Errorf("NS主机名不能为空")
+		}
+		if hosts[ns.Name] {
+			return fmt.Errorf("NS主机 %s 重复", ns.Name)
+		}
+		hosts[ns.Name] = true
+		if _, err := dnsname.Target(ns.Name+".", p.getOrigin(), "NS"); err != nil {
+			return err
+		}
+		if needsGlue(ns.Name + ".") {
+			if len(ns.Addresses) == 0 {
+				return fmt.Errorf("NS主机 %s 在zone内，必须提供胶水地址", ns.Name)
+			}
+			for j, address := range ns.Addresses {
+				if _, err := p.glueType(address); err != nil {
+					return err
+				}
+				// A、AAAA胶水按规范写法保存
+				if ip := net.ParseIP(address); ip != nil {
+					ns.Addresses[j] = ip.String()
+				}
+			}
+		} else if len(ns.Addresses) > 0 {
+			return fmt.Errorf("NS主机 %s 不在委派点之下，不能提供胶水地址", ns.Name)
+		}
+		req.NameServers[i] = ns
+	}
+
+	// 委派点只能有NS/DS，委派点之下只能有本次NS主机的胶水，已是委派点时其下原有的胶水在替换后清理
+	glueOwners := map[string]bool{}
+	for _, ns := range req.NameServers {
+		if len(ns.Addresses) > 0 {
+			glueOwners[p.relativize(ns.Name+".")] = true
+		}
+	}
+	existing := set.isDelegation(req.DomainName)
+	var conflicts []string
+	for _, record := range records {
+		if record.DomainName == "@" || !p.isSubName(req.DomainName, record.DomainName) {
+			continue
+		}
+		if p.sameName(record.DomainName, req.DomainName) {
+			if record.Type != "NS" && record.Type != "DS" {
+				conflicts = append(conflicts, record.DomainName+" "+record.Type)
+			}
+			continue
+		}
+		if record.Type == "NS" {
+			conflicts = append(conflicts, record.DomainName+" "+record.Type)
+			continue
+		}
+		if !isAddressType(record.Type) || !(glueOwners[p.relativize(p.qualify(record.DomainName, p.getOrigin()))] || existing) {
+			conflicts = append(conflicts, record.DomainName+" "+record.Type)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%s 下已有其他记录，不能委派: %s", req.DomainName, gstr.Join(conflicts, ", "))
+	}
+	if err := p.checkVariants(req.DomainName); err != nil {
+		return err
+	}
+
+	// 替换NS集合
+	for _, record := range p.listDNSRecords() {
+		if record.Type == "NS" && p.sameName(record.DomainName, req.DomainName) {
+			if err := p.removeStoredRecord(record); err != nil {
+				return err
+			}
+		}
+	}
+	for _, ns := range req.NameServers {
+		err := p.addNSRecord(dnsRecord{DomainName: req.DomainName, TTL: req.TTL, Type: "NS", Data: ns.Name + "."})
+		if err != nil {
+			return err
+		}
+	}
+	// 替换胶水
+	for _, ns := range req.NameServers {
+		if len(ns.Addresses) == 0 {
+			continue
+		}
+		owner := p.relativize(ns.Name + ".")
+		for _, record := range p.listDNSRecords() {
+			if isAddressType(record.Type) && p.sameName(record.DomainName, owner) {
+				if err := p.removeStoredRecord(record); err != nil {
+					return err
+				}
+			}
+		}
+		for _, address := range ns.Addresses {
+			glueType, _ := p.glueType(address)
+			err := p.addDomainRecord(dnsRecord{DomainName: owner, TTL: req.TTL, Type: glueType, Data: address})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = p.pruneOrphanGlue()
+	return err
+}
+
+// 删除子域委派，连同DS和不再被引用的胶水
+func (p *ChnZone) RemoveDelegation(jsonReq string) error {
+	var req delegation
+	err := json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonRecord:", err)
+		return err
+	}
+	err = p.checkDomainStatus(gstr.Trim(req.DomainName))
+	if err != nil {
+		return err
+	}
+	err = p.removeDelegation(gstr.Trim(req.DomainName))
+	if err != nil {
+		return err
+	}
+	// 递增serial
+	err = p.incrementSerial()
+	if err != nil {
+		fmt.Println("Error increment serial:", err)
+		return err
+	}
+	return p.WriteZoneFile()
+}
+
+func (p *ChnZone) removeDelegation(domainName string) error {
+	if !p.isDelegation(domainName) {
+		return errorf(ErrNotFound, "%s 不是委派点", domainName)
+	}
+	for _, record := range p.listDNSRecords() {
+		if (record.Type == "NS" || record.Type == "DS") && p.sameName(record.DomainName, domainName) {
+			if err := p.removeStoredRecord(record); err != nil {
+				return err
+			}
+		}
+	}
+	// 委派点已删除，原委派点下不再被引用的胶水不会被pruneOrphanGlue识别，需要单独清理
+	records := p.listDNSRecords()
+	set := p.delegationSet(records)
+	for _, record := range records {
+		if isAddressType(record.Type) && !p.sameName(record.DomainName, domainName) &&
+			p.isSubName(domainName, record.DomainName) && !set.isGlueOwner(record.DomainName) {
+			if err := p.removeStoredRecord(record); err != nil {
+				return err
+			}
+			fmt.Println("remove orphaned glue", record.DomainName, record.Type, record.Data)
+		}
+	}
+	_, err := p.pruneOrphanGlue()
+	return err
+}
+
+// 查询委派，domainName为空时返回所有委派
+func (p *ChnZone) QueryDelegation(jsonReq string) ([]delegation, error) {
+	var req delegation
+	if jsonReq != "" {
+		err := json.Unmarshal([]byte(jsonReq), &req)
+		if err != nil {
+			fmt.Println("Error unmarshal jsonRecord:", err)
+			return nil, err
+		}
+	}
+	records := p.listDNSRecords()
+	set := p.delegationSet(records)
+	byName := map[string]*delegation{}
+	var names []string
+	for _, record := range records {
+		if record.Type != "NS" || record.DomainName == "@" {
+			continue
+		}
+		if req.DomainName != "" && !p.sameName(record.DomainName, req.DomainName) {
+			continue
+		}
+		d, ok := byName[record.DomainName]
+		if !ok {
+			d = &delegation{DomainName: record.DomainName, TTL: record.TTL}
+			byName[record.DomainName] = d
+			names = append(names, record.DomainName)
+		}
+		ns := nameServer{Name: strings.TrimSuffix(record.Data, ".")}
+		if set.findCut(record.Data) != "" {
+			owner := p.relativize(record.Data)
+			for _, glue := range records {
+				if isAddressType(glue.Type) && p.sameName(glue.DomainName, owner) {
+					ns.Addresses = append(ns.Addresses, glue.Data)
+				}
+			}
+		}
+		d.NameServers = append(d.NameServers, ns)
+	}
+	for _, record := range records {
+		if d, ok := byName[record.DomainName]; ok && record.Type == "DS" {
+			d.DS = append(d.DS, record.Data)
+		}
+	}
+	sort.Strings(names)
+	var res []delegation
+	for _, name := range names {
+		res = append(res, *byName[name])
+	}
+	return res, nil
+}
+
+// 检查新增记录是否与委派冲突：委派点只能有NS/DS，委派点之下只能有被NS引用的胶水
+func (p *ChnZone) checkDelegationConflict(record dnsRecord) error {
+	if record.DomainName == "@" {
+		return nil
+	}
+	records := p.listDNSRecords()
+	set := p.delegationSet(records)
+	cut := set.findCut(record.DomainName)
+	if cut == "" {
+		if record.Type != "NS" {
+			return nil
+		}
+		// 新增的NS会产生委派点，其下只能有这条NS主机的地址记录，其他记录会被遮蔽，并在下次清理胶水时被删除
+		for _, stored := range records {
+			if stored.DomainName == "@" || !p.isSubName(record.DomainName, stored.DomainName) {
+				continue
+			}
+			if p.sameName(stored.DomainName, record.DomainName) {
+				if stored.Type != "DS" {
+					return fmt.Errorf("%s 已有%s记录，不能添加NS", record.DomainName, stored.Type)
+				}
+				continue
+			}
+			if !isAddressType(stored.Type) || set.fqdn(stored.DomainName) != set.fqdn(record.Data) {
+				return fmt.Errorf("%s 下已有记录 %s %s，不能添加NS", record.DomainName, stored.DomainName, stored.Type)
+			}
+		}
+		return nil
+	}
+	if p.sameName(record.DomainName, cut) {
+		if record.Type != "NS" && record.Type != "DS" {
+			return fmt.Errorf("%s 是委派点，只能添加NS/DS记录", cut)
+		}
+		return nil
+	}
+	if isAddressType(record.Type) && set.isGlueOwner(record.DomainName) {
+		return nil
+	}
+	return fmt.Errorf("%s 位于委派点 %s 之下，只能添加NS主机的胶水记录", record.DomainName, cut)
+}
+
+// 清理委派点之下不再被任何NS引用的胶水
+func (p *ChnZone) pruneOrphanGlue() ([]dnsRecord, error) {
+	records := p.listDNSRecords()
+	set := p.delegationSet(records)
+	var removed []dnsRecord
+	for _, record := range records {
+		if !isAddressType(record.Type) || record.DomainName == "@" {
+			continue
+		}
+		if set.findCut(record.DomainName) == "" || set.isGlueOwner(record.DomainName) {
+			continue
+		}
+		if err := p.removeStoredRecord(record); err != nil {
+			return removed, err
+		}
+		removed = append(removed, record)
+		fmt.Println("remove orphaned glue", record.DomainName, record.Type, record.Data)
+	}
+	return removed, nil
+}
+
+// 委派点和NS主机的集合，每次操作从zone记录构建一次，逐条记录检查时不再重新解析zone
+type delegationSet struct {
+	origin string
+	cuts   map[string]string // 委派点的小写绝对域名 -> zone中的写法
+	hosts  map[string]bool   // 被NS引用的主机的小写绝对域名
+}
+
+func (p *ChnZone) delegationSet(records []dnsRecord) *delegationSet {
+	set := &delegationSet{origin: p.getOrigin(), cuts: map[string]string{}, hosts: map[string]bool{}}
+	for _, record := range records {
+		if record.Type != "NS" {
+			continue
+		}
+		set.hosts[set.fqdn(record.Data)] = true
+		if record.DomainName == "@" {
+			continue
+		}
+		if _, ok := set.cuts[set.fqdn(record.DomainName)]; !ok {
+			set.cuts[set.fqdn(record.DomainName)] = record.DomainName
+		}
+	}
+	return set
+}
+
+// 转换为小写绝对域名，与qualify的规则一致
+func (set *delegationSet) fqdn(name string) string {
+	if name == "@" {
+		return set.origin
+	}
+	if !strings.HasSuffix(name, ".") {
+		name += "." + set.origin
+	}
+	return strings.ToLower(name)
+}
+
+// 某个名字是否被zone内的NS记录引用为NS主机
+func (set *delegationSet) isGlueOwner(domainName string) bool {
+	return set.hosts[set.fqdn(domainName)]
+}
+
+// 非apex且有NS记录的域名是委派点
+func (set *delegationSet) isDelegation(domainName string) bool {
+	_, ok := set.cuts[set.fqdn(domainName)]
+	return ok && domainName != "@"
+}
+
+// 查找包含domainName的委派点（domainName本身或其祖先），取最靠近zone apex的一个，不存在时返回空字符串
+func (set *delegationSet) findCut(domainName string) string {
+	cut := ""
+	name := set.fqdn(domainName)
+	for name != set.origin && dns.IsSubDomain(set.origin, name) {
+		if stored, ok := set.cuts[name]; ok {
+			cut = stored
+		}
+		next, end := dns.NextLabel(name, 0)
+		if end {
+			break
+		}
+		name = name[next:]
+	}
+	return cut
+}
+
+// 只检查一个名字时使用，需要逐条记录检查时应先构建delegationSet
+func (p *ChnZone) isGlueOwner(domainName string) bool {
+	return p.delegationSet(p.listDNSRecords()).isGlueOwner(domainName)
+}
+
+func (p *ChnZone) findCut(domainName string) string {
+	return p.delegationSet(p.listDNSRecords()).findCut(domainName)
+}
+
+// child是否等于parent或位于parent之下
+func (p *ChnZone) isSubName(parent string, child string) bool {
+	origin := p.getOrigin()
+	return dns.IsSubDomain(strings.ToLower(p.qualify(parent, origin)), strings.ToLower(p.qualify(child, origin)))
+}
+
+func (p *ChnZone) sameName(a string, b string) bool {
+	origin := p.getOrigin()
+	return strings.EqualFold(p.qualify(a, origin), p.qualify(b, origin))
+}
+
+// 绝对域名是否位于本zone内
+func (p *ChnZone) inZone(fqdn string) bool {
+	return dns.IsSubDomain(p.getOrigin(), strings.ToLower(dns.Fqdn(fqdn)))
+}
+
+// 把zone内的绝对域名转换为相对于$ORIGIN的写法
+func (p *ChnZone) relativize(fqdn string) string {
+	origin := p.getOrigin()
+	fqdn = strings.ToLower(dns.Fqdn(idn.ToASCII(fqdn)))
+	if fqdn == origin {
+		return "@"
+	}
+	return strings.TrimSuffix(fqdn, "."+origin)
+}
+
+func isAddressType(recordType string) bool {
+	return recordType == "A" || recordType == "AAAA" || recordType == "A9"
+}
+
+// 根据地址格式判断胶水记录类型
+func (p *ChnZone) glueType(address string) (string, error) {
+	if ip := net.ParseIP(address); ip != nil {
+		if ip.To4() != nil {
+			return "A", nil
+		}
+		return "AAAA", nil
+	}
+	if err := p.checkIPv9Address(address); err != nil {
+		return "", fmt.Errorf("胶水地址 %s 不是合法的IPv4/IPv6/IPv9地址", address)
+	}
+	return "A9", nil
+}
+
+func (p *ChnZone) checkIPv6Address(address string) error {
+	ip := net.ParseIP(address)
+	if ip == nil || ip.To4() != nil {
+		return fmt.Errorf("data is not a valid IPv6 address")
+	}
+	return nil
+}
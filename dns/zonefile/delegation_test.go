@@ -0,0 +1,208 @@
+package zonefile
+
+import (
+	"strings"
+	"testing"
+)
+
+// 委派sub带zone内的胶水，深层委派deep.x只有zone外的NS
+var delegationLines = []string{
+	"sub 86400 IN NS ns1.sub.chn.",
+	"sub 86400 IN NS ns.example.net.",
+	"ns1.sub 86400 IN A 192.0.2.53",
+	"deep.x 86400 IN NS ns.example.net.",
+	"www 600 IN A 192.0.2.1",
+}
+
+func TestDelegationSet(t *testing.T) {
+	p := newTestZone(t, delegationLines...)
+	set := p.delegationSet(p.listDNSRecords())
+	tests := []struct {
+		name       string
+		cut        string
+		delegation bool
+		glueOwner  bool
+	}{
+		{"@", "", false, false},
+		{"www", "", false, false},
+		{"sub", "sub", true, false},
+		{"SUB", "sub", true, false},
+		{"sub.chn.", "sub", true, false},
+		{"ns1.sub", "sub", false, true},
+		{"a.b.sub", "sub", false, false},
+		{"x", "", false, false},
+		{"deep.x", "deep.x", true, false},
+		{"host.deep.x", "deep.x", false, false},
+		{"a.gtld-servers", "", false, true},
+		{"subway", "", false, false},
+	}
+	for _, tt := range tests {
+		if got := set.findCut(tt.name); got != tt.cut {
+			t.Errorf("findCut(%q) = %q，应为 %q", tt.name, got, tt.cut)
+		}
+		if got := set.isDelegation(tt.name); got != tt.delegation {
+			t.Errorf("isDelegation(%q) = %v，应为 %v", tt.name, got, tt.delegation)
+		}
+		if got := set.isGlueOwner(tt.name); got != tt.glueOwner {
+			t.Errorf("isGlueOwner(%q) = %v，应为 %v", tt.name, got, tt.glueOwner)
+		}
+	}
+}
+
+func TestCheckDelegationConflict(t *testing.T) {
+	p := newTestZone(t, append(delegationLines, "mail.foo 600 IN A 192.0.2.9")...)
+	tests := []struct {
+		name    string
+		record  dnsRecord
+		wantErr bool
+	}{
+		{"DS at cut", dnsRecord{DomainName: "sub", Type: "DS"}, false},
+		{"A at cut", dnsRecord{DomainName: "sub", Type: "A"}, true},
+		{"glue", dnsRecord{DomainName: "ns1.sub", Type: "AAAA"}, false},
+		{"non glue under cut", dnsRecord{DomainName: "mail.sub", Type: "A"}, true},
+		{"NS under cut", dnsRecord{DomainName: "a.sub", Type: "NS"}, true},
+		{"NS above data", dnsRecord{DomainName: "www", Type: "NS"}, true},
+		{"new cut", dnsRecord{DomainName: "other", Type: "NS", Data: "ns.example.net."}, false},
+		{"NS above address", dnsRecord{DomainName: "foo", Type: "NS", Data: "ns.example.net."}, true},
+		{"NS above own host", dnsRecord{DomainName: "foo", Type: "NS", Data: "mail.foo.chn."}, false},
+		{"apex", dnsRecord{DomainName: "@", Type: "MX"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.checkDelegationConflict(tt.record)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkDelegationConflict(%s %s) error = %v, wantErr %v", tt.record.DomainName, tt.record.Type, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPruneOrphanGlue(t *testing.T) {
+	p := newTestZone(t, append(delegationLines,
+		"ns2.sub 86400 IN A 192.0.2.54",
+		"ns2.sub 86400 IN AAAA 2001:db8::54",
+	)...)
+	removed, err := p.pruneOrphanGlue()
+	if err != nil {
+		t.Fatalf("pruneOrphanGlue: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("清理了%d条胶水，应为2条: %v", len(removed), removed)
+	}
+	for _, record := range removed {
+		if record.DomainName != "ns2.sub" {
+			t.Errorf("不应清理 %s %s", record.DomainName, record.Type)
+		}
+	}
+	if removed, _ = p.pruneOrphanGlue(); removed != nil {
+		t.Error("再次清理时不应有记录")
+	}
+}
+
+func TestSetDelegation(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     delegation
+		wantErr bool
+		// 成功后zone中sub的NS和胶水
+		wantNS   int
+		wantGlue []string
+	}{
+		{
+			name:     "replace ns set",
+			req:      delegation{DomainName: "sub", NameServers: []nameServer{{Name: "ns2.sub.chn", Addresses: []string{"192.0.2.54"}}}},
+			wantNS:   1,
+			wantGlue: []string{"ns2.sub"},
+		},
+		{
+			name:     "keep existing glue host",
+			req:      delegation{DomainName: "sub", NameServers: []nameServer{{Name: "ns1.sub.chn", Addresses: []string{"192.0.2.55"}}, {Name: "ns.example.org"}}},
+			wantNS:   2,
+			wantGlue: []string{"ns1.sub"},
+		},
+		{name: "in-zone host without glue", req: delegation{DomainName: "sub", NameServers: []nameServer{{Name: "ns3.sub.chn"}}}, wantErr: true},
+		{name: "glue for external host", req: delegation{DomainName: "sub", NameServers: []nameServer{{Name: "ns.example.org", Addresses: []string{"192.0.2.1"}}}}, wantErr: true},
+		{name: "under existing cut", req: delegation{DomainName: "a.sub", NameServers: []nameServer{{Name: "ns.example.org"}}}, wantErr: true},
+		{name: "name has data", req: delegation{DomainName: "www", NameServers: []nameServer{{Name: "ns.example.org"}}}, wantErr: true},
+		{name: "apex", req: delegation{DomainName: "@", NameServers: []nameServer{{Name: "ns.example.org"}}}, wantErr: true},
+		{name: "no ns", req: delegation{DomainName: "new"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestZone(t, delegationLines...)
+			err := p.setDelegation(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setDelegation error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			ns := 0
+			var glue []string
+			for _, record := range p.listDNSRecords() {
+				if record.Type == "NS" && record.DomainName == "sub" {
+					ns++
+				}
+				if record.Type == "A" && record.DomainName != "www" {
+					glue = append(glue, record.DomainName)
+				}
+			}
+			if ns != tt.wantNS {
+				t.Errorf("sub有%d条NS，应为%d条", ns, tt.wantNS)
+			}
+			if len(glue) != len(tt.wantGlue) || (len(glue) > 0 && glue[0] != tt.wantGlue[0]) {
+				t.Errorf("胶水为 %v，应为 %v", glue, tt.wantGlue)
+			}
+		})
+	}
+}
+
+// zone内不在委派点之下的NS主机不需要胶水，它的地址记录不被替换
+func TestSetDelegationHostOutsideCut(t *testing.T) {
+	lines := append(delegationLines, "www 600 IN A 192.0.2.2")
+	p := newTestZone(t, lines...)
+	err := p.setDelegation(delegation{DomainName: "example", NameServers: []nameServer{{Name: "www.chn", Addresses: []string{"198.51.100.9"}}}})
+	if err == nil {
+		t.Fatal("给不在委派点之下的主机提供地址应返回错误")
+	}
+	if err = p.setDelegation(delegation{DomainName: "example", NameServers: []nameServer{{Name: "www.chn"}}}); err != nil {
+		t.Fatalf("setDelegation: %v", err)
+	}
+	var www []string
+	for _, record := range p.listDNSRecords() {
+		if record.DomainName == "www" {
+			www = append(www, record.TTL+" "+record.Data)
+		}
+	}
+	if strings.Join(www, ",") != "600 192.0.2.1,600 192.0.2.2" {
+		t.Errorf("www的记录变为 %v", www)
+	}
+	if got, _ := p.QueryDelegation(`{"domainName":"example"}`); len(got) != 1 || len(got[0].NameServers[0].Addresses) != 0 {
+		t.Errorf("查询委派得到 %+v，www不是胶水", got)
+	}
+	// registry给出的地址对不需要胶水的主机忽略
+	if err = p.PublishDelegation("example2.chn.", []string{"www.chn"}, map[string][]string{"www.chn": {"198.51.100.9"}}, nil); err != nil {
+		t.Fatalf("PublishDelegation: %v", err)
+	}
+	if records, _ := p.QueryDNSRecord(`{"domainName":"www","type":"A"}`); len(records) != 2 {
+		t.Errorf("发布委派后www有%d条A记录，应为2条", len(records))
+	}
+}
+
+func TestRemoveDelegation(t *testing.T) {
+	p := newTestZone(t, append(delegationLines, "sub 86400 IN DS 12345 13 2 "+strings.Repeat("AB", 32))...)
+	if err := p.removeDelegation("sub"); err != nil {
+		t.Fatalf("removeDelegation: %v", err)
+	}
+	for _, record := range p.listDNSRecords() {
+		if p.isSubName("sub", record.DomainName) {
+			t.Errorf("删除委派后仍有 %s %s %s", record.DomainName, record.Type, record.Data)
+		}
+	}
+	if err := p.removeDelegation("www"); err == nil {
+		t.Error("www不是委派点，应返回错误")
+	}
+	if !p.isDelegation("deep.x") {
+		t.Error("不应影响其他委派")
+	}
+}
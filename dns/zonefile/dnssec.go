@@ -0,0 +1,478 @@
+package zonefile
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"newCHNTLDManager/dns/dnssec"
+
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/miekg/dns"
+)
+
+type dsRecord struct {
+	KeyTag     uint16 `json:"keyTag"`
+	Algorithm  uint8  `json:"algorithm"`
+	DigestType uint8  `json:"digestType"`
+	Digest     string `json:"digest"`
+	Record     string `json:"record"`
+}
+
+// 设置DNSSEC签名器，设置后每次写zone文件都会同时写出签名后的zone文件
+func (p *ChnZone) SetSigner(signer *dnssec.Signer) {
+	p.signer = signer
+}
+
+func (p *ChnZone) GetSigner() *dnssec.Signer {
+	return p.signer
+}
+
+// 签名即将过期时重新签名，serial递增以便从服务器同步新的签名
+func (p *ChnZone) ResignZone() (bool, error) {
+	if p.signer == nil || !p.signer.NeedsResign(time.Now().UTC()) {
+		return false, nil
+	}
+	err := p.incrementSerial()
+	if err != nil {
+		fmt.Println("Error increment serial:", err)
+		return false, err
+	}
+	return true, p.WriteZoneFile()
+}
+
+// 返回需要提交给父区的DS记录
+func (p *ChnZone) QueryDSRecord() ([]dsRecord, error) {
+	if p.signer == nil {
+		return nil, fmt.Errorf("DNSSEC未启用")
+	}
+	var res []dsRecord
+	for _, ds := range p.signer.DSRecords() {
+		res = append(res, dsRecord{
+			KeyTag:     ds.KeyTag,
+			Algorithm:  ds.Algorithm,
+			DigestType: ds.DigestType,
+			Digest:     ds.Digest,
+			Record:     ds.String(),
+		})
+	}
+	return res, nil
+}
+
+func (p *ChnZone) writeSignedZoneFile() error {
+	soa, err := p.readSOA()
+	if err != nil {
+		return err
+	}
+	rrs, err := p.toRRs()
+	if err != nil {
+		return err
+	}
+	signed, err := p.signer.SignZone(soa, rrs)
+	if err != nil {
+		fmt.Println("Error sign zone:", err)
+		return err
+	}
+	var sb strings.Builder
+	for _, rr := range signed {
+		sb.WriteString(p.rrString(rr))
+		sb.WriteString("\n")
+	}
+	err = os.WriteFile(p.signer.Config().SignedFile, []byte(sb.String()), 0644)
+	if err != nil {
+		fmt.Println("Error writing file:", err)
+		return err
+	}
+	return nil
+}
+
+// A9使用自定义类型编码，写文件时还原为A9的文本格式
+func (p *ChnZone) rrString(rr dns.RR) string {
+	if unknown, ok := rr.(*dns.RFC3597); ok && unknown.Hdr.Rrtype == p.signer.Config().A9TypeCode {
+		h := unknown.Hdr
+		return fmt.Sprintf("%s\t%d\tIN\tA9\t%s", h.Name, h.Ttl, unpackIPv9(unknown.Rdata))
+	}
+	if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == p.signer.Config().A9TypeCode {
+		return strings.Replace(sig.String(), "RRSIG\tTYPE"+strconv.Itoa(int(sig.TypeCovered)), "RRSIG\tA9", 1)
+	}
+	return rr.String()
+}
+
+// 从$ORIGIN行读取zone名
+func (p *ChnZone) getOrigin() string {
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		items := gstr.SplitAndTrim(e.Value.(string), " ")
+		if len(items) == 2 && items[0] == "$ORIGIN" {
+			return dns.Fqdn(items[1])
+		}
+	}
+	return "chn."
+}
+
+// zone的$ORIGIN，调用方需要持有mLock
+func (p *ChnZone) Origin() string {
+	return p.getOrigin()
+}
+
+// 解析SOA，SOA的各个字段分布在"IN SOA"行之后的5行
+func (p *ChnZone) readSOA() (*dns.SOA, error) {
+	origin := p.getOrigin()
+	soa := &dns.SOA{Hdr: dns.RR_Header{Name: origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 120}}
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		items := gstr.SplitAndTrim(e.Value.(string), " ")
+		if len(items) == 2 && items[0] == "$TTL" {
+			ttl, err := strconv.ParseUint(items[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("$TTL 格式错误: %v", err)
+			}
+			soa.Hdr.Ttl = uint32(ttl)
+		}
+		if !gstr.Contains(e.Value.(string), "IN SOA") {
+			continue
+		}
+		for i, item := range items {
+			if item == "SOA" && i+2 < len(items) {
+				soa.Ns = p.qualify(items[i+1], origin)
+				soa.Mbox = p.qualify(items[i+2], origin)
+			}
+		}
+		var values []uint32
+		for f := e.Next(); f != nil && len(values) < 5; f = f.Next() {
+			value, err := strconv.ParseUint(gstr.Trim(gstr.Split(f.Value.(string), ";")[0]), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("SOA 格式错误: %v", err)
+			}
+			values = append(values, uint32(value))
+		}
+		if len(values) != 5 {
+			return nil, fmt.Errorf("SOA 格式错误")
+		}
+		soa.Serial, soa.Refresh, soa.Retry, soa.Expire, soa.Minttl = values[0], values[1], values[2], values[3], values[4]
+		return soa, nil
+	}
+	return nil, fmt.Errorf("not found SOA")
+}
+
+// 相对域名补全为绝对域名
+func (p *ChnZone) qualify(name string, origin string) string {
+	if name == "@" {
+		return origin
+	}
+	if gstr.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "." + origin
+}
+
+// 解析一行记录，格式与QueryDNSRecord一致，行尾注释中的id为记录ID
+func parseRecordLine(line string) (dnsRecord, bool) {
+	line, comment := splitComment(line)
+	items := gstr.SplitAndTrim(line, " ")
+	if len(items) < 5 || items[0] == ";" || gstr.HasPrefix(items[0], "$") {
+		return dnsRecord{}, false
+	}
+	record := dnsRecord{
+		ID:         commentID(comment),
+		DomainName: items[0],
+		TTL:        items[1],
+		IN:         items[2],
+		Type:       items[3],
+		Data:       items[4],
+	}
+	switch items[3] {
+	case "MX":
+		//MX 记录特殊处理，多一项优先级
+		if len(items) < 6 {
+			return dnsRecord{}, false
+		}
+		record.Priority = items[4]
+		record.Data = items[5]
+	case "TXT":
+		//TXT 记录特殊处理，data为带引号和转义的一个或多个字符串
+		i := strings.Index(line, `"`)
+		if i < 0 {
+			return dnsRecord{}, false
+		}
+		list, err := unquoteTXT(line[i:])
+		if err != nil {
+			return dnsRecord{}, false
+		}
+		record.Data = strings.Join(list, "")
+		record.Strings = list
+	case "DS":
+		//DS 记录的data由多项组成
+		record.Data = gstr.Join(items[4:], " ")
+	}
+	return record, true
+}
+
+// 获取"; Nameservers"之后的全部记录
+func (p *ChnZone) listDNSRecords() []dnsRecord {
+	var records []dnsRecord
+	start := false
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		if e.Value.(string) == "; Nameservers" {
+			start = true
+		}
+		if !start {
+			continue
+		}
+		if record, ok := parseRecordLine(e.Value.(string)); ok {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// "; Nameservers"之后无法解析的记录行，listDNSRecords会跳过这些行
+func (p *ChnZone) badRecordLine() (string, bool) {
+	start := false
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		line := e.Value.(string)
+		if line == "; Nameservers" {
+			start = true
+		}
+		if !start {
+			continue
+		}
+		body, _ := splitComment(line)
+		body = strings.TrimSpace(body)
+		if body == "" || gstr.HasPrefix(body, "$") {
+			continue
+		}
+		if _, ok := parseRecordLine(line); !ok {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+// 把zone中的记录转换为dns.RR。有记录无法解析或转换时返回错误，不签名缺少记录的zone
+func (p *ChnZone) toRRs() ([]dns.RR, error) {
+	if line, ok := p.badRecordLine(); ok {
+		return nil, fmt.Errorf("记录 %s 无法解析，不能签名", strings.TrimSpace(line))
+	}
+	origin := p.getOrigin()
+	var rrs []dns.RR
+	for _, record := range p.listDNSRecords() {
+		rr, err := p.toRR(record, origin)
+		if err != nil {
+			return nil, fmt.Errorf("记录 %s %s %s 无法签名: %v", record.DomainName, record.Type, record.Data, err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
+func (p *ChnZone) toRR(record dnsRecord, origin string) (dns.RR, error) {
+	if record.IN != "IN" {
+		return nil, fmt.Errorf("class 必须是IN")
+	}
+	ttl, err := strconv.ParseUint(record.TTL, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	hdr := dns.RR_Header{Name: p.qualify(record.DomainName, origin), Class: dns.ClassINET, Ttl: uint32(ttl)}
+	switch record.Type {
+	case "A":
+		ip := net.ParseIP(record.Data).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("data is not a valid IPv4 address")
+		}
+		hdr.Rrtype = dns.TypeA
+		return &dns.A{Hdr: hdr, A: ip}, nil
+	case "AAAA":
+		ip := net.ParseIP(record.Data)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("data is not a valid IPv6 address")
+		}
+		hdr.Rrtype = dns.TypeAAAA
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+	case "A9":
+		wire, err := packIPv9(record.Data)
+		if err != nil {
+			return nil, err
+		}
+		hdr.Rrtype = p.signer.Config().A9TypeCode
+		return &dns.RFC3597{Hdr: hdr, Rdata: hex.EncodeToString(wire)}, nil
+	case "NS":
+		hdr.Rrtype = dns.TypeNS
+		return &dns.NS{Hdr: hdr, Ns: p.qualify(record.Data, origin)}, nil
+	case "CNAME":
+		hdr.Rrtype = dns.TypeCNAME
+		return &dns.CNAME{Hdr: hdr, Target: p.qualify(record.Data, origin)}, nil
+	case "PTR":
+		hdr.Rrtype = dns.TypePTR
+		return &dns.PTR{Hdr: hdr, Ptr: p.qualify(record.Data, origin)}, nil
+	case "MX":
+		pri, err := strconv.ParseUint(record.Priority, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		hdr.Rrtype = dns.TypeMX
+		return &dns.MX{Hdr: hdr, Preference: uint16(pri), Mx: p.qualify(record.Data, origin)}, nil
+	case "TXT":
+		hdr.Rrtype = dns.TypeTXT
+		list, err := txtStrings(record)
+		if err != nil {
+			return nil, err
+		}
+		// miekg/dns的TXT字符串使用presentation格式的转义
+		txt := make([]string, len(list))
+		for i, s := range list {
+			txt[i] = escapeTXT(s)
+		}
+		return &dns.TXT{Hdr: hdr, Txt: txt}, nil
+	case "DS":
+		ds, err := parseDSData(record.Data)
+		if err != nil {
+			return nil, err
+		}
+		ds.Hdr = hdr
+		ds.Hdr.Rrtype = dns.TypeDS
+		return ds, nil
+	}
+	return nil, fmt.Errorf("不支持的类型")
+}
+
+// IPv9地址由8段32位十进制数组成，以"["分隔，"n]"表示压缩了n段0，最后一段可以是IPv4地址
+func packIPv9(address string) ([]byte, error) {
+	var segments []uint32
+	for _, item := range gstr.Split(address, "[") {
+		if gstr.Contains(item, "]") {
+			compressItems := gstr.Split(item, "]")
+			compressLen, err := strconv.Atoi(compressItems[0])
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < compressLen; i++ {
+				segments = append(segments, 0)
+			}
+			item = compressItems[1]
+		}
+		if ip := net.ParseIP(item).To4(); ip != nil {
+			segments = append(segments, uint32(ip[0])<<24|uint32(ip[1])<<16|uint32(ip[2])<<8|uint32(ip[3]))
+			continue
+		}
+		value, err := strconv.ParseUint(item, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("data is not a valid IPv9 address")
+		}
+		segments = append(segments, uint32(value))
+	}
+	if len(segments) != 8 {
+		return nil, fmt.Errorf("data is not a valid IPv9 address,IPv9地址段不等于8段")
+	}
+	wire := make([]byte, 0, 32)
+	for _, seg := range segments {
+		wire = append(wire, byte(seg>>24), byte(seg>>16), byte(seg>>8), byte(seg))
+	}
+	return wire, nil
+}
+
+func unpackIPv9(rdata string) string {
+	wire, err := hex.DecodeString(rdata)
+	if err != nil || len(wire) != 32 {
+		return rdata
+	}
+	var items []string
+	for i := 0; i < 32; i += 4 {
+		seg := uint32(wire[i])<<24 | uint32(wire[i+1])<<16 | uint32(wire[i+2])<<8 | uint32(wire[i+3])
+		items = append(items, strconv.FormatUint(uint64(seg), 10))
+	}
+	return strings.Join(items, "[")
+}
+
+type keyRequest struct {
+	KeyTag uint16 `json:"keyTag"`
+	Role   string `json:"role"`
+}
+
+// 轮换时间计算所需的zone参数：SOA各项以及zone中最大的TTL
+func (p *ChnZone) zoneTiming() (dnssec.ZoneTiming, error) {
+	soa, err := p.readSOA()
+	if err != nil {
+		return dnssec.ZoneTiming{}, err
+	}
+	timing := dnssec.ZoneTiming{
+		MaxTTL:  soa.Hdr.Ttl,
+		Refresh: soa.Refresh,
+		Retry:   soa.Retry,
+		Expire:  soa.Expire,
+		Minimum: soa.Minttl,
+	}
+	for _, record := range p.listDNSRecords() {
+		ttl, err := strconv.ParseUint(record.TTL, 10, 32)
+		if err == nil && uint32(ttl) > timing.MaxTTL {
+			timing.MaxTTL = uint32(ttl)
+		}
+	}
+	return timing, nil
+}
+
+// 推进密钥轮换，密钥状态变化后由ResignZone重新签名
+func (p *ChnZone) RunKeyRollover() error {
+	if p.signer == nil {
+		return nil
+	}
+	timing, err := p.zoneTiming()
+	if err != nil {
+		return err
+	}
+	_, err = p.signer.Rollover(time.Now().UTC(), timing)
+	return err
+}
+
+func (p *ChnZone) QueryKeyStatus() ([]dnssec.KeyStatus, error) {
+	if p.signer == nil {
+		return nil, fmt.Errorf("DNSSEC未启用")
+	}
+	timing, err := p.zoneTiming()
+	if err != nil {
+		return nil, err
+	}
+	return p.signer.KeyStatus(time.Now().UTC(), timing), nil
+}
+
+// 手动开始轮换，请求格式{"role":"ZSK"}
+func (p *ChnZone) StartKeyRollover(jsonReq string) error {
+	if p.signer == nil {
+		return fmt.Errorf("DNSSEC未启用")
+	}
+	var req keyRequest
+	err := json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonRecord:", err)
+		return err
+	}
+	_, err = p.signer.StartRollover(req.Role, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	// 递增serial
+	err = p.incrementSerial()
+	if err != nil {
+		fmt.Println("Error increment serial:", err)
+		return err
+	}
+	return p.WriteZoneFile()
+}
+
+// 确认新KSK的DS已在父区发布，请求格式{"keyTag":12345}
+func (p *ChnZone) ConfirmDSPublished(jsonReq string) error {
+	if p.signer == nil {
+		return fmt.Errorf("DNSSEC未启用")
+	}
+	var req keyRequest
+	err := json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonRecord:", err)
+		return err
+	}
+	return p.signer.ConfirmDSPublished(req.KeyTag, time.Now().UTC())
+}
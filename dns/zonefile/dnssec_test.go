@@ -0,0 +1,35 @@
+package zonefile
+
+import (
+	"testing"
+)
+
+func TestToRRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		count   int
+		wantErr bool
+	}{
+		{"valid records", []string{"www 600 IN A 192.0.2.1", `txt 600 IN TXT "a" "b"`, "mail 600 IN MX 10 mx.chn."}, 4, false},
+		// 无法转换的记录不能被跳过，否则签名后的zone会缺少记录
+		{"bad address", []string{"www 600 IN A 192.0.2.1", "bad 600 IN A not-an-ip"}, 0, true},
+		{"unknown type", []string{"cntest 600 CNAME IN www.163.com."}, 0, true},
+		{"mx without priority", []string{"www 600 IN A 192.0.2.1", "jlmag.jlmag 600 IN MX jlmag"}, 0, true},
+		{"too few fields", []string{"www 600 IN A"}, 0, true},
+		{"txt without quotes", []string{"txt 600 IN TXT abc"}, 0, true},
+		{"comments and directives", []string{"; comment", "", "$TTL 600", "www 600 IN A 192.0.2.1 ; id=00000000000000a1"}, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestZone(t, tt.lines...)
+			rrs, err := p.toRRs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toRRs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(rrs) != tt.count {
+				t.Errorf("toRRs() 返回%d条记录，应为%d条", len(rrs), tt.count)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package zonefile
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"newCHNTLDManager/dns/resolver"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/miekg/dns"
+)
+
+// DS管理配置，对应config.yaml中的ds节点
+type DSConfig struct {
+	// 添加DS时是否向子域查询DNSKEY确认匹配
+	VerifyDNSKEY bool `json:"verifyDNSKEY"`
+	// 递归解析器地址，host:port
+	Resolver string `json:"resolver"`
+	Timeout  string `json:"timeout"`
+	// 是否定期扫描子域的CDS/CDNSKEY
+	CDSScan         bool   `json:"cdsScan"`
+	CDSScanInterval string `json:"cdsScanInterval"`
+	// 只接受解析器已验证(AD)的CDS/CDNSKEY
+	CDSRequireAD bool `json:"cdsRequireAD"`
+
+	timeout         time.Duration
+	cdsScanInterval time.Duration
+}
+
+// 读取ds配置并补齐默认值
+func LoadDSConfig(ctx context.Context) (DSConfig, error) {
+	cfg := DSConfig{
+		Resolver:        "127.0.0.1:53",
+		Timeout:         "5s",
+		CDSScanInterval: "6h",
+		CDSRequireAD:    true,
+	}
+	v, err := g.Cfg().Get(ctx, "ds")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+		return cfg, fmt.Errorf("ds.timeout 格式错误: %v", err)
+	}
+	if cfg.cdsScanInterval, err = time.ParseDuration(cfg.CDSScanInterval); err != nil {
+		return cfg, fmt.Errorf("ds.cdsScanInterval 格式错误: %v", err)
+	}
+	return cfg, nil
+}
+
+func (c DSConfig) CDSScanIntervalDuration() time.Duration {
+	return c.cdsScanInterval
+}
+
+// CDS扫描的结果
+type cdsChange struct {
+	DomainName string   `json:"domainName"`
+	Action     string   `json:"action"`
+	OldDS      []string `json:"oldDS"`
+	NewDS      []string `json:"newDS"`
+	Msg        string   `json:"msg,omitempty"`
+}
+
+func (p *ChnZone) SetDSConfig(cfg DSConfig) {
+	p.dsConfig = cfg
+}
+
+func (p *ChnZone) resolver() *resolver.Resolver {
+	return resolver.New(p.dsConfig.Resolver, p.dsConfig.timeout)
+}
+
+// 检查DS记录：data格式为"keyTag algorithm digestType digest"，检查通过后把data规范化
+func (p *ChnZone) checkDSRecord(record *dnsRecord) error {
+	ds, err := parseDSData(record.Data)
+	if err != nil {
+		return err
+	}
+	record.Data = dsData(ds)
+	if !p.isDelegation(record.DomainName) {
+		return fmt.Errorf("DS记录只能添加在委派点，%s 没有NS记录", record.DomainName)
+	}
+	if p.dsConfig.VerifyDNSKEY {
+		return p.verifyDSWithDNSKEY(p.qualify(record.DomainName, p.getOrigin()), []*dns.DS{ds})
+	}
+	return nil
+}
+
+func parseDSData(data string) (*dns.DS, error) {
+	items := gstr.SplitAndTrim(data, " ")
+	if len(items) < 4 {
+		return nil, fmt.Errorf("DS数据格式应为: keyTag algorithm digestType digest")
+	}
+	keyTag, err := strconv.ParseUint(items[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("DS keyTag 必须是0-65535的数字")
+	}
+	algorithm, err := strconv.ParseUint(items[1], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("DS algorithm 必须是数字")
+	}
+	switch uint8(algorithm) {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512, dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519, dns.ED448:
+	default:
+		return nil, fmt.Errorf("不支持的DS algorithm %d", algorithm)
+	}
+	digestType, err := strconv.ParseUint(items[2], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("DS digestType 必须是数字")
+	}
+	// 摘要允许分段书写
+	digest := strings.ToUpper(strings.Join(items[3:], ""))
+	digestLen := map[uint8]int{dns.SHA1: 40, dns.SHA256: 64, dns.SHA384: 96}
+	expectLen, ok := digestLen[uint8(digestType)]
+	if !ok {
+		return nil, fmt.Errorf("不支持的DS digestType %d", digestType)
+	}
+	if _, err = hex.DecodeString(digest); err != nil || len(digest) != expectLen {
+		return nil, fmt.Errorf("DS digest 必须是%d位十六进制", expectLen)
+	}
+	return &dns.DS{
+		KeyTag:     uint16(keyTag),
+		Algorithm:  uint8(algorithm),
+		DigestType: uint8(digestType),
+		Digest:     digest,
+	}, nil
+}
+
+func dsData(ds *dns.DS) string {
+	return fmt.Sprintf("%d %d %d %s", ds.KeyTag, ds.Algorithm, ds.DigestType, strings.ToUpper(ds.Digest))
+}
+
+// 非apex且有NS记录的域名是委派点
+func (p *ChnZone) isDelegation(domainName string) bool {
+	return p.delegationSet(p.listDNSRecords()).isDelegation(domainName)
+}
+
+// 向子域查询DNSKEY，确认每个DS都能匹配到一个DNSKEY，name为绝对域名
+func (p *ChnZone) verifyDSWithDNSKEY(name string, dsList []*dns.DS) error {
+	in, err := p.resolver().Query(name, dns.TypeDNSKEY)
+	if err != nil {
+		return fmt.Errorf("查询%s的DNSKEY失败: %v", name, err)
+	}
+	var keys []*dns.DNSKEY
+	for _, rr := range in.Answer {
+		if key, ok := rr.(*dns.DNSKEY); ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%s 没有DNSKEY记录", name)
+	}
+	for _, ds := range dsList {
+		matched := false
+		for _, key := range keys {
+			if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+				continue
+			}
+			if expect := key.ToDS(ds.DigestType); expect != nil && strings.EqualFold(expect.Digest, ds.Digest) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("DS %s 与 %s 的DNSKEY不匹配", dsData(ds), name)
+		}
+	}
+	return nil
+}
+
+func (p *ChnZone) addDSRecord(record dnsRecord) error {
+	strRecord, err := p.renderRecord(record)
+	if err != nil {
+		return err
+	}
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		if e.Value.(string) == "; Nameservers" {
+			p.insertLine(e, strRecord)
+			return nil
+		}
+	}
+	return fmt.Errorf("not found Nameservers area")
+}
+
+// CDS扫描中一个委派的快照和查询结果
+type cdsScan struct {
+	domainName string
+	// 绝对域名
+	name string
+	// 扫描开始时的DS
+	current []dnsRecord
+	wanted  []*dns.DS
+	// 子域发布了algorithm为0的CDS/CDNSKEY，要求删除DS
+	deleteAll bool
+	err       error
+}
+
+// 扫描所有委派的CDS/CDNSKEY（RFC 7344/8078），按子域的要求更新或删除DS。
+// 与委派健康检查一样，只在读取快照和修改zone时持有lock，网络查询期间不持有
+func (p *ChnZone) ScanCDS(lock sync.Locker) ([]cdsChange, error) {
+	lock.Lock()
+	scans := p.prepareCDSScan()
+	lock.Unlock()
+
+	for i := range scans {
+		p.queryCDS(&scans[i])
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	return p.applyCDS(scans)
+}
+
+// 需要扫描的委派及其当前的DS，锁定的委派不按CDS修改DS
+func (p *ChnZone) prepareCDSScan() []cdsScan {
+	origin := p.getOrigin()
+	var names []string
+	currentDS := map[string][]dnsRecord{}
+	for _, record := range p.listDNSRecords() {
+		if record.Type == "NS" && record.DomainName != "@" && currentDS[record.DomainName] == nil {
+			names = append(names, record.DomainName)
+			currentDS[record.DomainName] = []dnsRecord{}
+		}
+	}
+	for _, record := range p.listDNSRecords() {
+		if record.Type == "DS" && currentDS[record.DomainName] != nil {
+			currentDS[record.DomainName] = append(currentDS[record.DomainName], record)
+		}
+	}
+	var scans []cdsScan
+	for _, domainName := range names {
+		if p.checkDomainStatus(domainName) != nil {
+			continue
+		}
+		scans = append(scans, cdsScan{
+			domainName: domainName,
+			name:       p.qualify(domainName, origin),
+			current:    currentDS[domainName],
+		})
+	}
+	return scans
+}
+
+// 查询子域的CDS，没有时查询CDNSKEY；需要修改DS时确认CDS与子域的DNSKEY匹配。只访问网络，不读写zone
+func (p *ChnZone) queryCDS(scan *cdsScan) {
+	r := p.resolver()
+	in, err := r.Query(scan.name, dns.TypeCDS)
+	if err != nil {
+		scan.err = err
+		return
+	}
+	if len(in.Answer) > 0 && p.dsConfig.CDSRequireAD && !in.AuthenticatedData {
+		scan.err = fmt.Errorf("%s 的CDS未通过DNSSEC验证", scan.name)
+		return
+	}
+	for _, rr := range in.Answer {
+		if cds, ok := rr.(*dns.CDS); ok {
+			if cds.Algorithm == 0 {
+				scan.deleteAll = true
+				continue
+			}
+			ds := cds.DS
+			scan.wanted = append(scan.wanted, &ds)
+		}
+	}
+	if len(scan.wanted) == 0 && !scan.deleteAll {
+		in, err = r.Query(scan.name, dns.TypeCDNSKEY)
+		if err != nil {
+			scan.err = err
+			return
+		}
+		if len(in.Answer) > 0 && p.dsConfig.CDSRequireAD && !in.AuthenticatedData {
+			scan.err = fmt.Errorf("%s 的CDNSKEY未通过DNSSEC验证", scan.name)
+			return
+		}
+		for _, rr := range in.Answer {
+			if cdnskey, ok := rr.(*dns.CDNSKEY); ok {
+				if cdnskey.Algorithm == 0 {
+					scan.deleteAll = true
+					continue
+				}
+				if ds := cdnskey.DNSKEY.ToDS(dns.SHA256); ds != nil {
+					scan.wanted = append(scan.wanted, ds)
+				}
+			}
+		}
+	}
+	if scan.deleteAll || len(scan.wanted) == 0 || sameDSSet(scan.current, scan.wanted) {
+		return
+	}
+	// CDS必须对应子域当前发布的DNSKEY
+	scan.err = p.verifyDSWithDNSKEY(scan.name, scan.wanted)
+}
+
+// 按查询结果修改DS。扫描期间委派被删除、被锁定或DS被修改的，放弃本次结果
+func (p *ChnZone) applyCDS(scans []cdsScan) ([]cdsChange, error) {
+	var changes []cdsChange
+	applied := false
+	// 只修改DS，委派点在应用期间不变
+	set := p.delegationSet(p.listDNSRecords())
+	for _, scan := range scans {
+		if scan.err != nil {
+			changes = append(changes, cdsChange{DomainName: scan.domainName, Action: "error", Msg: scan.err.Error()})
+			continue
+		}
+		var oldData []string
+		for _, record := range scan.current {
+			oldData = append(oldData, record.Data)
+		}
+		if scan.deleteAll && len(scan.current) == 0 {
+			continue
+		}
+		if !scan.deleteAll && (len(scan.wanted) == 0 || sameDSSet(scan.current, scan.wanted)) {
+			continue
+		}
+		var newData []string
+		for _, ds := range scan.wanted {
+			newData = append(newData, dsData(ds))
+		}
+		if scan.deleteAll {
+			newData = nil
+		}
+		if !set.isDelegation(scan.domainName) || p.checkDomainStatus(scan.domainName) != nil || !p.sameStoredDS(scan.domainName, scan.current) {
+			changes = append(changes, cdsChange{DomainName: scan.domainName, Action: "skip", OldDS: oldData, NewDS: newData, Msg: "扫描期间委派或DS已被修改"})
+			continue
+		}
+		ttl := "86400"
+		if len(scan.current) > 0 {
+			ttl = scan.current[0].TTL
+		}
+		for _, record := range scan.current {
+			if err := p.removeStoredRecord(record); err != nil {
+				return changes, err
+			}
+		}
+		for _, data := range newData {
+			if err := p.addDSRecord(dnsRecord{DomainName: scan.domainName, TTL: ttl, Type: "DS", Data: data}); err != nil {
+				return changes, err
+			}
+		}
+		applied = true
+		if scan.deleteAll {
+			changes = append(changes, cdsChange{DomainName: scan.domainName, Action: "delete", OldDS: oldData})
+		} else {
+			changes = append(changes, cdsChange{DomainName: scan.domainName, Action: "update", OldDS: oldData, NewDS: newData})
+		}
+	}
+	if !applied {
+		return changes, nil
+	}
+	// 递增serial
+	err := p.incrementSerial()
+	if err != nil {
+		fmt.Println("Error increment serial:", err)
+		return changes, err
+	}
+	return changes, p.WriteZoneFile()
+}
+
+// 当前DS与wanted是否为同一集合
+func sameDSSet(current []dnsRecord, wanted []*dns.DS) bool {
+	if len(current) != len(wanted) {
+		return false
+	}
+	have := map[string]bool{}
+	for _, record := range current {
+		have[record.Data] = true
+	}
+	for _, ds := range wanted {
+		if !have[dsData(ds)] {
+			return false
+		}
+	}
+	return true
+}
+
+// zone中domainName的DS是否仍与扫描开始时相同
+func (p *ChnZone) sameStoredDS(domainName string, snapshot []dnsRecord) bool {
+	var stored []dnsRecord
+	for _, record := range p.listDNSRecords() {
+		if record.Type == "DS" && record.DomainName == domainName {
+			stored = append(stored, record)
+		}
+	}
+	if len(stored) != len(snapshot) {
+		return false
+	}
+	have := map[string]bool{}
+	for _, record := range snapshot {
+		have[record.TTL+" "+record.Data] = true
+	}
+	for _, record := range stored {
+		if !have[record.TTL+" "+record.Data] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package zonefile
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseDSData(t *testing.T) {
+	digest256 := strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{"sha256", "12345 13 2 " + digest256, "12345 13 2 " + strings.ToUpper(digest256), false},
+		{"split digest", "12345 13 2 " + digest256[:32] + " " + digest256[32:], "12345 13 2 " + strings.ToUpper(digest256), false},
+		{"sha1", "1 8 1 " + strings.Repeat("0", 40), "1 8 1 " + strings.Repeat("0", 40), false},
+		{"sha384", "1 14 4 " + strings.Repeat("F", 96), "1 14 4 " + strings.Repeat("F", 96), false},
+		{"too few fields", "12345 13 2", "", true},
+		{"key tag out of range", "65536 13 2 " + digest256, "", true},
+		{"unknown algorithm", "12345 99 2 " + digest256, "", true},
+		{"unknown digest type", "12345 13 3 " + digest256, "", true},
+		{"digest length", "12345 13 2 " + digest256[:62], "", true},
+		{"digest not hex", "12345 13 2 " + strings.Repeat("zz", 32), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds, err := parseDSData(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDSData(%q) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+			}
+			if err == nil && dsData(ds) != tt.want {
+				t.Errorf("dsData = %q，应为 %q", dsData(ds), tt.want)
+			}
+		})
+	}
+}
+
+// 子域child.chn.的替身服务器，发布一个KSK和对应的CDS
+func cdsServer(t *testing.T, key *dns.DNSKEY, deleteAll bool) string {
+	t.Helper()
+	return startTestDNS(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		hdr := dns.RR_Header{Name: req.Question[0].Name, Class: dns.ClassINET, Ttl: 300}
+		switch req.Question[0].Qtype {
+		case dns.TypeCDS:
+			hdr.Rrtype = dns.TypeCDS
+			if deleteAll {
+				m.Answer = append(m.Answer, &dns.CDS{DS: dns.DS{Hdr: hdr, DigestType: 0, Digest: "00"}})
+			} else {
+				m.Answer = append(m.Answer, &dns.CDS{DS: *key.ToDS(dns.SHA256)})
+				m.Answer[0].Header().Rrtype = dns.TypeCDS
+			}
+		case dns.TypeDNSKEY:
+			m.Answer = append(m.Answer, key)
+		}
+		w.WriteMsg(m)
+	})
+}
+
+func testKSK(t *testing.T) *dns.DNSKEY {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "child.chn.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 300},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	if _, err := key.Generate(256); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func dsOf(p *ChnZone, domainName string) []string {
+	var res []string
+	for _, record := range p.listDNSRecords() {
+		if record.Type == "DS" && record.DomainName == domainName {
+			res = append(res, record.Data)
+		}
+	}
+	return res
+}
+
+func TestScanCDS(t *testing.T) {
+	oldDS := "1 13 2 " + strings.Repeat("AB", 32)
+	tests := []struct {
+		name      string
+		deleteAll bool
+		action    string
+		wantDS    func(key *dns.DNSKEY) []string
+	}{
+		{"update", false, "update", func(key *dns.DNSKEY) []string { return []string{dsData(key.ToDS(dns.SHA256))} }},
+		{"delete", true, "delete", func(key *dns.DNSKEY) []string { return nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := testKSK(t)
+			p := newTestZone(t,
+				"child 600 IN NS ns1.example.net.",
+				"child 600 IN DS "+oldDS,
+			)
+			p.SetDSConfig(DSConfig{Resolver: cdsServer(t, key, tt.deleteAll), timeout: time.Second})
+			changes, err := p.ScanCDS(new(sync.Mutex))
+			if err != nil {
+				t.Fatalf("ScanCDS: %v", err)
+			}
+			if len(changes) != 1 || changes[0].Action != tt.action {
+				t.Fatalf("changes = %+v，应为一条%s", changes, tt.action)
+			}
+			if got, want := dsOf(p, "child"), tt.wantDS(key); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("DS = %v，应为 %v", got, want)
+			}
+		})
+	}
+}
+
+// 网络查询期间DS被其他请求修改时，放弃本次扫描结果
+func TestScanCDSSkipsConcurrentChange(t *testing.T) {
+	key := testKSK(t)
+	p := newTestZone(t,
+		"child 600 IN NS ns1.example.net.",
+		"child 600 IN DS 1 13 2 "+strings.Repeat("AB", 32),
+	)
+	p.SetDSConfig(DSConfig{Resolver: cdsServer(t, key, false), timeout: time.Second})
+	scans := p.prepareCDSScan()
+	for i := range scans {
+		p.queryCDS(&scans[i])
+	}
+	manual := "2 13 2 " + strings.Repeat("CD", 32)
+	if err := p.removeStoredRecord(dnsRecord{DomainName: "child", Type: "DS", Data: "1 13 2 " + strings.Repeat("AB", 32)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.addDSRecord(dnsRecord{DomainName: "child", TTL: "600", Type: "DS", Data: manual}); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := p.applyCDS(scans)
+	if err != nil {
+		t.Fatalf("applyCDS: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Action != "skip" {
+		t.Fatalf("changes = %+v，应为一条skip", changes)
+	}
+	if got := dsOf(p, "child"); len(got) != 1 || got[0] != manual {
+		t.Errorf("DS = %v，应保留手工修改的 %s", got, manual)
+	}
+}
+
+// 扫描期间不持有lock：查询CDS时另一个goroutine可以取得lock
+func TestScanCDSReleasesLock(t *testing.T) {
+	key := testKSK(t)
+	lock := new(sync.Mutex)
+	queried := make(chan struct{})
+	release := make(chan struct{})
+	addr := startTestDNS(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Qtype == dns.TypeCDS {
+			close(queried)
+			<-release
+		}
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if req.Question[0].Qtype == dns.TypeDNSKEY {
+			m.Answer = append(m.Answer, key)
+		}
+		w.WriteMsg(m)
+	})
+	p := newTestZone(t, "child 600 IN NS ns1.example.net.")
+	p.SetDSConfig(DSConfig{Resolver: addr, timeout: 5 * time.Second})
+	done := make(chan error)
+	go func() {
+		_, err := p.ScanCDS(lock)
+		done <- err
+	}()
+	<-queried
+	lock.Lock()
+	lock.Unlock()
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("ScanCDS: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 错误类别，REST接口据此返回对应的HTTP状态码
+type ErrorKind int
+
+const (
+	ErrUnknown ErrorKind = iota
+	// 记录不存在
+	ErrNotFound
+	// 记录已存在
+	ErrExists
+	// 域名已锁定或暂停解析
+	ErrProhibited
+	// 写zone文件、状态文件或签名失败，不是请求的问题
+	ErrInternal
+)
+
+type Error struct {
+	Kind ErrorKind
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func errorf(kind ErrorKind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// 内部错误保留原来的错误信息
+func internalError(err error) error {
+	if err == nil || KindOf(err) != ErrUnknown {
+		return err
+	}
+	return &Error{Kind: ErrInternal, Msg: err.Error()}
+}
+
+// 取得错误类别，非zonefile错误返回ErrUnknown
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return ErrUnknown
+}
@@ -0,0 +1,45 @@
+package zonefile
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// 请求不合法的错误没有类别，写文件失败是ErrInternal
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		name string
+		// zone文件所在目录不存在，使写文件失败
+		badPath bool
+		record  string
+		want    ErrorKind
+	}{
+		{name: "ok", record: `{"domainName":"www","ttl":"600","type":"A","data":"192.0.2.1"}`},
+		{name: "invalid data", record: `{"domainName":"www","ttl":"600","type":"A","data":"not-an-ip"}`, want: ErrUnknown},
+		{name: "write fails", badPath: true, record: `{"domainName":"www","ttl":"600","type":"A","data":"192.0.2.1"}`, want: ErrInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestZone(t)
+			if tt.badPath {
+				p.zoneFile = filepath.Join(t.TempDir(), "missing", "chn.zone")
+			}
+			_, err := p.CreateRecord(tt.record)
+			if tt.name == "ok" {
+				if err != nil {
+					t.Fatalf("CreateRecord: %v", err)
+				}
+				return
+			}
+			if err == nil || KindOf(err) != tt.want {
+				t.Errorf("CreateRecord error = %v，类别为%d，应为%d", err, KindOf(err), tt.want)
+			}
+		})
+	}
+	if internalError(nil) != nil {
+		t.Error("internalError(nil) 应为nil")
+	}
+	if err := internalError(errorf(ErrNotFound, "x")); KindOf(err) != ErrNotFound {
+		t.Errorf("已有类别的错误不应改为ErrInternal: %v", err)
+	}
+}
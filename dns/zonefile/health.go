@@ -0,0 +1,285 @@
+package zonefile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"newCHNTLDManager/dns/resolver"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/miekg/dns"
+)
+
+// 委派健康检查配置，对应config.yaml中的health节点
+type HealthConfig struct {
+	Enabled bool `json:"enabled"`
+	// 解析zone外NS主机地址用的递归解析器，host:port
+	Resolver string `json:"resolver"`
+	// 向子域NS发起查询的端口，测试时可配合本地替身服务器使用
+	ServerPort   string `json:"serverPort"`
+	Timeout      string `json:"timeout"`
+	ScanInterval string `json:"scanInterval"`
+
+	timeout      time.Duration
+	scanInterval time.Duration
+}
+
+// 读取health配置并补齐默认值
+func LoadHealthConfig(ctx context.Context) (HealthConfig, error) {
+	cfg := HealthConfig{
+		Resolver:     "127.0.0.1:53",
+		ServerPort:   "53",
+		Timeout:      "5s",
+		ScanInterval: "6h",
+	}
+	v, err := g.Cfg().Get(ctx, "health")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+		return cfg, fmt.Errorf("health.timeout 格式错误: %v", err)
+	}
+	if cfg.scanInterval, err = time.ParseDuration(cfg.ScanInterval); err != nil {
+		return cfg, fmt.Errorf("health.scanInterval 格式错误: %v", err)
+	}
+	return cfg, nil
+}
+
+func (c HealthConfig) ScanIntervalDuration() time.Duration {
+	return c.scanInterval
+}
+
+// 一个委派的检查结果
+type healthReport struct {
+	DomainName string         `json:"domainName"`
+	CheckedAt  time.Time      `json:"checkedAt"`
+	Status     string         `json:"status"`
+	ParentNS   []string       `json:"parentNS"`
+	Servers    []serverReport `json:"servers"`
+	Problems   []string       `json:"problems"`
+}
+
+// 单个NS地址的检查结果
+type serverReport struct {
+	Name    string   `json:"name"`
+	Address string   `json:"address"`
+	Lame    bool     `json:"lame"`
+	Serial  uint32   `json:"serial,omitempty"`
+	ChildNS []string `json:"childNS,omitempty"`
+	Msg     string   `json:"msg,omitempty"`
+}
+
+const (
+	healthOK      = "ok"
+	healthWarning = "warning"
+	healthError   = "error"
+)
+
+// 保存最近一次的检查结果，扫描不持有mLock，结果单独加锁
+type healthStore struct {
+	lock    sync.RWMutex
+	reports map[string]healthReport
+}
+
+func (p *ChnZone) SetHealthConfig(cfg HealthConfig) {
+	p.healthConfig = cfg
+}
+
+// 检查给定的委派，origin和delegations应在持有mLock时通过Origin和QueryDelegation取得，
+// 检查期间不读取zone；all为true表示delegations是全部委派，此时丢弃已删除委派的旧结果
+func (p *ChnZone) ScanDelegationHealth(origin string, delegations []delegation, all bool) []healthReport {
+	var reports []healthReport
+	for _, d := range delegations {
+		report := p.checkDelegationHealth(origin, d)
+		reports = append(reports, report)
+		if report.Status != healthOK {
+			fmt.Println("delegation health:", report.DomainName, report.Status, report.Problems)
+		}
+	}
+	p.health.lock.Lock()
+	if p.health.reports == nil || all {
+		p.health.reports = map[string]healthReport{}
+	}
+	for _, report := range reports {
+		p.health.reports[strings.ToLower(report.DomainName)] = report
+	}
+	p.health.lock.Unlock()
+	return reports
+}
+
+// 查询最近一次检查结果，domainName为空时返回全部
+func (p *ChnZone) QueryDelegationHealth(jsonReq string) ([]healthReport, error) {
+	var req delegation
+	if jsonReq != "" {
+		err := json.Unmarshal([]byte(jsonReq), &req)
+		if err != nil {
+			fmt.Println("Error unmarshal jsonRecord:", err)
+			return nil, err
+		}
+	}
+	name := strings.ToLower(gstr.Trim(req.DomainName))
+	p.health.lock.RLock()
+	defer p.health.lock.RUnlock()
+	var res []healthReport
+	for key, report := range p.health.reports {
+		if name == "" || key == name {
+			res = append(res, report)
+		}
+	}
+	if name != "" && len(res) == 0 {
+		return nil, fmt.Errorf("%s 尚未检查", req.DomainName)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].DomainName < res[j].DomainName })
+	return res, nil
+}
+
+func (p *ChnZone) checkDelegationHealth(origin string, d delegation) healthReport {
+	child := p.qualify(d.DomainName, origin)
+	report := healthReport{
+		DomainName: d.DomainName,
+		CheckedAt:  time.Now(),
+		Status:     healthOK,
+	}
+	r := resolver.New(p.healthConfig.Resolver, p.healthConfig.timeout)
+	parentNS := map[string]bool{}
+	for _, ns := range d.NameServers {
+		parentNS[strings.ToLower(dns.Fqdn(ns.Name))] = true
+		report.ParentNS = append(report.ParentNS, strings.ToLower(dns.Fqdn(ns.Name)))
+	}
+	sort.Strings(report.ParentNS)
+
+	answered := 0
+	serials := map[uint32]bool{}
+	for _, ns := range d.NameServers {
+		name := strings.ToLower(dns.Fqdn(ns.Name))
+		addresses := p.nameServerAddresses(r, ns)
+		if len(addresses) == 0 {
+			report.Servers = append(report.Servers, serverReport{Name: name, Lame: true, Msg: "无法解析NS主机地址"})
+			report.Problems = append(report.Problems, fmt.Sprintf("NS %s 无法解析地址", name))
+			continue
+		}
+		for _, addr := range addresses {
+			server := p.checkServer(r, child, name, addr)
+			report.Servers = append(report.Servers, server)
+			if server.Lame {
+				report.Problems = append(report.Problems, fmt.Sprintf("NS %s(%s) 不能权威应答: %s", name, addr, server.Msg))
+				continue
+			}
+			answered++
+			serials[server.Serial] = true
+			if !sameNSSet(parentNS, server.ChildNS) {
+				report.Problems = append(report.Problems, fmt.Sprintf("NS %s(%s) 返回的NS集合 %v 与父区 %v 不一致", name, addr, server.ChildNS, report.ParentNS))
+			}
+		}
+	}
+	if len(serials) > 1 {
+		var list []string
+		for _, server := range report.Servers {
+			if !server.Lame {
+				list = append(list, fmt.Sprintf("%s=%d", server.Address, server.Serial))
+			}
+		}
+		report.Problems = append(report.Problems, "各NS的SOA serial不一致: "+strings.Join(list, ", "))
+	}
+	switch {
+	case answered == 0:
+		report.Status = healthError
+	case len(report.Problems) > 0:
+		report.Status = healthWarning
+	}
+	return report
+}
+
+// NS主机的地址：优先使用zone中的胶水，否则通过解析器查询；A9地址无法查询，忽略
+func (p *ChnZone) nameServerAddresses(r *resolver.Resolver, ns nameServer) []string {
+	var addresses []string
+	for _, addr := range ns.Addresses {
+		if net.ParseIP(addr) != nil {
+			addresses = append(addresses, addr)
+		}
+	}
+	if len(ns.Addresses) > 0 {
+		return addresses
+	}
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		in, err := r.Query(ns.Name, qtype)
+		if err != nil {
+			continue
+		}
+		for _, rr := range in.Answer {
+			switch v := rr.(type) {
+			case *dns.A:
+				addresses = append(addresses, v.A.String())
+			case *dns.AAAA:
+				addresses = append(addresses, v.AAAA.String())
+			}
+		}
+	}
+	return addresses
+}
+
+// 向单个NS地址查询子域的SOA和NS，没有权威应答即为lame
+func (p *ChnZone) checkServer(r *resolver.Resolver, child string, name string, addr string) serverReport {
+	server := serverReport{Name: name, Address: addr}
+	target := net.JoinHostPort(addr, p.healthConfig.ServerPort)
+	in, err := r.QueryAuthoritative(target, child, dns.TypeSOA)
+	if err != nil {
+		server.Lame = true
+		server.Msg = err.Error()
+		return server
+	}
+	if !in.Authoritative {
+		server.Lame = true
+		server.Msg = "响应没有AA标志"
+		return server
+	}
+	var soa *dns.SOA
+	for _, rr := range in.Answer {
+		if v, ok := rr.(*dns.SOA); ok && strings.EqualFold(v.Hdr.Name, child) {
+			soa = v
+		}
+	}
+	if soa == nil {
+		server.Lame = true
+		server.Msg = "没有返回子域的SOA"
+		return server
+	}
+	server.Serial = soa.Serial
+
+	in, err = r.QueryAuthoritative(target, child, dns.TypeNS)
+	if err != nil {
+		server.Msg = "查询NS失败: " + err.Error()
+		return server
+	}
+	for _, rr := range in.Answer {
+		if v, ok := rr.(*dns.NS); ok {
+			server.ChildNS = append(server.ChildNS, strings.ToLower(dns.Fqdn(v.Ns)))
+		}
+	}
+	sort.Strings(server.ChildNS)
+	return server
+}
+
+func sameNSSet(parent map[string]bool, child []string) bool {
+	if len(parent) != len(child) {
+		return false
+	}
+	for _, ns := range child {
+		if !parent[ns] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package zonefile
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// 子域child.chn.的替身NS，aa为false时模拟lame，ns为返回的NS集合
+func childServer(t *testing.T, aa bool, ns ...string) string {
+	t.Helper()
+	return startTestDNS(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Authoritative = aa
+		q := req.Question[0]
+		switch q.Qtype {
+		case dns.TypeSOA:
+			m.Answer = append(m.Answer, &dns.SOA{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+				Ns:  "ns1.child.chn.", Mbox: "hostmaster.child.chn.", Serial: 2024010101,
+			})
+		case dns.TypeNS:
+			for _, name := range ns {
+				m.Answer = append(m.Answer, &dns.NS{Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: name})
+			}
+		}
+		w.WriteMsg(m)
+	})
+}
+
+// 替身递归解析器，只能解析ns.example.net.，地址为127.0.0.1
+func fakeResolver(t *testing.T) string {
+	t.Helper()
+	return startTestDNS(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		q := req.Question[0]
+		if q.Name != "ns.example.net." {
+			m.Rcode = dns.RcodeNameError
+		} else if q.Qtype == dns.TypeA {
+			m.Answer = append(m.Answer, &dns.A{Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.ParseIP("127.0.0.1")})
+		}
+		w.WriteMsg(m)
+	})
+}
+
+func TestScanDelegationHealth(t *testing.T) {
+	parentNS := []string{"ns1.child.chn.", "ns.example.net."}
+	tests := []struct {
+		name        string
+		aa          bool
+		childNS     []string
+		nameServers []nameServer
+		status      string
+		problems    int
+	}{
+		{
+			name:        "ok",
+			aa:          true,
+			childNS:     parentNS,
+			nameServers: []nameServer{{Name: "ns1.child.chn", Addresses: []string{"127.0.0.1"}}, {Name: "ns.example.net"}},
+			status:      healthOK,
+		},
+		{
+			name:        "ns set mismatch",
+			aa:          true,
+			childNS:     []string{"ns1.child.chn."},
+			nameServers: []nameServer{{Name: "ns1.child.chn", Addresses: []string{"127.0.0.1"}}, {Name: "ns.example.net"}},
+			status:      healthWarning,
+			problems:    2,
+		},
+		{
+			name:        "lame",
+			aa:          false,
+			childNS:     parentNS,
+			nameServers: []nameServer{{Name: "ns1.child.chn", Addresses: []string{"127.0.0.1"}}},
+			status:      healthError,
+			problems:    1,
+		},
+		{
+			name:        "unresolvable host",
+			aa:          true,
+			childNS:     []string{"ns.unknown.net."},
+			nameServers: []nameServer{{Name: "ns.unknown.net"}},
+			status:      healthError,
+			problems:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, port, _ := net.SplitHostPort(childServer(t, tt.aa, tt.childNS...))
+			p := newTestZone(t)
+			p.SetHealthConfig(HealthConfig{Resolver: fakeResolver(t), ServerPort: port, timeout: time.Second})
+			reports := p.ScanDelegationHealth("chn.", []delegation{{DomainName: "child", NameServers: tt.nameServers}}, true)
+			if len(reports) != 1 {
+				t.Fatalf("返回%d个结果，应为1个", len(reports))
+			}
+			report := reports[0]
+			if report.Status != tt.status || len(report.Problems) != tt.problems {
+				t.Errorf("status = %s，problems = %v，应为 %s 和%d个问题", report.Status, report.Problems, tt.status, tt.problems)
+			}
+			stored, err := p.QueryDelegationHealth(`{"domainName":"CHILD"}`)
+			if err != nil || len(stored) != 1 || stored[0].Status != tt.status {
+				t.Errorf("QueryDelegationHealth = %v, %v", stored, err)
+			}
+		})
+	}
+}
+
+func TestScanDelegationHealthDropsRemoved(t *testing.T) {
+	p := newTestZone(t)
+	p.SetHealthConfig(HealthConfig{Resolver: fakeResolver(t), ServerPort: "1", timeout: 100 * time.Millisecond})
+	p.ScanDelegationHealth("chn.", []delegation{{DomainName: "old", NameServers: []nameServer{{Name: "ns.unknown.net"}}}}, true)
+	p.ScanDelegationHealth("chn.", []delegation{{DomainName: "new", NameServers: []nameServer{{Name: "ns.unknown.net"}}}}, false)
+	if res, _ := p.QueryDelegationHealth(""); len(res) != 2 {
+		t.Errorf("只检查部分委派时应保留其他结果，得到%d个", len(res))
+	}
+	p.ScanDelegationHealth("chn.", []delegation{{DomainName: "new", NameServers: []nameServer{{Name: "ns.unknown.net"}}}}, true)
+	if _, err := p.QueryDelegationHealth(`{"domainName":"old"}`); err == nil {
+		t.Error("全部检查后应丢弃已删除委派的结果")
+	}
+}
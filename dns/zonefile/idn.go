@@ -0,0 +1,143 @@
+package zonefile
+
+import (
+	"fmt"
+	"strings"
+
+	"newCHNTLDManager/dns/idn"
+
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/miekg/dns"
+)
+
+func (p *ChnZone) SetIDN(table *idn.Table) {
+	p.idn = table
+}
+
+// 目标为域名的记录类型
+func isTargetType(recordType string) bool {
+	return recordType == "CNAME" || recordType == "NS" || recordType == "MX" || recordType == "PTR"
+}
+
+// zone的顶级域，不带点
+func (p *ChnZone) tld() string {
+	return strings.TrimSuffix(p.getOrigin(), ".")
+}
+
+// 把新增记录的名字转换为A-label后保存。owner按IDNA2008和字符表检查，目标只转换写法
+func (p *ChnZone) toALabel(record *dnsRecord) error {
+	name := gstr.Trim(record.DomainName)
+	if p.idn != nil {
+		res, err := p.idn.Name(p.tld(), name)
+		if err != nil {
+			return err
+		}
+		name = res.ALabel
+	} else {
+		name = idn.ToASCII(name)
+	}
+	record.DomainName = name
+	if isTargetType(record.Type) {
+		record.Data = idn.ToASCII(gstr.Trim(record.Data))
+	}
+	return nil
+}
+
+// 查询和删除时把名字转换为A-label，与zone中的写法比较
+func lookupALabel(record *dnsRecord) {
+	record.DomainName = idn.ToASCII(record.DomainName)
+	if isTargetType(record.Type) {
+		record.Data = idn.ToASCII(record.Data)
+	}
+}
+
+// 给查询结果补充U-label写法
+func withUnicode(record dnsRecord) dnsRecord {
+	record.UnicodeName = idn.ToUnicode(record.DomainName)
+	if isTargetType(record.Type) {
+		record.UnicodeData = idn.ToUnicode(record.Data)
+	}
+	return record
+}
+
+// 记录所属的二级label，zone apex和zone外的名字返回空字符串
+func (p *ChnZone) secondLevel(domainName string) string {
+	name := gstr.Trim(domainName)
+	if gstr.HasSuffix(name, ".") {
+		if !p.inZone(name) {
+			return ""
+		}
+		name = p.relativize(name)
+	}
+	if name == "@" {
+		return ""
+	}
+	labels := dns.SplitDomainName(name)
+	if len(labels) == 0 {
+		return ""
+	}
+	return strings.ToLower(labels[len(labels)-1])
+}
+
+// 二级label的变体已在zone中使用时拒绝，例如已有“中国”时不能再添加“中國”
+func (p *ChnZone) checkVariants(domainName string) error {
+	if p.idn == nil {
+		return nil
+	}
+	label := p.secondLevel(domainName)
+	variants := p.idn.Variants(label)
+	if len(variants) == 0 {
+		return nil
+	}
+	used := map[string]bool{}
+	for _, record := range p.listDNSRecords() {
+		used[p.secondLevel(record.DomainName)] = true
+	}
+	for _, v := range variants {
+		if used[v] {
+			return fmt.Errorf("%s 是已存在的 %s 的变体，不能添加", label, v)
+		}
+	}
+	return nil
+}
+
+// 把zone中直接以UTF-8书写的owner和目标改为A-label，返回修改的行数
+func (p *ChnZone) MigrateIDN() (int, error) {
+	count := 0
+	start := false
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		line := e.Value.(string)
+		if line == "; Nameservers" {
+			start = true
+		}
+		if !start {
+			continue
+		}
+		record, ok := parseRecordLine(line)
+		if !ok {
+			continue
+		}
+		converted := line
+		if name := idn.ToASCII(record.DomainName); name != record.DomainName {
+			converted = strings.Replace(converted, record.DomainName, name, 1)
+		}
+		if isTargetType(record.Type) {
+			if data := idn.ToASCII(record.Data); data != record.Data {
+				i := strings.LastIndex(converted, record.Data)
+				converted = converted[:i] + data + converted[i+len(record.Data):]
+			}
+		}
+		if converted != line {
+			fmt.Println("idn:", line, "=>", converted)
+			p.setLine(e, converted)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := p.incrementSerial(); err != nil {
+		return 0, err
+	}
+	return count, p.WriteZoneFile()
+}
@@ -0,0 +1,54 @@
+package zonefile
+
+import (
+	"net"
+
+	dnsname "newCHNTLDManager/dns/name"
+)
+
+// 规范化新增记录中的名字：IDN转换为A-label，owner转换为相对于$ORIGIN的小写写法，
+// CNAME、NS、MX、PTR的目标转换为小写的绝对域名，并按记录类型检查长度和主机名规则
+func (p *ChnZone) normalizeRecord(record *dnsRecord) error {
+	if err := p.toALabel(record); err != nil {
+		return err
+	}
+	origin := p.getOrigin()
+	owner, err := dnsname.Owner(record.DomainName, origin, record.Type)
+	if err != nil {
+		return err
+	}
+	record.DomainName = owner
+	if isTargetType(record.Type) {
+		target, err := dnsname.Target(record.Data, origin, record.Type)
+		if err != nil {
+			return err
+		}
+		record.Data = target
+	}
+	// IPv6地址统一为压缩的小写写法，格式错误由调用方检查
+	if record.Type == "A" || record.Type == "AAAA" {
+		if ip := net.ParseIP(record.Data); ip != nil {
+			record.Data = ip.String()
+		}
+	}
+	return nil
+}
+
+// zone中的记录与record是否相同，名字不区分大小写和相对、绝对写法
+func (p *ChnZone) sameRecord(stored dnsRecord, record dnsRecord) bool {
+	origin := p.getOrigin()
+	return stored.Type == record.Type && dnsname.Equal(stored.DomainName, record.DomainName, origin) && sameData(stored, record, origin)
+}
+
+// 目标为域名的记录按规范化后的绝对域名比较，IPv4、IPv6地址按解析后的地址比较，其他记录按原样比较
+func sameData(stored dnsRecord, record dnsRecord, origin string) bool {
+	if isTargetType(stored.Type) {
+		return dnsname.TargetFqdn(stored.Data, origin, stored.Type) == dnsname.TargetFqdn(record.Data, origin, record.Type)
+	}
+	if stored.Type == "A" || stored.Type == "AAAA" {
+		if a, b := net.ParseIP(stored.Data), net.ParseIP(record.Data); a != nil && b != nil {
+			return a.Equal(b)
+		}
+	}
+	return stored.Data == record.Data
+}
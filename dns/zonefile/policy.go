@@ -0,0 +1,18 @@
+package zonefile
+
+import (
+	"newCHNTLDManager/dns/policy"
+)
+
+func (p *ChnZone) SetPolicy(table *policy.Table) {
+	p.policy = table
+}
+
+// 记录所属的二级label在保留或禁止名单中时拒绝添加，zone apex不检查
+func (p *ChnZone) checkPolicy(domainName string) error {
+	label := p.secondLevel(domainName)
+	if label == "" {
+		return nil
+	}
+	return p.policy.Check(label)
+}
@@ -0,0 +1,164 @@
+package zonefile
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gogf/gf/v2/container/glist"
+	"github.com/miekg/dns"
+)
+
+// 以下方法供registry根据域名状态发布zone内容，只修改内存中的zone，
+// 调用方完成一批修改后调用Commit递增serial并写文件，调用方需持有mLock
+
+// 发布域名委派：替换NS集合、胶水和DS，glue的key为NS主机名。失败时zone保持不变
+func (p *ChnZone) PublishDelegation(domainName string, nameServers []string, glue map[string][]string, ds []string) error {
+	name := p.relativize(dns.Fqdn(domainName))
+	if !p.inZone(domainName) || name == "@" {
+		return fmt.Errorf("%s 不在zone %s 内", domainName, p.getOrigin())
+	}
+	req := delegation{DomainName: name}
+	// registry给出所有本顶级域内主机的地址，只有位于委派点之下的主机需要胶水，其他主机的地址记录不由委派维护
+	set := p.delegationSet(p.listDNSRecords())
+	for _, ns := range nameServers {
+		host := dns.Fqdn(ns)
+		if set.findCut(host) != "" || p.isSubName(name, host) {
+			req.NameServers = append(req.NameServers, nameServer{Name: ns, Addresses: glue[ns]})
+		} else {
+			req.NameServers = append(req.NameServers, nameServer{Name: ns})
+		}
+	}
+	var dsList []string
+	for _, data := range ds {
+		parsed, err := parseDSData(data)
+		if err != nil {
+			return err
+		}
+		dsList = append(dsList, dsData(parsed))
+	}
+
+	backup := p.snapshot()
+	err := p.setDelegation(req)
+	if err == nil {
+		err = p.replaceDS(name, dsList)
+	}
+	if err != nil {
+		p.restore(backup)
+		return err
+	}
+	return nil
+}
+
+// 撤下域名委派（NS、DS和胶水），域名没有委派时不做任何事
+func (p *ChnZone) WithdrawDelegation(domainName string) error {
+	name := p.relativize(dns.Fqdn(domainName))
+	if !p.isDelegation(name) {
+		return nil
+	}
+	backup := p.snapshot()
+	if err := p.removeDelegation(name); err != nil {
+		p.restore(backup)
+		return err
+	}
+	return nil
+}
+
+// 删除域名及其之下的所有记录
+func (p *ChnZone) PurgeDomain(domainName string) error {
+	name := p.relativize(dns.Fqdn(domainName))
+	if name == "@" {
+		return fmt.Errorf("不能删除zone apex")
+	}
+	backup := p.snapshot()
+	for _, record := range p.listDNSRecords() {
+		if record.DomainName != "@" && p.isSubName(name, record.DomainName) {
+			if err := p.removeStoredRecord(record); err != nil {
+				p.restore(backup)
+				return err
+			}
+		}
+	}
+	if _, err := p.pruneOrphanGlue(); err != nil {
+		p.restore(backup)
+		return err
+	}
+	p.clearStatuses(name)
+	return nil
+}
+
+// 递增serial并写zone文件，PurgeDomain清除过状态时同时保存状态文件。失败时写回原来的zone文件，内存中的zone恢复到Commit之前，
+// 调用方可以再调用Rollback放弃全部修改
+func (p *ChnZone) Commit() error {
+	backup := p.snapshot()
+	old, err := os.ReadFile(p.zonePath())
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error read zone file:", err)
+		return err
+	}
+	err = p.incrementSerial()
+	if err == nil {
+		err = p.WriteZoneFile()
+	}
+	if err == nil && p.statusesChanged {
+		err = p.saveStatuses()
+	}
+	if err != nil {
+		fmt.Println("Error commit zone:", err)
+		if old != nil {
+			if restoreErr := os.WriteFile(p.zonePath(), old, 0644); restoreErr != nil {
+				fmt.Println("Error restore zone file:", restoreErr)
+			}
+		}
+		p.restore(backup)
+		return err
+	}
+	p.statusesChanged = false
+	return nil
+}
+
+func (p *ChnZone) replaceDS(name string, dsList []string) error {
+	ttl := "86400"
+	for _, record := range p.listDNSRecords() {
+		if record.Type == "NS" && p.sameName(record.DomainName, name) {
+			ttl = record.TTL
+		}
+	}
+	for _, record := range p.listDNSRecords() {
+		if record.Type == "DS" && p.sameName(record.DomainName, name) {
+			if err := p.removeStoredRecord(record); err != nil {
+				return err
+			}
+		}
+	}
+	for _, data := range dsList {
+		if err := p.addDSRecord(dnsRecord{DomainName: name, TTL: ttl, Type: "DS", Data: data}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ChnZone) snapshot() []interface{} {
+	return p.runtimeZoneFileList.FrontAll()
+}
+
+func (p *ChnZone) restore(lines []interface{}) {
+	p.runtimeZoneFileList = glist.NewFrom(lines)
+	p.invalidateIndex()
+}
+
+// 放弃上次写文件之后对zone和域名状态的修改
+func (p *ChnZone) Rollback() {
+	if p.statusesChanged {
+		p.loadStatuses()
+		p.statusesChanged = false
+	}
+	list := glist.New()
+	err := p.readZoneContentFromFile(p.zonePath(), list)
+	if err != nil {
+		fmt.Println("Error read zone file:", err)
+		return
+	}
+	p.runtimeZoneFileList = list
+	p.invalidateIndex()
+}
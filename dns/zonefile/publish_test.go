@@ -0,0 +1,143 @@
+package zonefile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"newCHNTLDManager/dns/dnssec"
+
+	"github.com/miekg/dns"
+)
+
+// dom委派给host下的ns1.host，host本身是另一个委派点
+var purgeLines = []string{
+	"dom 86400 IN NS ns1.host.chn.",
+	"host 86400 IN NS ns.example.net.",
+	"ns1.host 86400 IN A 192.0.2.53",
+	"www.dom 600 IN A 192.0.2.1",
+	"keep 600 IN A 192.0.2.2",
+}
+
+func TestPurgeDomain(t *testing.T) {
+	all := []string{"@", "dom", "host", "ns1.host", "www.dom", "keep"}
+	tests := []struct {
+		name string
+		// 清除后提交还是放弃；statusFails时状态文件位置换成目录，使Commit写状态文件失败
+		commit      bool
+		statusFails bool
+		wantErr     bool
+		wantLeft    []string
+		// 内存和状态文件中是否还有dom的状态
+		wantStatus bool
+	}{
+		{name: "commit", commit: true, wantLeft: []string{"@", "host", "keep"}},
+		{name: "rollback", wantLeft: all, wantStatus: true},
+		{name: "status write fails", commit: true, statusFails: true, wantErr: true, wantLeft: all},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestZone(t, purgeLines...)
+			p.statuses = map[string]*domainStatus{
+				"dom":  {DomainName: "dom", Status: []string{StatusClientHold}},
+				"keep": {DomainName: "keep", Status: []string{StatusClientHold}},
+			}
+			if err := p.WriteZoneFile(); err != nil {
+				t.Fatalf("WriteZoneFile: %v", err)
+			}
+			if err := p.saveStatuses(); err != nil {
+				t.Fatalf("saveStatuses: %v", err)
+			}
+			if tt.statusFails {
+				if err := os.Remove(p.statusPath()); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Mkdir(p.statusPath(), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := p.PurgeDomain("dom.chn."); err != nil {
+				t.Fatalf("PurgeDomain: %v", err)
+			}
+			if p.statuses["dom"] != nil {
+				t.Error("清除后内存中不应有dom的状态")
+			}
+			var err error
+			if tt.commit {
+				err = p.Commit()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Commit error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.commit || err != nil {
+				p.Rollback()
+			}
+			var left []string
+			seen := map[string]bool{}
+			for _, record := range p.listDNSRecords() {
+				if !seen[record.DomainName] {
+					seen[record.DomainName] = true
+					left = append(left, record.DomainName)
+				}
+			}
+			if strings.Join(left, ",") != strings.Join(tt.wantLeft, ",") {
+				t.Errorf("剩余的名字为 %v，应为 %v", left, tt.wantLeft)
+			}
+			if tt.statusFails {
+				return
+			}
+			saved := &ChnZone{zoneFile: p.zoneFile}
+			saved.loadStatuses()
+			for _, statuses := range []map[string]*domainStatus{p.statuses, saved.statuses} {
+				if _, ok := statuses["dom"]; ok != tt.wantStatus {
+					t.Errorf("dom的状态存在=%v，应为%v", ok, tt.wantStatus)
+				}
+				if statuses["keep"] == nil {
+					t.Error("不应清除keep的状态")
+				}
+			}
+		})
+	}
+}
+
+func TestCommitRestoresZoneFile(t *testing.T) {
+	p := newTestZone(t)
+	if err := p.WriteZoneFile(); err != nil {
+		t.Fatalf("WriteZoneFile: %v", err)
+	}
+	old, _ := os.ReadFile(p.zonePath())
+	soa, _ := p.readSOA()
+
+	// 签名后的文件写到不存在的目录，写完zone文件后签名步骤失败
+	dir := t.TempDir()
+	signer, err := dnssec.NewSigner(dnssec.Config{
+		KeyDir:     dir,
+		SignedFile: filepath.Join(dir, "missing", "chn.zone.signed"),
+		Algorithm:  dns.ECDSAP256SHA256,
+		DNSKEYTTL:  3600,
+		A9TypeCode: 65281,
+	}, "chn.")
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	p.SetSigner(signer)
+	p.runtimeZoneFileList.PushBack("www 600 IN A 192.0.2.1")
+
+	if err := p.Commit(); err == nil {
+		t.Fatal("签名文件无法写入时Commit应失败")
+	}
+	if content, _ := os.ReadFile(p.zonePath()); string(content) != string(old) {
+		t.Error("Commit失败后zone文件应保持原样")
+	}
+	if after, _ := p.readSOA(); after.Serial != soa.Serial {
+		t.Errorf("Commit失败后serial为%d，应为%d", after.Serial, soa.Serial)
+	}
+	if len(p.listDNSRecords()) != 2 {
+		t.Error("Commit失败后内存中应保留未提交的修改")
+	}
+	p.Rollback()
+	if len(p.listDNSRecords()) != 1 {
+		t.Error("Rollback后应放弃未提交的修改")
+	}
+}
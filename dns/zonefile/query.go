@@ -0,0 +1,328 @@
+package zonefile
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"newCHNTLDManager/dns/idn"
+	dnsname "newCHNTLDManager/dns/name"
+
+	"github.com/miekg/dns"
+)
+
+// 分页时每页的默认和最大条数
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+// QueryDNSRecord原有的三个字段，请求中只有这些字段时按原来的方式返回全部结果
+var legacyQueryFields = map[string]bool{"domainName": true, "type": true, "data": true}
+
+// 记录查询条件，各条件同时满足。名字条件按相对于origin的A-label或U-label写法匹配，不区分大小写
+type recordQuery struct {
+	DomainName   string   `json:"domainName"`   // 名字完全相同
+	Type         string   `json:"type"`         // 单个类型
+	Data         string   `json:"data"`         // 数据完全相同，与QueryDNSRecord的比较方式一致
+	Types        []string `json:"types"`        // 类型属于其中之一
+	NamePrefix   string   `json:"namePrefix"`   // 名字前缀
+	NameSuffix   string   `json:"nameSuffix"`   // 名字后缀，按字符匹配，按label匹配用subtree
+	NameGlob     string   `json:"nameGlob"`     // 通配，*匹配任意字符（包括点），?匹配一个字符
+	Subtree      string   `json:"subtree"`      // 名字本身及其下的所有名字
+	TTLMin       int      `json:"ttlMin"`       // TTL下限，包含
+	TTLMax       int      `json:"ttlMax"`       // TTL上限，包含，0为不限
+	DataContains string   `json:"dataContains"` // 数据包含的子串，不区分大小写
+	Sort         string   `json:"sort"`         // 逗号分隔的name、type、ttl、data，前加-为降序，默认name,type
+	Offset       int      `json:"offset"`
+	Limit        int      `json:"limit"`  // 默认100，最大1000
+	Cursor       string   `json:"cursor"` // 上一页返回的nextCursor，不能与offset同时使用
+}
+
+// 一页查询结果，totalCount为满足条件的记录总数
+type recordPage struct {
+	TotalCount int         `json:"totalCount"`
+	Records    []dnsRecord `json:"records"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// 排序用的记录，name为按label反序排列的小写绝对域名，与DNSSEC的规范顺序一致
+type sortedRecord struct {
+	record dnsRecord
+	name   string
+	ttl    int
+}
+
+// 游标记录上一页最后一条记录的排序字段，记录被删除后仍能从原位置继续
+type queryCursor struct {
+	Name string `json:"n"`
+	Type string `json:"t"`
+	TTL  int    `json:"l"`
+	Data string `json:"d"`
+	ID   string `json:"i"`
+}
+
+// 查询记录，支持过滤、排序和分页。请求中只有domainName、type、data时与QueryDNSRecord相同，返回全部结果
+func (p *ChnZone) QueryDNSRecordPage(jsonReq string) (recordPage, error) {
+	legacy, err := isLegacyQuery(jsonReq)
+	if err != nil {
+		return recordPage{}, err
+	}
+	if legacy {
+		records, err := p.QueryDNSRecord(jsonReq)
+		if err != nil {
+			return recordPage{}, err
+		}
+		return recordPage{TotalCount: len(records), Records: records}, nil
+	}
+	var req recordQuery
+	err = json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonReq:", err)
+		return recordPage{}, err
+	}
+	return p.searchRecords(req)
+}
+
+func isLegacyQuery(jsonReq string) (bool, error) {
+	if strings.TrimSpace(jsonReq) == "" {
+		return true, nil
+	}
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal([]byte(jsonReq), &fields)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonReq:", err)
+		return false, err
+	}
+	for key := range fields {
+		if !legacyQueryFields[key] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (p *ChnZone) searchRecords(req recordQuery) (recordPage, error) {
+	if req.Offset < 0 || req.Limit < 0 || req.TTLMin < 0 || req.TTLMax < 0 {
+		return recordPage{}, fmt.Errorf("offset、limit、ttlMin、ttlMax不能为负数")
+	}
+	if req.Offset > 0 && req.Cursor != "" {
+		return recordPage{}, fmt.Errorf("offset和cursor不能同时使用")
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultQueryLimit
+	}
+	if req.Limit > maxQueryLimit {
+		return recordPage{}, fmt.Errorf("limit不能超过%d", maxQueryLimit)
+	}
+	keys, err := parseSort(req.Sort)
+	if err != nil {
+		return recordPage{}, err
+	}
+	match, err := p.recordMatcher(req)
+	if err != nil {
+		return recordPage{}, err
+	}
+	origin := p.getOrigin()
+	var list []sortedRecord
+	for _, record := range p.listDNSRecords() {
+		if !match(record) {
+			continue
+		}
+		ttl, _ := strconv.Atoi(record.TTL)
+		list = append(list, sortedRecord{record: record, name: canonicalName(record.DomainName, origin), ttl: ttl})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return compareRecords(keys, list[i], list[j]) < 0
+	})
+
+	page := recordPage{TotalCount: len(list), Records: []dnsRecord{}}
+	start := req.Offset
+	if req.Cursor != "" {
+		after, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return recordPage{}, err
+		}
+		start = sort.Search(len(list), func(i int) bool {
+			return compareRecords(keys, list[i], after) > 0
+		})
+	}
+	if start > len(list) {
+		start = len(list)
+	}
+	end := start + req.Limit
+	if end > len(list) {
+		end = len(list)
+	}
+	for _, item := range list[start:end] {
+		page.Records = append(page.Records, withUnicode(item.record))
+	}
+	if end < len(list) {
+		page.NextCursor = encodeCursor(list[end-1])
+	}
+	return page, nil
+}
+
+// 把查询条件转换为匹配函数，名字条件先转换为A-label
+func (p *ChnZone) recordMatcher(req recordQuery) (func(dnsRecord) bool, error) {
+	origin := p.getOrigin()
+	types := map[string]bool{}
+	for _, t := range req.Types {
+		types[strings.ToUpper(strings.TrimSpace(t))] = true
+	}
+	if req.NameGlob != "" {
+		if _, err := path.Match(req.NameGlob, ""); err != nil {
+			return nil, fmt.Errorf("nameGlob %q 格式错误", req.NameGlob)
+		}
+	}
+	exact := dnsRecord{DomainName: req.DomainName, Type: req.Type, Data: req.Data}
+	lookupALabel(&exact)
+	subtree := ""
+	if req.Subtree != "" {
+		subtree = dnsname.Fqdn(idn.ToASCII(req.Subtree), origin)
+	}
+	prefix := strings.ToLower(req.NamePrefix)
+	suffix := strings.ToLower(req.NameSuffix)
+	glob := strings.ToLower(req.NameGlob)
+	contains := strings.ToLower(req.DataContains)
+
+	return func(record dnsRecord) bool {
+		if req.Type != "" && record.Type != req.Type {
+			return false
+		}
+		if len(types) > 0 && !types[record.Type] {
+			return false
+		}
+		if req.DomainName != "" && !dnsname.Equal(record.DomainName, exact.DomainName, origin) {
+			return false
+		}
+		if req.Data != "" {
+			exact.Type = record.Type
+			if !sameData(record, exact, origin) {
+				return false
+			}
+		}
+		ttl, _ := strconv.Atoi(record.TTL)
+		if ttl < req.TTLMin || (req.TTLMax > 0 && ttl > req.TTLMax) {
+			return false
+		}
+		fqdn := dnsname.Fqdn(record.DomainName, origin)
+		if subtree != "" && fqdn != subtree && !strings.HasSuffix(fqdn, "."+subtree) {
+			return false
+		}
+		names := relativeNames(record.DomainName, origin)
+		if prefix != "" && !anyName(names, func(n string) bool { return strings.HasPrefix(n, prefix) }) {
+			return false
+		}
+		if suffix != "" && !anyName(names, func(n string) bool { return strings.HasSuffix(n, suffix) }) {
+			return false
+		}
+		if glob != "" && !anyName(names, func(n string) bool { ok, _ := path.Match(glob, n); return ok }) {
+			return false
+		}
+		if contains != "" && !strings.Contains(strings.ToLower(record.Data), contains) &&
+			!(isTargetType(record.Type) && strings.Contains(strings.ToLower(idn.ToUnicode(record.Data)), contains)) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// 名字相对于origin的A-label和U-label写法，zone外的名字为绝对域名
+func relativeNames(domainName string, origin string) []string {
+	name, err := dnsname.Relative(domainName, origin)
+	if err != nil {
+		name = dnsname.Fqdn(domainName, origin)
+	}
+	if unicode := strings.ToLower(idn.ToUnicode(name)); unicode != name {
+		return []string{name, unicode}
+	}
+	return []string{name}
+}
+
+func anyName(names []string, match func(string) bool) bool {
+	for _, n := range names {
+		if match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// label反序后的名字，a.b.chn.为chn.b.a，按字符串比较即为从右往左逐个label比较
+func canonicalName(domainName string, origin string) string {
+	labels := dns.SplitDomainName(dnsname.Fqdn(domainName, origin))
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	// 用\x00分隔，使父名字排在子名字前
+	return strings.Join(labels, "\x00")
+}
+
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+func parseSort(s string) ([]sortKey, error) {
+	if strings.TrimSpace(s) == "" {
+		s = "name,type"
+	}
+	var keys []sortKey
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		key := sortKey{field: strings.TrimPrefix(item, "-"), desc: strings.HasPrefix(item, "-")}
+		switch key.field {
+		case "name", "type", "ttl", "data":
+		default:
+			return nil, fmt.Errorf("不支持按 %q 排序，可以使用name、type、ttl、data", item)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// 按排序字段比较，字段都相同时按ID比较，保证顺序确定，游标可以定位
+func compareRecords(keys []sortKey, a sortedRecord, b sortedRecord) int {
+	for _, key := range keys {
+		c := 0
+		switch key.field {
+		case "name":
+			c = strings.Compare(a.name, b.name)
+		case "type":
+			c = strings.Compare(a.record.Type, b.record.Type)
+		case "ttl":
+			c = a.ttl - b.ttl
+		case "data":
+			c = strings.Compare(a.record.Data, b.record.Data)
+		}
+		if c != 0 {
+			if key.desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return strings.Compare(a.record.ID, b.record.ID)
+}
+
+func encodeCursor(item sortedRecord) string {
+	content, _ := json.Marshal(queryCursor{Name: item.name, Type: item.record.Type, TTL: item.ttl, Data: item.record.Data, ID: item.record.ID})
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func decodeCursor(cursor string) (sortedRecord, error) {
+	content, err := base64.RawURLEncoding.DecodeString(cursor)
+	var c queryCursor
+	if err == nil {
+		err = json.Unmarshal(content, &c)
+	}
+	if err != nil {
+		return sortedRecord{}, fmt.Errorf("cursor %q 格式错误", cursor)
+	}
+	return sortedRecord{record: dnsRecord{Type: c.Type, Data: c.Data, ID: c.ID}, name: c.Name, ttl: c.TTL}, nil
+}
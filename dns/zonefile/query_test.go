@@ -0,0 +1,128 @@
+package zonefile
+
+import (
+	"strings"
+	"testing"
+)
+
+// 默认排序（name,type）下的顺序为 @ a b.a b mail txt www
+var queryLines = []string{
+	"a 600 IN A 192.0.2.1 ; id=0000000000000001",
+	"b.a 300 IN A 192.0.2.2 ; id=0000000000000002",
+	"b 600 IN AAAA 2001:db8::1 ; id=0000000000000003",
+	"mail 3600 IN MX 10 mail.example.com. ; id=0000000000000004",
+	`txt 600 IN TXT "hello world" ; id=0000000000000005`,
+	"www 600 IN CNAME a ; id=0000000000000006",
+}
+
+// 一页结果中的名字，按返回顺序以空格分隔
+func pageNames(page recordPage) string {
+	var names []string
+	for _, record := range page.Records {
+		names = append(names, record.DomainName)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestQueryDNSRecordPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     string
+		want    string
+		total   int
+		cursor  bool
+		wantErr bool
+	}{
+		{name: "all", req: `{"limit":10}`, want: "@ a b.a b mail txt www", total: 7},
+		{name: "types", req: `{"types":["a","AAAA"]}`, want: "a b.a b", total: 3},
+		{name: "prefix", req: `{"namePrefix":"B"}`, want: "b.a b", total: 2},
+		{name: "suffix", req: `{"nameSuffix":".a"}`, want: "b.a", total: 1},
+		{name: "glob", req: `{"nameGlob":"*a"}`, want: "a b.a", total: 2},
+		{name: "subtree", req: `{"subtree":"a"}`, want: "a b.a", total: 2},
+		{name: "subtree fqdn", req: `{"subtree":"a.chn."}`, want: "a b.a", total: 2},
+		{name: "ttl range", req: `{"ttlMin":600,"ttlMax":600}`, want: "a b txt www", total: 4},
+		{name: "data contains", req: `{"dataContains":"EXAMPLE"}`, want: "mail", total: 1},
+		{name: "combined", req: `{"types":["A"],"subtree":"a","ttlMax":300}`, want: "b.a", total: 1},
+		{name: "sort desc", req: `{"sort":"-ttl,name"}`, want: "@ mail a b txt www b.a", total: 7},
+		{name: "sort data", req: `{"types":["A"],"sort":"-data"}`, want: "b.a a", total: 2},
+		{name: "offset", req: `{"offset":5,"limit":10}`, want: "txt www", total: 7},
+		{name: "offset past end", req: `{"offset":50}`, want: "", total: 7},
+		{name: "limit", req: `{"limit":2}`, want: "@ a", total: 7, cursor: true},
+		{name: "offset and cursor", req: `{"offset":1,"cursor":"e30"}`, wantErr: true},
+		{name: "limit too large", req: `{"limit":1001}`, wantErr: true},
+		{name: "negative offset", req: `{"offset":-1}`, wantErr: true},
+		{name: "bad sort", req: `{"sort":"id"}`, wantErr: true},
+		{name: "bad glob", req: `{"nameGlob":"["}`, wantErr: true},
+		{name: "bad cursor", req: `{"cursor":"!!"}`, wantErr: true},
+	}
+	p := newTestZone(t, queryLines...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := p.QueryDNSRecordPage(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QueryDNSRecordPage(%s) error = %v, wantErr %v", tt.req, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := pageNames(page); got != tt.want || page.TotalCount != tt.total || (page.NextCursor != "") != tt.cursor {
+				t.Errorf("QueryDNSRecordPage(%s) = %q total=%d cursor=%q，应为 %q total=%d", tt.req, got, page.TotalCount, page.NextCursor, tt.want, tt.total)
+			}
+		})
+	}
+}
+
+func TestQueryDNSRecordPageLegacy(t *testing.T) {
+	p := newTestZone(t, queryLines...)
+	page, err := p.QueryDNSRecordPage(`{"type":"A"}`)
+	if err != nil {
+		t.Fatalf("QueryDNSRecordPage: %v", err)
+	}
+	if page.TotalCount != 2 || len(page.Records) != 2 || page.NextCursor != "" {
+		t.Errorf("原有查询应返回全部2条A记录，得到 %+v", page)
+	}
+}
+
+func TestQueryDNSRecordPageCursor(t *testing.T) {
+	p := newTestZone(t, queryLines...)
+	for _, sort := range []string{"", "-ttl,name", "data"} {
+		var all []string
+		cursor := ""
+		for i := 0; ; i++ {
+			req := `{"limit":2,"sort":"` + sort + `","cursor":"` + cursor + `"}`
+			page, err := p.QueryDNSRecordPage(req)
+			if err != nil {
+				t.Fatalf("QueryDNSRecordPage(%s): %v", req, err)
+			}
+			if name := pageNames(page); name != "" {
+				all = append(all, name)
+			}
+			if cursor = page.NextCursor; cursor == "" || i > 10 {
+				break
+			}
+		}
+		full, _ := p.QueryDNSRecordPage(`{"sort":"` + sort + `"}`)
+		if got := strings.Join(all, " "); got != pageNames(full) {
+			t.Errorf("sort=%q 逐页取得 %q，应为 %q", sort, got, pageNames(full))
+		}
+	}
+}
+
+// 上一页最后一条记录被删除后，游标仍从原位置继续
+func TestQueryDNSRecordPageCursorAfterDelete(t *testing.T) {
+	p := newTestZone(t, queryLines...)
+	first, err := p.QueryDNSRecordPage(`{"limit":2}`)
+	if err != nil || pageNames(first) != "@ a" {
+		t.Fatalf("第一页 %q: %v", pageNames(first), err)
+	}
+	if err = p.DeleteRecord("0000000000000001"); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+	next, err := p.QueryDNSRecordPage(`{"limit":2,"cursor":"` + first.NextCursor + `"}`)
+	if err != nil {
+		t.Fatalf("第二页: %v", err)
+	}
+	if got := pageNames(next); got != "b.a b" || next.TotalCount != 6 {
+		t.Errorf("第二页 %q total=%d，应为 \"b.a b\" total=6", got, next.TotalCount)
+	}
+}
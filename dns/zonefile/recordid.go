@@ -0,0 +1,253 @@
+package zonefile
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"newCHNTLDManager/dns/idn"
+
+	"github.com/gogf/gf/v2/container/glist"
+	"github.com/miekg/dns"
+)
+
+// 记录ID为16位十六进制数，写在记录所在行的注释中，如 polo 600 IN A 1.2.3.4 ; id=5f0c3a9e12b4d7c8
+var recordIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+func randomRecordID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 分配一个zone中没有使用的ID
+func (p *ChnZone) newRecordID() string {
+	for {
+		id := randomRecordID()
+		if e, _ := p.findRecordByID(id); e == nil {
+			return id
+		}
+	}
+}
+
+// 分开记录和行尾注释，引号内和转义的分号不是注释
+func splitComment(line string) (string, string) {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return strings.TrimRight(line[:i], " \t"), strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return line, ""
+}
+
+// 注释中的记录ID，没有时返回空字符串
+func commentID(comment string) string {
+	for _, item := range strings.Fields(comment) {
+		if id := strings.TrimPrefix(item, "id="); id != item && recordIDPattern.MatchString(id) {
+			return id
+		}
+	}
+	return ""
+}
+
+// 给没有ID的记录补上ID，返回补上的个数。委派、胶水、DS等由其他接口维护的记录在写文件前统一分配
+func (p *ChnZone) assignRecordIDs() int {
+	used := map[string]bool{}
+	var missing []*glist.Element
+	start := false
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		line := e.Value.(string)
+		if line == "; Nameservers" {
+			start = true
+		}
+		if !start {
+			continue
+		}
+		record, ok := parseRecordLine(line)
+		if !ok {
+			continue
+		}
+		if record.ID == "" {
+			missing = append(missing, e)
+		} else {
+			used[record.ID] = true
+		}
+	}
+	for _, e := range missing {
+		id := randomRecordID()
+		for used[id] {
+			id = randomRecordID()
+		}
+		used[id] = true
+		line := e.Value.(string)
+		if _, comment := splitComment(line); comment == "" {
+			p.setLine(e, line+" ; id="+id)
+		} else {
+			p.setLine(e, line+" id="+id)
+		}
+	}
+	return len(missing)
+}
+
+// 给zone中已有的记录分配ID。只修改注释，不递增serial
+func (p *ChnZone) MigrateRecordIDs() (int, error) {
+	n := p.assignRecordIDs()
+	if n == 0 {
+		return 0, nil
+	}
+	return n, p.WriteZoneFile()
+}
+
+// 按ID查找记录所在的行
+func (p *ChnZone) findRecordByID(id string) (*glist.Element, dnsRecord) {
+	if !recordIDPattern.MatchString(id) {
+		return nil, dnsRecord{}
+	}
+	start := false
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		line := e.Value.(string)
+		if line == "; Nameservers" {
+			start = true
+		}
+		if !start {
+			continue
+		}
+		if record, ok := parseRecordLine(line); ok && record.ID == id {
+			return e, record
+		}
+	}
+	return nil, dnsRecord{}
+}
+
+// 返回给调用方的记录，TXT带上拆分后的字符串，名字带上U-label写法
+func storedView(record dnsRecord) dnsRecord {
+	if record.Type == "TXT" && len(record.Strings) == 0 {
+		record.Strings = splitTXT(record.Data)
+	}
+	return withUnicode(record)
+}
+
+// name是否为本zone，可以用U-label或A-label，带不带末尾的点
+func (p *ChnZone) IsZone(name string) bool {
+	return strings.EqualFold(dns.Fqdn(idn.ToASCII(strings.TrimSpace(name))), p.getOrigin())
+}
+
+func (p *ChnZone) GetRecord(id string) (dnsRecord, error) {
+	e, record := p.findRecordByID(id)
+	if e == nil {
+		return dnsRecord{}, errorf(ErrNotFound, "记录 %s 不存在", id)
+	}
+	return storedView(record), nil
+}
+
+// 委派点的NS、DS和委派点之下的胶水由SetDelegation、RemoveDelegation和registry维护，
+// 按ID修改或删除会绕过胶水清理和DS需要NS的检查，也会使registry的数据与zone不一致
+func (p *ChnZone) checkDelegationManaged(record dnsRecord) error {
+	if record.DomainName == "@" {
+		return nil
+	}
+	if record.Type == "NS" || record.Type == "DS" {
+		return errorf(ErrProhibited, "%s 的%s记录属于委派，请使用SetDelegation、RemoveDelegation修改", record.DomainName, record.Type)
+	}
+	if cut := p.findCut(record.DomainName); cut != "" {
+		return errorf(ErrProhibited, "%s 位于委派点 %s 之下，胶水请使用SetDelegation修改", record.DomainName, cut)
+	}
+	return nil
+}
+
+// 修改记录，ID不变。partial为false时jsonRecord是完整的记录，为true时只修改给出的字段。
+// 委派的NS、DS和胶水不能修改，也不能改成这些记录
+func (p *ChnZone) UpdateRecord(id string, jsonRecord string, partial bool) (dnsRecord, error) {
+	e, stored := p.findRecordByID(id)
+	if e == nil {
+		return dnsRecord{}, errorf(ErrNotFound, "记录 %s 不存在", id)
+	}
+	err := p.checkDomainStatus(stored.DomainName)
+	if err != nil {
+		return dnsRecord{}, err
+	}
+	err = p.checkDelegationManaged(stored)
+	if err != nil {
+		return dnsRecord{}, err
+	}
+	var record dnsRecord
+	if partial {
+		record = stored
+		var fields map[string]json.RawMessage
+		if err = json.Unmarshal([]byte(jsonRecord), &fields); err != nil {
+			fmt.Println("Error unmarshal jsonRecord:", err)
+			return dnsRecord{}, err
+		}
+		_, hasData := fields["data"]
+		_, hasStrings := fields["strings"]
+		// 只改data时TXT重新拆分，只改strings时data由strings拼接
+		if hasData && !hasStrings {
+			record.Strings = nil
+		}
+		if hasStrings && !hasData {
+			record.Data = ""
+		}
+	}
+	if err = json.Unmarshal([]byte(jsonRecord), &record); err != nil {
+		fmt.Println("Error unmarshal jsonRecord:", err)
+		return dnsRecord{}, err
+	}
+	record.ID = stored.ID
+	err = p.checkRecordInput(&record, jsonRecord)
+	if err != nil {
+		return dnsRecord{}, err
+	}
+	err = p.checkDelegationManaged(record)
+	if err != nil {
+		return dnsRecord{}, err
+	}
+	if other := p.findRecordElement(record); other != nil && other != e {
+		return dnsRecord{}, errorf(ErrExists, "已存在相同的记录")
+	}
+	// 先插入新行再删除旧行，插入失败时zone不变
+	err = p.insertRecord(record)
+	if err != nil {
+		return dnsRecord{}, err
+	}
+	p.removeLine(e)
+	err = p.incrementSerial()
+	if err != nil {
+		fmt.Println("Error increment serial:", err)
+		return dnsRecord{}, err
+	}
+	return storedView(record), p.WriteZoneFile()
+}
+
+// 按ID删除记录，委派的NS、DS和胶水需要通过RemoveDelegation删除
+func (p *ChnZone) DeleteRecord(id string) error {
+	e, record := p.findRecordByID(id)
+	if e == nil {
+		return errorf(ErrNotFound, "记录 %s 不存在", id)
+	}
+	err := p.checkDomainStatus(record.DomainName)
+	if err != nil {
+		return err
+	}
+	err = p.checkDelegationManaged(record)
+	if err != nil {
+		return err
+	}
+	p.removeLine(e)
+	err = p.incrementSerial()
+	if err != nil {
+		fmt.Println("Error increment serial:", err)
+		return err
+	}
+	return p.WriteZoneFile()
+}
@@ -0,0 +1,146 @@
+package zonefile
+
+import (
+	"testing"
+)
+
+func TestSplitComment(t *testing.T) {
+	tests := []struct {
+		line    string
+		record  string
+		comment string
+	}{
+		{"www 600 IN A 192.0.2.1", "www 600 IN A 192.0.2.1", ""},
+		{"www 600 IN A 192.0.2.1 ; id=0123456789abcdef", "www 600 IN A 192.0.2.1", "id=0123456789abcdef"},
+		{`txt 600 IN TXT "a;b" ; note`, `txt 600 IN TXT "a;b"`, "note"},
+		{`txt 600 IN TXT "a\";b"`, `txt 600 IN TXT "a\";b"`, ""},
+		{`txt 600 IN TXT a\;b ;x`, `txt 600 IN TXT a\;b`, "x"},
+	}
+	for _, tt := range tests {
+		record, comment := splitComment(tt.line)
+		if record != tt.record || comment != tt.comment {
+			t.Errorf("splitComment(%q) = %q, %q，应为 %q, %q", tt.line, record, comment, tt.record, tt.comment)
+		}
+	}
+}
+
+func TestCommentID(t *testing.T) {
+	tests := []struct {
+		comment string
+		id      string
+	}{
+		{"id=0123456789abcdef", "0123456789abcdef"},
+		{"note id=0123456789abcdef", "0123456789abcdef"},
+		{"id=0123456789ABCDEF", ""},
+		{"id=0123", ""},
+		{"xid=0123456789abcdef", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := commentID(tt.comment); got != tt.id {
+			t.Errorf("commentID(%q) = %q，应为 %q", tt.comment, got, tt.id)
+		}
+	}
+}
+
+func TestAssignRecordIDs(t *testing.T) {
+	p := newTestZone(t, "www 600 IN A 192.0.2.1 ; id=0123456789abcdef", "mail 600 IN A 192.0.2.2 ; note")
+	// apex NS和mail没有ID
+	if n := p.assignRecordIDs(); n != 2 {
+		t.Fatalf("补上%d个ID，应为2个", n)
+	}
+	if n := p.assignRecordIDs(); n != 0 {
+		t.Errorf("再次分配时补上%d个ID，应为0个", n)
+	}
+	ids := map[string]bool{}
+	for _, record := range p.listDNSRecords() {
+		if !recordIDPattern.MatchString(record.ID) || ids[record.ID] {
+			t.Errorf("%s %s 的ID %q 无效或重复", record.DomainName, record.Type, record.ID)
+		}
+		ids[record.ID] = true
+	}
+	if !ids["0123456789abcdef"] {
+		t.Error("已有的ID不应改变")
+	}
+}
+
+// 委派sub的NS、DS和胶水，以及普通记录www
+var recordIDLines = []string{
+	"sub 86400 IN NS ns1.sub.chn. ; id=00000000000000a1",
+	"sub 86400 IN DS 12345 13 2 ABABABABABABABABABABABABABABABABABABABABABABABABABABABABABABABAB ; id=00000000000000a2",
+	"ns1.sub 86400 IN A 192.0.2.53 ; id=00000000000000a3",
+	"www 600 IN A 192.0.2.1 ; id=00000000000000a4",
+}
+
+func TestUpdateRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		json    string
+		wantErr ErrorKind
+		ok      bool
+	}{
+		{name: "change data", id: "00000000000000a4", json: `{"data":"192.0.2.2"}`, ok: true},
+		{name: "unknown id", id: "00000000000000ff", json: `{"data":"192.0.2.2"}`, wantErr: ErrNotFound},
+		{name: "delegation NS", id: "00000000000000a1", json: `{"data":"ns2.sub.chn."}`, wantErr: ErrProhibited},
+		{name: "delegation DS", id: "00000000000000a2", json: `{"ttl":"600"}`, wantErr: ErrProhibited},
+		{name: "glue", id: "00000000000000a3", json: `{"data":"192.0.2.54"}`, wantErr: ErrProhibited},
+		{name: "into NS", id: "00000000000000a4", json: `{"domainName":"other","type":"NS","data":"ns.example.net."}`, wantErr: ErrProhibited},
+		{name: "under cut", id: "00000000000000a4", json: `{"domainName":"ns1.sub"}`, wantErr: ErrProhibited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestZone(t, recordIDLines...)
+			record, err := p.UpdateRecord(tt.id, tt.json, true)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("UpdateRecord: %v", err)
+				}
+				if record.ID != tt.id {
+					t.Errorf("ID变为 %s", record.ID)
+				}
+				if got, _ := p.GetRecord(tt.id); got.Data != "192.0.2.2" {
+					t.Errorf("修改后数据为 %s", got.Data)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("应返回错误")
+			}
+			if kind := KindOf(err); tt.wantErr != ErrUnknown && kind != tt.wantErr {
+				t.Errorf("错误 %v 的类别为%d，应为%d", err, kind, tt.wantErr)
+			}
+			if len(p.listDNSRecords()) != len(recordIDLines)+1 {
+				t.Error("失败时zone不应改变")
+			}
+		})
+	}
+}
+
+func TestDeleteRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		wantErr ErrorKind
+	}{
+		{"plain record", "00000000000000a4", ErrUnknown},
+		{"unknown id", "00000000000000ff", ErrNotFound},
+		{"bad id", "x", ErrNotFound},
+		{"delegation NS", "00000000000000a1", ErrProhibited},
+		{"delegation DS", "00000000000000a2", ErrProhibited},
+		{"glue", "00000000000000a3", ErrProhibited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestZone(t, recordIDLines...)
+			err := p.DeleteRecord(tt.id)
+			if KindOf(err) != tt.wantErr || (tt.wantErr == ErrUnknown) != (err == nil) {
+				t.Fatalf("DeleteRecord error = %v，类别应为%d", err, tt.wantErr)
+			}
+			_, getErr := p.GetRecord(tt.id)
+			if (getErr == nil) != (err != nil && tt.wantErr != ErrNotFound) {
+				t.Errorf("删除后GetRecord error = %v", getErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package zonefile
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// 一个TXT character-string最多255字节
+const maxTXTString = 255
+
+// 渲染前各字段的语法，名字已由dns/name规范化，这里只允许规范化后的字符，
+// 保证用户输入不能带入空白、换行、注释、括号、引号或$指令
+var (
+	ttlPattern      = regexp.MustCompile(`^[0-9]{1,10}$`)
+	priorityPattern = regexp.MustCompile(`^[0-9]{1,5}$`)
+	ownerPattern    = regexp.MustCompile(`^(@|(\*|[a-z0-9_-]{1,63})(\.[a-z0-9_-]{1,63})*\.?)$`)
+	targetPattern   = regexp.MustCompile(`^[a-z0-9_-]{1,63}(\.[a-z0-9_-]{1,63})*\.?$`)
+	ipv9Pattern     = regexp.MustCompile(`^[0-9a-f.:\[\]]+$`)
+	dsPattern       = regexp.MustCompile(`^[0-9]{1,5} [0-9]{1,3} [0-9]{1,3} [0-9A-F]{40,96}$`)
+)
+
+// 把记录渲染为zone文件中的一行。各字段先按语法检查，TXT按presentation格式转义并按255字节拆分，
+// 渲染结果再解析一次，必须正好得到一条owner和类型都一致的记录
+func (p *ChnZone) renderRecord(record dnsRecord) (string, error) {
+	if !ownerPattern.MatchString(record.DomainName) {
+		return "", fmt.Errorf("域名 %q 含有非法字符", record.DomainName)
+	}
+	if !ttlPattern.MatchString(record.TTL) {
+		return "", fmt.Errorf("TTL %q 必须是数字", record.TTL)
+	}
+	data, err := renderData(record)
+	if err != nil {
+		return "", err
+	}
+	line := record.DomainName + " " + record.TTL + " IN " + record.Type + " " + data
+	if err = p.verifyLine(line, record); err != nil {
+		return "", fmt.Errorf("记录渲染校验失败: %v", err)
+	}
+	if record.ID != "" {
+		if !recordIDPattern.MatchString(record.ID) {
+			return "", fmt.Errorf("记录ID %q 格式错误", record.ID)
+		}
+		line += " ; id=" + record.ID
+	}
+	return line, nil
+}
+
+// 按记录类型检查并渲染rdata
+func renderData(record dnsRecord) (string, error) {
+	switch record.Type {
+	case "A", "AAAA":
+		ip := net.ParseIP(record.Data)
+		if ip == nil || (ip.To4() != nil) != (record.Type == "A") || ip.String() != record.Data {
+			return "", fmt.Errorf("%s记录的地址 %q 格式错误", record.Type, record.Data)
+		}
+		return record.Data, nil
+	case "A9":
+		if !ipv9Pattern.MatchString(record.Data) {
+			return "", fmt.Errorf("A9记录的地址 %q 含有非法字符", record.Data)
+		}
+		return record.Data, nil
+	case "NS", "CNAME", "PTR":
+		if !targetPattern.MatchString(record.Data) {
+			return "", fmt.Errorf("%s记录的目标 %q 含有非法字符", record.Type, record.Data)
+		}
+		return record.Data, nil
+	case "MX":
+		if !priorityPattern.MatchString(record.Priority) {
+			return "", fmt.Errorf("MX优先级 %q 必须是数字", record.Priority)
+		}
+		if !targetPattern.MatchString(record.Data) {
+			return "", fmt.Errorf("MX记录的目标 %q 含有非法字符", record.Data)
+		}
+		return record.Priority + " " + record.Data, nil
+	case "DS":
+		if !dsPattern.MatchString(record.Data) {
+			return "", fmt.Errorf("DS数据 %q 格式错误", record.Data)
+		}
+		return record.Data, nil
+	case "TXT":
+		list, err := txtStrings(record)
+		if err != nil {
+			return "", err
+		}
+		return quoteTXT(list), nil
+	}
+	return "", fmt.Errorf("不支持的类型 %q", record.Type)
+}
+
+// 解析渲染结果：不能有换行，只能得到一条记录，owner、类型与输入一致，TXT内容与输入相同。
+// A9不是miekg/dns认识的类型，按字段检查
+func (p *ChnZone) verifyLine(line string, record dnsRecord) error {
+	if strings.ContainsAny(line, "\r\n") {
+		return fmt.Errorf("包含换行")
+	}
+	origin := p.getOrigin()
+	if record.Type == "A9" {
+		fields := strings.Fields(line)
+		if len(fields) != 5 || strings.ContainsAny(line, ";()\"$\\") {
+			return fmt.Errorf("A9记录格式错误")
+		}
+		return nil
+	}
+	zp := dns.NewZoneParser(strings.NewReader(line+"\n"), origin, "")
+	var rrs []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return err
+	}
+	if len(rrs) != 1 {
+		return fmt.Errorf("得到%d条记录", len(rrs))
+	}
+	hdr := rrs[0].Header()
+	if !strings.EqualFold(hdr.Name, p.qualify(record.DomainName, origin)) {
+		return fmt.Errorf("owner为%s", hdr.Name)
+	}
+	if dns.TypeToString[hdr.Rrtype] != record.Type {
+		return fmt.Errorf("类型为%s", dns.TypeToString[hdr.Rrtype])
+	}
+	if txt, ok := rrs[0].(*dns.TXT); ok {
+		list, _ := txtStrings(record)
+		if len(txt.Txt) != len(list) || strings.Join(txt.Txt, "") != escapeTXT(record.Data) {
+			return fmt.Errorf("TXT内容不一致")
+		}
+	}
+	return nil
+}
+
+// 按255字节拆分TXT内容，空内容为一个空字符串
+func splitTXT(data string) []string {
+	if data == "" {
+		return []string{""}
+	}
+	var res []string
+	for len(data) > maxTXTString {
+		res = append(res, data[:maxTXTString])
+		data = data[maxTXTString:]
+	}
+	return append(res, data)
+}
+
+// TXT记录的character-string：给出strings时按原样使用，否则把data按255字节拆分
+func txtStrings(record dnsRecord) ([]string, error) {
+	if len(record.Strings) == 0 {
+		return splitTXT(record.Data), nil
+	}
+	for _, s := range record.Strings {
+		if len(s) > maxTXTString {
+			return nil, fmt.Errorf("TXT的每个字符串不能超过%d字节", maxTXTString)
+		}
+	}
+	if strings.Join(record.Strings, "") != record.Data {
+		return nil, fmt.Errorf("TXT的strings拼接后与data不一致")
+	}
+	return record.Strings, nil
+}
+
+// 按presentation格式书写character-string，每个字符串加上引号，以空格分隔
+func quoteTXT(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = `"` + escapeTXT(s) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// 转义character-string：引号和反斜杠前加反斜杠，不可打印字符和非ASCII字节写成\DDD。
+// miekg/dns的TXT也以这种写法保存字符串
+func escapeTXT(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// 解析一个或多个带引号的character-string，\DDD按十进制字节解码，其他\X为X本身
+func unquoteTXT(s string) ([]string, error) {
+	var res []string
+	s = strings.TrimSpace(s)
+	for s != "" {
+		if s[0] != '"' {
+			return nil, fmt.Errorf("TXT内容必须用引号括起")
+		}
+		var b []byte
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] != '\\' {
+				b = append(b, s[i])
+				continue
+			}
+			if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+				n, _ := strconv.Atoi(s[i+1 : i+4])
+				if n > 255 {
+					return nil, fmt.Errorf("TXT转义\\%s超出范围", s[i+1:i+4])
+				}
+				b = append(b, byte(n))
+				i += 3
+				continue
+			}
+			if i+1 >= len(s) {
+				return nil, fmt.Errorf("TXT内容以反斜杠结尾")
+			}
+			i++
+			b = append(b, s[i])
+		}
+		if i >= len(s) {
+			return nil, fmt.Errorf("TXT内容缺少结束引号")
+		}
+		res = append(res, string(b))
+		s = strings.TrimSpace(s[i+1:])
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("TXT内容不能为空")
+	}
+	return res, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,126 @@
+package zonefile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRenderRecord(t *testing.T) {
+	p := newTestZone(t)
+	tests := []struct {
+		name    string
+		record  dnsRecord
+		want    string
+		wantErr bool
+	}{
+		{"A", dnsRecord{DomainName: "www", TTL: "600", Type: "A", Data: "192.0.2.1"}, "www 600 IN A 192.0.2.1", false},
+		{"AAAA not canonical", dnsRecord{DomainName: "www", TTL: "600", Type: "AAAA", Data: "2001:DB8::1"}, "", true},
+		{"A with IPv6", dnsRecord{DomainName: "www", TTL: "600", Type: "A", Data: "::1"}, "", true},
+		{"MX", dnsRecord{DomainName: "@", TTL: "600", Type: "MX", Priority: "10", Data: "mail.example.com."}, "@ 600 IN MX 10 mail.example.com.", false},
+		{"with id", dnsRecord{DomainName: "www", TTL: "600", Type: "CNAME", Data: "web", ID: "0123456789abcdef"}, "www 600 IN CNAME web ; id=0123456789abcdef", false},
+		{"bad id", dnsRecord{DomainName: "www", TTL: "600", Type: "CNAME", Data: "web", ID: "x; evil"}, "", true},
+		{"TXT escaped", dnsRecord{DomainName: "txt", TTL: "600", Type: "TXT", Data: "a \"b\" ;(c)\n"}, `txt 600 IN TXT "a \"b\" ;(c)\010"`, false},
+		{"TXT split", dnsRecord{DomainName: "txt", TTL: "600", Type: "TXT", Data: strings.Repeat("x", 300)}, `txt 600 IN TXT "` + strings.Repeat("x", 255) + `" "` + strings.Repeat("x", 45) + `"`, false},
+		{"owner with newline", dnsRecord{DomainName: "www\n$INCLUDE /etc/passwd", TTL: "600", Type: "A", Data: "192.0.2.1"}, "", true},
+		{"owner with space", dnsRecord{DomainName: "www 600 IN A 6.6.6.6 ;", TTL: "600", Type: "A", Data: "192.0.2.1"}, "", true},
+		{"TTL not number", dnsRecord{DomainName: "www", TTL: "600 IN A 6.6.6.6\nx", Type: "A", Data: "192.0.2.1"}, "", true},
+		{"target with comment", dnsRecord{DomainName: "www", TTL: "600", Type: "CNAME", Data: "web ; x"}, "", true},
+		{"MX priority injection", dnsRecord{DomainName: "@", TTL: "600", Type: "MX", Priority: "10 (", Data: "mail"}, "", true},
+		{"A9 with paren", dnsRecord{DomainName: "www", TTL: "600", Type: "A9", Data: "32768[86(1"}, "", true},
+		{"DS lowercase digest", dnsRecord{DomainName: "sub", TTL: "600", Type: "DS", Data: "1 13 2 " + strings.Repeat("ab", 32)}, "", true},
+		{"unknown type", dnsRecord{DomainName: "www", TTL: "600", Type: "$INCLUDE", Data: "/etc/passwd"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.renderRecord(tt.record)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderRecord error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderRecord = %q，应为 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnquoteTXT(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{`"abc"`, []string{"abc"}, false},
+		{`"a" "b"`, []string{"a", "b"}, false},
+		{`"\"\\\059\255"`, []string{"\"\\;\xff"}, false},
+		{`""`, []string{""}, false},
+		{`abc`, nil, true},
+		{`"abc`, nil, true},
+		{`"\256"`, nil, true},
+		{`"abc\`, nil, true},
+		{``, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := unquoteTXT(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unquoteTXT(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("unquoteTXT(%q) = %q，应为 %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// 用恶意输入（换行、分号、括号、引号、$指令、\000、\xff等）渲染各类记录：渲染成功的每一行都必须只解析出
+// 一条owner和类型一致的记录，TXT必须能原样还原；名字和TTL合法时TXT必须能渲染
+func FuzzRenderRecord(f *testing.F) {
+	hostile := []string{"\n", "\r\n", ";", "(", ")", "\"", "\\", " ", "\t", "$INCLUDE /etc/passwd", "$ORIGIN evil.", "$TTL 1",
+		"@", "*", ".", "www", "1.2.3.4", "::1", "IN A 6.6.6.6", "\\010", "\\\"", "中文", "\x00", "\\000", "\xff", "_dmarc"}
+	types := []string{"A", "AAAA", "A9", "NS", "CNAME", "PTR", "MX", "TXT", "DS", "$INCLUDE", "A\nB"}
+	for _, typ := range types {
+		f.Add("www", "600", typ, "10", "192.0.2.1")
+		for _, s := range hostile {
+			f.Add("www", "600", typ, "10", s)
+			f.Add("www"+s, "600", typ, "10", "www")
+			f.Add("www", "600"+s, typ, "10"+s, "a"+s+"b")
+		}
+	}
+	p := newTestZone(f)
+	origin := p.getOrigin()
+	f.Fuzz(func(t *testing.T, domainName string, ttl string, typ string, priority string, data string) {
+		record := dnsRecord{DomainName: domainName, TTL: ttl, Type: typ, Priority: priority, Data: data}
+		line, err := p.renderRecord(record)
+		if err != nil {
+			if typ == "TXT" && domainName == "www" && ttl == "600" {
+				t.Fatalf("TXT %q 无法渲染: %v", data, err)
+			}
+			return
+		}
+		if strings.ContainsAny(line, "\r\n") || strings.HasPrefix(line, "$") {
+			t.Fatalf("%+v 渲染为 %q", record, line)
+		}
+		if typ == "TXT" {
+			fields := strings.SplitN(line, " TXT ", 2)
+			list, err := unquoteTXT(fields[1])
+			if err != nil || strings.Join(list, "") != data {
+				t.Fatalf("TXT %q 渲染为 %q 后无法还原", data, line)
+			}
+		}
+		if typ == "A9" {
+			return
+		}
+		zp := dns.NewZoneParser(strings.NewReader(line+"\n"), origin, "")
+		var rrs []dns.RR
+		for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+			rrs = append(rrs, rr)
+		}
+		if zp.Err() != nil || len(rrs) != 1 {
+			t.Fatalf("%+v 渲染为 %q，解析得到%d条记录: %v", record, line, len(rrs), zp.Err())
+		}
+		if hdr := rrs[0].Header(); !strings.EqualFold(hdr.Name, p.qualify(domainName, origin)) || dns.TypeToString[hdr.Rrtype] != typ {
+			t.Fatalf("%+v 渲染为 %q，解析得到 %s %s", record, line, hdr.Name, dns.TypeToString[hdr.Rrtype])
+		}
+	})
+}
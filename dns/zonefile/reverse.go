@@ -0,0 +1,335 @@
+package zonefile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"newCHNTLDManager/dns/idn"
+	dnsname "newCHNTLDManager/dns/name"
+
+	"github.com/gogf/gf/v2/container/glist"
+	"github.com/miekg/dns"
+)
+
+// 反查请求，ip、cidr、ipv9Prefix、target只能给出一个
+type reverseReq struct {
+	IP         string `json:"ip"`         // A、AAAA记录的地址
+	CIDR       string `json:"cidr"`       // IPv4或IPv6网段
+	IPv9Prefix string `json:"ipv9Prefix"` // A9地址的前几段，如32768[86
+	Target     string `json:"target"`     // CNAME、MX、NS、PTR的目标，没有末尾点时同时按绝对域名和zone内的名字查找
+}
+
+// 按数据反查记录的索引，第一次查询时建立，之后随zone的每行修改增量更新，整个zone被替换时失效
+type reverseIndex struct {
+	origin  string
+	v4      []ipEntry // A记录，按地址排序
+	v6      []ipEntry // AAAA记录，按地址排序
+	ipv9    []ipv9Entry
+	targets map[string][]*glist.Element // 小写绝对域名 -> 记录所在的行
+	records map[*glist.Element]dnsRecord
+}
+
+type ipEntry struct {
+	ip net.IP
+	e  *glist.Element
+}
+
+// key为展开压缩后的IPv9地址，每段后加[，按段前缀匹配时不会把3276匹配到32768
+type ipv9Entry struct {
+	key string
+	e   *glist.Element
+}
+
+// 整个zone被替换后调用，使反查索引失效
+func (p *ChnZone) invalidateIndex() {
+	p.reverse = nil
+}
+
+// 在mark之后插入一行，mark为nil时插入到最后
+func (p *ChnZone) insertLine(mark *glist.Element, line string) {
+	var e *glist.Element
+	if mark == nil {
+		e = p.runtimeZoneFileList.PushBack(line)
+	} else {
+		e = p.runtimeZoneFileList.InsertAfter(mark, line)
+	}
+	if p.reverse != nil {
+		p.reverse.add(e)
+	}
+}
+
+func (p *ChnZone) removeLine(e *glist.Element) {
+	if p.reverse != nil {
+		p.reverse.remove(e)
+	}
+	p.runtimeZoneFileList.Remove(e)
+}
+
+func (p *ChnZone) setLine(e *glist.Element, line string) {
+	if p.reverse != nil {
+		p.reverse.remove(e)
+	}
+	e.Value = line
+	if p.reverse != nil {
+		p.reverse.add(e)
+	}
+}
+
+func (p *ChnZone) getReverseIndex() *reverseIndex {
+	if p.reverse != nil {
+		return p.reverse
+	}
+	index := &reverseIndex{origin: p.getOrigin(), targets: map[string][]*glist.Element{}, records: map[*glist.Element]dnsRecord{}}
+	start := false
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		if e.Value.(string) == "; Nameservers" {
+			start = true
+		}
+		if start {
+			index.add(e)
+		}
+	}
+	p.reverse = index
+	return index
+}
+
+// 把一行加入索引，不是记录或不是可以反查的类型时忽略
+func (index *reverseIndex) add(e *glist.Element) {
+	record, ok := parseRecordLine(e.Value.(string))
+	if !ok {
+		return
+	}
+	switch record.Type {
+	case "A":
+		ip := net.ParseIP(record.Data).To4()
+		if ip == nil {
+			return
+		}
+		index.v4 = insertIP(index.v4, ipEntry{ip: ip, e: e})
+	case "AAAA":
+		ip := net.ParseIP(record.Data)
+		if ip == nil || ip.To4() != nil {
+			return
+		}
+		index.v6 = insertIP(index.v6, ipEntry{ip: ip.To16(), e: e})
+	case "A9":
+		segments, ok := expandIPv9(record.Data)
+		if !ok {
+			return
+		}
+		key := ipv9Key(segments)
+		i := sort.Search(len(index.ipv9), func(i int) bool { return index.ipv9[i].key > key })
+		index.ipv9 = append(index.ipv9, ipv9Entry{})
+		copy(index.ipv9[i+1:], index.ipv9[i:])
+		index.ipv9[i] = ipv9Entry{key: key, e: e}
+	case "CNAME", "MX", "NS", "PTR":
+		target := index.targetKey(record)
+		index.targets[target] = append(index.targets[target], e)
+	default:
+		return
+	}
+	index.records[e] = record
+}
+
+// 把一行从索引中删除，按记录的数据定位，不扫描整个索引
+func (index *reverseIndex) remove(e *glist.Element) {
+	record, ok := index.records[e]
+	if !ok {
+		return
+	}
+	delete(index.records, e)
+	switch record.Type {
+	case "A":
+		index.v4 = removeIP(index.v4, net.ParseIP(record.Data).To4(), e)
+	case "AAAA":
+		index.v6 = removeIP(index.v6, net.ParseIP(record.Data).To16(), e)
+	case "A9":
+		segments, _ := expandIPv9(record.Data)
+		key := ipv9Key(segments)
+		i := sort.Search(len(index.ipv9), func(i int) bool { return index.ipv9[i].key >= key })
+		for ; i < len(index.ipv9) && index.ipv9[i].key == key; i++ {
+			if index.ipv9[i].e == e {
+				index.ipv9 = append(index.ipv9[:i], index.ipv9[i+1:]...)
+				return
+			}
+		}
+	default:
+		target := index.targetKey(record)
+		list := index.targets[target]
+		for i := range list {
+			if list[i] == e {
+				list = append(list[:i], list[i+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(index.targets, target)
+		} else {
+			index.targets[target] = list
+		}
+	}
+}
+
+func (index *reverseIndex) targetKey(record dnsRecord) string {
+	return strings.ToLower(dnsname.TargetFqdn(record.Data, index.origin, record.Type))
+}
+
+// 按地址插入，地址相同时插入到最后
+func insertIP(list []ipEntry, entry ipEntry) []ipEntry {
+	i := sort.Search(len(list), func(i int) bool { return bytes.Compare(list[i].ip, entry.ip) > 0 })
+	list = append(list, ipEntry{})
+	copy(list[i+1:], list[i:])
+	list[i] = entry
+	return list
+}
+
+func removeIP(list []ipEntry, ip net.IP, e *glist.Element) []ipEntry {
+	i := sort.Search(len(list), func(i int) bool { return bytes.Compare(list[i].ip, ip) >= 0 })
+	for ; i < len(list) && bytes.Equal(list[i].ip, ip); i++ {
+		if list[i].e == e {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// 按地址、网段、IPv9前缀或目标反查引用它的记录，结果按名字、类型、数据排序
+func (p *ChnZone) ReverseSearch(jsonReq string) ([]dnsRecord, error) {
+	var req reverseReq
+	err := json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonReq:", err)
+		return nil, err
+	}
+	given := 0
+	for _, v := range []string{req.IP, req.CIDR, req.IPv9Prefix, req.Target} {
+		if strings.TrimSpace(v) != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, fmt.Errorf("ip、cidr、ipv9Prefix、target必须且只能给出一个")
+	}
+	index := p.getReverseIndex()
+	var found []*glist.Element
+	switch {
+	case req.IP != "":
+		ip := net.ParseIP(strings.TrimSpace(req.IP))
+		if ip == nil {
+			return nil, fmt.Errorf("ip %q 格式错误", req.IP)
+		}
+		found = index.ipRange(ip, ip)
+	case req.CIDR != "":
+		_, network, err := net.ParseCIDR(strings.TrimSpace(req.CIDR))
+		if err != nil {
+			return nil, fmt.Errorf("cidr %q 格式错误", req.CIDR)
+		}
+		last := make(net.IP, len(network.IP))
+		for i := range network.IP {
+			last[i] = network.IP[i] | ^network.Mask[i]
+		}
+		found = index.ipRange(network.IP, last)
+	case req.IPv9Prefix != "":
+		segments, ok := expandIPv9(strings.TrimSuffix(strings.TrimSpace(req.IPv9Prefix), "["))
+		if !ok || len(segments) > 8 {
+			return nil, fmt.Errorf("ipv9Prefix %q 格式错误", req.IPv9Prefix)
+		}
+		found = index.ipv9Prefix(ipv9Key(segments))
+	default:
+		found = index.target(strings.TrimSpace(req.Target))
+	}
+	list := make([]sortedRecord, 0, len(found))
+	for _, e := range found {
+		record := index.records[e]
+		list = append(list, sortedRecord{record: record, name: canonicalName(record.DomainName, index.origin)})
+	}
+	keys := []sortKey{{field: "name"}, {field: "type"}, {field: "data"}}
+	sort.Slice(list, func(i, j int) bool {
+		return compareRecords(keys, list[i], list[j]) < 0
+	})
+	records := []dnsRecord{}
+	for _, item := range list {
+		records = append(records, withUnicode(item.record))
+	}
+	return records, nil
+}
+
+// 地址在[first, last]之间的记录，IPv4查A记录，IPv6查AAAA记录
+func (index *reverseIndex) ipRange(first net.IP, last net.IP) []*glist.Element {
+	list := index.v6
+	if v4 := first.To4(); v4 != nil {
+		list, first, last = index.v4, v4, last.To4()
+	} else {
+		first, last = first.To16(), last.To16()
+	}
+	var res []*glist.Element
+	i := sort.Search(len(list), func(i int) bool { return bytes.Compare(list[i].ip, first) >= 0 })
+	for ; i < len(list) && bytes.Compare(list[i].ip, last) <= 0; i++ {
+		res = append(res, list[i].e)
+	}
+	return res
+}
+
+func (index *reverseIndex) ipv9Prefix(prefix string) []*glist.Element {
+	var res []*glist.Element
+	i := sort.Search(len(index.ipv9), func(i int) bool { return index.ipv9[i].key >= prefix })
+	for ; i < len(index.ipv9) && strings.HasPrefix(index.ipv9[i].key, prefix); i++ {
+		res = append(res, index.ipv9[i].e)
+	}
+	return res
+}
+
+func (index *reverseIndex) target(name string) []*glist.Element {
+	name = strings.ToLower(idn.ToASCII(name))
+	if name == "" {
+		return nil
+	}
+	keys := []string{dns.Fqdn(name)}
+	if !strings.HasSuffix(name, ".") {
+		if relative := dnsname.Fqdn(name, index.origin); relative != keys[0] {
+			keys = append(keys, relative)
+		}
+	}
+	var res []*glist.Element
+	for _, key := range keys {
+		res = append(res, index.targets[key]...)
+	}
+	return res
+}
+
+// 展开IPv9地址的压缩写法，n]表示n段0，数字段去掉前导0，最后一段可以是IPv4地址
+func expandIPv9(address string) ([]string, bool) {
+	if address == "" {
+		return nil, false
+	}
+	var segments []string
+	for _, item := range strings.Split(address, "[") {
+		if zeros, rest, ok := strings.Cut(item, "]"); ok {
+			n, err := strconv.Atoi(zeros)
+			if err != nil || n <= 0 || n > 8 {
+				return nil, false
+			}
+			for ; n > 0; n-- {
+				segments = append(segments, "0")
+			}
+			item = rest
+		}
+		if n, err := strconv.Atoi(item); err == nil && n >= 0 {
+			segments = append(segments, strconv.Itoa(n))
+		} else if ip := net.ParseIP(item).To4(); ip != nil {
+			segments = append(segments, ip.String())
+		} else {
+			return nil, false
+		}
+	}
+	return segments, true
+}
+
+func ipv9Key(segments []string) string {
+	return strings.Join(segments, "[") + "["
+}
@@ -0,0 +1,164 @@
+package zonefile
+
+import (
+	"strings"
+	"testing"
+)
+
+var reverseLines = []string{
+	"www 600 IN A 192.0.2.1 ; id=0000000000000001",
+	"web 600 IN A 192.0.2.1 ; id=0000000000000002",
+	"api 600 IN A 192.0.2.200 ; id=0000000000000003",
+	"far 600 IN A 198.51.100.1 ; id=0000000000000004",
+	"www 600 IN AAAA 2001:db8::1 ; id=0000000000000005",
+	"v9 600 IN A9 32768[86[5]4 ; id=0000000000000006",
+	"v9b 600 IN A9 32768[860[5]5 ; id=0000000000000007",
+	"alias 600 IN CNAME www ; id=0000000000000008",
+	"ext 600 IN CNAME www.chn. ; id=0000000000000009",
+	"@ 600 IN MX 10 mail.example.com. ; id=000000000000000a",
+	"1.2 600 IN PTR www.chn. ; id=000000000000000b",
+}
+
+// 结果中的名字和类型，以空格分隔
+func reverseNames(records []dnsRecord) string {
+	var names []string
+	for _, record := range records {
+		names = append(names, record.DomainName+"/"+record.Type)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestReverseSearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     string
+		want    string
+		wantErr bool
+	}{
+		{name: "ip", req: `{"ip":"192.0.2.1"}`, want: "web/A www/A"},
+		{name: "ipv6", req: `{"ip":"2001:DB8:0::1"}`, want: "www/AAAA"},
+		{name: "ip none", req: `{"ip":"192.0.2.2"}`, want: ""},
+		{name: "cidr", req: `{"cidr":"192.0.2.0/24"}`, want: "api/A web/A www/A"},
+		{name: "cidr narrow", req: `{"cidr":"192.0.2.128/25"}`, want: "api/A"},
+		{name: "cidr ipv6", req: `{"cidr":"2001:db8::/32"}`, want: "www/AAAA"},
+		{name: "ipv9 prefix", req: `{"ipv9Prefix":"32768[86"}`, want: "v9/A9"},
+		{name: "ipv9 prefix trailing", req: `{"ipv9Prefix":"32768["}`, want: "v9/A9 v9b/A9"},
+		{name: "ipv9 leading zero", req: `{"ipv9Prefix":"32768[0860"}`, want: "v9b/A9"},
+		{name: "target relative", req: `{"target":"www"}`, want: "1.2/PTR alias/CNAME ext/CNAME"},
+		{name: "target bare", req: `{"target":"www."}`, want: "alias/CNAME"},
+		{name: "target absolute", req: `{"target":"mail.example.com."}`, want: "@/MX"},
+		{name: "target case", req: `{"target":"WWW.CHN."}`, want: "1.2/PTR ext/CNAME"},
+		{name: "nothing given", req: `{}`, wantErr: true},
+		{name: "two given", req: `{"ip":"192.0.2.1","target":"www"}`, wantErr: true},
+		{name: "bad ip", req: `{"ip":"192.0.2"}`, wantErr: true},
+		{name: "bad cidr", req: `{"cidr":"192.0.2.0"}`, wantErr: true},
+		{name: "bad ipv9", req: `{"ipv9Prefix":"a[b"}`, wantErr: true},
+	}
+	p := newTestZone(t, reverseLines...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := p.ReverseSearch(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReverseSearch(%s) error = %v, wantErr %v", tt.req, err, tt.wantErr)
+			}
+			if got := reverseNames(records); !tt.wantErr && got != tt.want {
+				t.Errorf("ReverseSearch(%s) = %q，应为 %q", tt.req, got, tt.want)
+			}
+		})
+	}
+}
+
+// 各种修改后增量更新的索引与重建的索引结果相同，且没有被重建
+func TestReverseIndexIncremental(t *testing.T) {
+	p := newTestZone(t, reverseLines...)
+	p.loadStatuses()
+	index := p.getReverseIndex()
+	steps := []func() error{
+		func() error { return p.AddDNSRecord(`{"domainName":"new","ttl":"600","type":"A","data":"192.0.2.1"}`) },
+		func() error { return p.AddDNSRecord(`{"domainName":"new","ttl":"600","type":"CNAME","data":"www"}`) },
+		func() error { return p.DeleteRecord("0000000000000002") },
+		func() error {
+			_, err := p.UpdateRecord("0000000000000003", `{"data":"192.0.2.1"}`, true)
+			return err
+		},
+		func() error {
+			_, err := p.UpdateRecord("0000000000000006", `{"data":"32768[86[5]7"}`, true)
+			return err
+		},
+		func() error { return p.DelDNSRecord(`{"domainName":"alias","type":"CNAME","data":"www"}`) },
+		func() error {
+			_, err := p.SetDomainStatus(`{"domainName":"www","add":["clientHold"]}`)
+			return err
+		},
+		func() error {
+			_, err := p.SetDomainStatus(`{"domainName":"www","rem":["clientHold"]}`)
+			return err
+		},
+	}
+	queries := []string{`{"ip":"192.0.2.1"}`, `{"cidr":"0.0.0.0/0"}`, `{"cidr":"::/0"}`, `{"ipv9Prefix":"32768"}`, `{"target":"www"}`}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("第%d步: %v", i+1, err)
+		}
+		if p.reverse != index {
+			t.Fatalf("第%d步后索引被重建", i+1)
+		}
+		for _, q := range queries {
+			got, _ := p.ReverseSearch(q)
+			p.invalidateIndex()
+			want, _ := p.ReverseSearch(q)
+			p.reverse = index
+			if reverseNames(got) != reverseNames(want) {
+				t.Errorf("第%d步后 %s = %q，重建索引后为 %q", i+1, q, reverseNames(got), reverseNames(want))
+			}
+		}
+	}
+	if records, _ := p.ReverseSearch(`{"ip":"192.0.2.1"}`); reverseNames(records) != "api/A new/A www/A" {
+		t.Errorf("最终结果为 %q", reverseNames(records))
+	}
+}
+
+func TestReverseIndexRollback(t *testing.T) {
+	p := newTestZone(t, reverseLines...)
+	if err := p.WriteZoneFile(); err != nil {
+		t.Fatalf("WriteZoneFile: %v", err)
+	}
+	p.getReverseIndex()
+	if err := p.insertRecord(dnsRecord{DomainName: "new", TTL: "600", Type: "A", Data: "192.0.2.1"}); err != nil {
+		t.Fatalf("insertRecord: %v", err)
+	}
+	if records, _ := p.ReverseSearch(`{"ip":"192.0.2.1"}`); reverseNames(records) != "new/A web/A www/A" {
+		t.Errorf("插入后结果为 %q", reverseNames(records))
+	}
+	p.Rollback()
+	if records, _ := p.ReverseSearch(`{"ip":"192.0.2.1"}`); reverseNames(records) != "web/A www/A" {
+		t.Errorf("回滚后结果为 %q", reverseNames(records))
+	}
+}
+
+func TestExpandIPv9(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		ok      bool
+	}{
+		{"32768[86[21]4", "32768[86[0[0[0[0[0[0[0[4", false},
+		{"32768[86[2]4", "32768[86[0[0[4", true},
+		{"0032768[086", "32768[86", true},
+		{"1]5", "0[5", true},
+		{"32768[1.2.3.4", "32768[1.2.3.4", true},
+		{"32768", "32768", true},
+		{"", "", false},
+		{"32768[", "", false},
+		{"9]1", "", false},
+		{"0]1", "", false},
+		{"-1", "", false},
+		{"a[b", "", false},
+	}
+	for _, tt := range tests {
+		segments, ok := expandIPv9(tt.address)
+		if ok != tt.ok || (ok && strings.Join(segments, "[") != tt.want) {
+			t.Errorf("expandIPv9(%q) = %q, %v，应为 %q, %v", tt.address, strings.Join(segments, "["), ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package zonefile
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"newCHNTLDManager/dns/eppstatus"
+	"newCHNTLDManager/dns/idn"
+
+	"github.com/gogf/gf/v2/os/gfile"
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/miekg/dns"
+)
+
+// 域名状态和暂停解析时移出zone的记录保存在zone文件旁的.status文件，默认为/var/named/chn.zone.status
+func (p *ChnZone) statusPath() string {
+	return p.zonePath() + ".status"
+}
+
+// zone支持的域名状态，取值见eppstatus
+const (
+	// 暂停解析：域名及其下的记录从zone中移出，但保留，恢复时放回
+	StatusClientHold = eppstatus.ClientHold
+	StatusServerHold = eppstatus.ServerHold
+	// 锁定：拒绝修改域名及其下的记录，clientUpdateProhibited可以直接去掉
+	StatusClientUpdateProhibited = eppstatus.ClientUpdateProhibited
+	// 注册局锁定，只能通过LockDomain设置，UnlockDomain凭解锁码去掉
+	StatusServerUpdateProhibited = eppstatus.ServerUpdateProhibited
+)
+
+// 一个名字的状态
+type domainStatus struct {
+	DomainName string   `json:"domainName"`
+	Status     []string `json:"status"`
+	// 由registry根据注册数据同步的锁定，只能通过registry解锁
+	RegistryLocked bool `json:"registryLocked,omitempty"`
+	// 解锁码的bcrypt哈希
+	UnlockHash string `json:"unlockHash,omitempty"`
+	// 暂停解析时移出zone的记录行
+	Held      []heldRecord `json:"held,omitempty"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+// 移出zone的记录行和它原来所在的区域
+type heldRecord struct {
+	Section string `json:"section"`
+	Line    string `json:"line"`
+}
+
+type statusRequest struct {
+	DomainName string   `json:"domainName"`
+	Add        []string `json:"add,omitempty"`
+	Rem        []string `json:"rem,omitempty"`
+	UnlockCode string   `json:"unlockCode,omitempty"`
+}
+
+// 查询结果，unlockCode只在LockDomain时返回一次
+type statusView struct {
+	DomainName string    `json:"domainName"`
+	Status     []string  `json:"status"`
+	Locked     bool      `json:"locked"`
+	Held       bool      `json:"held"`
+	HeldCount  int       `json:"heldCount"`
+	UnlockCode string    `json:"unlockCode,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func (s *domainStatus) hasStatus(status string) bool {
+	return eppstatus.Contains(s.Status, status)
+}
+
+func (s *domainStatus) held() bool {
+	return s.hasStatus(StatusClientHold) || s.hasStatus(StatusServerHold)
+}
+
+func (s *domainStatus) locked() bool {
+	return s.RegistryLocked || s.hasStatus(StatusClientUpdateProhibited) || s.hasStatus(StatusServerUpdateProhibited)
+}
+
+func (s *domainStatus) empty() bool {
+	return len(s.Status) == 0 && !s.RegistryLocked && len(s.Held) == 0
+}
+
+func (s *domainStatus) view() statusView {
+	status := s.Status
+	if s.RegistryLocked {
+		status = append(append([]string{}, status...), "registryLocked")
+	}
+	if len(status) == 0 {
+		status = []string{"ok"}
+	}
+	return statusView{
+		DomainName: s.DomainName,
+		Status:     status,
+		Locked:     s.locked(),
+		Held:       s.held(),
+		HeldCount:  len(s.Held),
+		UpdatedAt:  s.UpdatedAt,
+	}
+}
+
+// 读取状态文件，文件不存在时没有任何状态
+func (p *ChnZone) loadStatuses() {
+	p.statuses = map[string]*domainStatus{}
+	if !gfile.Exists(p.statusPath()) {
+		return
+	}
+	var list []*domainStatus
+	if err := json.Unmarshal([]byte(gfile.GetContents(p.statusPath())), &list); err != nil {
+		fmt.Println("Error unmarshal status file:", err)
+		return
+	}
+	for _, s := range list {
+		p.statuses[s.DomainName] = s
+	}
+}
+
+func (p *ChnZone) saveStatuses() error {
+	list := make([]*domainStatus, 0, len(p.statuses))
+	for _, s := range p.statuses {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DomainName < list[j].DomainName })
+	content, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return internalError(err)
+	}
+	if err = gfile.PutBytes(p.statusPath(), content); err != nil {
+		fmt.Println("Error writing status file:", err)
+	}
+	return internalError(err)
+}
+
+// 把请求中的名字转换为相对于$ORIGIN的小写写法
+func (p *ChnZone) statusName(domainName string) (string, error) {
+	name := strings.ToLower(idn.ToASCII(gstr.Trim(domainName)))
+	if gstr.HasSuffix(name, ".") {
+		if !p.inZone(name) {
+			return "", fmt.Errorf("%s 不在zone %s 内", domainName, p.getOrigin())
+		}
+		name = p.relativize(name)
+	}
+	if name == "" || name == "@" {
+		return "", fmt.Errorf("域名不能为空，且不能是zone apex")
+	}
+	return name, nil
+}
+
+// 名字本身或其上级被锁定、暂停解析时拒绝修改
+func (p *ChnZone) checkDomainStatus(domainName string) error {
+	domainName = idn.ToASCII(domainName)
+	for _, s := range p.statuses {
+		if !p.isSubName(s.DomainName, domainName) {
+			continue
+		}
+		if s.locked() {
+			return errorf(ErrProhibited, "%s 已锁定，需要先解锁", s.DomainName)
+		}
+		if s.held() {
+			return errorf(ErrProhibited, "%s 已暂停解析，需要先恢复", s.DomainName)
+		}
+	}
+	return nil
+}
+
+// 把名字及其下的记录从zone中移出，记录所在的区域一并保存
+func (p *ChnZone) holdRecords(s *domainStatus) {
+	section := ""
+	for e := p.runtimeZoneFileList.Front(); e != nil; {
+		next := e.Next()
+		line := e.Value.(string)
+		if gstr.HasPrefix(line, "; ") {
+			section = line
+		} else if record, ok := parseRecordLine(line); ok && section != "" && record.DomainName != "@" && p.isSubName(s.DomainName, record.DomainName) {
+			s.Held = append(s.Held, heldRecord{Section: section, Line: line})
+			p.removeLine(e)
+		}
+		e = next
+	}
+}
+
+// 把移出的记录放回原来的区域
+func (p *ChnZone) releaseRecords(s *domainStatus) {
+	for i := len(s.Held) - 1; i >= 0; i-- {
+		held := s.Held[i]
+		inserted := false
+		for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+			if e.Value.(string) == held.Section {
+				p.insertLine(e, held.Line)
+				inserted = true
+				break
+			}
+		}
+		if !inserted {
+			p.insertLine(nil, held.Line)
+		}
+	}
+	s.Held = nil
+}
+
+// 修改名字的状态，add和rem只能包含hold状态和clientUpdateProhibited，
+// 注册局锁定使用LockDomain和UnlockDomain
+func (p *ChnZone) SetDomainStatus(jsonReq string) (*statusView, error) {
+	var req statusRequest
+	err := json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonRecord:", err)
+		return nil, err
+	}
+	name, err := p.statusName(req.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range append(append([]string{}, req.Add...), req.Rem...) {
+		switch status {
+		case StatusClientHold, StatusServerHold, StatusClientUpdateProhibited:
+		case StatusServerUpdateProhibited:
+			return nil, fmt.Errorf("%s 请使用LockDomain和UnlockDomain", status)
+		default:
+			return nil, fmt.Errorf("不支持的状态 %s", status)
+		}
+	}
+	s := p.statuses[name]
+	if s == nil {
+		s = &domainStatus{DomainName: name}
+	}
+	if s.RegistryLocked || s.hasStatus(StatusServerUpdateProhibited) {
+		return nil, fmt.Errorf("%s 已锁定，需要先解锁", name)
+	}
+	if s.hasStatus(StatusClientUpdateProhibited) && !eppstatus.Contains(req.Rem, StatusClientUpdateProhibited) {
+		return nil, fmt.Errorf("%s 已锁定，需要同时去掉%s", name, StatusClientUpdateProhibited)
+	}
+	// 上级名字的状态同样作用于本名字，不能在其下另行设置
+	for _, other := range p.statuses {
+		if other.DomainName != name && p.isSubName(other.DomainName, name) && (other.held() || other.locked()) {
+			return nil, fmt.Errorf("上级域名 %s 已设置状态", other.DomainName)
+		}
+	}
+
+	wasHeld := s.held()
+	var list []string
+	for _, status := range s.Status {
+		if !eppstatus.Contains(req.Rem, status) {
+			list = append(list, status)
+		}
+	}
+	for _, status := range req.Add {
+		if !eppstatus.Contains(list, status) {
+			list = append(list, status)
+		}
+	}
+	s.Status = list
+	s.UpdatedAt = time.Now().UTC()
+	p.statuses[name] = s
+
+	switch {
+	case s.held() && !wasHeld:
+		// 先保存移出的记录再写zone，写zone失败时记录仍在状态文件中
+		p.holdRecords(s)
+		if err = p.saveStatuses(); err != nil {
+			return nil, err
+		}
+		err = p.commitStatusChange()
+	case !s.held() && wasHeld:
+		p.releaseRecords(s)
+		p.dropEmptyStatus(name)
+		if err = p.commitStatusChange(); err != nil {
+			return nil, err
+		}
+		err = p.saveStatuses()
+	default:
+		p.dropEmptyStatus(name)
+		err = p.saveStatuses()
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := s.view()
+	return &res, nil
+}
+
+func (p *ChnZone) commitStatusChange() error {
+	// 递增serial
+	err := p.incrementSerial()
+	if err != nil {
+		fmt.Println("Error increment serial:", err)
+		return err
+	}
+	return p.WriteZoneFile()
+}
+
+// 注册局锁定，返回只显示一次的解锁码
+func (p *ChnZone) LockDomain(jsonReq string) (*statusView, error) {
+	var req statusRequest
+	err := json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonRecord:", err)
+		return nil, err
+	}
+	name, err := p.statusName(req.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	s := p.statuses[name]
+	if s == nil {
+		s = &domainStatus{DomainName: name}
+	}
+	if s.hasStatus(StatusServerUpdateProhibited) {
+		return nil, fmt.Errorf("%s 已经锁定", name)
+	}
+	code := eppstatus.NewUnlockCode()
+	hash, err := eppstatus.HashUnlockCode(code)
+	if err != nil {
+		return nil, fmt.Errorf("生成解锁码哈希失败: %v", err)
+	}
+	s.Status = append(s.Status, StatusServerUpdateProhibited)
+	s.UnlockHash = hash
+	s.UpdatedAt = time.Now().UTC()
+	p.statuses[name] = s
+	if err = p.saveStatuses(); err != nil {
+		return nil, err
+	}
+	res := s.view()
+	res.UnlockCode = code
+	return &res, nil
+}
+
+// 凭LockDomain返回的解锁码解除注册局锁定
+func (p *ChnZone) UnlockDomain(jsonReq string) (*statusView, error) {
+	var req statusRequest
+	err := json.Unmarshal([]byte(jsonReq), &req)
+	if err != nil {
+		fmt.Println("Error unmarshal jsonRecord:", err)
+		return nil, err
+	}
+	name, err := p.statusName(req.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	s := p.statuses[name]
+	if s == nil || !s.hasStatus(StatusServerUpdateProhibited) {
+		return nil, fmt.Errorf("%s 没有锁定", name)
+	}
+	if !eppstatus.CheckUnlockCode(s.UnlockHash, req.UnlockCode) {
+		return nil, fmt.Errorf("解锁码不正确")
+	}
+	var list []string
+	for _, status := range s.Status {
+		if status != StatusServerUpdateProhibited {
+			list = append(list, status)
+		}
+	}
+	s.Status = list
+	s.UnlockHash = ""
+	s.UpdatedAt = time.Now().UTC()
+	p.dropEmptyStatus(name)
+	if err = p.saveStatuses(); err != nil {
+		return nil, err
+	}
+	res := s.view()
+	return &res, nil
+}
+
+// 查询名字的状态，domainName为空时返回所有设置了状态的名字
+func (p *ChnZone) QueryDomainStatus(jsonReq string) ([]statusView, error) {
+	var req statusRequest
+	if gstr.Trim(jsonReq) != "" {
+		err := json.Unmarshal([]byte(jsonReq), &req)
+		if err != nil {
+			fmt.Println("Error unmarshal jsonRecord:", err)
+			return nil, err
+		}
+	}
+	res := []statusView{}
+	if gstr.Trim(req.DomainName) == "" {
+		for _, s := range p.statuses {
+			res = append(res, s.view())
+		}
+		sort.Slice(res, func(i, j int) bool { return res[i].DomainName < res[j].DomainName })
+		return res, nil
+	}
+	name, err := p.statusName(req.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	s := p.statuses[name]
+	if s == nil {
+		s = &domainStatus{DomainName: name}
+	}
+	return append(res, s.view()), nil
+}
+
+// 供registry同步注册域名的锁定状态，被锁定的域名不能通过AddDNSRecord等接口修改
+func (p *ChnZone) SetDomainLock(domainName string, locked bool) error {
+	name := p.relativize(dns.Fqdn(domainName))
+	if !p.inZone(domainName) || name == "@" {
+		return fmt.Errorf("%s 不在zone %s 内", domainName, p.getOrigin())
+	}
+	s := p.statuses[name]
+	if s == nil {
+		if !locked {
+			return nil
+		}
+		s = &domainStatus{DomainName: name}
+	}
+	if s.RegistryLocked == locked {
+		return nil
+	}
+	old := *s
+	s.RegistryLocked = locked
+	s.UpdatedAt = time.Now().UTC()
+	p.statuses[name] = s
+	p.dropEmptyStatus(name)
+	if err := p.saveStatuses(); err != nil {
+		// 保存失败时内存中的状态也不变
+		*s = old
+		p.statuses[name] = s
+		p.dropEmptyStatus(name)
+		return err
+	}
+	return nil
+}
+
+// 没有任何状态时删除名字的条目
+func (p *ChnZone) dropEmptyStatus(name string) {
+	if s := p.statuses[name]; s != nil && s.empty() {
+		delete(p.statuses, name)
+	}
+}
+
+// 清除名字及其下所有名字的状态和保存的记录，随zone修改在Commit时保存
+func (p *ChnZone) clearStatuses(name string) {
+	for key := range p.statuses {
+		if p.isSubName(name, key) {
+			delete(p.statuses, key)
+			p.statusesChanged = true
+		}
+	}
+}
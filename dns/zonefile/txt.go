@@ -0,0 +1,393 @@
+package zonefile
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	dnsname "newCHNTLDManager/dns/name"
+
+	"github.com/gogf/gf/v2/text/gstr"
+)
+
+// 邮件认证记录的版本标签，同一owner上每种只保留一条
+const (
+	spfVersion   = "v=spf1"
+	dmarcVersion = "v=DMARC1"
+	dkimVersion  = "v=DKIM1"
+)
+
+// 邮件认证记录的默认TTL
+const mailTXTTTL = "3600"
+
+// SPF需要DNS查询的机制最多10个（RFC 7208 4.6.4）
+const maxSPFLookups = 10
+
+// RSA的DKIM公钥至少1024位（RFC 8301）
+const minDKIMRSABits = 1024
+
+// SPF记录，all为-all、~all或?all，默认~all
+type spfReq struct {
+	DomainName string   `json:"domainName"`
+	TTL        string   `json:"ttl,omitempty"`
+	A          bool     `json:"a,omitempty"`
+	MX         bool     `json:"mx,omitempty"`
+	IP4        []string `json:"ip4,omitempty"`
+	IP6        []string `json:"ip6,omitempty"`
+	Include    []string `json:"include,omitempty"`
+	All        string   `json:"all,omitempty"`
+}
+
+// DMARC记录，发布在_dmarc.<domainName>，policy为none、quarantine或reject
+type dmarcReq struct {
+	DomainName      string   `json:"domainName"`
+	TTL             string   `json:"ttl,omitempty"`
+	Policy          string   `json:"policy"`
+	SubdomainPolicy string   `json:"subdomainPolicy,omitempty"`
+	Percent         *int     `json:"pct,omitempty"`
+	Rua             []string `json:"rua,omitempty"`
+	Ruf             []string `json:"ruf,omitempty"`
+	Adkim           string   `json:"adkim,omitempty"`
+	Aspf            string   `json:"aspf,omitempty"`
+}
+
+// DKIM公钥，发布在<selector>._domainkey.<domainName>，keyType为rsa或ed25519，
+// publicKey为base64或PEM格式的公钥
+type dkimReq struct {
+	DomainName string `json:"domainName"`
+	TTL        string `json:"ttl,omitempty"`
+	Selector   string `json:"selector"`
+	KeyType    string `json:"keyType,omitempty"`
+	PublicKey  string `json:"publicKey"`
+	Testing    bool   `json:"testing,omitempty"`
+}
+
+// 按参数生成并发布SPF记录，替换domainName上原有的SPF
+func (p *ChnZone) SetSPF(jsonReq string) (dnsRecord, error) {
+	var req spfReq
+	if err := json.Unmarshal([]byte(jsonReq), &req); err != nil {
+		fmt.Println("Error unmarshal jsonReq:", err)
+		return dnsRecord{}, err
+	}
+	terms := []string{spfVersion}
+	lookups := 0
+	if req.A {
+		terms = append(terms, "a")
+		lookups++
+	}
+	if req.MX {
+		terms = append(terms, "mx")
+		lookups++
+	}
+	for _, v := range req.IP4 {
+		if err := checkCIDR(v, true); err != nil {
+			return dnsRecord{}, err
+		}
+		terms = append(terms, "ip4:"+v)
+	}
+	for _, v := range req.IP6 {
+		if err := checkCIDR(v, false); err != nil {
+			return dnsRecord{}, err
+		}
+		terms = append(terms, "ip6:"+strings.ToLower(v))
+	}
+	for _, v := range req.Include {
+		// include的域名可以有下划线label，如_spf.example.com
+		name, err := dnsname.Target(v, p.getOrigin(), "CNAME")
+		if err != nil {
+			return dnsRecord{}, fmt.Errorf("include %s 不合法: %v", v, err)
+		}
+		terms = append(terms, "include:"+strings.TrimSuffix(name, "."))
+		lookups++
+	}
+	if lookups > maxSPFLookups {
+		return dnsRecord{}, fmt.Errorf("SPF需要DNS查询的机制有%d个，不能超过%d个", lookups, maxSPFLookups)
+	}
+	all := gstr.Trim(req.All)
+	if all == "" {
+		all = "~all"
+	}
+	if all != "-all" && all != "~all" && all != "?all" {
+		return dnsRecord{}, fmt.Errorf("all 只能是 -all、~all 或 ?all")
+	}
+	terms = append(terms, all)
+	return p.setMailTXT(req.DomainName, req.TTL, strings.Join(terms, " "), spfVersion)
+}
+
+// 按参数生成并发布DMARC记录，替换_dmarc.<domainName>上原有的DMARC
+func (p *ChnZone) SetDMARC(jsonReq string) (dnsRecord, error) {
+	var req dmarcReq
+	if err := json.Unmarshal([]byte(jsonReq), &req); err != nil {
+		fmt.Println("Error unmarshal jsonReq:", err)
+		return dnsRecord{}, err
+	}
+	if !isDMARCPolicy(req.Policy) {
+		return dnsRecord{}, fmt.Errorf("policy 只能是 none、quarantine 或 reject")
+	}
+	tags := []string{dmarcVersion, "p=" + req.Policy}
+	if req.SubdomainPolicy != "" {
+		if !isDMARCPolicy(req.SubdomainPolicy) {
+			return dnsRecord{}, fmt.Errorf("subdomainPolicy 只能是 none、quarantine 或 reject")
+		}
+		tags = append(tags, "sp="+req.SubdomainPolicy)
+	}
+	if req.Percent != nil {
+		if *req.Percent < 0 || *req.Percent > 100 {
+			return dnsRecord{}, fmt.Errorf("pct 必须在0到100之间")
+		}
+		tags = append(tags, "pct="+strconv.Itoa(*req.Percent))
+	}
+	for _, item := range []struct {
+		tag  string
+		list []string
+	}{{"rua", req.Rua}, {"ruf", req.Ruf}} {
+		if len(item.list) == 0 {
+			continue
+		}
+		uris := make([]string, len(item.list))
+		for i, v := range item.list {
+			uri, err := mailtoURI(v)
+			if err != nil {
+				return dnsRecord{}, fmt.Errorf("%s: %v", item.tag, err)
+			}
+			uris[i] = uri
+		}
+		tags = append(tags, item.tag+"="+strings.Join(uris, ","))
+	}
+	for _, item := range []struct{ tag, value string }{{"adkim", req.Adkim}, {"aspf", req.Aspf}} {
+		if item.value == "" {
+			continue
+		}
+		if item.value != "r" && item.value != "s" {
+			return dnsRecord{}, fmt.Errorf("%s 只能是 r 或 s", item.tag)
+		}
+		tags = append(tags, item.tag+"="+item.value)
+	}
+	return p.setMailTXT(subName("_dmarc", req.DomainName), req.TTL, strings.Join(tags, "; "), dmarcVersion)
+}
+
+// 检查公钥并发布DKIM记录，替换同一selector上原有的DKIM。RSA公钥较长，按255字节拆分为多个字符串
+func (p *ChnZone) SetDKIM(jsonReq string) (dnsRecord, error) {
+	var req dkimReq
+	if err := json.Unmarshal([]byte(jsonReq), &req); err != nil {
+		fmt.Println("Error unmarshal jsonReq:", err)
+		return dnsRecord{}, err
+	}
+	selector := strings.ToLower(gstr.Trim(req.Selector))
+	if selector == "" {
+		return dnsRecord{}, fmt.Errorf("selector不能为空")
+	}
+	keyType := req.KeyType
+	if keyType == "" {
+		keyType = "rsa"
+	}
+	key, err := dkimPublicKey(keyType, req.PublicKey)
+	if err != nil {
+		return dnsRecord{}, err
+	}
+	tags := []string{dkimVersion, "k=" + keyType}
+	if req.Testing {
+		tags = append(tags, "t=y")
+	}
+	tags = append(tags, "p="+key)
+	owner := subName(selector+"._domainkey", req.DomainName)
+	return p.setMailTXT(owner, req.TTL, strings.Join(tags, "; "), dkimVersion)
+}
+
+// 在owner上发布TXT，替换以同一版本标签开头的原有TXT
+func (p *ChnZone) setMailTXT(owner string, ttl string, data string, version string) (dnsRecord, error) {
+	if gstr.Trim(ttl) == "" {
+		ttl = mailTXTTTL
+	}
+	record := dnsRecord{DomainName: owner, TTL: ttl, Type: "TXT", Data: data}
+	if err := p.checkNewRecord(&record, false); err != nil {
+		return dnsRecord{}, err
+	}
+	// 先渲染一次，失败时不删除原有记录
+	if _, err := p.renderRecord(record); err != nil {
+		return dnsRecord{}, err
+	}
+	origin := p.getOrigin()
+	for _, stored := range p.listDNSRecords() {
+		if stored.Type == "TXT" && dnsname.Equal(stored.DomainName, record.DomainName, origin) && hasVersion(stored.Data, version) {
+			if err := p.removeStoredRecord(stored); err != nil {
+				return dnsRecord{}, err
+			}
+		}
+	}
+	if err := p.addTXTRecord(record); err != nil {
+		return dnsRecord{}, err
+	}
+	if err := p.incrementSerial(); err != nil {
+		fmt.Println("Error increment serial:", err)
+		return dnsRecord{}, err
+	}
+	record.Strings = splitTXT(record.Data)
+	return withUnicode(record), p.WriteZoneFile()
+}
+
+// TXT内容是否以版本标签开头，标签不区分大小写
+func hasVersion(data string, version string) bool {
+	if len(data) < len(version) || !strings.EqualFold(data[:len(version)], version) {
+		return false
+	}
+	rest := data[len(version):]
+	return rest == "" || rest[0] == ' ' || rest[0] == ';'
+}
+
+// 在domainName下拼接子域，domainName为空或@时为zone apex
+func subName(prefix string, domainName string) string {
+	domainName = gstr.Trim(domainName)
+	if domainName == "" || domainName == "@" {
+		return prefix
+	}
+	return prefix + "." + domainName
+}
+
+// SPF的ip4、ip6可以是地址或CIDR
+func checkCIDR(value string, v4 bool) error {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		var err error
+		ip, _, err = net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("%s 不是合法的地址或CIDR", value)
+		}
+	}
+	if (ip.To4() != nil) != v4 {
+		if v4 {
+			return fmt.Errorf("ip4 %s 不是IPv4地址", value)
+		}
+		return fmt.Errorf("ip6 %s 不是IPv6地址", value)
+	}
+	return nil
+}
+
+func isDMARCPolicy(policy string) bool {
+	return policy == "none" || policy == "quarantine" || policy == "reject"
+}
+
+// DMARC报告地址写为mailto:URI，逗号和感叹号在DMARC中有特殊含义，不能出现在地址中
+func mailtoURI(value string) (string, error) {
+	address := strings.TrimPrefix(gstr.Trim(value), "mailto:")
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || strings.ContainsAny(address, ",!;") {
+		return "", fmt.Errorf("%s 不是合法的邮件地址", value)
+	}
+	return "mailto:" + address, nil
+}
+
+// 检查DKIM公钥并返回base64写法。RSA为DER编码的SubjectPublicKeyInfo，ed25519为32字节的原始公钥
+func dkimPublicKey(keyType string, value string) (string, error) {
+	var lines []string
+	for _, line := range strings.Split(value, "\n") {
+		line = gstr.Trim(line)
+		if line == "" || strings.HasPrefix(line, "-----") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+	if err != nil || len(der) == 0 {
+		return "", fmt.Errorf("publicKey不是合法的base64")
+	}
+	switch keyType {
+	case "rsa":
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return "", fmt.Errorf("publicKey不是合法的RSA公钥: %v", err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return "", fmt.Errorf("publicKey不是RSA公钥")
+		}
+		if rsaKey.N.BitLen() < minDKIMRSABits {
+			return "", fmt.Errorf("RSA公钥不能少于%d位", minDKIMRSABits)
+		}
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return "", fmt.Errorf("ed25519公钥必须是%d字节", ed25519.PublicKeySize)
+		}
+	default:
+		return "", fmt.Errorf("keyType 只能是 rsa 或 ed25519")
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// 把旧版本以Go转义（strconv.Quote）写入的TXT和超过255字节的单个字符串改为presentation格式，返回修改的行数
+func (p *ChnZone) MigrateTXT() (int, error) {
+	count := 0
+	start := false
+	for e := p.runtimeZoneFileList.Front(); e != nil; e = e.Next() {
+		line := e.Value.(string)
+		if line == "; Nameservers" {
+			start = true
+		}
+		if !start {
+			continue
+		}
+		record, ok := parseRecordLine(line)
+		if !ok || record.Type != "TXT" {
+			continue
+		}
+		body, _ := splitComment(line)
+		quoted := body[strings.Index(body, `"`):]
+		if hasGoEscape(quoted) {
+			data, err := strconv.Unquote(quoted)
+			if err != nil {
+				continue
+			}
+			record.Data = data
+		} else if !hasLongString(record.Strings) {
+			continue
+		}
+		record.Strings = nil
+		converted, err := p.renderRecord(record)
+		if err != nil {
+			fmt.Println("txt: skip", line, ":", err)
+			continue
+		}
+		if converted != line {
+			fmt.Println("txt:", line, "=>", converted)
+			p.setLine(e, converted)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := p.incrementSerial(); err != nil {
+		return 0, err
+	}
+	return count, p.WriteZoneFile()
+}
+
+// 是否包含presentation格式中没有的Go转义，如\n、\t、\x00、\u4e2d
+func hasGoEscape(quoted string) bool {
+	for i := 0; i < len(quoted)-1; i++ {
+		if quoted[i] != '\\' {
+			continue
+		}
+		if strings.IndexByte("abfnrtvxuU", quoted[i+1]) >= 0 {
+			return true
+		}
+		i++
+	}
+	return false
+}
+
+func hasLongString(list []string) bool {
+	for _, s := range list {
+		if len(s) > maxTXTString {
+			return true
+		}
+	}
+	return false
+}
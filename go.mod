@@ -2,7 +2,12 @@ module newCHNTLDManager
 
 go 1.18
 
-require github.com/gogf/gf/v2 v2.6.1
+require (
+	github.com/gogf/gf/v2 v2.6.1
+	github.com/miekg/dns v1.1.50
+	golang.org/x/crypto v0.14.0
+	golang.org/x/net v0.17.0
+)
 
 require (
 	github.com/BurntSushi/toml v1.2.0 // indirect
@@ -22,7 +27,6 @@ require (
 	go.opentelemetry.io/otel v1.14.0 // indirect
 	go.opentelemetry.io/otel/sdk v1.14.0 // indirect
 	go.opentelemetry.io/otel/trace v1.14.0 // indirect
-	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,41 @@
+// =================================================================================
+// This is auto-generated by GoFrame CLI tool only once. Fill this file as you wish.
+// =================================================================================
+
+package dns
+
+import (
+	"encoding/json"
+	"strings"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+// ChnZone的方法接收JSON字符串，请求结构的json标签与之一致，直接编码后传入
+func encode(req interface{}) string {
+	content, _ := json.Marshal(req)
+	return string(content)
+}
+
+// 把ChnZone返回的结果转换为api中的类型
+func convert(from interface{}, to interface{}) error {
+	content, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, to)
+}
+
+// 把查询参数编码为QueryDNSRecordPage的请求，types在接口中逗号分隔，在ChnZone中为数组
+func encodeFilter(filter v1.RecordFilter) string {
+	var types []string
+	for _, t := range strings.Split(filter.Types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return encode(struct {
+		v1.RecordFilter
+		Types []string `json:"types"`
+	}{filter, types})
+}
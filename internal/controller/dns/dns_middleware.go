@@ -0,0 +1,58 @@
+package dns
+
+import (
+	"net/http"
+
+	"newCHNTLDManager/dns/zonefile"
+
+	"github.com/gogf/gf/v2/errors/gcode"
+	"github.com/gogf/gf/v2/errors/gerror"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// 写出与原有接口一致的success、msg，成功时data为返回的结构。
+// POST成功返回201，参数错误400，域名锁定或暂停解析403，不存在404，已存在409，内部错误500
+func MiddlewareResponse(r *ghttp.Request) {
+	r.Middleware.Next()
+	if r.Response.BufferLength() > 0 {
+		return
+	}
+	if err := r.GetError(); err != nil {
+		r.Response.WriteHeader(statusOf(err))
+		r.Response.WriteJson(g.Map{"success": false, "msg": err.Error()})
+		return
+	}
+	// 没有匹配的路由等情况
+	if r.Response.Status > 0 && r.Response.Status != http.StatusOK {
+		r.Response.WriteJson(g.Map{"success": false, "msg": http.StatusText(r.Response.Status)})
+		return
+	}
+	if r.Method == http.MethodPost {
+		r.Response.WriteHeader(http.StatusCreated)
+	}
+	r.Response.WriteJson(g.Map{"success": true, "msg": "ok", "data": r.GetHandlerResponse()})
+}
+
+// zone的错误大多是请求中的名字、数据不合法，没有类别时按400处理；写文件、签名失败有ErrInternal类别，按500处理
+func statusOf(err error) int {
+	switch gerror.Code(err) {
+	case gcode.CodeValidationFailed, gcode.CodeInvalidParameter:
+		return http.StatusBadRequest
+	case gcode.CodeNotFound:
+		return http.StatusNotFound
+	case gcode.CodeInternalPanic, gcode.CodeInternalError:
+		return http.StatusInternalServerError
+	}
+	switch zonefile.KindOf(err) {
+	case zonefile.ErrNotFound:
+		return http.StatusNotFound
+	case zonefile.ErrExists:
+		return http.StatusConflict
+	case zonefile.ErrProhibited:
+		return http.StatusForbidden
+	case zonefile.ErrInternal:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
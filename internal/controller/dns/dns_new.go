@@ -0,0 +1,29 @@
+package dns
+
+import (
+	"sync"
+
+	"newCHNTLDManager/api/dns"
+	"newCHNTLDManager/dns/zonefile"
+
+	"github.com/gogf/gf/v2/errors/gcode"
+	"github.com/gogf/gf/v2/errors/gerror"
+)
+
+type ControllerV1 struct {
+	zone *zonefile.ChnZone
+	// 与原有接口共用的锁，zone的读写必须串行
+	lock sync.Locker
+}
+
+func NewV1(zone *zonefile.ChnZone, lock sync.Locker) dns.IDnsV1 {
+	return &ControllerV1{zone: zone, lock: lock}
+}
+
+// 路径中的zone必须是本zone
+func (c *ControllerV1) checkZone(zone string) error {
+	if !c.zone.IsZone(zone) {
+		return gerror.NewCodef(gcode.CodeNotFound, "zone %s 不存在", zone)
+	}
+	return nil
+}
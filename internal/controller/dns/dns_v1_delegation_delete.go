@@ -0,0 +1,13 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) DelegationDelete(ctx context.Context, req *v1.DelegationDeleteReq) (res *v1.DelegationDeleteRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return &v1.DelegationDeleteRes{}, c.zone.RemoveDelegation(encode(req))
+}
@@ -0,0 +1,24 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) DelegationList(ctx context.Context, req *v1.DelegationListReq) (res *v1.DelegationListRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delegations, err := c.zone.QueryDelegation(encode(req))
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.DelegationListRes{Delegations: []v1.Delegation{}}
+	if len(delegations) > 0 {
+		if err = convert(delegations, &res.Delegations); err != nil {
+			return nil, err
+		}
+	}
+	res.TotalCount = len(res.Delegations)
+	return
+}
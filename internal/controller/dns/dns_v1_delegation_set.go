@@ -0,0 +1,13 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) DelegationSet(ctx context.Context, req *v1.DelegationSetReq) (res *v1.DelegationSetRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return &v1.DelegationSetRes{}, c.zone.SetDelegation(encode(req))
+}
@@ -0,0 +1,19 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) DKIMSet(ctx context.Context, req *v1.DKIMSetReq) (res *v1.DKIMSetRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	record, err := c.zone.SetDKIM(encode(req))
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.DKIMSetRes{}
+	err = convert(record, &res.Record)
+	return
+}
@@ -0,0 +1,19 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) DMARCSet(ctx context.Context, req *v1.DMARCSetReq) (res *v1.DMARCSetRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	record, err := c.zone.SetDMARC(encode(req))
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.DMARCSetRes{}
+	err = convert(record, &res.Record)
+	return
+}
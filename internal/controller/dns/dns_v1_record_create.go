@@ -0,0 +1,19 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) RecordCreate(ctx context.Context, req *v1.RecordCreateReq) (res *v1.RecordCreateRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	record, err := c.zone.CreateRecord(encode(req))
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.RecordCreateRes{}
+	err = convert(record, &res.Record)
+	return
+}
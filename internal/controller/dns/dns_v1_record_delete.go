@@ -0,0 +1,13 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) RecordDelete(ctx context.Context, req *v1.RecordDeleteReq) (res *v1.RecordDeleteRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return &v1.RecordDeleteRes{}, c.zone.DelDNSRecord(encode(req))
+}
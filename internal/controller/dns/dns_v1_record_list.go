@@ -0,0 +1,19 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) RecordList(ctx context.Context, req *v1.RecordListReq) (res *v1.RecordListRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	page, err := c.zone.QueryDNSRecordPage(encodeFilter(req.RecordFilter))
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.RecordListRes{}
+	err = convert(page, res)
+	return
+}
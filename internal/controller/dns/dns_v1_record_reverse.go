@@ -0,0 +1,22 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) RecordReverse(ctx context.Context, req *v1.RecordReverseReq) (res *v1.RecordReverseRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	records, err := c.zone.ReverseSearch(encode(req))
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.RecordReverseRes{Records: []v1.Record{}}
+	if err = convert(records, &res.Records); err != nil {
+		return nil, err
+	}
+	res.TotalCount = len(res.Records)
+	return
+}
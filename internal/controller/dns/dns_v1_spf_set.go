@@ -0,0 +1,19 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) SPFSet(ctx context.Context, req *v1.SPFSetReq) (res *v1.SPFSetRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	record, err := c.zone.SetSPF(encode(req))
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.SPFSetRes{}
+	err = convert(record, &res.Record)
+	return
+}
@@ -0,0 +1,22 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) ZoneRecordCreate(ctx context.Context, req *v1.ZoneRecordCreateReq) (res *v1.ZoneRecordCreateRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err = c.checkZone(req.Zone); err != nil {
+		return nil, err
+	}
+	record, err := c.zone.CreateRecord(encode(req))
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.ZoneRecordCreateRes{}
+	err = convert(record, &res.Record)
+	return
+}
@@ -0,0 +1,16 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) ZoneRecordDelete(ctx context.Context, req *v1.ZoneRecordDeleteReq) (res *v1.ZoneRecordDeleteRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err = c.checkZone(req.Zone); err != nil {
+		return nil, err
+	}
+	return &v1.ZoneRecordDeleteRes{}, c.zone.DeleteRecord(req.ID)
+}
@@ -0,0 +1,22 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) ZoneRecordGet(ctx context.Context, req *v1.ZoneRecordGetReq) (res *v1.ZoneRecordGetRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err = c.checkZone(req.Zone); err != nil {
+		return nil, err
+	}
+	record, err := c.zone.GetRecord(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.ZoneRecordGetRes{}
+	err = convert(record, &res.Record)
+	return
+}
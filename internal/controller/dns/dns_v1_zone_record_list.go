@@ -0,0 +1,22 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) ZoneRecordList(ctx context.Context, req *v1.ZoneRecordListReq) (res *v1.ZoneRecordListRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err = c.checkZone(req.Zone); err != nil {
+		return nil, err
+	}
+	page, err := c.zone.QueryDNSRecordPage(encodeFilter(req.RecordFilter))
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.ZoneRecordListRes{}
+	err = convert(page, res)
+	return
+}
@@ -0,0 +1,22 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) ZoneRecordPatch(ctx context.Context, req *v1.ZoneRecordPatchReq) (res *v1.ZoneRecordPatchRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err = c.checkZone(req.Zone); err != nil {
+		return nil, err
+	}
+	record, err := c.zone.UpdateRecord(req.ID, encode(req), true)
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.ZoneRecordPatchRes{}
+	err = convert(record, &res.Record)
+	return
+}
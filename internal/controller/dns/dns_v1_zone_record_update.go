@@ -0,0 +1,22 @@
+package dns
+
+import (
+	"context"
+
+	"newCHNTLDManager/api/dns/v1"
+)
+
+func (c *ControllerV1) ZoneRecordUpdate(ctx context.Context, req *v1.ZoneRecordUpdateReq) (res *v1.ZoneRecordUpdateRes, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err = c.checkZone(req.Zone); err != nil {
+		return nil, err
+	}
+	record, err := c.zone.UpdateRecord(req.ID, encode(req), false)
+	if err != nil {
+		return nil, err
+	}
+	res = &v1.ZoneRecordUpdateRes{}
+	err = convert(record, &res.Record)
+	return
+}
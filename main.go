@@ -1,14 +1,30 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	_ "newCHNTLDManager/internal/packed"
+	"strings"
 	"sync"
+	"time"
 
+	"newCHNTLDManager/dns/dnssec"
+	"newCHNTLDManager/dns/idn"
+	"newCHNTLDManager/dns/policy"
 	"newCHNTLDManager/dns/service"
 	"newCHNTLDManager/dns/zonefile"
+	dnsctl "newCHNTLDManager/internal/controller/dns"
+	"newCHNTLDManager/registry"
+	"newCHNTLDManager/registry/epp"
+	"newCHNTLDManager/registry/escrow"
+	"newCHNTLDManager/registry/rdap"
+	"newCHNTLDManager/registry/whois"
 
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/gtimer"
 	//"github.com/gogf/gf/v2/os/gctx"
 	//"newCHNTLDManager/internal/cmd"
 )
@@ -21,12 +37,217 @@ func main() {
 	var mLock = new(sync.Mutex)
 	chnZone := new(zonefile.ChnZone)
 	chnZone.Init()
+	ctx := gctx.GetInitCtx()
+
+	// DNSSEC签名
+	dnssecCfg, err := dnssec.LoadConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	if dnssecCfg.Enabled {
+		signer, err := dnssec.NewSigner(dnssecCfg, "chn.")
+		if err != nil {
+			panic(err)
+		}
+		chnZone.SetSigner(signer)
+		gtimer.AddSingleton(ctx, dnssecCfg.CheckIntervalDuration(), func(ctx context.Context) {
+			mLock.Lock()
+			err := chnZone.RunKeyRollover()
+			if err != nil {
+				fmt.Println("Error key rollover:", err)
+			}
+			resigned, err := chnZone.ResignZone()
+			mLock.Unlock()
+			if err != nil {
+				fmt.Println("Error resign zone:", err)
+				return
+			}
+			if resigned {
+				out, err := service.ReloadZone()
+				if err != nil {
+					fmt.Println("Error reload zone:", err, out)
+				}
+			}
+		})
+	}
+
+	// 委派子域的DS管理，CDS扫描在网络查询期间不持有mLock
+	dsCfg, err := zonefile.LoadDSConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	chnZone.SetDSConfig(dsCfg)
+	if dsCfg.CDSScan {
+		gtimer.AddSingleton(ctx, dsCfg.CDSScanIntervalDuration(), func(ctx context.Context) {
+			changes, err := chnZone.ScanCDS(mLock)
+			if err != nil {
+				fmt.Println("Error scan CDS:", err)
+			}
+			for _, change := range changes {
+				fmt.Println("CDS scan:", change.DomainName, change.Action, change.NewDS, change.Msg)
+			}
+		})
+	}
+
+	// 委派子域健康检查，网络查询期间不持有mLock
+	healthCfg, err := zonefile.LoadHealthConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	chnZone.SetHealthConfig(healthCfg)
+	if healthCfg.Enabled {
+		gtimer.AddSingleton(ctx, healthCfg.ScanIntervalDuration(), func(ctx context.Context) {
+			mLock.Lock()
+			origin := chnZone.Origin()
+			delegations, err := chnZone.QueryDelegation("")
+			mLock.Unlock()
+			if err != nil {
+				fmt.Println("Error query delegation:", err)
+				return
+			}
+			chnZone.ScanDelegationHealth(origin, delegations, true)
+		})
+	}
+
+	// 保留、禁止、溢价名字，注册域名和AddDNSRecord都按此检查
+	policyCfg, err := policy.LoadConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	policyTable, err := policy.New(policyCfg)
+	if err != nil {
+		panic(err)
+	}
+	chnZone.SetPolicy(policyTable)
+
+	// IDN字符表和变体，zone和注册数据中的IDN统一保存为A-label
+	idnCfg, err := idn.LoadConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	idnTable, err := idn.New(idnCfg)
+	if err != nil {
+		panic(err)
+	}
+	chnZone.SetIDN(idnTable)
+	if n, err := chnZone.MigrateIDN(); err != nil {
+		fmt.Println("Error migrate idn:", err)
+	} else if n > 0 {
+		fmt.Println("idn: converted", n, "records to A-label")
+	}
+	if n, err := chnZone.MigrateTXT(); err != nil {
+		fmt.Println("Error migrate txt:", err)
+	} else if n > 0 {
+		fmt.Println("txt: converted", n, "records to presentation format")
+	}
+	if n, err := chnZone.MigrateRecordIDs(); err != nil {
+		fmt.Println("Error assign record ids:", err)
+	} else if n > 0 {
+		fmt.Println("record id: assigned", n, "records")
+	}
+
+	// 注册局数据，域名状态决定zone中发布的委派
+	registryCfg, err := registry.LoadConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	reg, err := registry.New(registryCfg, chnZone)
+	if err != nil {
+		panic(err)
+	}
+	reg.SetPolicy(policyTable)
+	reg.SetIDN(idnTable)
+
+	// 原注册商超时未处理的转移申请自动批准
+	gtimer.AddSingleton(ctx, registryCfg.Transfer.CheckIntervalDuration(), func(ctx context.Context) {
+		if _, err := reg.RunTransfers(time.Now()); err != nil {
+			fmt.Println("Error run transfers:", err)
+		}
+	})
+
+	// 域名到期、赎回、清除，每批变化提交一次zone
+	if registryCfg.Lifecycle.Enabled {
+		gtimer.AddSingleton(ctx, registryCfg.Lifecycle.CheckIntervalDuration(), func(ctx context.Context) {
+			mLock.Lock()
+			defer mLock.Unlock()
+			if _, err := reg.RunLifecycle(time.Now()); err != nil {
+				fmt.Println("Error run lifecycle:", err)
+			}
+		})
+	}
+
+	// 已结束阶段的申请分配，分配成功时创建域名并发布委派
+	if len(registryCfg.Launch.Phases) > 0 {
+		gtimer.AddSingleton(ctx, registryCfg.Launch.CheckIntervalDuration(), func(ctx context.Context) {
+			mLock.Lock()
+			defer mLock.Unlock()
+			if _, err := reg.RunLaunch(time.Now()); err != nil {
+				fmt.Println("Error run launch:", err)
+			}
+		})
+	}
+
+	// 注册数据托管，按间隔生成全量或增量托管文件
+	escrowCfg, err := escrow.LoadConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	rde := escrow.New(escrowCfg, reg)
+	if escrowCfg.Enabled {
+		gtimer.AddSingleton(ctx, escrowCfg.CheckIntervalDuration(), func(ctx context.Context) {
+			if _, err := rde.Run(time.Now()); err != nil {
+				fmt.Println("Error run escrow:", err)
+			}
+		})
+	}
+
+	// 注册商使用的EPP服务
+	eppCfg, err := epp.LoadConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	if eppCfg.Enabled {
+		if err = epp.NewServer(eppCfg, reg, mLock).Start(); err != nil {
+			panic(err)
+		}
+	}
+
+	// 公开的WHOIS查询服务
+	whoisCfg, err := whois.LoadConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	if whoisCfg.Enabled {
+		whoisServer, err := whois.NewServer(whoisCfg, reg)
+		if err != nil {
+			panic(err)
+		}
+		if err = whoisServer.Start(); err != nil {
+			panic(err)
+		}
+	}
+
 	s := g.Server()
 
+	// RDAP查询接口，与WHOIS共用隐藏个人信息的规则
+	rdapCfg, err := rdap.LoadConfig(ctx)
+	if err != nil {
+		panic(err)
+	}
+	if rdapCfg.Enabled {
+		rdap.NewServer(rdapCfg, reg).Bind(s)
+	}
+
+	// 结构化的REST接口，OpenAPI文档见server.openapiPath，下面的原有接口保留为兼容别名
+	s.Group("/api/v1", func(group *ghttp.RouterGroup) {
+		group.Middleware(dnsctl.MiddlewareResponse)
+		group.Bind(dnsctl.NewV1(chnZone, mLock))
+	})
+
 	//测试
 	s.BindHandler("/QueryDNSRecord", func(r *ghttp.Request) {
 		mLock.Lock()
-		res, err := chnZone.QueryDNSRecord(r.GetBodyString())
+		page, err := chnZone.QueryDNSRecordPage(r.GetBodyString())
 		defer mLock.Unlock()
 		if err != nil {
 			r.Response.WriteJsonExit(g.Map{
@@ -37,8 +258,9 @@ func main() {
 			r.Response.WriteJsonExit(g.Map{
 				"success":        true,
 				"msg":            "ok",
-				"totalCount":     len(res),
-				"recordListJson": res,
+				"totalCount":     page.TotalCount,
+				"recordListJson": page.Records,
+				"nextCursor":     page.NextCursor,
 			})
 		}
 
@@ -78,6 +300,779 @@ func main() {
 		}
 	})
 
+	// 按参数生成SPF、DMARC、DKIM记录，替换同一名字上原有的同类记录
+	s.BindHandler("/SetSPF", func(r *ghttp.Request) {
+		mLock.Lock()
+		defer mLock.Unlock()
+		res, err := chnZone.SetSPF(r.GetBodyString())
+		writeResult(r, err, g.Map{"record": res})
+	})
+
+	s.BindHandler("/SetDMARC", func(r *ghttp.Request) {
+		mLock.Lock()
+		defer mLock.Unlock()
+		res, err := chnZone.SetDMARC(r.GetBodyString())
+		writeResult(r, err, g.Map{"record": res})
+	})
+
+	s.BindHandler("/SetDKIM", func(r *ghttp.Request) {
+		mLock.Lock()
+		defer mLock.Unlock()
+		res, err := chnZone.SetDKIM(r.GetBodyString())
+		writeResult(r, err, g.Map{"record": res})
+	})
+
+	// 反查引用某个地址、网段或目标的记录
+	s.BindHandler("/ReverseSearch", func(r *ghttp.Request) {
+		mLock.Lock()
+		defer mLock.Unlock()
+		res, err := chnZone.ReverseSearch(r.GetBodyString())
+		writeResult(r, err, g.Map{"totalCount": len(res), "recordListJson": res})
+	})
+
+	s.BindHandler("/QueryDSRecord", func(r *ghttp.Request) {
+		mLock.Lock()
+		res, err := chnZone.QueryDSRecord()
+		defer mLock.Unlock()
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		} else {
+			r.Response.WriteJsonExit(g.Map{
+				"success":        true,
+				"msg":            "ok",
+				"totalCount":     len(res),
+				"recordListJson": res,
+			})
+		}
+	})
+
+	s.BindHandler("/SetDelegation", func(r *ghttp.Request) {
+		mLock.Lock()
+		err := chnZone.SetDelegation(r.GetBodyString())
+		defer mLock.Unlock()
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		} else {
+			r.Response.WriteJsonExit(g.Map{
+				"success": true,
+				"msg":     "ok",
+			})
+		}
+	})
+
+	s.BindHandler("/RemoveDelegation", func(r *ghttp.Request) {
+		mLock.Lock()
+		err := chnZone.RemoveDelegation(r.GetBodyString())
+		defer mLock.Unlock()
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		} else {
+			r.Response.WriteJsonExit(g.Map{
+				"success": true,
+				"msg":     "ok",
+			})
+		}
+	})
+
+	s.BindHandler("/QueryDelegation", func(r *ghttp.Request) {
+		mLock.Lock()
+		res, err := chnZone.QueryDelegation(r.GetBodyString())
+		defer mLock.Unlock()
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		} else {
+			r.Response.WriteJsonExit(g.Map{
+				"success":            true,
+				"msg":                "ok",
+				"totalCount":         len(res),
+				"delegationListJson": res,
+			})
+		}
+	})
+
+	s.BindHandler("/ScanCDS", func(r *ghttp.Request) {
+		res, err := chnZone.ScanCDS(mLock)
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		} else {
+			r.Response.WriteJsonExit(g.Map{
+				"success":        true,
+				"msg":            "ok",
+				"totalCount":     len(res),
+				"changeListJson": res,
+			})
+		}
+	})
+
+	s.BindHandler("/QueryDelegationHealth", func(r *ghttp.Request) {
+		res, err := chnZone.QueryDelegationHealth(r.GetBodyString())
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		} else {
+			r.Response.WriteJsonExit(g.Map{
+				"success":        true,
+				"msg":            "ok",
+				"totalCount":     len(res),
+				"reportListJson": res,
+			})
+		}
+	})
+
+	// 立即检查，请求体为空时检查全部委派
+	s.BindHandler("/ScanDelegationHealth", func(r *ghttp.Request) {
+		body := r.GetBodyString()
+		mLock.Lock()
+		origin := chnZone.Origin()
+		delegations, err := chnZone.QueryDelegation(body)
+		mLock.Unlock()
+		if err == nil && len(delegations) == 0 {
+			err = fmt.Errorf("没有找到委派")
+		}
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		}
+		res := chnZone.ScanDelegationHealth(origin, delegations, body == "")
+		r.Response.WriteJsonExit(g.Map{
+			"success":        true,
+			"msg":            "ok",
+			"totalCount":     len(res),
+			"reportListJson": res,
+		})
+	})
+
+	s.BindHandler("/QueryDNSSECKeyStatus", func(r *ghttp.Request) {
+		mLock.Lock()
+		res, err := chnZone.QueryKeyStatus()
+		defer mLock.Unlock()
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		} else {
+			r.Response.WriteJsonExit(g.Map{
+				"success":     true,
+				"msg":         "ok",
+				"totalCount":  len(res),
+				"keyListJson": res,
+			})
+		}
+	})
+
+	s.BindHandler("/StartKeyRollover", func(r *ghttp.Request) {
+		mLock.Lock()
+		err := chnZone.StartKeyRollover(r.GetBodyString())
+		defer mLock.Unlock()
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		} else {
+			r.Response.WriteJsonExit(g.Map{
+				"success": true,
+				"msg":     "ok",
+			})
+		}
+	})
+
+	s.BindHandler("/ConfirmDSPublished", func(r *ghttp.Request) {
+		mLock.Lock()
+		err := chnZone.ConfirmDSPublished(r.GetBodyString())
+		defer mLock.Unlock()
+		if err != nil {
+			r.Response.WriteJsonExit(g.Map{
+				"success": false,
+				"msg":     err.Error(),
+			})
+		} else {
+			r.Response.WriteJsonExit(g.Map{
+				"success": true,
+				"msg":     "ok",
+			})
+		}
+	})
+
+	// 注册局：注册商、联系人、主机、域名
+	s.BindHandler("/CreateRegistrar", func(r *ghttp.Request) {
+		var req registry.Registrar
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.CreateRegistrar(req)
+		writeResult(r, err, g.Map{"registrar": res})
+	})
+
+	// 设置注册商的EPP登录密码
+	s.BindHandler("/SetRegistrarPassword", func(r *ghttp.Request) {
+		var req struct {
+			ID       string `json:"id"`
+			Password string `json:"password"`
+		}
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		writeResult(r, reg.SetRegistrarPassword(req.ID, req.Password), nil)
+	})
+
+	s.BindHandler("/CreateContact", func(r *ghttp.Request) {
+		var req registry.Contact
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.CreateContact(req)
+		writeResult(r, err, g.Map{"contact": res})
+	})
+
+	s.BindHandler("/UpdateContact", func(r *ghttp.Request) {
+		var req registry.Contact
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.UpdateContact(req)
+		writeResult(r, err, g.Map{"contact": res})
+	})
+
+	s.BindHandler("/DeleteContact", func(r *ghttp.Request) {
+		var req registry.Contact
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		writeResult(r, reg.DeleteContact(req.ID, req.RegistrarID), nil)
+	})
+
+	s.BindHandler("/CreateHost", func(r *ghttp.Request) {
+		var req registry.Host
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.CreateHost(req)
+		writeResult(r, err, g.Map{"host": res})
+	})
+
+	s.BindHandler("/UpdateHost", func(r *ghttp.Request) {
+		var req registry.Host
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		res, err := reg.UpdateHost(req)
+		mLock.Unlock()
+		writeResult(r, err, g.Map{"host": res})
+	})
+
+	s.BindHandler("/DeleteHost", func(r *ghttp.Request) {
+		var req registry.Host
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		writeResult(r, reg.DeleteHost(req.Name, req.RegistrarID), nil)
+	})
+
+	s.BindHandler("/CreateDomain", func(r *ghttp.Request) {
+		var req struct {
+			registry.Domain
+			Years int `json:"years"`
+			// 注册局人员的override口令，可以注册保留和禁止的名字
+			Override string `json:"override"`
+			// 商标声明期内已确认的声明ID，由/ClaimsNotice取得
+			NoticeID string `json:"noticeId"`
+		}
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		res, err := reg.CreateDomain(req.Domain, req.Years, policyTable.Override(req.Override), req.NoticeID)
+		mLock.Unlock()
+		writeResult(r, err, g.Map{"domain": res})
+	})
+
+	s.BindHandler("/UpdateDomain", func(r *ghttp.Request) {
+		var req registry.Domain
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		res, err := reg.UpdateDomain(req)
+		mLock.Unlock()
+		writeResult(r, err, g.Map{"domain": res})
+	})
+
+	s.BindHandler("/SuspendDomain", func(r *ghttp.Request) {
+		var req registry.Domain
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		err := reg.SuspendDomain(req.Name)
+		mLock.Unlock()
+		writeResult(r, err, nil)
+	})
+
+	s.BindHandler("/UnsuspendDomain", func(r *ghttp.Request) {
+		var req registry.Domain
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		err := reg.UnsuspendDomain(req.Name)
+		mLock.Unlock()
+		writeResult(r, err, nil)
+	})
+
+	s.BindHandler("/DeleteDomain", func(r *ghttp.Request) {
+		var req registry.Domain
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		err := reg.DeleteDomain(req.Name, req.RegistrarID)
+		mLock.Unlock()
+		writeResult(r, err, nil)
+	})
+
+	// 赎回期内恢复域名
+	s.BindHandler("/RestoreDomain", func(r *ghttp.Request) {
+		var req registry.Domain
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		res, err := reg.RestoreDomain(req.Name, req.RegistrarID)
+		mLock.Unlock()
+		writeResult(r, err, g.Map{"domain": res})
+	})
+
+	// 批量检查名字能否注册，suggest大于0时给出替代名字
+	s.BindHandler("/CheckAvailability", func(r *ghttp.Request) {
+		var req struct {
+			Names   []string `json:"names"`
+			Suggest int      `json:"suggest"`
+		}
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.CheckAvailability(req.Names, req.Suggest)
+		writeResult(r, err, g.Map{"totalCount": len(res), "resultListJson": res})
+	})
+
+	// 商标库，sunrise申请和商标声明使用
+	s.BindHandler("/AddMark", func(r *ghttp.Request) {
+		var req registry.Mark
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.AddMark(req)
+		writeResult(r, err, g.Map{"mark": res})
+	})
+
+	s.BindHandler("/DelMark", func(r *ghttp.Request) {
+		var req registry.Mark
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		writeResult(r, reg.DeleteMark(req.ID), nil)
+	})
+
+	s.BindHandler("/QueryMark", func(r *ghttp.Request) {
+		res := reg.ListMarks()
+		writeResult(r, nil, g.Map{"totalCount": len(res), "markListJson": res})
+	})
+
+	// 名字的商标声明，notice为null时不需要确认
+	s.BindHandler("/ClaimsNotice", func(r *ghttp.Request) {
+		var req registry.Domain
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.ClaimsNotice(req.Name)
+		writeResult(r, err, g.Map{"notice": res})
+	})
+
+	s.BindHandler("/QueryLaunchPhase", func(r *ghttp.Request) {
+		writeResult(r, nil, g.Map{"phase": reg.CurrentPhase(time.Now()), "phases": registryCfg.Launch.Phases})
+	})
+
+	// sunrise、landrush阶段的域名申请，阶段结束后分配
+	s.BindHandler("/CreateApplication", func(r *ghttp.Request) {
+		var req registry.Application
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.CreateApplication(req)
+		writeResult(r, err, g.Map{"application": res})
+	})
+
+	s.BindHandler("/WithdrawApplication", func(r *ghttp.Request) {
+		var req registry.Application
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		writeResult(r, reg.WithdrawApplication(req.ID, req.RegistrarID), nil)
+	})
+
+	// id为空时按name、registrarId列出申请
+	s.BindHandler("/QueryApplication", func(r *ghttp.Request) {
+		var req registry.Application
+		if len(r.GetBody()) > 0 {
+			if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+				writeResult(r, err, nil)
+			}
+		}
+		if req.ID == "" {
+			res := reg.ListApplications(req.Name, req.RegistrarID)
+			writeResult(r, nil, g.Map{"totalCount": len(res), "applicationListJson": res})
+		}
+		res, err := reg.GetApplication(req.ID)
+		writeResult(r, err, g.Map{"application": res})
+	})
+
+	// 注册局人员直接把名字分配给某个申请，同名的其他申请被拒绝并退款
+	s.BindHandler("/AllocateApplication", func(r *ghttp.Request) {
+		var req registry.Application
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		res, err := reg.AllocateApplication(req.ID)
+		mLock.Unlock()
+		writeResult(r, err, g.Map{"domain": res})
+	})
+
+	// 名字的A-label、U-label写法和变体，按zone的顶级域检查字符表
+	s.BindHandler("/ConvertIDN", func(r *ghttp.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(req.Name), "."))
+		res, err := idnTable.Name(registryCfg.TLD, name)
+		if err != nil {
+			writeResult(r, err, nil)
+		}
+		labels := strings.Split(res.ALabel, ".")
+		writeResult(r, nil, g.Map{"aLabel": res.ALabel, "uLabel": res.ULabel, "variants": idnTable.Variants(labels[0])})
+	})
+
+	// 策略表条目只能由注册局人员凭override口令修改，配置文件中的条目不能通过接口删除
+	s.BindHandler("/AddPolicyEntry", func(r *ghttp.Request) {
+		var req policyReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		if !policyTable.Override(req.Override) {
+			writeResult(r, fmt.Errorf("修改策略表需要注册局的override口令"), nil)
+		}
+		res, err := policyTable.Add(req.Entry)
+		writeResult(r, err, g.Map{"entry": res})
+	})
+
+	s.BindHandler("/DelPolicyEntry", func(r *ghttp.Request) {
+		var req policyReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		if !policyTable.Override(req.Override) {
+			writeResult(r, fmt.Errorf("修改策略表需要注册局的override口令"), nil)
+		}
+		writeResult(r, policyTable.Remove(req.Kind, req.Pattern, req.Match), nil)
+	})
+
+	// name不为空时返回匹配该名字的条目，否则按kind列出
+	s.BindHandler("/QueryPolicy", func(r *ghttp.Request) {
+		var req struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		}
+		if len(r.GetBody()) > 0 {
+			if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+				writeResult(r, err, nil)
+			}
+		}
+		if req.Name != "" {
+			labels := strings.Split(strings.TrimSuffix(strings.ToLower(req.Name), "."+registryCfg.TLD), ".")
+			label := labels[len(labels)-1]
+			writeResult(r, nil, g.Map{"name": req.Name, "entry": policyTable.Match(label)})
+		}
+		res := policyTable.List(req.Kind)
+		writeResult(r, nil, g.Map{"totalCount": len(res), "entryListJson": res})
+	})
+
+	// 域名状态：注册域名由注册局处理，其余名字直接在zone上设置
+	s.BindHandler("/SetDomainStatus", func(r *ghttp.Request) {
+		var req domainStatusReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		defer mLock.Unlock()
+		if name, ok := registryDomain(reg, req.DomainName); ok {
+			res, err := reg.SetDomainStatus(name, req.RegistrarID, req.Add, req.Rem)
+			writeResult(r, err, g.Map{"domain": res})
+		}
+		res, err := chnZone.SetDomainStatus(r.GetBodyString())
+		writeResult(r, err, g.Map{"status": res})
+	})
+
+	// 注册局锁定，解锁码只返回这一次
+	s.BindHandler("/LockDomain", func(r *ghttp.Request) {
+		var req domainStatusReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		defer mLock.Unlock()
+		if name, ok := registryDomain(reg, req.DomainName); ok {
+			code, err := reg.LockDomain(name)
+			if err != nil && code != "" {
+				// 已锁定但zone同步失败且无法撤销，解锁码只有这一次机会返回
+				r.Response.WriteJsonExit(g.Map{"success": false, "msg": err.Error(), "unlockCode": code})
+			}
+			writeResult(r, err, g.Map{"unlockCode": code})
+		}
+		res, err := chnZone.LockDomain(r.GetBodyString())
+		if err != nil {
+			writeResult(r, err, nil)
+		}
+		writeResult(r, nil, g.Map{"unlockCode": res.UnlockCode, "status": res})
+	})
+
+	s.BindHandler("/UnlockDomain", func(r *ghttp.Request) {
+		var req domainStatusReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		mLock.Lock()
+		defer mLock.Unlock()
+		if name, ok := registryDomain(reg, req.DomainName); ok {
+			writeResult(r, reg.UnlockDomain(name, req.UnlockCode), nil)
+		}
+		res, err := chnZone.UnlockDomain(r.GetBodyString())
+		writeResult(r, err, g.Map{"status": res})
+	})
+
+	// domainName为空时列出zone上设置了状态的名字
+	s.BindHandler("/QueryDomainStatus", func(r *ghttp.Request) {
+		var req domainStatusReq
+		if len(r.GetBody()) > 0 {
+			if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+				writeResult(r, err, nil)
+			}
+		}
+		mLock.Lock()
+		defer mLock.Unlock()
+		if name, ok := registryDomain(reg, req.DomainName); ok {
+			dom, err := reg.GetDomain(name)
+			if err != nil {
+				writeResult(r, err, nil)
+			}
+			res := []g.Map{{"domainName": dom.Name, "status": dom.Status, "locked": dom.Locked(), "held": dom.HasStatus(registry.StatusClientHold) || dom.HasStatus(registry.StatusServerHold)}}
+			writeResult(r, nil, g.Map{"totalCount": len(res), "statusListJson": res})
+		}
+		res, err := chnZone.QueryDomainStatus(r.GetBodyString())
+		writeResult(r, err, g.Map{"totalCount": len(res), "statusListJson": res})
+	})
+
+	// 管理注册商重新生成域名的authInfo
+	s.BindHandler("/GenerateAuthInfo", func(r *ghttp.Request) {
+		var req transferReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		if err := authRegistrar(reg, policyTable, req.RegistrarID, req.Password, req.Override); err != nil {
+			writeResult(r, err, nil)
+		}
+		code, err := reg.GenerateAuthInfo(req.Name, req.RegistrarID)
+		writeResult(r, err, g.Map{"authInfo": code})
+	})
+
+	s.BindHandler("/VerifyAuthInfo", func(r *ghttp.Request) {
+		var req transferReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		if err := authRegistrar(reg, policyTable, req.RegistrarID, req.Password, req.Override); err != nil {
+			writeResult(r, err, nil)
+		}
+		writeResult(r, reg.VerifyAuthInfo(req.Name, req.AuthInfo), nil)
+	})
+
+	// 转移操作：request由转入注册商提交，approve、reject由原注册商处理，cancel由转入注册商撤回
+	s.BindHandler("/TransferDomain", func(r *ghttp.Request) {
+		var req transferReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		if err := authRegistrar(reg, policyTable, req.RegistrarID, req.Password, req.Override); err != nil {
+			writeResult(r, err, nil)
+		}
+		var res *registry.Transfer
+		var err error
+		switch req.Op {
+		case "request":
+			res, err = reg.RequestTransfer(req.Name, req.RegistrarID, req.AuthInfo, req.Years)
+		case "approve":
+			res, err = reg.ApproveTransfer(req.Name, req.RegistrarID)
+		case "reject":
+			res, err = reg.RejectTransfer(req.Name, req.RegistrarID)
+		case "cancel":
+			res, err = reg.CancelTransfer(req.Name, req.RegistrarID)
+		case "query":
+			res, err = reg.QueryTransfer(req.Name, req.RegistrarID)
+		default:
+			err = fmt.Errorf("不支持的转移操作 %s", req.Op)
+		}
+		writeResult(r, err, g.Map{"transfer": res})
+	})
+
+	// 取注册商队列中最早的消息，ackId不为0时先确认该消息
+	s.BindHandler("/PollMessage", func(r *ghttp.Request) {
+		var req struct {
+			RegistrarID string `json:"registrarId"`
+			AckID       uint64 `json:"ackId"`
+		}
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		if req.AckID != 0 {
+			if _, err := reg.AckMessage(req.RegistrarID, req.AckID); err != nil {
+				writeResult(r, err, nil)
+			}
+		}
+		msg, count := reg.Poll(req.RegistrarID)
+		writeResult(r, nil, g.Map{"message": msg, "count": count})
+	})
+
+	// 注册商充值，amount单位为分，负数为注册局调整
+	s.BindHandler("/Deposit", func(r *ghttp.Request) {
+		var req billingReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.Deposit(req.RegistrarID, req.Amount, req.Memo)
+		writeResult(r, err, g.Map{"entry": res})
+	})
+
+	s.BindHandler("/QueryBalance", func(r *ghttp.Request) {
+		var req billingReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := reg.GetRegistrar(req.RegistrarID)
+		if err != nil {
+			writeResult(r, err, nil)
+		}
+		billing := reg.Config().Billing
+		writeResult(r, nil, g.Map{"registrarId": res.ID, "balance": res.Balance, "currency": billing.Currency, "minBalance": billing.MinBalance})
+	})
+
+	// 查询名字某项操作的价格，op为create、renew、transfer、restore
+	s.BindHandler("/QueryPrice", func(r *ghttp.Request) {
+		var req billingReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		name := strings.ToLower(strings.TrimSuffix(req.Name, "."))
+		if name != "" && !strings.Contains(name, ".") {
+			name += "." + registryCfg.TLD
+		}
+		tier, price, err := reg.Price(name, req.Op, req.Years)
+		writeResult(r, err, g.Map{"name": name, "op": req.Op, "tier": tier, "price": price, "currency": registryCfg.Billing.Currency})
+	})
+
+	// 对账单，from、to为RFC3339时间，可以省略；format为csv时返回CSV文件
+	s.BindHandler("/ExportStatement", func(r *ghttp.Request) {
+		var req billingReq
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		var from, to time.Time
+		var err error
+		if req.From != "" {
+			if from, err = time.Parse(time.RFC3339, req.From); err != nil {
+				writeResult(r, err, nil)
+			}
+		}
+		if req.To != "" {
+			if to, err = time.Parse(time.RFC3339, req.To); err != nil {
+				writeResult(r, err, nil)
+			}
+		}
+		res, err := reg.Statement(req.RegistrarID, from, to)
+		if err != nil || req.Format != "csv" {
+			writeResult(r, err, g.Map{"statement": res})
+		}
+		r.Response.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		r.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=statement-%s.csv", req.RegistrarID))
+		if err = registry.WriteStatementCSV(r.Response.Writer, res); err != nil {
+			fmt.Println("Error export statement:", err)
+		}
+		r.Exit()
+	})
+
+	// 立即生成托管文件，type为FULL或DIFF
+	s.BindHandler("/CreateEscrowDeposit", func(r *ghttp.Request) {
+		var req struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := rde.Deposit(strings.ToUpper(req.Type))
+		writeResult(r, err, g.Map{"deposit": res})
+	})
+
+	// 重新读取托管目录中的文件，校验签名和数量并与当前数据比较
+	s.BindHandler("/VerifyEscrowDeposit", func(r *ghttp.Request) {
+		var req struct {
+			File string `json:"file"`
+		}
+		if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+			writeResult(r, err, nil)
+		}
+		res, err := rde.Verify(req.File)
+		writeResult(r, err, g.Map{"report": res})
+	})
+
+	// name为空时按registrarId列出域名
+	s.BindHandler("/QueryDomain", func(r *ghttp.Request) {
+		var req registry.Domain
+		if len(r.GetBody()) > 0 {
+			if err := json.Unmarshal(r.GetBody(), &req); err != nil {
+				writeResult(r, err, nil)
+			}
+		}
+		if req.Name == "" {
+			res := reg.ListDomains(req.RegistrarID)
+			writeResult(r, nil, g.Map{"totalCount": len(res), "domainListJson": res})
+		}
+		res, err := reg.GetDomain(req.Name)
+		writeResult(r, err, g.Map{"domain": res})
+	})
+
 	s.BindHandler("/ReloadZone", func(r *ghttp.Request) {
 		out, err := service.ReloadZone()
 		if err != nil {
@@ -248,3 +1243,78 @@ func main() {
 	s.SetPort(80)
 	s.Run()
 }
+
+type transferReq struct {
+	Op          string `json:"op"`
+	Name        string `json:"name"`
+	RegistrarID string `json:"registrarId"`
+	// 注册商的EPP登录密码，注册局人员可改用override口令
+	Password string `json:"password"`
+	Override string `json:"override"`
+	AuthInfo string `json:"authInfo"`
+	Years    int    `json:"years"`
+}
+
+type policyReq struct {
+	policy.Entry
+	Override string `json:"override"`
+}
+
+type billingReq struct {
+	RegistrarID string `json:"registrarId"`
+	Amount      int64  `json:"amount"`
+	Memo        string `json:"memo"`
+	Name        string `json:"name"`
+	Op          string `json:"op"`
+	Years       int    `json:"years"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Format      string `json:"format"`
+}
+
+type domainStatusReq struct {
+	DomainName  string   `json:"domainName"`
+	RegistrarID string   `json:"registrarId"`
+	Add         []string `json:"add"`
+	Rem         []string `json:"rem"`
+	UnlockCode  string   `json:"unlockCode"`
+}
+
+// name是注册域名时返回注册局中的全名，name可以省略顶级域
+func registryDomain(reg *registry.Registry, name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	for _, n := range []string{name, name + "." + reg.Config().TLD} {
+		if dom, err := reg.GetDomain(n); err == nil {
+			return dom.Name, true
+		}
+	}
+	return "", false
+}
+
+// 写统一格式的JSON响应，err不为nil时返回失败
+// 以注册商身份操作的接口先认证registrarId：注册商的EPP密码，或注册局人员的override口令
+func authRegistrar(reg *registry.Registry, table *policy.Table, registrarID string, password string, override string) error {
+	if table.Override(override) {
+		return nil
+	}
+	return reg.Authenticate(registrarID, password)
+}
+
+func writeResult(r *ghttp.Request, err error, data g.Map) {
+	if err != nil {
+		r.Response.WriteJsonExit(g.Map{
+			"success": false,
+			"msg":     err.Error(),
+		})
+	}
+	res := g.Map{
+		"success": true,
+		"msg":     "ok",
+	}
+	for k, v := range data {
+		res[k] = v
+	}
+	r.Response.WriteJsonExit(res)
+}
@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 密码用bcrypt保存
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// 校验password与保存的bcrypt哈希是否一致
+func checkPasswordHash(stored string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+}
+
+// EPP要求密码长度6-16
+func checkPassword(password string) error {
+	if len(password) < 6 || len(password) > 16 {
+		return errorf(ErrInvalid, "密码长度必须在6-16之间")
+	}
+	return nil
+}
+
+// 设置注册商的登录密码
+func (r *Registry) SetRegistrarPassword(id string, password string) error {
+	if err := checkPassword(password); err != nil {
+		return err
+	}
+	return r.update(func(t *tx) error {
+		registrar := t.d.Registrars[id]
+		if registrar == nil {
+			return errorf(ErrNotFound, "注册商 %s 不存在", id)
+		}
+		hash, err := hashPassword(password)
+		if err != nil {
+			return fmt.Errorf("生成密码哈希失败: %v", err)
+		}
+		t.d.Credentials[id] = hash
+		registrar.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+// 校验注册商的登录密码，注册商停用时也认证失败
+func (r *Registry) Authenticate(id string, password string) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	registrar := r.data.Registrars[id]
+	stored, ok := r.data.Credentials[id]
+	if registrar == nil || !ok || !checkPasswordHash(stored, password) {
+		return errorf(ErrAuthentication, "注册商 %s 认证失败", id)
+	}
+	if registrar.Status != StatusOK {
+		return errorf(ErrForbidden, "注册商 %s 已停用", id)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPasswordHash(t *testing.T) {
+	hash, err := hashPassword("secret1")
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$2") {
+		t.Fatalf("哈希 %q 不是bcrypt格式", hash)
+	}
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		wantOK   bool
+	}{
+		{"bcrypt", hash, "secret1", true},
+		{"wrong password", hash, "secret2", false},
+		{"empty", "", "secret1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok := checkPasswordHash(tt.stored, tt.password); ok != tt.wantOK {
+				t.Errorf("checkPasswordHash = %v，应为 %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	r := newTestRegistry(t, &fakeZone{})
+	for _, id := range []string{"reg1", "off"} {
+		if _, err := r.CreateRegistrar(Registrar{ID: id, Name: id, Email: id + "@example.com"}); err != nil {
+			t.Fatalf("CreateRegistrar: %v", err)
+		}
+	}
+	if err := r.SetRegistrarPassword("reg1", "secret1"); err != nil {
+		t.Fatalf("SetRegistrarPassword: %v", err)
+	}
+	if err := r.SetRegistrarPassword("off", "secret3"); err != nil {
+		t.Fatalf("SetRegistrarPassword: %v", err)
+	}
+	if err := r.SetRegistrarStatus("off", false); err != nil {
+		t.Fatalf("SetRegistrarStatus: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		password string
+		kind     ErrorKind
+	}{
+		{"ok", "reg1", "secret1", ErrUnknown},
+		{"wrong password", "reg1", "secret2", ErrAuthentication},
+		{"unknown registrar", "nobody", "secret1", ErrAuthentication},
+		{"disabled", "off", "secret3", ErrForbidden},
+		{"disabled wrong password", "off", "wrong1", ErrAuthentication},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Authenticate(tt.id, tt.password)
+			if KindOf(err) != tt.kind {
+				t.Errorf("Authenticate(%s) error = %v，类别应为%d", tt.id, err, tt.kind)
+			}
+		})
+	}
+}
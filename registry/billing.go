@@ -0,0 +1,516 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"newCHNTLDManager/dns/policy"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// 计费的操作
+const (
+	OpCreate    = "create"
+	OpRenew     = "renew"
+	OpAutoRenew = "autoRenew"
+	OpTransfer  = "transfer"
+	OpRestore   = "restore"
+)
+
+// 账本记录的类别
+const (
+	LedgerDeposit = "deposit"
+	LedgerCharge  = "charge"
+	LedgerRefund  = "refund"
+	// 注册局手工调整，金额可正可负
+	LedgerAdjust = "adjust"
+)
+
+// 没有溢价的名字使用的价格档
+const TierStandard = "standard"
+
+// 计费配置，对应registry.billing节点，金额单位均为分
+type BillingConfig struct {
+	// 不启用时注册、续费等操作不扣费，仍可充值和查询账本
+	Enabled  bool   `json:"enabled"`
+	Currency string `json:"currency"`
+	// 扣费后余额不能低于此值，负数表示允许透支。自动续费不受限制
+	MinBalance int64 `json:"minBalance"`
+	// 扣费后余额低于此值时给注册商发轮询消息
+	LowBalance int64 `json:"lowBalance"`
+	// 账本文件，每行一条JSON，与数据文件一起提交，只追加不修改
+	LedgerFile string `json:"ledgerFile"`
+	// 注册、续费、转移后的宽限期，期间删除退回该笔费用，EPP惯例均为5天
+	AddGrace      string `json:"addGrace"`
+	RenewGrace    string `json:"renewGrace"`
+	TransferGrace string `json:"transferGrace"`
+	// 价格表，key为价格档：standard或policy中premium条目的tier
+	Prices map[string]PriceList `json:"prices"`
+
+	addGrace      time.Duration
+	renewGrace    time.Duration
+	transferGrace time.Duration
+}
+
+// 一个价格档的价格，注册、续费、转移按年计，赎回按次计
+type PriceList struct {
+	Create   int64 `json:"create"`
+	Renew    int64 `json:"renew"`
+	Transfer int64 `json:"transfer"`
+	Restore  int64 `json:"restore"`
+}
+
+func (c *BillingConfig) parse() error {
+	items := []struct {
+		name  string
+		value string
+		d     *time.Duration
+	}{
+		{"addGrace", c.AddGrace, &c.addGrace},
+		{"renewGrace", c.RenewGrace, &c.renewGrace},
+		{"transferGrace", c.TransferGrace, &c.transferGrace},
+	}
+	for _, item := range items {
+		d, err := time.ParseDuration(item.value)
+		if err != nil {
+			return fmt.Errorf("registry.billing.%s 格式错误: %v", item.name, err)
+		}
+		*item.d = d
+	}
+	if !c.Enabled {
+		return nil
+	}
+	if _, ok := c.Prices[TierStandard]; !ok {
+		return fmt.Errorf("registry.billing.prices 缺少%s价格档", TierStandard)
+	}
+	for tier, p := range c.Prices {
+		if p.Create < 0 || p.Renew < 0 || p.Transfer < 0 || p.Restore < 0 {
+			return fmt.Errorf("registry.billing.prices.%s 价格不能为负数", tier)
+		}
+	}
+	return nil
+}
+
+// 账本中的一条记录
+type LedgerEntry struct {
+	ID          uint64    `json:"id"`
+	Time        time.Time `json:"time"`
+	RegistrarID string    `json:"registrarId"`
+	Type        string    `json:"type"`
+	Op          string    `json:"op,omitempty"`
+	Domain      string    `json:"domain,omitempty"`
+	Years       int       `json:"years,omitempty"`
+	Tier        string    `json:"tier,omitempty"`
+	// 金额，扣费为负数
+	Amount int64 `json:"amount"`
+	// 记账后的余额
+	Balance  int64  `json:"balance"`
+	Currency string `json:"currency"`
+	// 退款对应的扣费记录
+	RefID uint64 `json:"refId,omitempty"`
+	Memo  string `json:"memo,omitempty"`
+}
+
+// 宽限期内可以退回的一笔扣费
+type graceCharge struct {
+	EntryID     uint64    `json:"entryId"`
+	RegistrarID string    `json:"registrarId"`
+	Op          string    `json:"op"`
+	Years       int       `json:"years"`
+	Amount      int64     `json:"amount"`
+	Until       time.Time `json:"until"`
+}
+
+// 注册商在一段时间内的对账单
+type Statement struct {
+	RegistrarID string    `json:"registrarId"`
+	From        time.Time `json:"from,omitempty"`
+	To          time.Time `json:"to,omitempty"`
+	Currency    string    `json:"currency"`
+	// 期初、期末余额
+	Opening int64 `json:"opening"`
+	Closing int64 `json:"closing"`
+	// 本期各类合计，扣费为负数
+	Deposits int64         `json:"deposits"`
+	Charges  int64         `json:"charges"`
+	Refunds  int64         `json:"refunds"`
+	Adjusts  int64         `json:"adjusts"`
+	Entries  []LedgerEntry `json:"entries"`
+}
+
+// 名字的价格档，policy中premium条目的tier，没有时为standard
+func (r *Registry) priceTier(name string) string {
+	label := strings.TrimSuffix(normalizeName(name), "."+r.cfg.TLD)
+	if e := r.policy.Match(label); e != nil && e.Kind == policy.KindPremium {
+		return e.Tier
+	}
+	return TierStandard
+}
+
+// 查询操作的价格，赎回不计年数
+func (r *Registry) Price(name string, op string, years int) (string, int64, error) {
+	tier := r.priceTier(name)
+	prices, ok := r.cfg.Billing.Prices[tier]
+	if !ok {
+		return tier, 0, errorf(ErrPolicy, "价格档 %s 没有定价", tier)
+	}
+	if years < 1 {
+		years = 1
+	}
+	switch op {
+	case OpCreate:
+		return tier, prices.Create * int64(years), nil
+	case OpRenew, OpAutoRenew:
+		return tier, prices.Renew * int64(years), nil
+	case OpTransfer:
+		return tier, prices.Transfer * int64(years), nil
+	case OpRestore:
+		return tier, prices.Restore, nil
+	}
+	return tier, 0, errorf(ErrInvalid, "不支持的计费操作 %s", op)
+}
+
+// 按价格表扣费并记账，未启用计费或价格为0时什么也不做。force为true时不检查余额。
+// graceUntil晚于now时，在此之前删除域名可以退回这笔费用
+func (r *Registry) charge(t *tx, registrarID string, op string, name string, years int, now time.Time, force bool, graceUntil time.Time) (*LedgerEntry, error) {
+	if !r.cfg.Billing.Enabled {
+		return nil, nil
+	}
+	tier, amount, err := r.Price(name, op, years)
+	if err != nil {
+		return nil, err
+	}
+	if op == OpRestore {
+		years = 0
+	}
+	e, err := r.debit(t, LedgerEntry{RegistrarID: registrarID, Op: op, Domain: name, Years: years, Tier: tier, Amount: amount}, now, force)
+	if err != nil || e == nil {
+		return e, err
+	}
+	t.pruneGrace(name, now)
+	if graceUntil.After(now) {
+		t.d.Grace[name] = append(t.d.Grace[name], &graceCharge{EntryID: e.ID, RegistrarID: registrarID, Op: op, Years: years, Amount: amount, Until: graceUntil})
+	}
+	return e, nil
+}
+
+// 按e.Amount扣费，金额为0或未启用计费时返回nil。扣费后余额低于lowBalance时通知注册商
+func (r *Registry) debit(t *tx, e LedgerEntry, now time.Time, force bool) (*LedgerEntry, error) {
+	cfg := r.cfg.Billing
+	amount := e.Amount
+	if !cfg.Enabled || amount == 0 {
+		return nil, nil
+	}
+	registrar := t.d.Registrars[e.RegistrarID]
+	if registrar == nil {
+		return nil, errorf(ErrNotFound, "注册商 %s 不存在", e.RegistrarID)
+	}
+	if !force && registrar.Balance-amount < cfg.MinBalance {
+		return nil, errorf(ErrBilling, "注册商 %s 余额不足：%s %s需要%s，余额%s", e.RegistrarID, e.Domain, e.Op, formatAmount(amount), formatAmount(registrar.Balance))
+	}
+	before := registrar.Balance
+	e.Type = LedgerCharge
+	e.Amount = -amount
+	e = t.addLedger(registrar, e, cfg.Currency, now)
+	if before >= cfg.LowBalance && registrar.Balance < cfg.LowBalance {
+		t.addMessage(registrar.ID, fmt.Sprintf("Low balance: %s %s", formatAmount(registrar.Balance), cfg.Currency), nil)
+	}
+	return &e, nil
+}
+
+// 退回一笔扣费，amount为退款金额，refID为原扣费记录
+func (r *Registry) refund(t *tx, registrarID string, op string, name string, amount int64, refID uint64, memo string, now time.Time) {
+	registrar := t.d.Registrars[registrarID]
+	if amount <= 0 || registrar == nil {
+		return
+	}
+	t.addLedger(registrar, LedgerEntry{Type: LedgerRefund, Op: op, Domain: name, Amount: amount, RefID: refID, Memo: memo}, r.cfg.Billing.Currency, now)
+}
+
+// 记账并修改余额，ID与ROID共用序号
+func (t *tx) addLedger(registrar *Registrar, e LedgerEntry, currency string, now time.Time) LedgerEntry {
+	t.d.Sequence++
+	registrar.Balance += e.Amount
+	e.ID = t.d.Sequence
+	e.Time = now
+	e.RegistrarID = registrar.ID
+	e.Balance = registrar.Balance
+	e.Currency = currency
+	t.ledger = append(t.ledger, e)
+	return e
+}
+
+// 退回当前管理注册商在宽限期内的扣费，续费和转移增加的年限同时扣回，返回退款总额。
+// 自动续费的年限由startRedemption扣回
+func (r *Registry) refundGrace(t *tx, dom *Domain, now time.Time) int64 {
+	var total int64
+	for _, g := range t.d.Grace[dom.Name] {
+		if g.RegistrarID != dom.RegistrarID || !now.Before(g.Until) {
+			continue
+		}
+		r.refund(t, g.RegistrarID, g.Op, dom.Name, g.Amount, g.EntryID, "宽限期内删除", now)
+		if g.Op == OpRenew || g.Op == OpTransfer {
+			dom.ExpiresAt = dom.ExpiresAt.AddDate(-g.Years, 0, 0)
+		}
+		total += g.Amount
+	}
+	delete(t.d.Grace, dom.Name)
+	return total
+}
+
+// 去掉已过宽限期的记录
+func (t *tx) pruneGrace(name string, now time.Time) {
+	var list []*graceCharge
+	for _, g := range t.d.Grace[name] {
+		if now.Before(g.Until) {
+			list = append(list, g)
+		}
+	}
+	if len(list) == 0 {
+		delete(t.d.Grace, name)
+	} else {
+		t.d.Grace[name] = list
+	}
+}
+
+// 转移结束时的计费：拒绝或撤回时退回转入注册商预付的转移费，批准后原注册商的宽限期作废，
+// 转移费进入转移宽限期
+func (r *Registry) settleTransfer(t *tx, transfer *Transfer, approved bool, now time.Time) {
+	if !approved {
+		r.refund(t, transfer.GainingID, OpTransfer, transfer.Domain, transfer.Charged, transfer.ChargeID, "转移"+transfer.Status, now)
+		return
+	}
+	delete(t.d.Grace, transfer.Domain)
+	if transfer.Charged > 0 && r.cfg.Billing.transferGrace > 0 {
+		t.d.Grace[transfer.Domain] = []*graceCharge{{
+			EntryID:     transfer.ChargeID,
+			RegistrarID: transfer.GainingID,
+			Op:          OpTransfer,
+			Years:       transfer.Years,
+			Amount:      transfer.Charged,
+			Until:       now.Add(r.cfg.Billing.transferGrace),
+		}}
+	}
+}
+
+// 注册商充值，amount为负数时记为注册局调整
+func (r *Registry) Deposit(registrarID string, amount int64, memo string) (*LedgerEntry, error) {
+	if amount == 0 {
+		return nil, errorf(ErrRange, "金额不能为0")
+	}
+	var res LedgerEntry
+	err := r.update(func(t *tx) error {
+		registrar := t.d.Registrars[registrarID]
+		if registrar == nil {
+			return errorf(ErrNotFound, "注册商 %s 不存在", registrarID)
+		}
+		kind := LedgerDeposit
+		if amount < 0 {
+			kind = LedgerAdjust
+		}
+		res = t.addLedger(registrar, LedgerEntry{Type: kind, Amount: amount, Memo: memo}, r.cfg.Billing.Currency, time.Now().UTC())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 追加到账本文件并同步到磁盘，返回追加前的文件长度，供后续步骤失败时截断；没有追加时返回-1
+func (r *Registry) appendLedger(list []LedgerEntry) (int64, error) {
+	file := r.cfg.Billing.LedgerFile
+	if file == "" || len(list) == 0 {
+		return -1, nil
+	}
+	var lines []byte
+	for _, e := range list {
+		line, _ := json.Marshal(e)
+		lines = append(append(lines, line...), '\n')
+	}
+	if err := gfile.Mkdir(filepath.Dir(file)); err != nil {
+		return -1, fmt.Errorf("写账本失败: %v", err)
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return -1, fmt.Errorf("写账本失败: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return -1, fmt.Errorf("写账本失败: %v", err)
+	}
+	size := info.Size()
+	if _, err = f.Write(lines); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		r.truncateLedger(size)
+		return -1, fmt.Errorf("写账本失败: %v", err)
+	}
+	return size, nil
+}
+
+// 去掉appendLedger追加的记录，size为-1时什么也不做
+func (r *Registry) truncateLedger(size int64) {
+	if size < 0 {
+		return
+	}
+	if err := os.Truncate(r.cfg.Billing.LedgerFile, size); err != nil {
+		fmt.Println("Error truncate ledger:", err)
+	}
+}
+
+// 去掉账本末尾数据文件中没有的记录。追加账本之后、保存数据之前中断时会留下这样的记录，
+// 它们的ID大于数据中的Sequence
+func (r *Registry) repairLedger() error {
+	file := r.cfg.Billing.LedgerFile
+	if file == "" || !gfile.Exists(file) {
+		return nil
+	}
+	content := gfile.GetBytes(file)
+	offset := 0
+	for offset < len(content) {
+		end := bytes.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			// 最后一行没有写完
+			break
+		}
+		var e LedgerEntry
+		if err := json.Unmarshal(content[offset:offset+end], &e); err != nil {
+			return fmt.Errorf("账本%s格式错误: %v", file, err)
+		}
+		if e.ID > r.data.Sequence {
+			break
+		}
+		offset += end + 1
+	}
+	if offset == len(content) {
+		return nil
+	}
+	fmt.Println("Repair ledger: drop", len(content)-offset, "bytes not in registry data")
+	return os.Truncate(file, int64(offset))
+}
+
+func logLedger(list []LedgerEntry) {
+	for _, e := range list {
+		fmt.Println("billing:", e.RegistrarID, e.Type, e.Op, e.Domain, formatAmount(e.Amount), "balance", formatAmount(e.Balance))
+	}
+}
+
+// 从账本文件生成对账单，from、to为零值时不限制，区间为[from, to)
+func (r *Registry) Statement(registrarID string, from time.Time, to time.Time) (*Statement, error) {
+	registrar, err := r.GetRegistrar(registrarID)
+	if err != nil {
+		return nil, err
+	}
+	file := r.cfg.Billing.LedgerFile
+	if file == "" {
+		return nil, errorf(ErrPolicy, "registry.billing.ledgerFile 为空，没有账本")
+	}
+	st := &Statement{RegistrarID: registrarID, From: from, To: to, Currency: r.cfg.Billing.Currency, Entries: []LedgerEntry{}}
+	// 期初余额取期间内第一条记录之前的余额，期间内没有记录时取期间前后最近的记录
+	var before, after *LedgerEntry
+	for i, line := range strings.Split(gfile.GetContents(file), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var e LedgerEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("账本%s第%d行格式错误: %v", file, i+1, err)
+		}
+		if e.RegistrarID != registrarID {
+			continue
+		}
+		if !from.IsZero() && e.Time.Before(from) {
+			before = &e
+			continue
+		}
+		if !to.IsZero() && !e.Time.Before(to) {
+			after = &e
+			break
+		}
+		switch e.Type {
+		case LedgerDeposit:
+			st.Deposits += e.Amount
+		case LedgerCharge:
+			st.Charges += e.Amount
+		case LedgerRefund:
+			st.Refunds += e.Amount
+		case LedgerAdjust:
+			st.Adjusts += e.Amount
+		}
+		st.Entries = append(st.Entries, e)
+	}
+	switch {
+	case len(st.Entries) > 0:
+		st.Opening = st.Entries[0].Balance - st.Entries[0].Amount
+		st.Closing = st.Entries[len(st.Entries)-1].Balance
+	case before != nil:
+		st.Opening = before.Balance
+		st.Closing = before.Balance
+	case after != nil:
+		st.Opening = after.Balance - after.Amount
+		st.Closing = st.Opening
+	default:
+		st.Opening = registrar.Balance
+		st.Closing = registrar.Balance
+	}
+	return st, nil
+}
+
+// 对账单导出为CSV，金额以元为单位
+func WriteStatementCSV(w io.Writer, st *Statement) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{
+		{"id", "time", "type", "op", "domain", "years", "tier", "amount", "balance", "currency", "refId", "memo"},
+	}
+	for _, e := range st.Entries {
+		refID := ""
+		if e.RefID != 0 {
+			refID = strconv.FormatUint(e.RefID, 10)
+		}
+		years := ""
+		if e.Years != 0 {
+			years = strconv.Itoa(e.Years)
+		}
+		rows = append(rows, []string{
+			strconv.FormatUint(e.ID, 10),
+			e.Time.Format(time.RFC3339),
+			e.Type,
+			e.Op,
+			e.Domain,
+			years,
+			e.Tier,
+			formatAmount(e.Amount),
+			formatAmount(e.Balance),
+			e.Currency,
+			refID,
+			e.Memo,
+		})
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// 分转换为元，保留两位小数
+func formatAmount(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
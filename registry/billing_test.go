@@ -0,0 +1,231 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBillingRegistry(t *testing.T, zone Zone, mutate func(cfg *BillingConfig)) *Registry {
+	t.Helper()
+	r := newTestRegistryWith(t, zone, func(cfg *Config) {
+		cfg.Billing.Enabled = true
+		cfg.Billing.Prices = map[string]PriceList{TierStandard: {Create: 1000, Renew: 1000, Transfer: 800, Restore: 3000}}
+		if mutate != nil {
+			mutate(&cfg.Billing)
+		}
+	})
+	addTestRegistrar(t, r, "reg1", 5000)
+	return r
+}
+
+// 账本文件中的记录数
+func ledgerLines(t *testing.T, r *Registry) int {
+	t.Helper()
+	content, err := os.ReadFile(r.cfg.Billing.LedgerFile)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("读取账本: %v", err)
+	}
+	return strings.Count(string(content), "\n")
+}
+
+func TestDebit(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(cfg *BillingConfig)
+		amount  int64
+		force   bool
+		wantErr ErrorKind
+		// 扣费后的余额和是否有余额不足的提醒
+		wantBalance int64
+		wantMessage bool
+	}{
+		{name: "charge", amount: 1000, wantBalance: 4000},
+		{name: "below min balance", amount: 6000, wantErr: ErrBilling, wantBalance: 5000},
+		{name: "exactly min balance", amount: 5000, wantBalance: 0},
+		{name: "overdraft allowed", mutate: func(cfg *BillingConfig) { cfg.MinBalance = -2000 }, amount: 6000, wantBalance: -1000, wantMessage: true},
+		{name: "force", amount: 6000, force: true, wantBalance: -1000, wantMessage: true},
+		{name: "disabled", mutate: func(cfg *BillingConfig) { cfg.Enabled = false }, amount: 1000, wantBalance: 5000},
+		{name: "low balance", mutate: func(cfg *BillingConfig) { cfg.LowBalance = 4500 }, amount: 1000, wantBalance: 4000, wantMessage: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newBillingRegistry(t, &fakeZone{}, tt.mutate)
+			lines := ledgerLines(t, r)
+			err := r.update(func(t *tx) error {
+				_, err := r.debit(t, LedgerEntry{RegistrarID: "reg1", Op: OpCreate, Domain: "a.chn", Amount: tt.amount}, time.Now().UTC(), tt.force)
+				return err
+			})
+			if KindOf(err) != tt.wantErr || (tt.wantErr == ErrUnknown) != (err == nil) {
+				t.Fatalf("debit error = %v，类别应为%d", err, tt.wantErr)
+			}
+			if balance := r.data.Registrars["reg1"].Balance; balance != tt.wantBalance {
+				t.Errorf("余额为%d，应为%d", balance, tt.wantBalance)
+			}
+			if (len(r.data.Messages) > 0) != tt.wantMessage {
+				t.Errorf("消息数为%d", len(r.data.Messages))
+			}
+			charged := tt.wantBalance != 5000
+			if added := ledgerLines(t, r) - lines; added != map[bool]int{true: 1, false: 0}[charged] {
+				t.Errorf("账本增加了%d条记录", added)
+			}
+		})
+	}
+}
+
+// 注册宽限期内删除退回注册费，宽限期过后删除不退
+func TestDeleteDomainInAddGrace(t *testing.T) {
+	for _, inGrace := range []bool{true, false} {
+		t.Run(fmt.Sprint("inGrace=", inGrace), func(t *testing.T) {
+			r := newBillingRegistry(t, &fakeZone{}, nil)
+			r.data.Contacts["c1"] = &Contact{ID: "c1", RegistrarID: "reg1"}
+			if _, err := r.CreateDomain(Domain{Name: "a.chn", RegistrarID: "reg1", RegistrantID: "c1"}, 2, false, ""); err != nil {
+				t.Fatalf("CreateDomain: %v", err)
+			}
+			if balance := r.data.Registrars["reg1"].Balance; balance != 3000 {
+				t.Fatalf("注册两年后余额为%d，应为3000", balance)
+			}
+			if !inGrace {
+				for _, g := range r.data.Grace["a.chn"] {
+					g.Until = time.Now().UTC().Add(-time.Second)
+				}
+			}
+			if err := r.DeleteDomain("a.chn", "reg1"); err != nil {
+				t.Fatalf("DeleteDomain: %v", err)
+			}
+			want := map[bool]int64{true: 5000, false: 3000}[inGrace]
+			if balance := r.data.Registrars["reg1"].Balance; balance != want {
+				t.Errorf("删除后余额为%d，应为%d", balance, want)
+			}
+			if len(r.data.Grace["a.chn"]) != 0 {
+				t.Error("删除后不应保留宽限期记录")
+			}
+		})
+	}
+}
+
+func TestStatement(t *testing.T) {
+	r := newBillingRegistry(t, &fakeZone{}, nil)
+	addTestRegistrar(t, r, "reg2", 700)
+	if _, err := r.Deposit("reg1", -500, "adjust"); err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	err := r.update(func(t *tx) error {
+		e, err := r.debit(t, LedgerEntry{RegistrarID: "reg1", Op: OpCreate, Domain: "a.chn", Amount: 1000}, time.Now().UTC(), false)
+		if err != nil {
+			return err
+		}
+		r.refund(t, "reg1", OpCreate, "a.chn", 400, e.ID, "partial", time.Now().UTC())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	tests := []struct {
+		name        string
+		from        time.Time
+		to          time.Time
+		wantEntries int
+		// 期初、期末余额和各类合计
+		want Statement
+	}{
+		{name: "all", wantEntries: 4, want: Statement{Opening: 0, Closing: 3900, Deposits: 5000, Adjusts: -500, Charges: -1000, Refunds: 400}},
+		{name: "after", from: time.Now().Add(time.Hour), want: Statement{Opening: 3900, Closing: 3900}},
+		{name: "before", to: time.Now().Add(-time.Hour), want: Statement{Opening: 0, Closing: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := r.Statement("reg1", tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Statement: %v", err)
+			}
+			got := Statement{Opening: st.Opening, Closing: st.Closing, Deposits: st.Deposits, Adjusts: st.Adjusts, Charges: st.Charges, Refunds: st.Refunds}
+			if len(st.Entries) != tt.wantEntries || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("对账单 %d条 %+v，应为%d条 %+v", len(st.Entries), got, tt.wantEntries, tt.want)
+			}
+			for _, e := range st.Entries {
+				if e.RegistrarID != "reg1" {
+					t.Errorf("对账单中有其他注册商的记录 %+v", e)
+				}
+			}
+		})
+	}
+	if _, err := r.Statement("nobody", time.Time{}, time.Time{}); KindOf(err) != ErrNotFound {
+		t.Errorf("不存在的注册商 error = %v", err)
+	}
+}
+
+// 账本与数据文件、zone一起提交：任何一步失败时账本、余额和数据文件都不变
+func TestLedgerCommit(t *testing.T) {
+	tests := []struct {
+		name string
+		// 账本位置换成目录，使写账本失败
+		ledgerFails bool
+		commitErr   error
+		fnErr       error
+		wantErr     bool
+	}{
+		{name: "ok"},
+		{name: "ledger fails", ledgerFails: true, wantErr: true},
+		{name: "save after fn fails", fnErr: fmt.Errorf("fail"), wantErr: true},
+		{name: "zone commit fails", commitErr: fmt.Errorf("disk full"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newBillingRegistry(t, &fakeZone{commitErr: tt.commitErr}, nil)
+			lines := ledgerLines(t, r)
+			if tt.ledgerFails {
+				if err := os.Remove(r.cfg.Billing.LedgerFile); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Mkdir(r.cfg.Billing.LedgerFile, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := r.update(func(t *tx) error {
+				t.zoneChanged = true
+				t.addLedger(t.d.Registrars["reg1"], LedgerEntry{Type: LedgerAdjust, Amount: -100}, "CNY", time.Now().UTC())
+				return tt.fnErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("update error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := map[bool]int64{true: 5000, false: 4900}[tt.wantErr]
+			saved, err := loadData(r.cfg.DataFile)
+			if err != nil {
+				t.Fatalf("loadData: %v", err)
+			}
+			if r.data.Registrars["reg1"].Balance != want || saved.Registrars["reg1"].Balance != want {
+				t.Errorf("余额为%d，数据文件中为%d，应为%d", r.data.Registrars["reg1"].Balance, saved.Registrars["reg1"].Balance, want)
+			}
+			if tt.ledgerFails {
+				return
+			}
+			wantLines := lines + map[bool]int{true: 0, false: 1}[tt.wantErr]
+			if got := ledgerLines(t, r); got != wantLines {
+				t.Errorf("账本有%d条记录，应为%d条", got, wantLines)
+			}
+		})
+	}
+}
+
+// 追加账本之后、保存数据之前中断留下的记录在启动时去掉
+func TestRepairLedger(t *testing.T) {
+	r := newBillingRegistry(t, &fakeZone{}, nil)
+	if _, err := r.Deposit("reg1", 100, ""); err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	good, _ := os.ReadFile(r.cfg.Billing.LedgerFile)
+	orphan := fmt.Sprintf(`{"id":%d,"registrarId":"reg1","type":"deposit","amount":1}`+"\n", r.data.Sequence+1)
+	if err := os.WriteFile(r.cfg.Billing.LedgerFile, append(append([]byte{}, good...), orphan+`{"id":`...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(r.cfg, &fakeZone{}); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if content, _ := os.ReadFile(r.cfg.Billing.LedgerFile); string(content) != string(good) {
+		t.Errorf("修复后的账本为 %q，应为 %q", content, good)
+	}
+}
@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"strings"
+
+	"newCHNTLDManager/dns/policy"
+
+	"golang.org/x/net/idna"
+)
+
+// 一次最多检查的名字数
+const maxCheckNames = 100
+
+// 一个名字最多给出的替代名字数
+const maxSuggestions = 10
+
+// 不可注册的原因
+const (
+	ReasonInvalid    = "invalid"
+	ReasonRegistered = "registered"
+	ReasonReserved   = policy.KindReserved
+	ReasonBlocked    = policy.KindBlocked
+	ReasonVariant    = "variant"
+)
+
+// 可注册性检查结果，Name为A-label形式，IDN同时给出U-label形式
+type Availability struct {
+	Name        string `json:"name"`
+	UnicodeName string `json:"unicodeName,omitempty"`
+	Available   bool   `json:"available"`
+	Reason      string `json:"reason,omitempty"`
+	Msg         string `json:"msg,omitempty"`
+	// 溢价名字可以注册，按Tier计价
+	Premium     bool     `json:"premium,omitempty"`
+	Tier        string   `json:"tier,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// 生成替代名字时使用的前缀和后缀
+var (
+	suggestPrefixes = []string{"my", "get", "the"}
+	suggestSuffixes = []string{"1", "2", "365", "cn", "-cn", "online", "app", "hq"}
+)
+
+// 批量检查名字能否注册，名字可以省略顶级域。suggest大于0时为已注册、保留或禁止的名字
+// 给出最多suggest个可注册的替代名字
+func (r *Registry) CheckAvailability(names []string, suggest int) ([]Availability, error) {
+	if len(names) == 0 {
+		return nil, errorf(ErrInvalid, "至少需要一个名字")
+	}
+	if len(names) > maxCheckNames {
+		return nil, errorf(ErrRange, "一次最多检查%d个名字", maxCheckNames)
+	}
+	if suggest > maxSuggestions {
+		suggest = maxSuggestions
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	res := make([]Availability, 0, len(names))
+	for _, name := range names {
+		name = normalizeName(name)
+		if name != "" && !strings.Contains(name, ".") {
+			name += "." + r.cfg.TLD
+		}
+		a := r.checkAvailability(name)
+		if !a.Available && a.Reason != ReasonInvalid && suggest > 0 {
+			a.Suggestions = r.suggest(a, suggest)
+		}
+		res = append(res, a)
+	}
+	return res, nil
+}
+
+// 检查单个名字，调用方需持有r.lock
+func (r *Registry) checkAvailability(name string) Availability {
+	name = normalizeName(name)
+	a := Availability{Name: name}
+	label, err := r.domainLabel(name)
+	if err != nil {
+		a.Reason = ReasonInvalid
+		a.Msg = err.Error()
+		return a
+	}
+	a.Name = label + "." + r.cfg.TLD
+	unicodeLabel := label
+	if u, err := idna.Lookup.ToUnicode(label); err == nil && u != label {
+		unicodeLabel = u
+		a.UnicodeName = u + "." + r.cfg.TLD
+	}
+	// 注册数据中A-label和U-label两种形式都可能出现
+	for _, n := range []string{a.Name, a.UnicodeName} {
+		if dom := r.data.Domains[n]; n != "" && dom != nil {
+			a.Reason = ReasonRegistered
+			a.Msg = "已注册"
+			if dom.Deleting() {
+				a.Msg = "已注册，正在删除流程中"
+			}
+			return a
+		}
+	}
+	// 简繁体等变体已注册时不能注册
+	for _, v := range r.variants(label) {
+		if dom := r.data.Domains[v]; dom != nil {
+			a.Reason = ReasonVariant
+			a.Msg = "是已注册的 " + dom.Name + " 的变体"
+			return a
+		}
+	}
+	if e := r.policy.Match(unicodeLabel); e != nil {
+		switch e.Kind {
+		case policy.KindBlocked, policy.KindReserved:
+			a.Reason = e.Kind
+			a.Msg = "注册局保留"
+			if e.Kind == policy.KindBlocked {
+				a.Msg = "禁止注册"
+			}
+			if e.Reason != "" {
+				a.Msg += ": " + e.Reason
+			}
+			return a
+		case policy.KindPremium:
+			a.Premium = true
+			a.Tier = e.Tier
+		}
+	}
+	a.Available = true
+	return a
+}
+
+// 检查名字是否为本顶级域下合法的二级域名，返回label的A-label形式，IDN按IDNA2008规则检查
+func (r *Registry) domainLabel(name string) (string, error) {
+	label := strings.TrimSuffix(name, "."+r.cfg.TLD)
+	if label == name || label == "" || strings.Contains(label, ".") {
+		return "", errorf(ErrInvalid, "%s 不是.%s下的二级域名", name, r.cfg.TLD)
+	}
+	if isASCII(label) {
+		if err := checkLabel(label); err != nil {
+			return "", err
+		}
+	}
+	ldh, err := idna.Registration.ToASCII(label)
+	if err != nil {
+		return "", errorf(ErrInvalid, "%s 不是合法的IDN: %v", label, err)
+	}
+	if len(ldh) >= 4 && ldh[2:4] == "--" && !strings.HasPrefix(ldh, "xn--") {
+		return "", errorf(ErrInvalid, "label %s 的第3、4个字符不能都是连字符", ldh)
+	}
+	// 按顶级域允许的文字检查
+	if r.idn != nil {
+		if _, err := r.idn.Label(r.cfg.TLD, ldh); err != nil {
+			return "", errorf(ErrInvalid, "%v", err)
+		}
+	}
+	return ldh, checkLabel(ldh)
+}
+
+// label的变体，A-label和U-label两种写法的完整域名
+func (r *Registry) variants(label string) []string {
+	if r.idn == nil {
+		return nil
+	}
+	var res []string
+	for _, v := range r.idn.Variants(label) {
+		res = append(res, v+"."+r.cfg.TLD)
+		if u, err := idna.Lookup.ToUnicode(v); err == nil {
+			res = append(res, u+"."+r.cfg.TLD)
+		}
+	}
+	return res
+}
+
+// 由label的变化生成可注册的替代名字：加前缀、后缀，去掉连字符。IDN在U-label上变化
+func (r *Registry) suggest(a Availability, limit int) []string {
+	base := strings.TrimSuffix(a.Name, "."+r.cfg.TLD)
+	if a.UnicodeName != "" {
+		base = strings.TrimSuffix(a.UnicodeName, "."+r.cfg.TLD)
+	}
+	var candidates []string
+	if strings.Contains(base, "-") {
+		candidates = append(candidates, strings.ReplaceAll(base, "-", ""))
+	}
+	for _, suffix := range suggestSuffixes {
+		candidates = append(candidates, base+suffix)
+	}
+	for _, prefix := range suggestPrefixes {
+		candidates = append(candidates, prefix+base)
+	}
+	var res []string
+	seen := map[string]bool{a.Name: true}
+	for _, candidate := range candidates {
+		c := r.checkAvailability(candidate + "." + r.cfg.TLD)
+		if !c.Available || seen[c.Name] {
+			continue
+		}
+		seen[c.Name] = true
+		if c.UnicodeName != "" {
+			res = append(res, c.UnicodeName)
+		} else {
+			res = append(res, c.Name)
+		}
+		if len(res) >= limit {
+			break
+		}
+	}
+	return res
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"newCHNTLDManager/dns/idn"
+	"newCHNTLDManager/dns/policy"
+)
+
+// 已注册example.chn、my-shop.chn、中国.chn，正在删除old.chn，保留nic、禁止spam*、溢价vip
+func newCheckRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := newTestRegistry(t, &fakeZone{})
+	table, err := policy.New(policy.Config{Entries: []policy.Entry{
+		{Kind: policy.KindReserved, Pattern: "nic", Reason: "registry"},
+		{Kind: policy.KindBlocked, Pattern: "spam*"},
+		{Kind: policy.KindPremium, Pattern: "vip", Tier: "A"},
+	}})
+	if err != nil {
+		t.Fatalf("policy.New: %v", err)
+	}
+	r.SetPolicy(table)
+	idnTable, err := idn.New(idn.Config{Tables: map[string][]string{"chn": {"Han"}}, Variants: []string{"国國"}})
+	if err != nil {
+		t.Fatalf("idn.New: %v", err)
+	}
+	r.SetIDN(idnTable)
+	expires := time.Now().UTC().AddDate(1, 0, 0)
+	for _, dom := range []*Domain{
+		testDomain("example.chn", "reg1", expires),
+		testDomain("my-shop.chn", "reg1", expires),
+		testDomain("xn--fiqs8s.chn", "reg1", expires),
+		testDomain("old.chn", "reg1", expires, StatusRedemptionPeriod),
+	} {
+		r.data.Domains[dom.Name] = dom
+	}
+	return r
+}
+
+func TestCheckAvailability(t *testing.T) {
+	r := newCheckRegistry(t)
+	tests := []struct {
+		name string
+		want Availability
+	}{
+		{"free.chn", Availability{Name: "free.chn", Available: true}},
+		{"FREE", Availability{Name: "free.chn", Available: true}},
+		{"example.chn", Availability{Name: "example.chn", Reason: ReasonRegistered, Msg: "已注册"}},
+		{"old", Availability{Name: "old.chn", Reason: ReasonRegistered, Msg: "已注册，正在删除流程中"}},
+		{"中国", Availability{Name: "xn--fiqs8s.chn", UnicodeName: "中国.chn", Reason: ReasonRegistered, Msg: "已注册"}},
+		{"中國", Availability{Name: "xn--fiqz9s.chn", UnicodeName: "中國.chn", Reason: ReasonVariant, Msg: "是已注册的 xn--fiqs8s.chn 的变体"}},
+		{"中文", Availability{Name: "xn--fiq228c.chn", UnicodeName: "中文.chn", Available: true}},
+		{"nic", Availability{Name: "nic.chn", Reason: ReasonReserved, Msg: "注册局保留: registry"}},
+		{"spammer", Availability{Name: "spammer.chn", Reason: ReasonBlocked, Msg: "禁止注册"}},
+		{"vip", Availability{Name: "vip.chn", Available: true, Premium: true, Tier: "A"}},
+		{"-bad", Availability{Name: "-bad.chn", Reason: ReasonInvalid}},
+		{"ab--cd", Availability{Name: "ab--cd.chn", Reason: ReasonInvalid}},
+		{"a_b", Availability{Name: "a_b.chn", Reason: ReasonInvalid}},
+		{"a.b.chn", Availability{Name: "a.b.chn", Reason: ReasonInvalid}},
+		{"example.com", Availability{Name: "example.com", Reason: ReasonInvalid}},
+		{strings.Repeat("a", 64), Availability{Name: strings.Repeat("a", 64) + ".chn", Reason: ReasonInvalid}},
+		// 顶级域的字符表只允许汉字
+		{"привет", Availability{Name: "привет.chn", Reason: ReasonInvalid}},
+	}
+	for _, tt := range tests {
+		res, err := r.CheckAvailability([]string{tt.name}, 0)
+		if err != nil {
+			t.Fatalf("CheckAvailability(%q): %v", tt.name, err)
+		}
+		got := res[0]
+		if tt.want.Reason == ReasonInvalid {
+			// 非法名字的说明来自IDNA库，只检查类别
+			got.Msg = ""
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CheckAvailability(%q) = %+v，应为 %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckAvailabilityLimits(t *testing.T) {
+	r := newCheckRegistry(t)
+	if _, err := r.CheckAvailability(nil, 0); KindOf(err) != ErrInvalid {
+		t.Errorf("没有名字 error = %v", err)
+	}
+	names := make([]string, maxCheckNames+1)
+	for i := range names {
+		names[i] = "a"
+	}
+	if _, err := r.CheckAvailability(names, 0); KindOf(err) != ErrRange {
+		t.Errorf("名字过多 error = %v", err)
+	}
+	if res, err := r.CheckAvailability(names[:maxCheckNames], 0); err != nil || len(res) != maxCheckNames {
+		t.Errorf("%d个名字: %d %v", maxCheckNames, len(res), err)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	r := newCheckRegistry(t)
+	r.data.Domains["example1.chn"] = testDomain("example1.chn", "reg1", time.Now().UTC().AddDate(1, 0, 0))
+	tests := []struct {
+		name    string
+		suggest int
+		want    []string
+	}{
+		// 已注册的example1.chn不作为替代名字
+		{"example", 3, []string{"example2.chn", "example365.chn", "examplecn.chn"}},
+		// 先去掉连字符
+		{"my-shop", 2, []string{"myshop.chn", "my-shop1.chn"}},
+		// IDN在U-label上变化
+		{"中国", 2, []string{"中国1.chn", "中国2.chn"}},
+		// 保留名字也给出替代名字
+		{"nic", 1, []string{"nic1.chn"}},
+		// 超过上限时按上限
+		{"example", 100, []string{"example2.chn", "example365.chn", "examplecn.chn", "example-cn.chn", "exampleonline.chn", "exampleapp.chn", "examplehq.chn", "myexample.chn", "getexample.chn", "theexample.chn"}},
+		// 可注册和非法的名字没有替代名字
+		{"free", 3, nil},
+		{"-bad", 3, nil},
+		{"example", 0, nil},
+	}
+	for _, tt := range tests {
+		res, err := r.CheckAvailability([]string{tt.name}, tt.suggest)
+		if err != nil {
+			t.Fatalf("CheckAvailability(%q): %v", tt.name, err)
+		}
+		if got := res[0].Suggestions; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s 的替代名字为 %v，应为 %v", tt.name, got, tt.want)
+		}
+	}
+}
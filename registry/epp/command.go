@@ -0,0 +1,942 @@
+package epp
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"newCHNTLDManager/registry"
+)
+
+// EPP结果码（RFC 5730 3节）
+const (
+	codeOK                     = 1000
+	codePending                = 1001
+	codeNoMessages             = 1300
+	codeAckToDequeue           = 1301
+	codeLogout                 = 1500
+	codeUnknownCommand         = 2000
+	codeSyntax                 = 2001
+	codeCommandUse             = 2002
+	codeMissingParam           = 2003
+	codeValueRange             = 2004
+	codeValueSyntax            = 2005
+	codeUnimplementedVersion   = 2100
+	codeUnimplementedOption    = 2102
+	codeUnimplementedExtension = 2103
+	codeBillingFailure         = 2104
+	codeAuthentication         = 2200
+	codeAuthorization          = 2201
+	codeInvalidAuthInfo        = 2202
+	codePendingTransfer        = 2300
+	codeNotPendingTransfer     = 2301
+	codeExists                 = 2302
+	codeNotExists              = 2303
+	codeStatusProhibits        = 2304
+	codeAssociation            = 2305
+	codePolicy                 = 2306
+	codeUnimplementedService   = 2307
+	codeFailed                 = 2400
+	codeAuthClosing            = 2501
+)
+
+var resultMsg = map[int]string{
+	codeOK:                     "Command completed successfully",
+	codePending:                "Command completed successfully; action pending",
+	codeNoMessages:             "Command completed successfully; no messages",
+	codeAckToDequeue:           "Command completed successfully; ack to dequeue",
+	codeLogout:                 "Command completed successfully; ending session",
+	codeUnknownCommand:         "Unknown command",
+	codeSyntax:                 "Command syntax error",
+	codeCommandUse:             "Command use error",
+	codeMissingParam:           "Required parameter missing",
+	codeValueRange:             "Parameter value range error",
+	codeValueSyntax:            "Parameter value syntax error",
+	codeUnimplementedVersion:   "Unimplemented protocol version",
+	codeUnimplementedOption:    "Unimplemented option",
+	codeUnimplementedExtension: "Unimplemented extension",
+	codeBillingFailure:         "Billing failure",
+	codeAuthentication:         "Authentication error",
+	codeAuthorization:          "Authorization error",
+	codeInvalidAuthInfo:        "Invalid authorization information",
+	codePendingTransfer:        "Object pending transfer",
+	codeNotPendingTransfer:     "Object not pending transfer",
+	codeExists:                 "Object exists",
+	codeNotExists:              "Object does not exist",
+	codeStatusProhibits:        "Object status prohibits operation",
+	codeAssociation:            "Object association prohibits operation",
+	codePolicy:                 "Parameter value policy error",
+	codeUnimplementedService:   "Unimplemented object service",
+	codeFailed:                 "Command failed",
+	codeAuthClosing:            "Authentication error; server closing connection",
+}
+
+var errorCodes = map[registry.ErrorKind]int{
+	registry.ErrInvalid:           codeValueSyntax,
+	registry.ErrRange:             codeValueRange,
+	registry.ErrNotFound:          codeNotExists,
+	registry.ErrExists:            codeExists,
+	registry.ErrInUse:             codeAssociation,
+	registry.ErrPolicy:            codePolicy,
+	registry.ErrForbidden:         codeAuthorization,
+	registry.ErrAuthentication:    codeAuthentication,
+	registry.ErrAuthInfo:          codeInvalidAuthInfo,
+	registry.ErrProhibited:        codeStatusProhibits,
+	registry.ErrPendingTransfer:   codePendingTransfer,
+	registry.ErrNoPendingTransfer: codeNotPendingTransfer,
+	registry.ErrBilling:           codeBillingFailure,
+}
+
+// 命令的处理结果
+type reply struct {
+	code      int
+	msg       string
+	resData   interface{}
+	extension interface{}
+	msgQ      *msgQ
+}
+
+func codeReply(code int, detail string) *reply {
+	msg := resultMsg[code]
+	if detail != "" {
+		msg += ": " + detail
+	}
+	return &reply{code: code, msg: msg}
+}
+
+// registry的错误按类别转换为结果码，其他错误(如zone冲突)视为命令失败
+func errReply(err error) *reply {
+	code, ok := errorCodes[registry.KindOf(err)]
+	if !ok {
+		code = codeFailed
+	}
+	return codeReply(code, err.Error())
+}
+
+func (s *Server) response(clTRID string, rep *reply) *eppResponse {
+	if rep.msg == "" {
+		rep.msg = resultMsg[rep.code]
+	}
+	res := &response{
+		Result: result{Code: rep.code, Msg: rep.msg},
+		MsgQ:   rep.msgQ,
+		TrID:   transaction{ClTRID: clTRID, SvTRID: s.nextSvTRID()},
+	}
+	if rep.resData != nil {
+		res.ResData = &anyData{Data: rep.resData}
+	}
+	if rep.extension != nil {
+		res.Extension = &anyData{Data: rep.extension}
+	}
+	return &eppResponse{Response: res}
+}
+
+// 处理一个数据单元，返回响应及是否关闭连接
+func (s *Server) handle(sess *session, frame []byte) (*eppResponse, bool) {
+	var req eppRequest
+	if err := xml.Unmarshal(frame, &req); err != nil || req.XMLName.Space != nsEPP {
+		return s.response("", codeReply(codeSyntax, "")), false
+	}
+	if req.Hello != nil {
+		return s.greeting(), false
+	}
+	if req.Command == nil {
+		return s.response("", codeReply(codeUnknownCommand, "")), false
+	}
+	rep, closeConn := s.dispatch(sess, req.Command)
+	return s.response(req.Command.ClTRID, rep), closeConn
+}
+
+type objectHandler func(sess *session, op string, obj *objectElem, ext *extension) *reply
+
+func (s *Server) dispatch(sess *session, cmd *command) (*reply, bool) {
+	if cmd.Login != nil {
+		return s.login(sess, cmd.Login)
+	}
+	if sess.clID == "" {
+		return codeReply(codeCommandUse, "not logged in"), false
+	}
+	if cmd.Logout != nil {
+		return codeReply(codeLogout, ""), true
+	}
+	if cmd.Poll != nil {
+		return s.poll(sess, cmd.Poll), false
+	}
+
+	var name string
+	var obj *objectCmd
+	transform := true
+	switch {
+	case cmd.Check != nil:
+		name, obj, transform = "check", cmd.Check, false
+	case cmd.Info != nil:
+		name, obj, transform = "info", cmd.Info, false
+	case cmd.Create != nil:
+		name, obj = "create", cmd.Create
+	case cmd.Update != nil:
+		name, obj = "update", cmd.Update
+	case cmd.Delete != nil:
+		name, obj = "delete", cmd.Delete
+	case cmd.Renew != nil:
+		name, obj = "renew", cmd.Renew
+	case cmd.Transfer != nil:
+		name, obj = "transfer", cmd.Transfer
+		transform = obj.Op != "query"
+	default:
+		return codeReply(codeUnknownCommand, ""), false
+	}
+	if obj.Object.XMLName.Local != name {
+		return codeReply(codeSyntax, ""), false
+	}
+	handlers := map[string]objectHandler{
+		nsDomain:  s.domainCommand,
+		nsHost:    s.hostCommand,
+		nsContact: s.contactCommand,
+	}
+	handler, ok := handlers[obj.Object.XMLName.Space]
+	if !ok {
+		return codeReply(codeUnimplementedService, obj.Object.XMLName.Space), false
+	}
+	obj.Object.op = obj.Op
+	if transform {
+		s.zoneLock.Lock()
+		defer s.zoneLock.Unlock()
+	}
+	return handler(sess, name, &obj.Object, cmd.Extension), false
+}
+
+func (s *Server) login(sess *session, l *login) (*reply, bool) {
+	if sess.clID != "" {
+		return codeReply(codeCommandUse, "already logged in"), false
+	}
+	if l.Options.Version != "1.0" {
+		return codeReply(codeUnimplementedVersion, ""), false
+	}
+	if l.Options.Lang != "en" {
+		return codeReply(codeUnimplementedOption, "lang "+l.Options.Lang), false
+	}
+	for _, uri := range l.Svcs.ObjURI {
+		if uri != nsDomain && uri != nsHost && uri != nsContact {
+			return codeReply(codeUnimplementedService, uri), false
+		}
+	}
+	for _, uri := range l.Svcs.SvcExtension.ExtURI {
+		if uri != nsSecDNS {
+			return codeReply(codeUnimplementedExtension, uri), false
+		}
+	}
+	if err := s.reg.Authenticate(l.ClID, l.PW); err != nil {
+		sess.loginFailures++
+		fmt.Println("epp: login failed:", l.ClID, sess.conn.RemoteAddr(), err)
+		if sess.loginFailures >= s.cfg.MaxLoginFailures {
+			return codeReply(codeAuthClosing, ""), true
+		}
+		return codeReply(codeAuthentication, ""), false
+	}
+	if l.NewPW != "" {
+		if err := s.reg.SetRegistrarPassword(l.ClID, l.NewPW); err != nil {
+			return errReply(err), false
+		}
+	}
+	sess.clID = l.ClID
+	fmt.Println("epp: login", l.ClID, sess.conn.RemoteAddr())
+	return codeReply(codeOK, ""), false
+}
+
+func (s *Server) poll(sess *session, p *poll) *reply {
+	switch p.Op {
+	case "req":
+		msg, count := s.reg.Poll(sess.clID)
+		if msg == nil {
+			return codeReply(codeNoMessages, "")
+		}
+		rep := codeReply(codeAckToDequeue, "")
+		rep.msgQ = &msgQ{Count: count, ID: strconv.FormatUint(msg.ID, 10), QDate: formatTime(msg.CreatedAt), Msg: msg.Text}
+		if msg.Transfer != nil {
+			rep.resData = trnData(msg.Transfer)
+		}
+		return rep
+	case "ack":
+		id, err := strconv.ParseUint(p.MsgID, 10, 64)
+		if err != nil {
+			return codeReply(codeValueSyntax, "msgID")
+		}
+		count, err := s.reg.AckMessage(sess.clID, id)
+		if err != nil {
+			return errReply(err)
+		}
+		rep := codeReply(codeOK, "")
+		rep.msgQ = &msgQ{Count: count, ID: p.MsgID}
+		return rep
+	}
+	return codeReply(codeValueSyntax, "poll op")
+}
+
+// 注册年限，只支持整年
+func periodYears(p *period) (int, *reply) {
+	if p == nil {
+		return 0, nil
+	}
+	switch p.Unit {
+	case "y":
+		return p.Value, nil
+	case "m":
+		if p.Value%12 == 0 {
+			return p.Value / 12, nil
+		}
+	}
+	return 0, codeReply(codeValueRange, "period")
+}
+
+func firstName(obj *objectElem) (string, *reply) {
+	if len(obj.Names) == 0 || strings.TrimSpace(obj.Names[0]) == "" {
+		return "", codeReply(codeMissingParam, "name")
+	}
+	return strings.TrimSpace(obj.Names[0]), nil
+}
+
+func statusList(statuses []string) []statusValue {
+	var list []statusValue
+	for _, st := range statuses {
+		list = append(list, statusValue{S: st})
+	}
+	return list
+}
+
+// ---------- domain ----------
+
+func (s *Server) domainCommand(sess *session, name string, obj *objectElem, ext *extension) *reply {
+	if name == "check" {
+		return s.domainCheck(obj)
+	}
+	domainName, rep := firstName(obj)
+	if rep != nil {
+		return rep
+	}
+	switch name {
+	case "info":
+		return s.domainInfo(sess, domainName, obj)
+	case "create":
+		return s.domainCreate(sess, domainName, obj, ext)
+	case "update":
+		return s.domainUpdate(sess, domainName, obj, ext)
+	case "delete":
+		if err := s.reg.DeleteDomain(domainName, sess.clID); err != nil {
+			return errReply(err)
+		}
+		// 进入赎回期时域名仍然存在，稍后才清除
+		if _, err := s.reg.GetDomain(domainName); err == nil {
+			return codeReply(codePending, "")
+		}
+		return codeReply(codeOK, "")
+	case "renew":
+		return s.domainRenew(sess, domainName, obj)
+	case "transfer":
+		return s.domainTransfer(sess, domainName, obj)
+	}
+	return codeReply(codeUnknownCommand, "")
+}
+
+func (s *Server) domainCheck(obj *objectElem) *reply {
+	data := &chkData{XMLName: xml.Name{Space: nsDomain, Local: "chkData"}}
+	for _, name := range obj.Names {
+		item := checkItem{Name: &checkName{Avail: "1", Value: name}}
+		if ok, reason := s.reg.DomainAvailable(name); !ok {
+			item.Name.Avail = "0"
+			item.Reason = reason
+		}
+		data.CD = append(data.CD, item)
+	}
+	rep := codeReply(codeOK, "")
+	rep.resData = data
+	return rep
+}
+
+func (s *Server) domainInfo(sess *session, name string, obj *objectElem) *reply {
+	dom, err := s.reg.GetDomain(name)
+	if err != nil {
+		return errReply(err)
+	}
+	data := &domainInfData{
+		Name:   dom.Name,
+		ROID:   dom.ROID,
+		Status: statusList(dom.Status),
+		ClID:   dom.RegistrarID,
+	}
+	rep := codeReply(codeOK, "")
+	rep.resData = data
+	sponsor := dom.RegistrarID == sess.clID
+	if !sponsor && (obj.AuthInfo == nil || dom.AuthInfo == "" || obj.AuthInfo.PW != dom.AuthInfo) {
+		// 非管理注册商只能看到基本信息
+		return rep
+	}
+	data.Registrant = dom.RegistrantID
+	for _, c := range []contactRef{{"admin", dom.AdminID}, {"tech", dom.TechID}, {"billing", dom.BillingID}} {
+		if c.ID != "" {
+			data.Contacts = append(data.Contacts, c)
+		}
+	}
+	if len(dom.NameServers) > 0 {
+		data.NS = &nsElem{HostObj: dom.NameServers}
+	}
+	for _, host := range s.reg.ListHosts(dom.Name) {
+		data.Hosts = append(data.Hosts, host.Name)
+	}
+	data.CrDate = formatTime(dom.CreatedAt)
+	data.UpDate = formatTime(dom.UpdatedAt)
+	data.ExDate = formatTime(dom.ExpiresAt)
+	data.TrDate = formatTime(dom.TransferredAt)
+	if sponsor {
+		data.AuthInfo = &authInfo{PW: dom.AuthInfo}
+	}
+	if len(dom.DS) > 0 {
+		info := &secDNSInfData{}
+		for _, ds := range dom.DS {
+			if d, ok := parseDS(ds); ok {
+				info.DSData = append(info.DSData, d)
+			}
+		}
+		rep.extension = info
+	}
+	return rep
+}
+
+func (s *Server) domainCreate(sess *session, name string, obj *objectElem, ext *extension) *reply {
+	years, rep := periodYears(obj.Period)
+	if rep != nil {
+		return rep
+	}
+	if obj.Registrant == "" {
+		return codeReply(codeMissingParam, "registrant")
+	}
+	if obj.AuthInfo == nil || obj.AuthInfo.PW == "" {
+		return codeReply(codeMissingParam, "authInfo")
+	}
+	dom := registry.Domain{
+		Name:         name,
+		RegistrarID:  sess.clID,
+		RegistrantID: obj.Registrant,
+		AuthInfo:     obj.AuthInfo.PW,
+	}
+	if rep = setContacts(&dom, obj.Contacts, nil); rep != nil {
+		return rep
+	}
+	if obj.NS != nil {
+		if len(obj.NS.HostAttr) > 0 {
+			return codeReply(codeUnimplementedOption, "hostAttr")
+		}
+		dom.NameServers = obj.NS.HostObj
+	}
+	if ext != nil && ext.SecDNSCreate != nil {
+		if len(ext.SecDNSCreate.KeyData) > 0 {
+			return codeReply(codeUnimplementedOption, "secDNS keyData")
+		}
+		for _, d := range ext.SecDNSCreate.DSData {
+			dom.DS = append(dom.DS, formatDS(d))
+		}
+	}
+	res, err := s.reg.CreateDomain(dom, years, false, "")
+	if err != nil {
+		return errReply(err)
+	}
+	rep = codeReply(codeOK, "")
+	rep.resData = &domainCreData{Name: res.Name, CrDate: formatTime(res.CreatedAt), ExDate: formatTime(res.ExpiresAt)}
+	return rep
+}
+
+// 按add/rem设置admin/tech/billing联系人，rem为true时删除
+func setContacts(dom *registry.Domain, contacts []contactRef, rem []contactRef) *reply {
+	fields := map[string]*string{"admin": &dom.AdminID, "tech": &dom.TechID, "billing": &dom.BillingID}
+	for _, c := range rem {
+		field, ok := fields[c.Type]
+		if !ok {
+			return codeReply(codeValueSyntax, "contact type "+c.Type)
+		}
+		if *field == c.ID {
+			*field = ""
+		}
+	}
+	for _, c := range contacts {
+		field, ok := fields[c.Type]
+		if !ok {
+			return codeReply(codeValueSyntax, "contact type "+c.Type)
+		}
+		*field = c.ID
+	}
+	return nil
+}
+
+func (s *Server) domainUpdate(sess *session, name string, obj *objectElem, ext *extension) *reply {
+	dom, err := s.reg.GetDomain(name)
+	if err != nil {
+		return errReply(err)
+	}
+	if dom.RegistrarID != sess.clID {
+		return codeReply(codeAuthorization, "")
+	}
+	req := *dom
+	req.RegistrarID = sess.clID
+	ns := map[string]bool{}
+	var nsOrder []string
+	for _, host := range dom.NameServers {
+		ns[host] = true
+		nsOrder = append(nsOrder, host)
+	}
+	// 除状态外是否还有其他修改
+	changed := obj.Chg != nil || (ext != nil && ext.SecDNSUpdate != nil)
+	for _, part := range []*updateElem{obj.Rem, obj.Add} {
+		if part != nil && part.NS != nil && len(part.NS.HostAttr) > 0 {
+			return codeReply(codeUnimplementedOption, "hostAttr")
+		}
+		if part != nil && (part.NS != nil || len(part.Contacts) > 0) {
+			changed = true
+		}
+	}
+	var addStatus, remStatus []string
+	if obj.Add != nil {
+		for _, st := range obj.Add.Statuses {
+			addStatus = append(addStatus, st.S)
+		}
+	}
+	if obj.Rem != nil {
+		for _, st := range obj.Rem.Statuses {
+			remStatus = append(remStatus, st.S)
+		}
+	}
+	if !changed {
+		if _, err = s.reg.SetDomainStatus(name, sess.clID, addStatus, remStatus); err != nil {
+			return errReply(err)
+		}
+		return codeReply(codeOK, "")
+	}
+	if obj.Rem != nil {
+		if obj.Rem.NS != nil {
+			for _, host := range obj.Rem.NS.HostObj {
+				delete(ns, strings.ToLower(strings.TrimSuffix(host, ".")))
+			}
+		}
+		if rep := setContacts(&req, nil, obj.Rem.Contacts); rep != nil {
+			return rep
+		}
+	}
+	if obj.Add != nil {
+		if obj.Add.NS != nil {
+			for _, host := range obj.Add.NS.HostObj {
+				host = strings.ToLower(strings.TrimSuffix(host, "."))
+				if !ns[host] {
+					ns[host] = true
+					nsOrder = append(nsOrder, host)
+				}
+			}
+		}
+		if rep := setContacts(&req, obj.Add.Contacts, nil); rep != nil {
+			return rep
+		}
+	}
+	req.NameServers = nil
+	for _, host := range nsOrder {
+		if ns[host] {
+			req.NameServers = append(req.NameServers, host)
+		}
+	}
+	if obj.Chg != nil {
+		if obj.Chg.Registrant != nil {
+			req.RegistrantID = *obj.Chg.Registrant
+		}
+		if obj.Chg.AuthInfo != nil {
+			req.AuthInfo = obj.Chg.AuthInfo.PW
+		}
+	}
+	if ext != nil && ext.SecDNSUpdate != nil {
+		req.DS = updateDS(dom.DS, ext.SecDNSUpdate)
+	}
+	// 按rem、修改、add的顺序执行，同一命令中可以先去掉clientUpdateProhibited再修改
+	if len(remStatus) > 0 {
+		if _, err = s.reg.SetDomainStatus(name, sess.clID, nil, remStatus); err != nil {
+			return errReply(err)
+		}
+	}
+	if _, err = s.reg.UpdateDomain(req); err != nil {
+		return errReply(err)
+	}
+	if len(addStatus) > 0 {
+		if _, err = s.reg.SetDomainStatus(name, sess.clID, addStatus, nil); err != nil {
+			return errReply(err)
+		}
+	}
+	return codeReply(codeOK, "")
+}
+
+func (s *Server) domainRenew(sess *session, name string, obj *objectElem) *reply {
+	years, rep := periodYears(obj.Period)
+	if rep != nil {
+		return rep
+	}
+	if obj.CurExpDate == "" {
+		return codeReply(codeMissingParam, "curExpDate")
+	}
+	curExpDate, err := time.Parse("2006-01-02", obj.CurExpDate)
+	if err != nil {
+		return codeReply(codeValueSyntax, "curExpDate")
+	}
+	dom, err := s.reg.RenewDomain(name, sess.clID, curExpDate, years)
+	if err != nil {
+		return errReply(err)
+	}
+	rep = codeReply(codeOK, "")
+	rep.resData = &domainRenData{Name: dom.Name, ExDate: formatTime(dom.ExpiresAt)}
+	return rep
+}
+
+func (s *Server) domainTransfer(sess *session, name string, obj *objectElem) *reply {
+	var transfer *registry.Transfer
+	var err error
+	code := codeOK
+	switch obj.op {
+	case "request":
+		years, rep := periodYears(obj.Period)
+		if rep != nil {
+			return rep
+		}
+		if obj.AuthInfo == nil {
+			return codeReply(codeMissingParam, "authInfo")
+		}
+		transfer, err = s.reg.RequestTransfer(name, sess.clID, obj.AuthInfo.PW, years)
+		code = codePending
+	case "query":
+		transfer, err = s.reg.QueryTransfer(name, sess.clID)
+	case "approve":
+		transfer, err = s.reg.ApproveTransfer(name, sess.clID)
+	case "reject":
+		transfer, err = s.reg.RejectTransfer(name, sess.clID)
+	case "cancel":
+		transfer, err = s.reg.CancelTransfer(name, sess.clID)
+	default:
+		return codeReply(codeValueSyntax, "transfer op "+obj.op)
+	}
+	if err != nil {
+		return errReply(err)
+	}
+	rep := codeReply(code, "")
+	rep.resData = trnData(transfer)
+	return rep
+}
+
+func trnData(t *registry.Transfer) *domainTrnData {
+	return &domainTrnData{
+		Name:     t.Domain,
+		TrStatus: t.Status,
+		ReID:     t.GainingID,
+		ReDate:   formatTime(t.RequestedAt),
+		AcID:     t.LosingID,
+		AcDate:   formatTime(t.ActionAt),
+		ExDate:   formatTime(t.ExpiresAt),
+	}
+}
+
+// ---------- host ----------
+
+func (s *Server) hostCommand(sess *session, name string, obj *objectElem, ext *extension) *reply {
+	if name == "check" {
+		data := &chkData{XMLName: xml.Name{Space: nsHost, Local: "chkData"}}
+		for _, hostName := range obj.Names {
+			item := checkItem{Name: &checkName{Avail: "1", Value: hostName}}
+			if _, err := s.reg.GetHost(hostName); err == nil {
+				item.Name.Avail = "0"
+				item.Reason = "In use"
+			}
+			data.CD = append(data.CD, item)
+		}
+		rep := codeReply(codeOK, "")
+		rep.resData = data
+		return rep
+	}
+	hostName, rep := firstName(obj)
+	if rep != nil {
+		return rep
+	}
+	switch name {
+	case "info":
+		host, err := s.reg.GetHost(hostName)
+		if err != nil {
+			return errReply(err)
+		}
+		status := []string{registry.StatusOK}
+		if s.reg.HostInUse(host.Name) {
+			status = []string{"linked"}
+		}
+		data := &hostInfData{
+			Name:   host.Name,
+			ROID:   host.ROID,
+			Status: statusList(status),
+			ClID:   host.RegistrarID,
+			CrDate: formatTime(host.CreatedAt),
+			UpDate: formatTime(host.UpdatedAt),
+		}
+		for _, address := range host.Addresses {
+			data.Addrs = append(data.Addrs, hostAddr(address))
+		}
+		rep = codeReply(codeOK, "")
+		rep.resData = data
+		return rep
+	case "create":
+		var addresses []string
+		for _, a := range obj.Addrs {
+			addresses = append(addresses, strings.TrimSpace(a.Value))
+		}
+		host, err := s.reg.CreateHost(registry.Host{Name: hostName, RegistrarID: sess.clID, Addresses: addresses})
+		if err != nil {
+			return errReply(err)
+		}
+		rep = codeReply(codeOK, "")
+		rep.resData = &hostCreData{Name: host.Name, CrDate: formatTime(host.CreatedAt)}
+		return rep
+	case "update":
+		return s.hostUpdate(sess, hostName, obj)
+	case "delete":
+		if err := s.reg.DeleteHost(hostName, sess.clID); err != nil {
+			return errReply(err)
+		}
+		return codeReply(codeOK, "")
+	}
+	return codeReply(codeUnknownCommand, "")
+}
+
+func hostAddr(address string) addr {
+	ip := "v4"
+	if parsed := net.ParseIP(address); parsed != nil && parsed.To4() == nil {
+		ip = "v6"
+	}
+	return addr{IP: ip, Value: address}
+}
+
+func (s *Server) hostUpdate(sess *session, name string, obj *objectElem) *reply {
+	host, err := s.reg.GetHost(name)
+	if err != nil {
+		return errReply(err)
+	}
+	if obj.Chg != nil && obj.Chg.Name != "" {
+		return codeReply(codeUnimplementedOption, "host rename")
+	}
+	for _, part := range []*updateElem{obj.Rem, obj.Add} {
+		if part != nil && len(part.Statuses) > 0 {
+			return codeReply(codeUnimplementedOption, "status")
+		}
+	}
+	addresses := map[string]bool{}
+	var order []string
+	for _, a := range host.Addresses {
+		addresses[a] = true
+		order = append(order, a)
+	}
+	if obj.Rem != nil {
+		for _, a := range obj.Rem.Addrs {
+			delete(addresses, strings.TrimSpace(a.Value))
+		}
+	}
+	if obj.Add != nil {
+		for _, a := range obj.Add.Addrs {
+			value := strings.TrimSpace(a.Value)
+			if !addresses[value] {
+				addresses[value] = true
+				order = append(order, value)
+			}
+		}
+	}
+	req := registry.Host{Name: host.Name, RegistrarID: sess.clID}
+	for _, a := range order {
+		if addresses[a] {
+			req.Addresses = append(req.Addresses, a)
+		}
+	}
+	if _, err = s.reg.UpdateHost(req); err != nil {
+		return errReply(err)
+	}
+	return codeReply(codeOK, "")
+}
+
+// ---------- contact ----------
+
+func (s *Server) contactCommand(sess *session, name string, obj *objectElem, ext *extension) *reply {
+	if name == "check" {
+		data := &chkData{XMLName: xml.Name{Space: nsContact, Local: "chkData"}}
+		for _, id := range obj.IDs {
+			item := checkItem{ID: &checkName{Avail: "1", Value: id}}
+			if _, err := s.reg.GetContact(id); err == nil {
+				item.ID.Avail = "0"
+				item.Reason = "In use"
+			}
+			data.CD = append(data.CD, item)
+		}
+		rep := codeReply(codeOK, "")
+		rep.resData = data
+		return rep
+	}
+	if len(obj.IDs) == 0 || strings.TrimSpace(obj.IDs[0]) == "" {
+		return codeReply(codeMissingParam, "id")
+	}
+	id := strings.TrimSpace(obj.IDs[0])
+	switch name {
+	case "info":
+		return s.contactInfo(sess, id, obj)
+	case "create":
+		contact := registry.Contact{ID: id, RegistrarID: sess.clID, Voice: obj.Voice, Fax: obj.Fax, Email: obj.Email}
+		if len(obj.PostalInfo) == 0 {
+			return codeReply(codeMissingParam, "postalInfo")
+		}
+		setPostalInfo(&contact, obj.PostalInfo[0])
+		if obj.AuthInfo != nil {
+			contact.AuthInfo = obj.AuthInfo.PW
+		}
+		res, err := s.reg.CreateContact(contact)
+		if err != nil {
+			return errReply(err)
+		}
+		rep := codeReply(codeOK, "")
+		rep.resData = &contactCreData{ID: res.ID, CrDate: formatTime(res.CreatedAt)}
+		return rep
+	case "update":
+		contact, err := s.reg.GetContact(id)
+		if err != nil {
+			return errReply(err)
+		}
+		if obj.Add != nil || obj.Rem != nil {
+			return codeReply(codeUnimplementedOption, "status")
+		}
+		if chg := obj.Chg; chg != nil {
+			if len(chg.PostalInfo) > 0 {
+				setPostalInfo(contact, chg.PostalInfo[0])
+			}
+			if chg.Voice != nil {
+				contact.Voice = *chg.Voice
+			}
+			if chg.Fax != nil {
+				contact.Fax = *chg.Fax
+			}
+			if chg.Email != nil {
+				contact.Email = *chg.Email
+			}
+			if chg.AuthInfo != nil {
+				contact.AuthInfo = chg.AuthInfo.PW
+			}
+		}
+		contact.RegistrarID = sess.clID
+		if _, err = s.reg.UpdateContact(*contact); err != nil {
+			return errReply(err)
+		}
+		return codeReply(codeOK, "")
+	case "delete":
+		if err := s.reg.DeleteContact(id, sess.clID); err != nil {
+			return errReply(err)
+		}
+		return codeReply(codeOK, "")
+	}
+	return codeReply(codeUnimplementedOption, "contact "+name)
+}
+
+func setPostalInfo(c *registry.Contact, p postalInfo) {
+	c.Name = p.Name
+	c.Org = p.Org
+	c.Street = p.Addr.Street
+	c.City = p.Addr.City
+	c.Province = p.Addr.SP
+	c.PostalCode = p.Addr.PC
+	c.Country = p.Addr.CC
+}
+
+func (s *Server) contactInfo(sess *session, id string, obj *objectElem) *reply {
+	contact, err := s.reg.GetContact(id)
+	if err != nil {
+		return errReply(err)
+	}
+	sponsor := contact.RegistrarID == sess.clID
+	if !sponsor && (obj.AuthInfo == nil || contact.AuthInfo == "" || obj.AuthInfo.PW != contact.AuthInfo) {
+		return codeReply(codeAuthorization, "")
+	}
+	status := []string{registry.StatusOK}
+	if s.reg.ContactInUse(id) {
+		status = []string{"linked"}
+	}
+	p := &postalInfo{Type: "int", Name: contact.Name, Org: contact.Org}
+	p.Addr.Street = contact.Street
+	p.Addr.City = contact.City
+	p.Addr.SP = contact.Province
+	p.Addr.PC = contact.PostalCode
+	p.Addr.CC = contact.Country
+	data := &contactInfData{
+		ID:         contact.ID,
+		ROID:       contact.ROID,
+		Status:     statusList(status),
+		PostalInfo: p,
+		Voice:      contact.Voice,
+		Fax:        contact.Fax,
+		Email:      contact.Email,
+		ClID:       contact.RegistrarID,
+		CrDate:     formatTime(contact.CreatedAt),
+		UpDate:     formatTime(contact.UpdatedAt),
+	}
+	if sponsor {
+		data.AuthInfo = &authInfo{PW: contact.AuthInfo}
+	}
+	rep := codeReply(codeOK, "")
+	rep.resData = data
+	return rep
+}
+
+// ---------- secDNS ----------
+
+// registry中DS的格式为"keyTag alg digestType digest"
+func formatDS(d dsData) string {
+	return fmt.Sprintf("%d %d %d %s", d.KeyTag, d.Alg, d.DigestType, strings.ToUpper(strings.TrimSpace(d.Digest)))
+}
+
+func parseDS(ds string) (dsData, bool) {
+	items := strings.Fields(ds)
+	if len(items) < 4 {
+		return dsData{}, false
+	}
+	keyTag, err1 := strconv.ParseUint(items[0], 10, 16)
+	alg, err2 := strconv.ParseUint(items[1], 10, 8)
+	digestType, err3 := strconv.ParseUint(items[2], 10, 8)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return dsData{}, false
+	}
+	return dsData{KeyTag: uint16(keyTag), Alg: uint8(alg), DigestType: uint8(digestType), Digest: strings.Join(items[3:], "")}, true
+}
+
+func updateDS(current []string, u *secDNSUpdate) []string {
+	var list []string
+	if u.Rem == nil || u.Rem.All != "true" {
+		removed := map[string]bool{}
+		if u.Rem != nil {
+			for _, d := range u.Rem.DSData {
+				removed[formatDS(d)] = true
+			}
+		}
+		for _, ds := range current {
+			if d, ok := parseDS(ds); !ok || !removed[formatDS(d)] {
+				list = append(list, ds)
+			}
+		}
+	}
+	if u.Add != nil {
+		for _, d := range u.Add.DSData {
+			if ds := formatDS(d); !containsDS(list, ds) {
+				list = append(list, ds)
+			}
+		}
+	}
+	return list
+}
+
+func containsDS(list []string, ds string) bool {
+	for _, item := range list {
+		if d, ok := parseDS(item); ok && formatDS(d) == ds {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package epp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// EPP服务配置，对应config.yaml中的epp节点
+type Config struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+	// 服务器证书和私钥，启用EPP时必须配置
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// 不为空时要求注册商提供由该CA签发的客户端证书
+	ClientCAFile string `json:"clientCAFile"`
+	ServerID     string `json:"serverID"`
+	IdleTimeout  string `json:"idleTimeout"`
+	// 单个数据单元的最大字节数
+	MaxFrameSize int `json:"maxFrameSize"`
+	// 连续登录失败多少次后断开连接
+	MaxLoginFailures int `json:"maxLoginFailures"`
+
+	idleTimeout time.Duration
+}
+
+// 读取epp配置并补齐默认值
+func LoadConfig(ctx context.Context) (Config, error) {
+	cfg := Config{
+		Listen:           ":700",
+		ServerID:         "CHN-EPP",
+		IdleTimeout:      "10m",
+		MaxFrameSize:     65536,
+		MaxLoginFailures: 3,
+	}
+	v, err := g.Cfg().Get(ctx, "epp")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.idleTimeout, err = time.ParseDuration(cfg.IdleTimeout); err != nil {
+		return cfg, fmt.Errorf("epp.idleTimeout 格式错误: %v", err)
+	}
+	if cfg.Enabled && (cfg.CertFile == "" || cfg.KeyFile == "") {
+		return cfg, fmt.Errorf("启用EPP时必须配置 epp.certFile 和 epp.keyFile")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,134 @@
+// 本地测试用的EPP客户端：登录后依次发送参数中的XML文件，打印服务器响应后登出
+//
+//	go run ./registry/epp/eppclient -addr 127.0.0.1:700 -id reg1 -pw secret123 samples/domain-check.xml
+package main
+
+import (
+	"crypto/tls"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"newCHNTLDManager/registry/epp"
+)
+
+const loginTemplate = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<epp xmlns="urn:ietf:params:xml:ns:epp-1.0">
+  <command>
+    <login>
+      <clID>%s</clID>
+      <pw>%s</pw>%s
+      <options>
+        <version>1.0</version>
+        <lang>en</lang>
+      </options>
+      <svcs>
+        <objURI>urn:ietf:params:xml:ns:domain-1.0</objURI>
+        <objURI>urn:ietf:params:xml:ns:host-1.0</objURI>
+        <objURI>urn:ietf:params:xml:ns:contact-1.0</objURI>
+        <svcExtension>
+          <extURI>urn:ietf:params:xml:ns:secDNS-1.1</extURI>
+        </svcExtension>
+      </svcs>
+    </login>
+    <clTRID>eppclient-login</clTRID>
+  </command>
+</epp>`
+
+const logoutFrame = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<epp xmlns="urn:ietf:params:xml:ns:epp-1.0">
+  <command>
+    <logout/>
+    <clTRID>eppclient-logout</clTRID>
+  </command>
+</epp>`
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:700", "EPP服务地址")
+	id := flag.String("id", "", "注册商ID")
+	pw := flag.String("pw", "", "注册商密码")
+	newPW := flag.String("newpw", "", "登录同时修改密码")
+	insecure := flag.Bool("insecure", false, "不校验服务器证书，用于自签名证书")
+	certFile := flag.String("cert", "", "客户端证书")
+	keyFile := flag.String("key", "", "客户端证书私钥")
+	flag.Parse()
+
+	conf := &tls.Config{InsecureSkipVerify: *insecure}
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			fail(err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	conn, err := tls.Dial("tcp", *addr, conf)
+	if err != nil {
+		fail(err)
+	}
+	defer conn.Close()
+
+	// 服务器连接后先发送greeting
+	if err = receive(conn); err != nil {
+		fail(err)
+	}
+	newPWElem := ""
+	if *newPW != "" {
+		newPWElem = "\n      <newPW>" + escape(*newPW) + "</newPW>"
+	}
+	if err = exchange(conn, []byte(fmt.Sprintf(loginTemplate, escape(*id), escape(*pw), newPWElem))); err != nil {
+		fail(err)
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, file := range files {
+		var frame []byte
+		if file == "-" {
+			frame, err = io.ReadAll(os.Stdin)
+		} else {
+			frame, err = os.ReadFile(file)
+		}
+		if err != nil {
+			fail(err)
+		}
+		if err = exchange(conn, frame); err != nil {
+			fail(err)
+		}
+	}
+	if err = exchange(conn, []byte(logoutFrame)); err != nil {
+		fail(err)
+	}
+}
+
+func exchange(conn *tls.Conn, frame []byte) error {
+	fmt.Printf(">>>>\n%s\n", frame)
+	if err := epp.WriteFrame(conn, frame); err != nil {
+		return err
+	}
+	return receive(conn)
+}
+
+func receive(conn *tls.Conn) error {
+	frame, err := epp.ReadFrame(conn, 1<<20)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("<<<<\n%s\n", frame)
+	return nil
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "eppclient:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,35 @@
+package epp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// RFC 5734：每个EPP数据单元前有4字节大端长度，长度包含这4个字节本身
+
+// 读取一个数据单元，超过maxSize时返回错误
+func ReadFrame(r io.Reader, maxSize int) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[:]))
+	if size < 4 || size-4 > maxSize {
+		return nil, fmt.Errorf("EPP数据单元长度%d不合法", size)
+	}
+	data := make([]byte, size-4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// 写一个数据单元
+func WriteFrame(w io.Writer, data []byte) error {
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)))
+	copy(buf[4:], data)
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,65 @@
+package epp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func frameOf(size uint32, body []byte) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, size)
+	return append(buf, body...)
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		maxSize int
+		want    string
+		wantErr bool
+	}{
+		{"ok", frameOf(9, []byte("hello")), 100, "hello", false},
+		{"empty body", frameOf(4, nil), 100, "", false},
+		{"at max size", frameOf(9, []byte("hello")), 5, "hello", false},
+		{"over max size", frameOf(10, []byte("hello!")), 5, "", true},
+		{"length below header", frameOf(3, nil), 100, "", true},
+		{"truncated body", frameOf(20, []byte("short")), 100, "", true},
+		{"truncated header", []byte{0, 0}, 100, "", true},
+		{"no input", nil, 100, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadFrame(bytes.NewReader(tt.input), tt.maxSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFrame error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("ReadFrame = %q，应为 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, body := range []string{"<epp/>", "", "第二个"} {
+		if err := WriteFrame(&buf, []byte(body)); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+	}
+	if size := binary.BigEndian.Uint32(buf.Bytes()); size != 10 {
+		t.Errorf("长度字段为%d，应包含4字节长度本身即10", size)
+	}
+	for _, want := range []string{"<epp/>", "", "第二个"} {
+		got, err := ReadFrame(&buf, 100)
+		if err != nil || string(got) != want {
+			t.Errorf("ReadFrame = %q, %v，应为 %q", got, err, want)
+		}
+	}
+	if _, err := ReadFrame(&buf, 100); err != io.EOF {
+		t.Errorf("读完后应返回io.EOF，得到 %v", err)
+	}
+}
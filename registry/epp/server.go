@@ -0,0 +1,142 @@
+package epp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"newCHNTLDManager/registry"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// 注册商使用的EPP服务（RFC 5730-5734）
+type Server struct {
+	cfg Config
+	reg *registry.Registry
+	// 修改zone的命令需要持有的锁，即main中的mLock
+	zoneLock sync.Locker
+	listener net.Listener
+	svTRID   uint64
+}
+
+func NewServer(cfg Config, reg *registry.Registry, zoneLock sync.Locker) *Server {
+	return &Server{cfg: cfg, reg: reg, zoneLock: zoneLock}
+}
+
+// 一个注册商连接
+type session struct {
+	conn          net.Conn
+	clID          string
+	loginFailures int
+}
+
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if s.cfg.CertFile == "" || s.cfg.KeyFile == "" {
+		return nil, fmt.Errorf("epp.certFile 和 epp.keyFile 必须配置")
+	}
+	cert, err := tls.LoadX509KeyPair(s.cfg.CertFile, s.cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取EPP证书失败: %v", err)
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if s.cfg.ClientCAFile != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(gfile.GetBytes(s.cfg.ClientCAFile)) {
+			return nil, fmt.Errorf("读取EPP客户端CA %s 失败", s.cfg.ClientCAFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
+}
+
+// 开始监听，返回后在后台处理连接
+func (s *Server) Start() error {
+	conf, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	s.listener, err = tls.Listen("tcp", s.cfg.Listen, conf)
+	if err != nil {
+		return err
+	}
+	fmt.Println("epp: listening on", s.listener.Addr())
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				fmt.Println("epp: accept error:", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			go s.serve(conn)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	sess := &session{conn: conn}
+	if err := s.write(sess, s.greeting()); err != nil {
+		return
+	}
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(s.cfg.idleTimeout))
+		frame, err := ReadFrame(conn, s.cfg.MaxFrameSize)
+		if err != nil {
+			return
+		}
+		res, closeConn := s.handle(sess, frame)
+		if err = s.write(sess, res); err != nil || closeConn {
+			return
+		}
+	}
+}
+
+func (s *Server) write(sess *session, res *eppResponse) error {
+	body, err := xml.Marshal(res)
+	if err != nil {
+		return err
+	}
+	_ = sess.conn.SetWriteDeadline(time.Now().Add(s.cfg.idleTimeout))
+	return WriteFrame(sess.conn, append([]byte(xml.Header), body...))
+}
+
+func (s *Server) greeting() *eppResponse {
+	g := &greeting{SvID: s.cfg.ServerID, SvDate: formatTime(time.Now())}
+	g.SvcMenu.Version = "1.0"
+	g.SvcMenu.Lang = []string{"en"}
+	g.SvcMenu.ObjURI = []string{nsDomain, nsHost, nsContact}
+	g.SvcMenu.SvcExtension.ExtURI = []string{nsSecDNS}
+	return &eppResponse{Greeting: g}
+}
+
+func (s *Server) nextSvTRID() string {
+	return fmt.Sprintf("%s-%d-%d", s.cfg.ServerID, time.Now().Unix(), atomic.AddUint64(&s.svTRID, 1))
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.0Z")
+}
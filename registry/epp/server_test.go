@@ -0,0 +1,112 @@
+package epp
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"newCHNTLDManager/registry"
+)
+
+// 不做任何事的Zone，EPP会话测试不涉及zone内容
+type nopZone struct{}
+
+func (nopZone) PublishDelegation(string, []string, map[string][]string, []string) error { return nil }
+func (nopZone) WithdrawDelegation(string) error                                         { return nil }
+func (nopZone) PurgeDomain(string) error                                                { return nil }
+func (nopZone) Commit() error                                                           { return nil }
+func (nopZone) Rollback()                                                               {}
+func (nopZone) SetDomainLock(string, bool) error                                        { return nil }
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	reg, err := registry.New(registry.Config{DataFile: filepath.Join(t.TempDir(), "registry.json"), TLD: "chn"}, nopZone{})
+	if err != nil {
+		t.Fatalf("registry.New: %v", err)
+	}
+	if _, err = reg.CreateRegistrar(registry.Registrar{ID: "reg1", Name: "reg1", Email: "reg1@example.com"}); err != nil {
+		t.Fatalf("CreateRegistrar: %v", err)
+	}
+	if err = reg.SetRegistrarPassword("reg1", "secret1"); err != nil {
+		t.Fatalf("SetRegistrarPassword: %v", err)
+	}
+	cfg := Config{ServerID: "TEST", MaxFrameSize: 65536, MaxLoginFailures: 2, idleTimeout: time.Minute}
+	return NewServer(cfg, reg, &sync.Mutex{})
+}
+
+func TestTLSConfigRequiresCertificate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no cert", Config{}},
+		{"no key", Config{CertFile: "server.crt"}},
+		{"missing files", Config{CertFile: filepath.Join(t.TempDir(), "server.crt"), KeyFile: filepath.Join(t.TempDir(), "server.key")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewServer(tt.cfg, nil, nil).tlsConfig(); err == nil {
+				t.Error("没有可用证书时应返回错误")
+			}
+		})
+	}
+}
+
+const loginFrame = `<epp xmlns="urn:ietf:params:xml:ns:epp-1.0"><command><login>
+<clID>reg1</clID><pw>%s</pw><options><version>1.0</version><lang>en</lang></options>
+<svcs><objURI>urn:ietf:params:xml:ns:domain-1.0</objURI></svcs></login><clTRID>ABC-1</clTRID></command></epp>`
+
+func TestHandle(t *testing.T) {
+	login := func(pw string) string { return fmt.Sprintf(loginFrame, pw) }
+	steps := []struct {
+		name      string
+		frame     string
+		greeting  bool
+		code      int
+		closeConn bool
+	}{
+		{name: "hello", frame: `<epp xmlns="urn:ietf:params:xml:ns:epp-1.0"><hello/></epp>`, greeting: true},
+		{name: "not xml", frame: `<epp`, code: codeSyntax},
+		{name: "wrong namespace", frame: `<epp xmlns="urn:example"><hello/></epp>`, code: codeSyntax},
+		{name: "no command", frame: `<epp xmlns="urn:ietf:params:xml:ns:epp-1.0"/>`, code: codeUnknownCommand},
+		{name: "command before login", frame: `<epp xmlns="urn:ietf:params:xml:ns:epp-1.0"><command><logout/></command></epp>`, code: codeCommandUse},
+		{name: "wrong password", frame: login("wrong1"), code: codeAuthentication},
+		{name: "login", frame: login("secret1"), code: codeOK},
+		{name: "login twice", frame: login("secret1"), code: codeCommandUse},
+		{name: "logout", frame: `<epp xmlns="urn:ietf:params:xml:ns:epp-1.0"><command><logout/></command></epp>`, code: codeLogout, closeConn: true},
+	}
+	s := newTestServer(t)
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	sess := &session{conn: server}
+	for _, step := range steps {
+		res, closeConn := s.handle(sess, []byte(step.frame))
+		if step.greeting {
+			if res.Greeting == nil || res.Greeting.SvID != "TEST" {
+				t.Errorf("%s: 应返回greeting", step.name)
+			}
+			continue
+		}
+		if res.Response == nil || res.Response.Result.Code != step.code || closeConn != step.closeConn {
+			t.Errorf("%s: 响应 %+v closeConn=%v，应为 %d closeConn=%v", step.name, res.Response, closeConn, step.code, step.closeConn)
+		}
+	}
+}
+
+func TestHandleLoginFailuresCloseConnection(t *testing.T) {
+	s := newTestServer(t)
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	sess := &session{conn: server}
+	for i, want := range []int{codeAuthentication, codeAuthClosing} {
+		res, closeConn := s.handle(sess, []byte(fmt.Sprintf(loginFrame, "wrong1")))
+		if res.Response.Result.Code != want || closeConn != (want == codeAuthClosing) {
+			t.Errorf("第%d次登录失败: code=%d closeConn=%v，应为%d", i+1, res.Response.Result.Code, closeConn, want)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package epp
+
+import "encoding/xml"
+
+const (
+	nsEPP     = "urn:ietf:params:xml:ns:epp-1.0"
+	nsDomain  = "urn:ietf:params:xml:ns:domain-1.0"
+	nsHost    = "urn:ietf:params:xml:ns:host-1.0"
+	nsContact = "urn:ietf:params:xml:ns:contact-1.0"
+	nsSecDNS  = "urn:ietf:params:xml:ns:secDNS-1.1"
+)
+
+// ---------- 请求 ----------
+
+// 客户端发来的数据单元，只按元素的local name匹配，命名空间在处理命令时检查
+type eppRequest struct {
+	XMLName xml.Name  `xml:"epp"`
+	Hello   *struct{} `xml:"hello"`
+	Command *command  `xml:"command"`
+}
+
+type command struct {
+	Login     *login     `xml:"login"`
+	Logout    *struct{}  `xml:"logout"`
+	Check     *objectCmd `xml:"check"`
+	Info      *objectCmd `xml:"info"`
+	Create    *objectCmd `xml:"create"`
+	Update    *objectCmd `xml:"update"`
+	Delete    *objectCmd `xml:"delete"`
+	Renew     *objectCmd `xml:"renew"`
+	Transfer  *objectCmd `xml:"transfer"`
+	Poll      *poll      `xml:"poll"`
+	Extension *extension `xml:"extension"`
+	ClTRID    string     `xml:"clTRID"`
+}
+
+type login struct {
+	ClID    string `xml:"clID"`
+	PW      string `xml:"pw"`
+	NewPW   string `xml:"newPW"`
+	Options struct {
+		Version string `xml:"version"`
+		Lang    string `xml:"lang"`
+	} `xml:"options"`
+	Svcs struct {
+		ObjURI       []string `xml:"objURI"`
+		SvcExtension struct {
+			ExtURI []string `xml:"extURI"`
+		} `xml:"svcExtension"`
+	} `xml:"svcs"`
+}
+
+type poll struct {
+	Op    string `xml:"op,attr"`
+	MsgID string `xml:"msgID,attr"`
+}
+
+// check/info/create等命令下的对象元素，如<domain:create>
+type objectCmd struct {
+	Op     string     `xml:"op,attr"`
+	Object objectElem `xml:",any"`
+}
+
+// 覆盖domain、host、contact三种对象命令可能出现的子元素
+type objectElem struct {
+	XMLName    xml.Name
+	Names      []string     `xml:"name"`
+	IDs        []string     `xml:"id"`
+	Period     *period      `xml:"period"`
+	NS         *nsElem      `xml:"ns"`
+	Registrant string       `xml:"registrant"`
+	Contacts   []contactRef `xml:"contact"`
+	AuthInfo   *authInfo    `xml:"authInfo"`
+	CurExpDate string       `xml:"curExpDate"`
+	Addrs      []addr       `xml:"addr"`
+	PostalInfo []postalInfo `xml:"postalInfo"`
+	Voice      string       `xml:"voice"`
+	Fax        string       `xml:"fax"`
+	Email      string       `xml:"email"`
+	Add        *updateElem  `xml:"add"`
+	Rem        *updateElem  `xml:"rem"`
+	Chg        *updateElem  `xml:"chg"`
+
+	// transfer命令的op属性
+	op string
+}
+
+type updateElem struct {
+	NS         *nsElem      `xml:"ns"`
+	Contacts   []contactRef `xml:"contact"`
+	Statuses   []statusElem `xml:"status"`
+	Registrant *string      `xml:"registrant"`
+	AuthInfo   *authInfo    `xml:"authInfo"`
+	Addrs      []addr       `xml:"addr"`
+	Name       string       `xml:"name"`
+	PostalInfo []postalInfo `xml:"postalInfo"`
+	Voice      *string      `xml:"voice"`
+	Fax        *string      `xml:"fax"`
+	Email      *string      `xml:"email"`
+}
+
+type period struct {
+	Unit  string `xml:"unit,attr"`
+	Value int    `xml:",chardata"`
+}
+
+type nsElem struct {
+	HostObj  []string   `xml:"hostObj"`
+	HostAttr []struct{} `xml:"hostAttr"`
+}
+
+type contactRef struct {
+	Type string `xml:"type,attr"`
+	ID   string `xml:",chardata"`
+}
+
+type authInfo struct {
+	PW string `xml:"pw"`
+}
+
+type addr struct {
+	IP    string `xml:"ip,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type statusElem struct {
+	S     string `xml:"s,attr"`
+	Lang  string `xml:"lang,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type postalInfo struct {
+	Type string `xml:"type,attr"`
+	Name string `xml:"name"`
+	Org  string `xml:"org,omitempty"`
+	Addr struct {
+		Street []string `xml:"street"`
+		City   string   `xml:"city"`
+		SP     string   `xml:"sp,omitempty"`
+		PC     string   `xml:"pc,omitempty"`
+		CC     string   `xml:"cc"`
+	} `xml:"addr"`
+}
+
+// RFC 5910 DNSSEC扩展，只支持dsData
+type extension struct {
+	SecDNSCreate *secDNSData   `xml:"urn:ietf:params:xml:ns:secDNS-1.1 create"`
+	SecDNSUpdate *secDNSUpdate `xml:"urn:ietf:params:xml:ns:secDNS-1.1 update"`
+}
+
+type secDNSData struct {
+	DSData  []dsData   `xml:"dsData"`
+	KeyData []struct{} `xml:"keyData"`
+}
+
+type secDNSUpdate struct {
+	Rem *struct {
+		All    string   `xml:"all"`
+		DSData []dsData `xml:"dsData"`
+	} `xml:"rem"`
+	Add *secDNSData `xml:"add"`
+}
+
+type dsData struct {
+	KeyTag     uint16 `xml:"keyTag"`
+	Alg        uint8  `xml:"alg"`
+	DigestType uint8  `xml:"digestType"`
+	Digest     string `xml:"digest"`
+}
+
+// ---------- 响应 ----------
+
+type eppResponse struct {
+	XMLName  xml.Name  `xml:"urn:ietf:params:xml:ns:epp-1.0 epp"`
+	Greeting *greeting `xml:"greeting,omitempty"`
+	Response *response `xml:"response,omitempty"`
+}
+
+type greeting struct {
+	SvID    string `xml:"svID"`
+	SvDate  string `xml:"svDate"`
+	SvcMenu struct {
+		Version      string   `xml:"version"`
+		Lang         []string `xml:"lang"`
+		ObjURI       []string `xml:"objURI"`
+		SvcExtension struct {
+			ExtURI []string `xml:"extURI"`
+		} `xml:"svcExtension"`
+	} `xml:"svcMenu"`
+	DCP struct {
+		Access struct {
+			All struct{} `xml:"all"`
+		} `xml:"access"`
+		Statement struct {
+			Purpose struct {
+				Admin struct{} `xml:"admin"`
+				Prov  struct{} `xml:"prov"`
+			} `xml:"purpose"`
+			Recipient struct {
+				Ours   struct{} `xml:"ours"`
+				Public struct{} `xml:"public"`
+			} `xml:"recipient"`
+			Retention struct {
+				Stated struct{} `xml:"stated"`
+			} `xml:"retention"`
+		} `xml:"statement"`
+	} `xml:"dcp"`
+}
+
+type response struct {
+	Result    result      `xml:"result"`
+	MsgQ      *msgQ       `xml:"msgQ,omitempty"`
+	ResData   *anyData    `xml:"resData,omitempty"`
+	Extension *anyData    `xml:"extension,omitempty"`
+	TrID      transaction `xml:"trID"`
+}
+
+type result struct {
+	Code int    `xml:"code,attr"`
+	Msg  string `xml:"msg"`
+}
+
+type msgQ struct {
+	Count int    `xml:"count,attr"`
+	ID    string `xml:"id,attr,omitempty"`
+	QDate string `xml:"qDate,omitempty"`
+	Msg   string `xml:"msg,omitempty"`
+}
+
+// resData或extension的内容，元素名由Data的XMLName决定
+type anyData struct {
+	Data interface{}
+}
+
+type transaction struct {
+	ClTRID string `xml:"clTRID,omitempty"`
+	SvTRID string `xml:"svTRID"`
+}
+
+type checkName struct {
+	Avail string `xml:"avail,attr"`
+	Value string `xml:",chardata"`
+}
+
+type checkItem struct {
+	Name   *checkName `xml:"name,omitempty"`
+	ID     *checkName `xml:"id,omitempty"`
+	Reason string     `xml:"reason,omitempty"`
+}
+
+type chkData struct {
+	XMLName xml.Name
+	CD      []checkItem `xml:"cd"`
+}
+
+type statusValue struct {
+	S string `xml:"s,attr"`
+}
+
+type domainInfData struct {
+	XMLName    xml.Name      `xml:"urn:ietf:params:xml:ns:domain-1.0 infData"`
+	Name       string        `xml:"name"`
+	ROID       string        `xml:"roid"`
+	Status     []statusValue `xml:"status"`
+	Registrant string        `xml:"registrant,omitempty"`
+	Contacts   []contactRef  `xml:"contact"`
+	NS         *nsElem       `xml:"ns,omitempty"`
+	Hosts      []string      `xml:"host"`
+	ClID       string        `xml:"clID"`
+	CrDate     string        `xml:"crDate,omitempty"`
+	UpDate     string        `xml:"upDate,omitempty"`
+	ExDate     string        `xml:"exDate,omitempty"`
+	TrDate     string        `xml:"trDate,omitempty"`
+	AuthInfo   *authInfo     `xml:"authInfo,omitempty"`
+}
+
+type domainCreData struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:domain-1.0 creData"`
+	Name    string   `xml:"name"`
+	CrDate  string   `xml:"crDate"`
+	ExDate  string   `xml:"exDate"`
+}
+
+type domainRenData struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:domain-1.0 renData"`
+	Name    string   `xml:"name"`
+	ExDate  string   `xml:"exDate"`
+}
+
+type domainTrnData struct {
+	XMLName  xml.Name `xml:"urn:ietf:params:xml:ns:domain-1.0 trnData"`
+	Name     string   `xml:"name"`
+	TrStatus string   `xml:"trStatus"`
+	ReID     string   `xml:"reID"`
+	ReDate   string   `xml:"reDate"`
+	AcID     string   `xml:"acID"`
+	AcDate   string   `xml:"acDate"`
+	ExDate   string   `xml:"exDate,omitempty"`
+}
+
+type hostInfData struct {
+	XMLName xml.Name      `xml:"urn:ietf:params:xml:ns:host-1.0 infData"`
+	Name    string        `xml:"name"`
+	ROID    string        `xml:"roid"`
+	Status  []statusValue `xml:"status"`
+	Addrs   []addr        `xml:"addr"`
+	ClID    string        `xml:"clID"`
+	CrDate  string        `xml:"crDate"`
+	UpDate  string        `xml:"upDate,omitempty"`
+}
+
+type hostCreData struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:host-1.0 creData"`
+	Name    string   `xml:"name"`
+	CrDate  string   `xml:"crDate"`
+}
+
+type contactInfData struct {
+	XMLName    xml.Name      `xml:"urn:ietf:params:xml:ns:contact-1.0 infData"`
+	ID         string        `xml:"id"`
+	ROID       string        `xml:"roid"`
+	Status     []statusValue `xml:"status"`
+	PostalInfo *postalInfo   `xml:"postalInfo,omitempty"`
+	Voice      string        `xml:"voice,omitempty"`
+	Fax        string        `xml:"fax,omitempty"`
+	Email      string        `xml:"email"`
+	ClID       string        `xml:"clID"`
+	CrDate     string        `xml:"crDate"`
+	UpDate     string        `xml:"upDate,omitempty"`
+	AuthInfo   *authInfo     `xml:"authInfo,omitempty"`
+}
+
+type contactCreData struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:contact-1.0 creData"`
+	ID      string   `xml:"id"`
+	CrDate  string   `xml:"crDate"`
+}
+
+type secDNSInfData struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:secDNS-1.1 infData"`
+	DSData  []dsData `xml:"dsData"`
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 错误类别，EPP等接口据此返回对应的结果码
+type ErrorKind int
+
+const (
+	ErrUnknown ErrorKind = iota
+	// 参数格式错误
+	ErrInvalid
+	// 参数超出范围
+	ErrRange
+	// 对象不存在
+	ErrNotFound
+	// 对象已存在
+	ErrExists
+	// 对象仍被引用
+	ErrInUse
+	// 违反注册政策
+	ErrPolicy
+	// 不是对象的管理注册商
+	ErrForbidden
+	// 认证失败
+	ErrAuthentication
+	// authInfo不正确
+	ErrAuthInfo
+	// 对象状态不允许该操作
+	ErrProhibited
+	// 已有转移申请
+	ErrPendingTransfer
+	// 没有转移申请
+	ErrNoPendingTransfer
+	// 余额不足等计费原因
+	ErrBilling
+)
+
+type Error struct {
+	Kind ErrorKind
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func errorf(kind ErrorKind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// 取得错误类别，非registry错误返回ErrUnknown
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return ErrUnknown
+}
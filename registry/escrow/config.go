@@ -0,0 +1,82 @@
+package escrow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 数据托管配置，对应config.yaml中的escrow节点
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// 托管文件和状态文件所在目录
+	Dir string `json:"dir"`
+	// 全量托管的间隔，其间按diffInterval生成增量托管，RDE惯例为每周全量、每天增量
+	FullInterval string `json:"fullInterval"`
+	DiffInterval string `json:"diffInterval"`
+	// 检查是否需要托管的间隔
+	CheckInterval string `json:"checkInterval"`
+	// 加密和签名，recipient、signKey都为空时只生成明文XML
+	GPG GPGConfig `json:"gpg"`
+
+	fullInterval  time.Duration
+	diffInterval  time.Duration
+	checkInterval time.Duration
+}
+
+// 调用本机gpg加密和签名
+type GPGConfig struct {
+	Binary string `json:"binary"`
+	// gpg的--homedir，为空时使用运行用户的默认目录
+	Home string `json:"home"`
+	// 托管机构公钥的ID或指纹，不为空时加密
+	Recipient string `json:"recipient"`
+	// 注册局签名私钥的ID或指纹，不为空时对托管文件生成分离签名
+	SignKey string `json:"signKey"`
+	// 加密后是否保留明文XML
+	KeepPlain bool `json:"keepPlain"`
+}
+
+// 读取escrow配置并补齐默认值
+func LoadConfig(ctx context.Context) (Config, error) {
+	cfg := Config{
+		Dir:           "/var/named/registry/escrow",
+		FullInterval:  "168h",
+		DiffInterval:  "24h",
+		CheckInterval: "1h",
+		GPG:           GPGConfig{Binary: "gpg"},
+	}
+	v, err := g.Cfg().Get(ctx, "escrow")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	items := []struct {
+		name  string
+		value string
+		d     *time.Duration
+	}{
+		{"fullInterval", cfg.FullInterval, &cfg.fullInterval},
+		{"diffInterval", cfg.DiffInterval, &cfg.diffInterval},
+		{"checkInterval", cfg.CheckInterval, &cfg.checkInterval},
+	}
+	for _, item := range items {
+		if *item.d, err = time.ParseDuration(item.value); err != nil {
+			return cfg, fmt.Errorf("escrow.%s 格式错误: %v", item.name, err)
+		}
+	}
+	if cfg.Dir == "" {
+		return cfg, fmt.Errorf("escrow.dir 不能为空")
+	}
+	return cfg, nil
+}
+
+func (c Config) CheckIntervalDuration() time.Duration {
+	return c.checkInterval
+}
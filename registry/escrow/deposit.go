@@ -0,0 +1,258 @@
+package escrow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"newCHNTLDManager/registry"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// 托管状态文件名，保存在dir下
+const stateFile = "state.json"
+
+// 数据托管，按RFC 8909格式把注册数据写成全量或增量托管文件
+type Escrow struct {
+	cfg  Config
+	reg  *registry.Registry
+	lock sync.Mutex
+}
+
+func New(cfg Config, reg *registry.Registry) *Escrow {
+	return &Escrow{cfg: cfg, reg: reg}
+}
+
+func (e *Escrow) Config() Config {
+	return e.cfg
+}
+
+// 上次托管的状态
+type state struct {
+	LastID     string    `json:"lastId"`
+	LastFullAt time.Time `json:"lastFullAt"`
+	LastAt     time.Time `json:"lastAt"`
+	// 上次托管时各对象内容的摘要，key为"类型:名字"，用于生成增量托管
+	Objects map[string]string `json:"objects"`
+}
+
+// 一次托管的结果
+type Result struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	PrevID    string    `json:"prevId,omitempty"`
+	Watermark time.Time `json:"watermark"`
+	// 最终的托管文件，加密时为.gpg文件
+	File      string `json:"file"`
+	Signature string `json:"signature,omitempty"`
+	// 文件中各类对象的数量，key为对象URI
+	Counts  map[string]int `json:"counts"`
+	Deleted int            `json:"deleted"`
+}
+
+// 根据间隔判断是否需要托管：距上次全量托管超过fullInterval时生成全量，
+// 否则距上次托管超过diffInterval时生成增量，都不需要时返回nil
+func (e *Escrow) Run(now time.Time) (*Result, error) {
+	st, err := e.loadState()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case st.LastID == "" || !now.Before(st.LastFullAt.Add(e.cfg.fullInterval)):
+		return e.Deposit(TypeFull)
+	case !now.Before(st.LastAt.Add(e.cfg.diffInterval)):
+		return e.Deposit(TypeDiff)
+	}
+	return nil, nil
+}
+
+// 立即生成托管文件，没有上次托管的状态时增量托管改为全量
+func (e *Escrow) Deposit(kind string) (*Result, error) {
+	if kind != TypeFull && kind != TypeDiff {
+		return nil, fmt.Errorf("不支持的托管类型 %s", kind)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	st, err := e.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if st.LastID == "" {
+		kind = TypeFull
+	}
+	snap := e.reg.Snapshot()
+	d, objects := buildDeposit(snap, kind, st)
+	// id取水印时间，同一秒内重复托管时加序号
+	d.ID = snap.Time.Format("20060102150405")
+	if d.ID <= st.LastID {
+		d.ID = st.LastID + "1"
+	}
+	if kind == TypeDiff {
+		d.PrevID = st.LastID
+	}
+	res := &Result{ID: d.ID, Type: kind, PrevID: d.PrevID, Watermark: snap.Time, Counts: map[string]int{}}
+	for _, c := range d.Contents.Header.Counts {
+		res.Counts[c.URI] = c.Value
+	}
+	if d.Deletes != nil {
+		res.Deleted = len(d.Deletes.Domains) + len(d.Deletes.Hosts) + len(d.Deletes.Contacts) + len(d.Deletes.Registrars)
+	}
+
+	content, err := xml.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = gfile.Mkdir(e.cfg.Dir); err != nil {
+		return nil, err
+	}
+	file := e.fileName(snap, kind)
+	tmp := file + ".tmp"
+	if err = gfile.PutBytes(tmp, append([]byte(xml.Header), content...)); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		return nil, err
+	}
+	if e.cfg.GPG.Recipient != "" {
+		if file, err = e.cfg.GPG.encrypt(file); err != nil {
+			return nil, err
+		}
+	}
+	if e.cfg.GPG.SignKey != "" {
+		if res.Signature, err = e.cfg.GPG.sign(file); err != nil {
+			return nil, err
+		}
+	}
+	res.File = file
+
+	// 文件生成成功后才更新状态，失败时下次仍以上次托管为基准
+	st.LastID = d.ID
+	st.LastAt = snap.Time
+	if kind == TypeFull {
+		st.LastFullAt = snap.Time
+	}
+	st.Objects = objects
+	if err = e.saveState(st); err != nil {
+		return nil, err
+	}
+	fmt.Println("escrow:", res.Type, res.ID, res.File, res.Counts, "deleted", res.Deleted)
+	return res, nil
+}
+
+// 生成托管内容，返回本次托管后全部对象的摘要
+func buildDeposit(snap *registry.Snapshot, kind string, st *state) (*deposit, map[string]string) {
+	d := &deposit{Type: kind, Watermark: formatTime(snap.Time)}
+	d.Menu.Version = "1.0"
+	d.Menu.ObjURI = append([]string{nsRDEHeader}, objectURIs...)
+	objects := map[string]string{}
+	// 全量托管包含全部对象，增量托管只包含摘要变化的对象
+	changed := func(key string, v interface{}) bool {
+		objects[key] = digest(v)
+		return kind == TypeFull || st.Objects[key] != objects[key]
+	}
+	for _, v := range snap.Domains {
+		if changed("domain:"+v.Name, v) {
+			d.Contents.Domains = append(d.Contents.Domains, domainXML(v))
+		}
+	}
+	for _, v := range snap.Hosts {
+		if changed("host:"+v.Name, v) {
+			d.Contents.Hosts = append(d.Contents.Hosts, hostXML(v))
+		}
+	}
+	for _, v := range snap.Contacts {
+		if changed("contact:"+v.ID, v) {
+			d.Contents.Contacts = append(d.Contents.Contacts, contactXML(v))
+		}
+	}
+	for _, v := range snap.Registrars {
+		// 余额不属于托管内容，余额变化不应产生增量
+		v.Balance = 0
+		if changed("registrar:"+v.ID, v) {
+			d.Contents.Registrars = append(d.Contents.Registrars, registrarXML(v))
+		}
+	}
+	d.Contents.Header = header{TLD: snap.TLD, Counts: []headerCount{
+		{URI: nsRDEDomain, Value: len(d.Contents.Domains)},
+		{URI: nsRDEHost, Value: len(d.Contents.Hosts)},
+		{URI: nsRDEContact, Value: len(d.Contents.Contacts)},
+		{URI: nsRDERegistrar, Value: len(d.Contents.Registrars)},
+	}}
+	if kind == TypeFull {
+		return d, objects
+	}
+	var keys []string
+	for key := range st.Objects {
+		if _, ok := objects[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return d, objects
+	}
+	sort.Strings(keys)
+	d.Deletes = &deletes{}
+	for _, key := range keys {
+		typ, name, _ := strings.Cut(key, ":")
+		switch typ {
+		case "domain":
+			d.Deletes.Domains = append(d.Deletes.Domains, objDelete{Name: name})
+		case "host":
+			d.Deletes.Hosts = append(d.Deletes.Hosts, objDelete{Name: name})
+		case "contact":
+			d.Deletes.Contacts = append(d.Deletes.Contacts, objDelete{ID: name})
+		case "registrar":
+			d.Deletes.Registrars = append(d.Deletes.Registrars, objDelete{ID: name})
+		}
+	}
+	return d, objects
+}
+
+func digest(v interface{}) string {
+	content, _ := json.Marshal(v)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
+
+// RDE惯例的文件名{tld}_{日期}_{full|diff}_S1_R{修订号}.xml，同一天重复托管时修订号加一
+func (e *Escrow) fileName(snap *registry.Snapshot, kind string) string {
+	for rev := 0; ; rev++ {
+		name := fmt.Sprintf("%s_%s_%s_S1_R%d.xml", snap.TLD, snap.Time.Format("2006-01-02"), strings.ToLower(kind), rev)
+		file := filepath.Join(e.cfg.Dir, name)
+		if !gfile.Exists(file) && !gfile.Exists(file+".gpg") {
+			return file
+		}
+	}
+}
+
+func (e *Escrow) loadState() (*state, error) {
+	st := &state{}
+	file := filepath.Join(e.cfg.Dir, stateFile)
+	if gfile.Exists(file) {
+		if err := json.Unmarshal(gfile.GetBytes(file), st); err != nil {
+			return nil, fmt.Errorf("读取托管状态%s失败: %v", file, err)
+		}
+	}
+	return st, nil
+}
+
+func (e *Escrow) saveState(st *state) error {
+	content, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(e.cfg.Dir, stateFile)
+	if err = gfile.PutBytes(file+".tmp", content); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
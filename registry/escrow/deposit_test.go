@@ -0,0 +1,252 @@
+package escrow
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"newCHNTLDManager/registry"
+)
+
+type nopZone struct{}
+
+func (nopZone) PublishDelegation(string, []string, map[string][]string, []string) error { return nil }
+func (nopZone) WithdrawDelegation(string) error                                         { return nil }
+func (nopZone) PurgeDomain(string) error                                                { return nil }
+func (nopZone) Commit() error                                                           { return nil }
+func (nopZone) Rollback()                                                               {}
+func (nopZone) SetDomainLock(string, bool) error                                        { return nil }
+
+// reg1管理a.chn，注册人C001，NS为ns1.example.net和ns2.example.net，不加密
+func newTestEscrow(t *testing.T) (*Escrow, *registry.Registry) {
+	t.Helper()
+	reg, err := registry.New(registry.Config{DataFile: filepath.Join(t.TempDir(), "registry.json"), TLD: "chn", DefaultPeriod: 1, MaxPeriod: 10}, nopZone{})
+	if err != nil {
+		t.Fatalf("registry.New: %v", err)
+	}
+	if _, err = reg.CreateRegistrar(registry.Registrar{ID: "reg1", Name: "Example Registrar", Email: "abuse@registrar.example"}); err != nil {
+		t.Fatalf("CreateRegistrar: %v", err)
+	}
+	if _, err = reg.CreateContact(registry.Contact{ID: "C001", RegistrarID: "reg1", Name: "Zhang San", Country: "CN", Email: "zhang@example.com"}); err != nil {
+		t.Fatalf("CreateContact: %v", err)
+	}
+	for _, name := range []string{"ns1.example.net", "ns2.example.net"} {
+		if _, err = reg.CreateHost(registry.Host{Name: name, RegistrarID: "reg1"}); err != nil {
+			t.Fatalf("CreateHost: %v", err)
+		}
+	}
+	createTestDomain(t, reg, "a.chn")
+	cfg := Config{Dir: filepath.Join(t.TempDir(), "escrow"), fullInterval: 7 * 24 * time.Hour, diffInterval: 24 * time.Hour}
+	return New(cfg, reg), reg
+}
+
+func createTestDomain(t *testing.T, reg *registry.Registry, name string) {
+	t.Helper()
+	dom := registry.Domain{Name: name, RegistrarID: "reg1", RegistrantID: "C001", TechID: "C001", NameServers: []string{"ns1.example.net"}, DS: []string{"12345 13 2 ABCDEF"}}
+	if _, err := reg.CreateDomain(dom, 1, false, ""); err != nil {
+		t.Fatalf("CreateDomain %s: %v", name, err)
+	}
+}
+
+func counts(domains int, hosts int, contacts int, registrars int) map[string]int {
+	return map[string]int{nsRDEDomain: domains, nsRDEHost: hosts, nsRDEContact: contacts, nsRDERegistrar: registrars}
+}
+
+// 第一次托管总是全量，之后的增量只包含变化和删除的对象，余额变化不产生增量，每个文件都能通过校验
+func TestDeposit(t *testing.T) {
+	e, reg := newTestEscrow(t)
+	steps := []struct {
+		name   string
+		change func(t *testing.T)
+		kind   string
+		// 实际生成的托管类型、各类对象数和删除的对象数
+		wantType    string
+		wantCounts  map[string]int
+		wantDeleted int
+	}{
+		{name: "first diff becomes full", kind: TypeDiff, wantType: TypeFull, wantCounts: counts(1, 2, 1, 1)},
+		{name: "no change", kind: TypeDiff, wantType: TypeDiff, wantCounts: counts(0, 0, 0, 0)},
+		{
+			name: "create and delete",
+			change: func(t *testing.T) {
+				createTestDomain(t, reg, "b.chn")
+				if err := reg.DeleteHost("ns2.example.net", "reg1"); err != nil {
+					t.Fatalf("DeleteHost: %v", err)
+				}
+			},
+			kind: TypeDiff, wantType: TypeDiff, wantCounts: counts(1, 0, 0, 0), wantDeleted: 1,
+		},
+		{
+			name: "balance only",
+			change: func(t *testing.T) {
+				if _, err := reg.Deposit("reg1", 1000, ""); err != nil {
+					t.Fatalf("Deposit: %v", err)
+				}
+			},
+			kind: TypeDiff, wantType: TypeDiff, wantCounts: counts(0, 0, 0, 0),
+		},
+		{name: "full", kind: TypeFull, wantType: TypeFull, wantCounts: counts(2, 1, 1, 1)},
+	}
+	prevID := ""
+	for _, step := range steps {
+		if step.change != nil {
+			step.change(t)
+		}
+		res, err := e.Deposit(step.kind)
+		if err != nil {
+			t.Fatalf("%s: Deposit: %v", step.name, err)
+		}
+		if res.Type != step.wantType || res.Deleted != step.wantDeleted || !equalCounts(res.Counts, step.wantCounts) {
+			t.Errorf("%s: 托管 %s %v 删除%d，应为 %s %v 删除%d", step.name, res.Type, res.Counts, res.Deleted, step.wantType, step.wantCounts, step.wantDeleted)
+		}
+		if res.ID <= prevID || (res.Type == TypeDiff) != (res.PrevID == prevID && prevID != "") {
+			t.Errorf("%s: id %s prevId %s，上次为 %s", step.name, res.ID, res.PrevID, prevID)
+		}
+		prevID = res.ID
+		report, err := e.Verify(filepath.Base(res.File))
+		if err != nil {
+			t.Fatalf("%s: Verify: %v", step.name, err)
+		}
+		if !report.OK || report.ID != res.ID || report.Deleted != res.Deleted || !equalCounts(report.Counts, res.Counts) {
+			t.Errorf("%s: 校验结果 %+v", step.name, report)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(e.cfg.Dir, "chn_*_S1_R*.xml"))
+	if len(files) != len(steps) {
+		t.Errorf("生成了%d个托管文件，应为%d个", len(files), len(steps))
+	}
+	if _, err := e.Deposit("PARTIAL"); err == nil {
+		t.Error("不支持的托管类型应返回错误")
+	}
+}
+
+func equalCounts(a map[string]int, b map[string]int) bool {
+	for _, uri := range objectURIs {
+		if a[uri] != b[uri] {
+			return false
+		}
+	}
+	return true
+}
+
+// 超过fullInterval时全量，超过diffInterval时增量，都没到时不托管
+func TestRun(t *testing.T) {
+	e, _ := newTestEscrow(t)
+	now := time.Now().UTC()
+	steps := []struct {
+		offset time.Duration
+		want   string
+	}{
+		{0, TypeFull},
+		{time.Hour, ""},
+		{25 * time.Hour, TypeDiff},
+		{8 * 24 * time.Hour, TypeFull},
+	}
+	for _, step := range steps {
+		res, err := e.Run(now.Add(step.offset))
+		if err != nil {
+			t.Fatalf("Run(+%v): %v", step.offset, err)
+		}
+		got := ""
+		if res != nil {
+			got = res.Type
+		}
+		if got != step.want {
+			t.Errorf("Run(+%v) 托管类型为%q，应为%q", step.offset, got, step.want)
+		}
+	}
+}
+
+func TestVerifyProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		// 修改托管文件或数据库，返回要校验的文件
+		change  func(t *testing.T, e *Escrow, reg *registry.Registry, file string) string
+		wantErr bool
+		problem string
+	}{
+		{
+			name: "header count",
+			change: func(t *testing.T, e *Escrow, reg *registry.Registry, file string) string {
+				rewrite(t, file, `<count uri="urn:ietf:params:xml:ns:rdeDomain-1.0">1</count>`, `<count uri="urn:ietf:params:xml:ns:rdeDomain-1.0">2</count>`)
+				return file
+			},
+			problem: "header声明2个，实际1个",
+		},
+		{
+			name: "diff without prevId",
+			change: func(t *testing.T, e *Escrow, reg *registry.Registry, file string) string {
+				rewrite(t, file, `type="FULL"`, `type="DIFF"`)
+				return file
+			},
+			problem: "增量托管缺少prevId",
+		},
+		{
+			name: "created after watermark",
+			change: func(t *testing.T, e *Escrow, reg *registry.Registry, file string) string {
+				time.Sleep(time.Second)
+				createTestDomain(t, reg, "late.chn")
+				return file
+			},
+			problem: "托管1个，数据库中2个，其中1个在水印之后创建",
+		},
+		{
+			name: "not xml",
+			change: func(t *testing.T, e *Escrow, reg *registry.Registry, file string) string {
+				rewrite(t, file, "<?xml", "<")
+				return file
+			},
+			wantErr: true,
+		},
+		{
+			name: "outside dir",
+			change: func(t *testing.T, e *Escrow, reg *registry.Registry, file string) string {
+				outside := filepath.Join(t.TempDir(), "deposit.xml")
+				content, _ := os.ReadFile(file)
+				if err := os.WriteFile(outside, content, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return "../" + filepath.Base(filepath.Dir(outside)) + "/deposit.xml"
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, reg := newTestEscrow(t)
+			res, err := e.Deposit(TypeFull)
+			if err != nil {
+				t.Fatalf("Deposit: %v", err)
+			}
+			report, err := e.Verify(tt.change(t, e, reg, res.File))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("应返回错误，校验结果为 %+v", report)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if report.OK || !strings.Contains(strings.Join(report.Problems, "\n"), tt.problem) {
+				t.Errorf("问题为 %v，应包含 %q", report.Problems, tt.problem)
+			}
+		})
+	}
+}
+
+func rewrite(t *testing.T, file string, old string, new string) {
+	t.Helper()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), old) {
+		t.Fatalf("托管文件中没有 %q:\n%s", old, content)
+	}
+	if err = os.WriteFile(file, []byte(strings.Replace(string(content), old, new, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package escrow
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// 以批处理模式执行gpg，返回标准输出
+func (c GPGConfig) run(args ...string) ([]byte, error) {
+	base := []string{"--batch", "--yes"}
+	if c.Home != "" {
+		base = append(base, "--homedir", c.Home)
+	}
+	cmd := exec.Command(c.Binary, append(base, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("gpg %s 失败: %v %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// 用托管机构的公钥加密，返回.gpg文件名，不保留明文时删除原文件
+func (c GPGConfig) encrypt(file string) (string, error) {
+	out := file + ".gpg"
+	if _, err := c.run("--trust-model", "always", "--recipient", c.Recipient, "--output", out, "--encrypt", file); err != nil {
+		return "", err
+	}
+	if !c.KeepPlain {
+		if err := os.Remove(file); err != nil {
+			return "", err
+		}
+	}
+	return out, nil
+}
+
+// 生成分离签名，返回.sig文件名
+func (c GPGConfig) sign(file string) (string, error) {
+	out := file + ".sig"
+	if _, err := c.run("--local-user", c.SignKey, "--output", out, "--detach-sign", file); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+func (c GPGConfig) verify(file string, sig string) error {
+	_, err := c.run("--verify", sig, file)
+	return err
+}
+
+// 解密到内存，需要托管机构的私钥，一般只在测试环境或托管机构使用
+func (c GPGConfig) decrypt(file string) ([]byte, error) {
+	return c.run("--decrypt", file)
+}
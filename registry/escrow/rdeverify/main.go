@@ -0,0 +1,55 @@
+// 托管文件校验工具：重新读取托管文件，检查签名和header中的数量，全量托管再与注册数据文件比较
+//
+//	go run ./registry/escrow/rdeverify -data /var/named/registry/registry.json /var/named/registry/escrow/chn_2024-01-07_full_S1_R0.xml.gpg
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"newCHNTLDManager/registry"
+	"newCHNTLDManager/registry/escrow"
+)
+
+func main() {
+	dataFile := flag.String("data", "/var/named/registry/registry.json", "注册数据文件，为空时不与数据库比较")
+	tld := flag.String("tld", "chn", "顶级域")
+	gpgBin := flag.String("gpg", "gpg", "gpg程序")
+	gpgHome := flag.String("gpghome", "", "gpg的--homedir，解密.gpg文件需要托管机构的私钥")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "用法: rdeverify [-data 注册数据文件] 托管文件...")
+		os.Exit(2)
+	}
+
+	var snap *registry.Snapshot
+	if *dataFile != "" {
+		// 只读取数据，不需要zone
+		reg, err := registry.New(registry.Config{DataFile: *dataFile, TLD: *tld}, nil)
+		if err != nil {
+			fail(err)
+		}
+		snap = reg.Snapshot()
+	}
+	gpg := escrow.GPGConfig{Binary: *gpgBin, Home: *gpgHome}
+	ok := true
+	for _, file := range flag.Args() {
+		report, err := escrow.Verify(file, gpg, snap)
+		if err != nil {
+			fail(err)
+		}
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		ok = ok && report.OK
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "rdeverify:", err)
+	os.Exit(1)
+}
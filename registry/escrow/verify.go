@@ -0,0 +1,149 @@
+package escrow
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"newCHNTLDManager/registry"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// 托管文件的校验结果，Problems为空时OK为true
+type Report struct {
+	File      string `json:"file"`
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	PrevID    string `json:"prevId,omitempty"`
+	Watermark string `json:"watermark"`
+	// 分离签名的校验结果：ok、bad或none
+	Signature string `json:"signature"`
+	// 文件中实际的对象数、header声明的对象数、当前数据库中的对象数，key为对象URI
+	Counts       map[string]int `json:"counts"`
+	HeaderCounts map[string]int `json:"headerCounts"`
+	LiveCounts   map[string]int `json:"liveCounts,omitempty"`
+	Deleted      int            `json:"deleted"`
+	Problems     []string       `json:"problems"`
+	OK           bool           `json:"ok"`
+}
+
+// 校验托管目录中的文件并与当前数据库比较，只取文件名部分，不能读取目录之外的文件
+func (e *Escrow) Verify(name string) (*Report, error) {
+	return Verify(filepath.Join(e.cfg.Dir, filepath.Base(name)), e.cfg.GPG, e.reg.Snapshot())
+}
+
+// 重新读取托管文件并校验：.gpg文件先解密，有.sig文件时校验签名，检查header中的数量，
+// snap不为nil时全量托管的数量还要与数据库比较。水印之后数据库的变化会作为差异报告
+func Verify(file string, gpg GPGConfig, snap *registry.Snapshot) (*Report, error) {
+	if !gfile.Exists(file) {
+		return nil, fmt.Errorf("托管文件 %s 不存在", file)
+	}
+	report := &Report{File: file, Signature: "none", Problems: []string{}}
+	if sig := file + ".sig"; gfile.Exists(sig) {
+		if err := gpg.verify(file, sig); err != nil {
+			report.Problems = append(report.Problems, "签名校验失败: "+err.Error())
+			report.Signature = "bad"
+		} else {
+			report.Signature = "ok"
+		}
+	}
+	content := gfile.GetBytes(file)
+	if strings.HasSuffix(file, ".gpg") {
+		var err error
+		if content, err = gpg.decrypt(file); err != nil {
+			return nil, err
+		}
+	}
+	var d deposit
+	if err := xml.Unmarshal(content, &d); err != nil {
+		return nil, fmt.Errorf("托管文件 %s 格式错误: %v", file, err)
+	}
+	report.ID = d.ID
+	report.Type = d.Type
+	report.PrevID = d.PrevID
+	report.Watermark = d.Watermark
+	if d.Type != TypeFull && d.Type != TypeDiff {
+		report.Problems = append(report.Problems, "不支持的托管类型 "+d.Type)
+	}
+	if d.Type == TypeDiff && d.PrevID == "" {
+		report.Problems = append(report.Problems, "增量托管缺少prevId")
+	}
+	report.Counts = map[string]int{
+		nsRDEDomain:    len(d.Contents.Domains),
+		nsRDEHost:      len(d.Contents.Hosts),
+		nsRDEContact:   len(d.Contents.Contacts),
+		nsRDERegistrar: len(d.Contents.Registrars),
+	}
+	report.HeaderCounts = map[string]int{}
+	for _, c := range d.Contents.Header.Counts {
+		report.HeaderCounts[c.URI] = c.Value
+	}
+	for _, uri := range objectURIs {
+		if n, ok := report.HeaderCounts[uri]; !ok {
+			report.Problems = append(report.Problems, "header缺少 "+uri+" 的数量")
+		} else if n != report.Counts[uri] {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s header声明%d个，实际%d个", uri, n, report.Counts[uri]))
+		}
+	}
+	if d.Deletes != nil {
+		report.Deleted = len(d.Deletes.Domains) + len(d.Deletes.Hosts) + len(d.Deletes.Contacts) + len(d.Deletes.Registrars)
+	}
+	if snap != nil && d.Type == TypeFull {
+		watermark, _ := time.Parse(time.RFC3339, d.Watermark)
+		report.LiveCounts = liveCounts(snap)
+		after := createdAfter(snap, watermark)
+		for _, uri := range objectURIs {
+			if report.LiveCounts[uri] == report.Counts[uri] {
+				continue
+			}
+			msg := fmt.Sprintf("%s 托管%d个，数据库中%d个", uri, report.Counts[uri], report.LiveCounts[uri])
+			if after[uri] > 0 {
+				msg += fmt.Sprintf("，其中%d个在水印之后创建", after[uri])
+			}
+			report.Problems = append(report.Problems, msg)
+		}
+	}
+	report.OK = len(report.Problems) == 0
+	return report, nil
+}
+
+func liveCounts(snap *registry.Snapshot) map[string]int {
+	return map[string]int{
+		nsRDEDomain:    len(snap.Domains),
+		nsRDEHost:      len(snap.Hosts),
+		nsRDEContact:   len(snap.Contacts),
+		nsRDERegistrar: len(snap.Registrars),
+	}
+}
+
+// 数据库中水印之后创建的对象数。水印只精确到秒，创建时间也按秒比较
+func createdAfter(snap *registry.Snapshot, watermark time.Time) map[string]int {
+	res := map[string]int{}
+	after := func(t time.Time) bool {
+		return t.Truncate(time.Second).After(watermark)
+	}
+	for _, v := range snap.Domains {
+		if after(v.CreatedAt) {
+			res[nsRDEDomain]++
+		}
+	}
+	for _, v := range snap.Hosts {
+		if after(v.CreatedAt) {
+			res[nsRDEHost]++
+		}
+	}
+	for _, v := range snap.Contacts {
+		if after(v.CreatedAt) {
+			res[nsRDEContact]++
+		}
+	}
+	for _, v := range snap.Registrars {
+		if after(v.CreatedAt) {
+			res[nsRDERegistrar]++
+		}
+	}
+	return res
+}
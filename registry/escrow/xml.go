@@ -0,0 +1,288 @@
+package escrow
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	"newCHNTLDManager/registry"
+)
+
+// RFC 8909、RFC 9022使用的命名空间
+const (
+	nsRDEHeader    = "urn:ietf:params:xml:ns:rdeHeader-1.0"
+	nsRDEDomain    = "urn:ietf:params:xml:ns:rdeDomain-1.0"
+	nsRDEHost      = "urn:ietf:params:xml:ns:rdeHost-1.0"
+	nsRDEContact   = "urn:ietf:params:xml:ns:rdeContact-1.0"
+	nsRDERegistrar = "urn:ietf:params:xml:ns:rdeRegistrar-1.0"
+)
+
+// 托管的对象类型，顺序与header中count的顺序一致
+var objectURIs = []string{nsRDEDomain, nsRDEHost, nsRDEContact, nsRDERegistrar}
+
+// 托管类型
+const (
+	TypeFull = "FULL"
+	TypeDiff = "DIFF"
+)
+
+// 托管文件的根元素，生成和校验共用
+type deposit struct {
+	XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:rde-1.0 deposit"`
+	Type      string   `xml:"type,attr"`
+	ID        string   `xml:"id,attr"`
+	PrevID    string   `xml:"prevId,attr,omitempty"`
+	Watermark string   `xml:"watermark"`
+	Menu      struct {
+		Version string   `xml:"version"`
+		ObjURI  []string `xml:"objURI"`
+	} `xml:"rdeMenu"`
+	Contents contents `xml:"contents"`
+	Deletes  *deletes `xml:"deletes,omitempty"`
+}
+
+type contents struct {
+	Domains    []rdeDomain    `xml:"urn:ietf:params:xml:ns:rdeDomain-1.0 domain"`
+	Hosts      []rdeHost      `xml:"urn:ietf:params:xml:ns:rdeHost-1.0 host"`
+	Contacts   []rdeContact   `xml:"urn:ietf:params:xml:ns:rdeContact-1.0 contact"`
+	Registrars []rdeRegistrar `xml:"urn:ietf:params:xml:ns:rdeRegistrar-1.0 registrar"`
+	Header     header         `xml:"urn:ietf:params:xml:ns:rdeHeader-1.0 header"`
+}
+
+// 增量托管中自上次托管以来删除的对象
+type deletes struct {
+	Domains    []objDelete `xml:"urn:ietf:params:xml:ns:rdeDomain-1.0 delete"`
+	Hosts      []objDelete `xml:"urn:ietf:params:xml:ns:rdeHost-1.0 delete"`
+	Contacts   []objDelete `xml:"urn:ietf:params:xml:ns:rdeContact-1.0 delete"`
+	Registrars []objDelete `xml:"urn:ietf:params:xml:ns:rdeRegistrar-1.0 delete"`
+}
+
+type objDelete struct {
+	Name string `xml:"name,omitempty"`
+	ID   string `xml:"id,omitempty"`
+}
+
+// 各类对象的数量，全量托管为总数，增量托管为本次包含的数量
+type header struct {
+	TLD    string        `xml:"tld"`
+	Counts []headerCount `xml:"count"`
+}
+
+type headerCount struct {
+	URI   string `xml:"uri,attr"`
+	Value int    `xml:",chardata"`
+}
+
+type status struct {
+	S string `xml:"s,attr"`
+}
+
+type rdeDomain struct {
+	Name       string       `xml:"name"`
+	ROID       string       `xml:"roid"`
+	Status     []status     `xml:"status"`
+	RGPStatus  []status     `xml:"rgpStatus"`
+	Registrant string       `xml:"registrant,omitempty"`
+	Contacts   []contactRef `xml:"contact"`
+	NS         *nsElem      `xml:"ns,omitempty"`
+	ClID       string       `xml:"clID"`
+	CrRr       string       `xml:"crRr,omitempty"`
+	CrDate     string       `xml:"crDate"`
+	ExDate     string       `xml:"exDate"`
+	UpDate     string       `xml:"upDate,omitempty"`
+	SecDNS     *secDNS      `xml:"secDNS,omitempty"`
+	TrDate     string       `xml:"trDate,omitempty"`
+}
+
+type nsElem struct {
+	HostObj []string `xml:"urn:ietf:params:xml:ns:domain-1.0 hostObj"`
+}
+
+type contactRef struct {
+	Type string `xml:"type,attr"`
+	ID   string `xml:",chardata"`
+}
+
+type secDNS struct {
+	DSData []dsData `xml:"urn:ietf:params:xml:ns:secDNS-1.1 dsData"`
+}
+
+type dsData struct {
+	KeyTag     uint16 `xml:"urn:ietf:params:xml:ns:secDNS-1.1 keyTag"`
+	Alg        uint8  `xml:"urn:ietf:params:xml:ns:secDNS-1.1 alg"`
+	DigestType uint8  `xml:"urn:ietf:params:xml:ns:secDNS-1.1 digestType"`
+	Digest     string `xml:"urn:ietf:params:xml:ns:secDNS-1.1 digest"`
+}
+
+type rdeHost struct {
+	Name   string   `xml:"name"`
+	ROID   string   `xml:"roid"`
+	Status []status `xml:"status"`
+	Addrs  []addr   `xml:"addr"`
+	ClID   string   `xml:"clID"`
+	CrRr   string   `xml:"crRr,omitempty"`
+	CrDate string   `xml:"crDate"`
+	UpDate string   `xml:"upDate,omitempty"`
+}
+
+type addr struct {
+	IP    string `xml:"ip,attr"`
+	Value string `xml:",chardata"`
+}
+
+type rdeContact struct {
+	ID         string      `xml:"id"`
+	ROID       string      `xml:"roid"`
+	Status     []status    `xml:"status"`
+	PostalInfo *postalInfo `xml:"postalInfo,omitempty"`
+	Voice      string      `xml:"voice,omitempty"`
+	Fax        string      `xml:"fax,omitempty"`
+	Email      string      `xml:"email"`
+	ClID       string      `xml:"clID"`
+	CrRr       string      `xml:"crRr,omitempty"`
+	CrDate     string      `xml:"crDate"`
+	UpDate     string      `xml:"upDate,omitempty"`
+}
+
+type postalInfo struct {
+	Type string `xml:"type,attr"`
+	Name string `xml:"urn:ietf:params:xml:ns:contact-1.0 name"`
+	Org  string `xml:"urn:ietf:params:xml:ns:contact-1.0 org,omitempty"`
+	Addr struct {
+		Street []string `xml:"urn:ietf:params:xml:ns:contact-1.0 street"`
+		City   string   `xml:"urn:ietf:params:xml:ns:contact-1.0 city"`
+		SP     string   `xml:"urn:ietf:params:xml:ns:contact-1.0 sp,omitempty"`
+		PC     string   `xml:"urn:ietf:params:xml:ns:contact-1.0 pc,omitempty"`
+		CC     string   `xml:"urn:ietf:params:xml:ns:contact-1.0 cc"`
+	} `xml:"urn:ietf:params:xml:ns:contact-1.0 addr"`
+}
+
+type rdeRegistrar struct {
+	ID     string `xml:"id"`
+	Name   string `xml:"name"`
+	Status string `xml:"status"`
+	Voice  string `xml:"voice,omitempty"`
+	Email  string `xml:"email"`
+	URL    string `xml:"url,omitempty"`
+	CrDate string `xml:"crDate"`
+	UpDate string `xml:"upDate,omitempty"`
+}
+
+// 生命周期状态在RDE中用rgpStatus表示
+var rgpStatuses = map[string]bool{
+	registry.StatusAutoRenewPeriod:  true,
+	registry.StatusRedemptionPeriod: true,
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func domainXML(dom registry.Domain) rdeDomain {
+	res := rdeDomain{
+		Name:       dom.Name,
+		ROID:       dom.ROID,
+		Registrant: dom.RegistrantID,
+		ClID:       dom.RegistrarID,
+		CrDate:     formatTime(dom.CreatedAt),
+		ExDate:     formatTime(dom.ExpiresAt),
+		UpDate:     formatTime(dom.UpdatedAt),
+		TrDate:     formatTime(dom.TransferredAt),
+	}
+	for _, s := range dom.Status {
+		if rgpStatuses[s] {
+			res.RGPStatus = append(res.RGPStatus, status{S: s})
+		} else {
+			res.Status = append(res.Status, status{S: s})
+		}
+	}
+	for _, c := range []contactRef{{"admin", dom.AdminID}, {"tech", dom.TechID}, {"billing", dom.BillingID}} {
+		if c.ID != "" {
+			res.Contacts = append(res.Contacts, c)
+		}
+	}
+	if len(dom.NameServers) > 0 {
+		res.NS = &nsElem{HostObj: dom.NameServers}
+	}
+	// registry中DS的格式为"keyTag alg digestType digest"
+	for _, ds := range dom.DS {
+		items := strings.Fields(ds)
+		if len(items) < 4 {
+			continue
+		}
+		keyTag, err1 := strconv.ParseUint(items[0], 10, 16)
+		alg, err2 := strconv.ParseUint(items[1], 10, 8)
+		digestType, err3 := strconv.ParseUint(items[2], 10, 8)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		if res.SecDNS == nil {
+			res.SecDNS = &secDNS{}
+		}
+		res.SecDNS.DSData = append(res.SecDNS.DSData, dsData{KeyTag: uint16(keyTag), Alg: uint8(alg), DigestType: uint8(digestType), Digest: strings.Join(items[3:], "")})
+	}
+	return res
+}
+
+func hostXML(host registry.Host) rdeHost {
+	res := rdeHost{
+		Name:   host.Name,
+		ROID:   host.ROID,
+		Status: []status{{S: registry.StatusOK}},
+		ClID:   host.RegistrarID,
+		CrDate: formatTime(host.CreatedAt),
+		UpDate: formatTime(host.UpdatedAt),
+	}
+	for _, a := range host.Addresses {
+		ip := "v4"
+		if strings.Contains(a, ":") {
+			ip = "v6"
+		}
+		res.Addrs = append(res.Addrs, addr{IP: ip, Value: a})
+	}
+	return res
+}
+
+func contactXML(c registry.Contact) rdeContact {
+	res := rdeContact{
+		ID:     c.ID,
+		ROID:   c.ROID,
+		Status: []status{{S: registry.StatusOK}},
+		Voice:  c.Voice,
+		Fax:    c.Fax,
+		Email:  c.Email,
+		ClID:   c.RegistrarID,
+		CrDate: formatTime(c.CreatedAt),
+		UpDate: formatTime(c.UpdatedAt),
+	}
+	p := &postalInfo{Type: "int", Name: c.Name, Org: c.Org}
+	p.Addr.Street = c.Street
+	p.Addr.City = c.City
+	p.Addr.SP = c.Province
+	p.Addr.PC = c.PostalCode
+	p.Addr.CC = c.Country
+	res.PostalInfo = p
+	return res
+}
+
+func registrarXML(r registry.Registrar) rdeRegistrar {
+	// RFC 9022中注册商状态为ok、readonly、terminated，停用的注册商按readonly托管
+	s := "ok"
+	if r.Status != registry.StatusOK {
+		s = "readonly"
+	}
+	return rdeRegistrar{
+		ID:     r.ID,
+		Name:   r.Name,
+		Status: s,
+		Voice:  r.Phone,
+		Email:  r.Email,
+		URL:    r.URL,
+		CrDate: formatTime(r.CreatedAt),
+		UpDate: formatTime(r.UpdatedAt),
+	}
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"sort"
+	"time"
+)
+
+// 某一时刻全部对象的副本，用于数据托管等整体导出，各列表按名字或ID排序
+type Snapshot struct {
+	Time       time.Time
+	TLD        string
+	Registrars []Registrar
+	Contacts   []Contact
+	Hosts      []Host
+	Domains    []Domain
+}
+
+// 在同一把读锁下复制全部对象，保证导出的数据前后一致
+func (r *Registry) Snapshot() *Snapshot {
+	r.lock.RLock()
+	d := r.data.clone()
+	r.lock.RUnlock()
+	s := &Snapshot{Time: time.Now().UTC(), TLD: r.cfg.TLD}
+	for _, v := range d.Registrars {
+		s.Registrars = append(s.Registrars, *v)
+	}
+	for _, v := range d.Contacts {
+		s.Contacts = append(s.Contacts, *v)
+	}
+	for _, v := range d.Hosts {
+		s.Hosts = append(s.Hosts, *v)
+	}
+	for _, v := range d.Domains {
+		s.Domains = append(s.Domains, *v)
+	}
+	sort.Slice(s.Registrars, func(i, j int) bool { return s.Registrars[i].ID < s.Registrars[j].ID })
+	sort.Slice(s.Contacts, func(i, j int) bool { return s.Contacts[i].ID < s.Contacts[j].ID })
+	sort.Slice(s.Hosts, func(i, j int) bool { return s.Hosts[i].Name < s.Hosts[j].Name })
+	sort.Slice(s.Domains, func(i, j int) bool { return s.Domains[i].Name < s.Domains[j].Name })
+	return s
+}
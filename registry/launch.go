@@ -0,0 +1,609 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// 开放注册前的阶段类型。sunrise只接受商标持有人的申请，landrush任何注册商都可以申请，
+// 两者都在阶段结束后分配，同名多个申请按竞价决定
+const (
+	PhaseSunrise  = "sunrise"
+	PhaseLandrush = "landrush"
+	// 最后一个阶段结束后为开放注册
+	PhaseGA = "ga"
+)
+
+// 申请状态，取值与EPP launch扩展(RFC 8334)一致，withdrawn为注册商撤回
+const (
+	AppPendingAllocation = "pendingAllocation"
+	AppAllocated         = "allocated"
+	AppRejected          = "rejected"
+	AppWithdrawn         = "withdrawn"
+)
+
+// 竞价成交的计费操作
+const OpAuction = "auction"
+
+// 开放注册配置，对应registry.launch节点，没有阶段时直接开放注册
+type LaunchConfig struct {
+	Phases []LaunchPhase `json:"phases"`
+	// 开放注册后多久之内注册与商标匹配的名字需要确认商标声明，ICANN惯例为90天
+	ClaimsPeriod string `json:"claimsPeriod"`
+	// 检查已结束阶段并分配申请的间隔
+	CheckInterval string `json:"checkInterval"`
+
+	claimsPeriod  time.Duration
+	checkInterval time.Duration
+}
+
+// 一个阶段，start、end为RFC 3339时间，区间为[start, end)
+type LaunchPhase struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	start time.Time
+	end   time.Time
+}
+
+func (c *LaunchConfig) parse() error {
+	var err error
+	if c.claimsPeriod, err = time.ParseDuration(c.ClaimsPeriod); err != nil {
+		return fmt.Errorf("registry.launch.claimsPeriod 格式错误: %v", err)
+	}
+	if c.checkInterval, err = time.ParseDuration(c.CheckInterval); err != nil {
+		return fmt.Errorf("registry.launch.checkInterval 格式错误: %v", err)
+	}
+	names := map[string]bool{}
+	for i := range c.Phases {
+		p := &c.Phases[i]
+		if p.Name == "" || names[p.Name] || p.Name == PhaseGA {
+			return fmt.Errorf("registry.launch.phases[%d] 名字为空或重复", i)
+		}
+		names[p.Name] = true
+		if p.Type != PhaseSunrise && p.Type != PhaseLandrush {
+			return fmt.Errorf("registry.launch.phases.%s 不支持的类型 %s", p.Name, p.Type)
+		}
+		if p.start, err = time.Parse(time.RFC3339, p.Start); err != nil {
+			return fmt.Errorf("registry.launch.phases.%s.start 格式错误: %v", p.Name, err)
+		}
+		if p.end, err = time.Parse(time.RFC3339, p.End); err != nil {
+			return fmt.Errorf("registry.launch.phases.%s.end 格式错误: %v", p.Name, err)
+		}
+		if !p.end.After(p.start) {
+			return fmt.Errorf("registry.launch.phases.%s 结束时间必须晚于开始时间", p.Name)
+		}
+		if i > 0 && p.start.Before(c.Phases[i-1].end) {
+			return fmt.Errorf("registry.launch.phases.%s 与前一阶段重叠", p.Name)
+		}
+	}
+	return nil
+}
+
+func (c LaunchConfig) CheckIntervalDuration() time.Duration {
+	return c.checkInterval
+}
+
+// now所在的阶段，开放注册时返回nil
+func (c LaunchConfig) phaseAt(now time.Time) *LaunchPhase {
+	for i := range c.Phases {
+		p := &c.Phases[i]
+		if !now.Before(p.start) && now.Before(p.end) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (c LaunchConfig) phase(name string) *LaunchPhase {
+	for i := range c.Phases {
+		if c.Phases[i].Name == name {
+			return &c.Phases[i]
+		}
+	}
+	return nil
+}
+
+// 开放注册的时间，没有阶段时为零值
+func (c LaunchConfig) gaStart() time.Time {
+	if len(c.Phases) == 0 {
+		return time.Time{}
+	}
+	return c.Phases[len(c.Phases)-1].end
+}
+
+// 是否需要确认商标声明：landrush阶段和开放注册后的claimsPeriod之内
+func (c LaunchConfig) inClaims(now time.Time) bool {
+	if p := c.phaseAt(now); p != nil {
+		return p.Type == PhaseLandrush
+	}
+	ga := c.gaStart()
+	return !ga.IsZero() && !now.Before(ga) && now.Before(ga.Add(c.claimsPeriod))
+}
+
+// 当前阶段，供查询接口使用
+type PhaseInfo struct {
+	Name  string    `json:"name"`
+	Type  string    `json:"type"`
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
+	// 是否需要确认商标声明
+	Claims bool `json:"claims"`
+}
+
+func (r *Registry) CurrentPhase(now time.Time) PhaseInfo {
+	cfg := r.cfg.Launch
+	if p := cfg.phaseAt(now); p != nil {
+		return PhaseInfo{Name: p.Name, Type: p.Type, Start: p.start, End: p.end, Claims: cfg.inClaims(now)}
+	}
+	return PhaseInfo{Name: PhaseGA, Type: PhaseGA, Start: cfg.gaStart(), Claims: cfg.inClaims(now)}
+}
+
+// ---------- 商标 ----------
+
+// 本地商标库中的一个商标，Labels为商标对应的label，可以是A-label或U-label
+type Mark struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Labels       []string  `json:"labels"`
+	Holder       string    `json:"holder"`
+	Jurisdiction string    `json:"jurisdiction,omitempty"`
+	Classes      []int     `json:"classes,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	// 为零值时不过期
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// 商标声明，注册与商标匹配的名字前注册商需要向注册人展示并确认
+type ClaimsNotice struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Marks []Mark `json:"marks"`
+}
+
+func (m *Mark) valid(now time.Time) bool {
+	return m.ExpiresAt.IsZero() || now.Before(m.ExpiresAt)
+}
+
+func (m *Mark) matches(labels []string) bool {
+	for _, l := range m.Labels {
+		for _, label := range labels {
+			if l == label {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// label的A-label和U-label两种写法
+func labelForms(label string) []string {
+	res := []string{label}
+	if u, err := idna.Lookup.ToUnicode(label); err == nil && u != label {
+		res = append(res, u)
+	}
+	return res
+}
+
+func (r *Registry) AddMark(m Mark) (*Mark, error) {
+	m.ID = strings.TrimSpace(m.ID)
+	if m.ID == "" || m.Name == "" || m.Holder == "" || len(m.Labels) == 0 {
+		return nil, errorf(ErrInvalid, "商标的id、name、holder、labels不能为空")
+	}
+	for i, l := range m.Labels {
+		l = strings.ToLower(strings.TrimSpace(l))
+		// 统一保存为A-label
+		if ldh, err := idna.Registration.ToASCII(l); err == nil {
+			l = ldh
+		}
+		if err := checkLabel(l); err != nil {
+			return nil, err
+		}
+		m.Labels[i] = l
+	}
+	m.CreatedAt = time.Now().UTC()
+	err := r.update(func(t *tx) error {
+		if t.d.Marks[m.ID] != nil {
+			return errorf(ErrExists, "商标 %s 已存在", m.ID)
+		}
+		c := m
+		t.d.Marks[m.ID] = &c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *Registry) DeleteMark(id string) error {
+	return r.update(func(t *tx) error {
+		if t.d.Marks[id] == nil {
+			return errorf(ErrNotFound, "商标 %s 不存在", id)
+		}
+		delete(t.d.Marks, id)
+		return nil
+	})
+}
+
+func (r *Registry) ListMarks() []Mark {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	res := []Mark{}
+	for _, m := range r.data.Marks {
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// 名字的商标声明，没有匹配的有效商标时返回nil
+func (r *Registry) ClaimsNotice(name string) (*ClaimsNotice, error) {
+	name = normalizeName(name)
+	label, err := r.domainLabel(name)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return claimsNotice(r.data, label+"."+r.cfg.TLD, label, time.Now().UTC()), nil
+}
+
+// 声明ID由名字和匹配的商标决定，商标变化后原来确认的声明失效
+func claimsNotice(d *data, name string, label string, now time.Time) *ClaimsNotice {
+	forms := labelForms(label)
+	notice := &ClaimsNotice{Name: name}
+	for _, m := range d.Marks {
+		if m.valid(now) && m.matches(forms) {
+			notice.Marks = append(notice.Marks, *m)
+		}
+	}
+	if len(notice.Marks) == 0 {
+		return nil
+	}
+	sort.Slice(notice.Marks, func(i, j int) bool { return notice.Marks[i].ID < notice.Marks[j].ID })
+	h := sha256.New()
+	h.Write([]byte(name))
+	for _, m := range notice.Marks {
+		h.Write([]byte("\n" + m.ID))
+	}
+	notice.ID = hex.EncodeToString(h.Sum(nil)[:8])
+	return notice
+}
+
+// 注册前的检查：开放注册前的阶段只接受申请，有待分配申请的名字不能直接注册，
+// 商标声明期内与商标匹配的名字需要提供已确认的声明ID
+func (r *Registry) checkLaunch(t *tx, name string, noticeID string, override bool, now time.Time) error {
+	if override {
+		return nil
+	}
+	cfg := r.cfg.Launch
+	if p := cfg.phaseAt(now); p != nil {
+		return errorf(ErrPolicy, "当前为%s阶段，只能提交申请", p.Name)
+	}
+	for _, app := range t.d.Applications {
+		if app.Name == name && app.Status == AppPendingAllocation {
+			return errorf(ErrPolicy, "域名 %s 有待分配的申请", name)
+		}
+	}
+	if !cfg.inClaims(now) {
+		return nil
+	}
+	label, err := r.domainLabel(name)
+	if err != nil {
+		return err
+	}
+	return checkNotice(t.d, label+"."+r.cfg.TLD, label, noticeID, now)
+}
+
+func checkNotice(d *data, name string, label string, noticeID string, now time.Time) error {
+	notice := claimsNotice(d, name, label, now)
+	if notice == nil || notice.ID == noticeID {
+		return nil
+	}
+	if noticeID == "" {
+		return errorf(ErrPolicy, "域名 %s 与商标匹配，需要确认商标声明 %s", name, notice.ID)
+	}
+	return errorf(ErrPolicy, "商标声明 %s 已失效，请重新确认 %s", noticeID, notice.ID)
+}
+
+// ---------- 申请 ----------
+
+// 开放注册前的域名申请，分配时按Domain中的联系人、NS等创建域名
+type Application struct {
+	ID          string `json:"id"`
+	Phase       string `json:"phase"`
+	Name        string `json:"name"`
+	RegistrarID string `json:"registrarId"`
+	Domain      Domain `json:"domain"`
+	Years       int    `json:"years"`
+	// sunrise申请使用的商标
+	MarkID string `json:"markId,omitempty"`
+	// landrush申请确认的商标声明
+	NoticeID string `json:"noticeId,omitempty"`
+	// 同名多个申请时的出价，单位分，成交时扣费
+	Bid    int64  `json:"bid"`
+	Status string `json:"status"`
+	// 申请时收取的注册费，未分配时退回
+	Charged   int64     `json:"charged,omitempty"`
+	ChargeID  uint64    `json:"chargeId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Msg       string    `json:"msg,omitempty"`
+}
+
+// 在sunrise或landrush阶段提交申请，申请时按注册价格扣费
+func (r *Registry) CreateApplication(req Application) (*Application, error) {
+	req.Name = normalizeName(req.Name)
+	label, err := r.domainLabel(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	req.Name = label + "." + r.cfg.TLD
+	if req.Years == 0 {
+		req.Years = r.cfg.DefaultPeriod
+	}
+	if req.Years < 1 || req.Years > r.cfg.MaxPeriod {
+		return nil, errorf(ErrRange, "注册年限必须在1-%d年之间", r.cfg.MaxPeriod)
+	}
+	if req.Bid < 0 {
+		return nil, errorf(ErrRange, "出价不能为负数")
+	}
+	dom := req.Domain
+	dom.Name = req.Name
+	dom.RegistrarID = req.RegistrarID
+	if dom.AuthInfo == "" {
+		dom.AuthInfo = r.newAuthInfo()
+	} else if err := checkAuthInfo(dom.AuthInfo); err != nil {
+		return nil, err
+	}
+	var res Application
+	err = r.update(func(t *tx) error {
+		now := time.Now().UTC()
+		p := r.cfg.Launch.phaseAt(now)
+		if p == nil {
+			return errorf(ErrPolicy, "当前为开放注册阶段，请直接注册")
+		}
+		if err := t.checkRegistrar(req.RegistrarID); err != nil {
+			return err
+		}
+		if err := r.checkCreatable(t, req.Name, false); err != nil {
+			return err
+		}
+		for _, app := range t.d.Applications {
+			if app.Name == req.Name && app.RegistrarID == req.RegistrarID && app.Status == AppPendingAllocation {
+				return errorf(ErrExists, "注册商 %s 已申请 %s", req.RegistrarID, req.Name)
+			}
+		}
+		switch p.Type {
+		case PhaseSunrise:
+			m := t.d.Marks[req.MarkID]
+			if m == nil || !m.valid(now) {
+				return errorf(ErrPolicy, "sunrise阶段需要有效的商标")
+			}
+			if !m.matches(labelForms(label)) {
+				return errorf(ErrPolicy, "商标 %s 与 %s 不匹配", m.ID, req.Name)
+			}
+		case PhaseLandrush:
+			if err := checkNotice(t.d, req.Name, label, req.NoticeID, now); err != nil {
+				return err
+			}
+		}
+		if err := r.checkDomainRefs(t, &dom); err != nil {
+			return err
+		}
+		app := req
+		app.ID = t.nextROID("A", r.cfg.TLD)
+		app.Phase = p.Name
+		app.Domain = dom
+		app.Status = AppPendingAllocation
+		app.CreatedAt = now
+		app.UpdatedAt = now
+		app.Msg = ""
+		charged, err := r.charge(t, req.RegistrarID, OpCreate, req.Name, req.Years, now, false, time.Time{})
+		if err != nil {
+			return err
+		}
+		if charged != nil {
+			app.Charged = -charged.Amount
+			app.ChargeID = charged.ID
+		}
+		t.d.Applications[app.ID] = &app
+		res = app
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 注册商在分配之前撤回申请，退回注册费
+func (r *Registry) WithdrawApplication(id string, registrarID string) error {
+	return r.update(func(t *tx) error {
+		app := t.d.Applications[id]
+		if app == nil {
+			return errorf(ErrNotFound, "申请 %s 不存在", id)
+		}
+		if err := checkSponsor(registrarID, app.RegistrarID, "申请 "+id); err != nil {
+			return err
+		}
+		if app.Status != AppPendingAllocation {
+			return errorf(ErrProhibited, "申请 %s 已处理", id)
+		}
+		r.closeApplication(t, app, AppWithdrawn, "", time.Now().UTC())
+		return nil
+	})
+}
+
+func (r *Registry) GetApplication(id string) (*Application, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	app := r.data.Applications[id]
+	if app == nil {
+		return nil, errorf(ErrNotFound, "申请 %s 不存在", id)
+	}
+	c := *app
+	return &c, nil
+}
+
+// 按名字或注册商列出申请，都为空时列出全部
+func (r *Registry) ListApplications(name string, registrarID string) []Application {
+	name = normalizeName(name)
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	res := []Application{}
+	for _, app := range r.data.Applications {
+		if (name == "" || app.Name == name) && (registrarID == "" || app.RegistrarID == registrarID) {
+			res = append(res, *app)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// 注册局直接把名字分配给某个申请，同名的其他申请被拒绝
+func (r *Registry) AllocateApplication(id string) (*Domain, error) {
+	var res Domain
+	err := r.update(func(t *tx) error {
+		app := t.d.Applications[id]
+		if app == nil {
+			return errorf(ErrNotFound, "申请 %s 不存在", id)
+		}
+		if app.Status != AppPendingAllocation {
+			return errorf(ErrProhibited, "申请 %s 已处理", id)
+		}
+		now := time.Now().UTC()
+		dom, err := r.allocate(t, app, false, now)
+		if err != nil {
+			return err
+		}
+		r.rejectOthers(t, app, now)
+		res = *dom
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 分配已结束阶段的申请，先结束的阶段先分配。同名只有一个申请时直接分配，
+// 多个申请时按出价从高到低、同价按申请时间先后依次尝试，出价扣费失败的跳过
+func (r *Registry) RunLaunch(now time.Time) ([]Application, error) {
+	now = now.UTC()
+	// 分配失败的申请及原因，重新执行时直接拒绝
+	failed := map[string]string{}
+	for {
+		var res []Application
+		err := r.update(func(t *tx) error {
+			groups := map[string][]*Application{}
+			var keys []string
+			for _, app := range t.d.Applications {
+				p := r.cfg.Launch.phase(app.Phase)
+				if app.Status != AppPendingAllocation || p == nil || now.Before(p.end) {
+					continue
+				}
+				key := p.end.Format(time.RFC3339) + " " + app.Name
+				if groups[key] == nil {
+					keys = append(keys, key)
+				}
+				groups[key] = append(groups[key], app)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				apps := groups[key]
+				sort.Slice(apps, func(i, j int) bool {
+					if apps[i].Bid != apps[j].Bid {
+						return apps[i].Bid > apps[j].Bid
+					}
+					return apps[i].CreatedAt.Before(apps[j].CreatedAt)
+				})
+				auction := len(apps) > 1
+				for _, app := range apps {
+					if app.Status != AppPendingAllocation {
+						continue
+					}
+					if msg, ok := failed[app.ID]; ok {
+						r.closeApplication(t, app, AppRejected, msg, now)
+						continue
+					}
+					// 失败前可能已修改数据和zone，返回错误使update放弃整个批次，拒绝该申请后重新执行
+					if _, err := r.allocate(t, app, auction, now); err != nil {
+						failed[app.ID] = err.Error()
+						fmt.Println("Error allocate:", app.ID, app.Name, err)
+						return errRetryBatch
+					}
+					r.rejectOthers(t, app, now)
+					break
+				}
+				for _, app := range apps {
+					res = append(res, *app)
+				}
+			}
+			return nil
+		})
+		if err == errRetryBatch {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, app := range res {
+			fmt.Println("launch", app.ID, app.Name, app.RegistrarID, app.Status, app.Msg)
+		}
+		return res, nil
+	}
+}
+
+// 按申请创建域名，auction为true时在创建成功后按出价扣费
+func (r *Registry) allocate(t *tx, app *Application, auction bool, now time.Time) (*Domain, error) {
+	if err := r.checkCreatable(t, app.Name, false); err != nil {
+		return nil, err
+	}
+	if err := t.checkRegistrar(app.RegistrarID); err != nil {
+		return nil, err
+	}
+	dom := app.Domain
+	if err := r.checkDomainRefs(t, &dom); err != nil {
+		return nil, err
+	}
+	if err := r.createDomain(t, &dom, app.Years, now); err != nil {
+		return nil, err
+	}
+	if auction && app.Bid > 0 {
+		if _, err := r.debit(t, LedgerEntry{RegistrarID: app.RegistrarID, Op: OpAuction, Domain: app.Name, Amount: app.Bid, Memo: app.ID}, now, false); err != nil {
+			return nil, err
+		}
+	}
+	app.Status = AppAllocated
+	app.UpdatedAt = now
+	t.addMessage(app.RegistrarID, fmt.Sprintf("Application %s allocated: %s", app.ID, app.Name), nil)
+	return &dom, nil
+}
+
+// 拒绝同名的其他待分配申请
+func (r *Registry) rejectOthers(t *tx, winner *Application, now time.Time) {
+	for _, app := range t.d.Applications {
+		if app.ID != winner.ID && app.Name == winner.Name && app.Status == AppPendingAllocation {
+			r.closeApplication(t, app, AppRejected, "已分配给申请 "+winner.ID, now)
+		}
+	}
+}
+
+// 结束未分配的申请，退回注册费并通知注册商
+func (r *Registry) closeApplication(t *tx, app *Application, status string, msg string, now time.Time) {
+	app.Status = status
+	app.Msg = msg
+	app.UpdatedAt = now
+	r.refund(t, app.RegistrarID, OpCreate, app.Name, app.Charged, app.ChargeID, "申请"+status, now)
+	t.addMessage(app.RegistrarID, fmt.Sprintf("Application %s %s: %s", app.ID, status, app.Name), nil)
+}
@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"testing"
+	"time"
+)
+
+var launchEnd = time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+// 注册局处于landrush阶段结束之后，reg1、reg2各有5000，申请已预付注册费1000
+func newLaunchRegistry(t *testing.T, zone Zone) *Registry {
+	t.Helper()
+	r := newTestRegistryWith(t, zone, func(cfg *Config) {
+		cfg.Billing.Enabled = true
+		cfg.Billing.Prices = map[string]PriceList{TierStandard: {Create: 1000, Renew: 1000}}
+		cfg.Launch.Phases = []LaunchPhase{{Name: "landrush", Type: PhaseLandrush, Start: "2026-01-01T00:00:00Z", End: launchEnd.Format(time.RFC3339)}}
+	})
+	addTestRegistrar(t, r, "reg1", 5000)
+	addTestRegistrar(t, r, "reg2", 5000)
+	r.data.Contacts["c1"] = &Contact{ID: "c1", RegistrarID: "reg1"}
+	r.data.Hosts["ns.example.net"] = &Host{Name: "ns.example.net"}
+	return r
+}
+
+type testApplication struct {
+	id          string
+	name        string
+	registrarID string
+	bid         int64
+	// 相对于阶段开始的申请时间
+	offset time.Duration
+}
+
+func addTestApplication(r *Registry, a testApplication) {
+	r.data.Applications[a.id] = &Application{
+		ID:          a.id,
+		Phase:       "landrush",
+		Name:        a.name,
+		RegistrarID: a.registrarID,
+		Domain:      Domain{Name: a.name, RegistrarID: a.registrarID, RegistrantID: "c1", NameServers: []string{"ns.example.net"}},
+		Years:       1,
+		Bid:         a.bid,
+		Status:      AppPendingAllocation,
+		Charged:     1000,
+		CreatedAt:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(a.offset),
+	}
+}
+
+func TestRunLaunch(t *testing.T) {
+	tests := []struct {
+		name     string
+		apps     []testApplication
+		balances map[string]int64
+		failName string
+		// 分配后各申请的状态和注册商余额
+		wantStatus   map[string]string
+		wantBalances map[string]int64
+	}{
+		{
+			name:         "single",
+			apps:         []testApplication{{id: "A1", name: "a.chn", registrarID: "reg1", bid: 500}},
+			wantStatus:   map[string]string{"A1": AppAllocated},
+			wantBalances: map[string]int64{"reg1": 5000, "reg2": 5000},
+		},
+		{
+			name: "highest bid",
+			apps: []testApplication{
+				{id: "A1", name: "a.chn", registrarID: "reg1", bid: 100},
+				{id: "A2", name: "a.chn", registrarID: "reg2", bid: 300, offset: time.Hour},
+			},
+			wantStatus:   map[string]string{"A1": AppRejected, "A2": AppAllocated},
+			wantBalances: map[string]int64{"reg1": 6000, "reg2": 4700},
+		},
+		{
+			name: "tie goes to earlier",
+			apps: []testApplication{
+				{id: "A1", name: "a.chn", registrarID: "reg1", bid: 200, offset: time.Hour},
+				{id: "A2", name: "a.chn", registrarID: "reg2", bid: 200},
+			},
+			wantStatus:   map[string]string{"A1": AppRejected, "A2": AppAllocated},
+			wantBalances: map[string]int64{"reg1": 6000, "reg2": 4800},
+		},
+		{
+			name: "bid not affordable",
+			apps: []testApplication{
+				{id: "A1", name: "a.chn", registrarID: "reg1", bid: 100},
+				{id: "A2", name: "a.chn", registrarID: "reg2", bid: 300},
+			},
+			balances:     map[string]int64{"reg2": 100},
+			wantStatus:   map[string]string{"A1": AppAllocated, "A2": AppRejected},
+			wantBalances: map[string]int64{"reg1": 4900, "reg2": 1100},
+		},
+		{
+			name: "zone fails",
+			apps: []testApplication{
+				{id: "A1", name: "a.chn", registrarID: "reg1", bid: 100},
+				{id: "A2", name: "a.chn", registrarID: "reg2", bid: 300},
+				{id: "A3", name: "b.chn", registrarID: "reg1"},
+			},
+			failName:     "a.chn.",
+			wantStatus:   map[string]string{"A1": AppRejected, "A2": AppRejected, "A3": AppAllocated},
+			wantBalances: map[string]int64{"reg1": 6000, "reg2": 6000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := &fakeZone{fail: map[string]bool{tt.failName: true}}
+			r := newLaunchRegistry(t, zone)
+			for id, balance := range tt.balances {
+				r.data.Registrars[id].Balance = balance
+			}
+			for _, app := range tt.apps {
+				addTestApplication(r, app)
+			}
+			if res, err := r.RunLaunch(launchEnd.Add(-time.Second)); err != nil || len(res) != 0 {
+				t.Fatalf("阶段结束前不应分配: %+v %v", res, err)
+			}
+			res, err := r.RunLaunch(launchEnd)
+			if err != nil {
+				t.Fatalf("RunLaunch: %v", err)
+			}
+			if len(res) != len(tt.apps) {
+				t.Errorf("处理了%d个申请，应为%d个", len(res), len(tt.apps))
+			}
+			for id, want := range tt.wantStatus {
+				app := r.data.Applications[id]
+				if app.Status != want {
+					t.Errorf("申请%s的状态为%s（%s），应为%s", id, app.Status, app.Msg, want)
+				}
+				dom := r.data.Domains[app.Name]
+				if want == AppAllocated && (dom == nil || dom.RegistrarID != app.RegistrarID) {
+					t.Errorf("申请%s分配后域名为 %+v", id, dom)
+				}
+			}
+			if tt.failName != "" && r.data.Domains["a.chn"] != nil {
+				t.Error("zone失败的域名不应创建")
+			}
+			for id, want := range tt.wantBalances {
+				if balance := r.data.Registrars[id].Balance; balance != want {
+					t.Errorf("%s的余额为%d，应为%d", id, balance, want)
+				}
+			}
+			if zone.pending != 0 {
+				t.Errorf("zone还有%d个未提交的修改", zone.pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// 生命周期配置，对应registry.lifecycle节点
+type LifecycleConfig struct {
+	// 是否定期处理到期域名；启用后删除域名先进入赎回期
+	Enabled bool `json:"enabled"`
+	// 到期时自动续费一年，否则直接进入赎回期
+	AutoRenew        bool   `json:"autoRenew"`
+	AutoRenewGrace   string `json:"autoRenewGrace"`
+	RedemptionPeriod string `json:"redemptionPeriod"`
+	PendingDelete    string `json:"pendingDelete"`
+	CheckInterval    string `json:"checkInterval"`
+	// 每次提交zone最多处理的状态变化数
+	BatchSize int `json:"batchSize"`
+	// 状态变化日志，每行一条JSON
+	LogFile string `json:"logFile"`
+
+	autoRenewGrace   time.Duration
+	redemptionPeriod time.Duration
+	pendingDelete    time.Duration
+	checkInterval    time.Duration
+}
+
+func (c *LifecycleConfig) parse() error {
+	items := []struct {
+		name  string
+		value string
+		d     *time.Duration
+	}{
+		{"autoRenewGrace", c.AutoRenewGrace, &c.autoRenewGrace},
+		{"redemptionPeriod", c.RedemptionPeriod, &c.redemptionPeriod},
+		{"pendingDelete", c.PendingDelete, &c.pendingDelete},
+		{"checkInterval", c.CheckInterval, &c.checkInterval},
+	}
+	for _, item := range items {
+		d, err := time.ParseDuration(item.value)
+		if err != nil {
+			return fmt.Errorf("registry.lifecycle.%s 格式错误: %v", item.name, err)
+		}
+		*item.d = d
+	}
+	if c.BatchSize < 1 {
+		return fmt.Errorf("registry.lifecycle.batchSize 必须大于0")
+	}
+	return nil
+}
+
+func (c LifecycleConfig) CheckIntervalDuration() time.Duration {
+	return c.checkInterval
+}
+
+// 生命周期事件
+const (
+	EventAutoRenew         = "autoRenew"
+	EventAutoRenewGraceEnd = "autoRenewGraceEnd"
+	EventExpire            = "expire"
+	EventDelete            = "delete"
+	EventRestore           = "restore"
+	EventRedemptionEnd     = "redemptionEnd"
+	EventPurge             = "purge"
+)
+
+// 一次状态变化，提交成功后写入日志
+type Transition struct {
+	Time        time.Time `json:"time"`
+	Domain      string    `json:"domain"`
+	RegistrarID string    `json:"registrarId"`
+	Event       string    `json:"event"`
+	// 变化后的状态，清除后为空
+	Status []string `json:"status,omitempty"`
+	Msg    string   `json:"msg,omitempty"`
+}
+
+func (t *tx) addTransition(dom *Domain, event string, now time.Time, msg string) {
+	tr := Transition{Time: now, Domain: dom.Name, RegistrarID: dom.RegistrarID, Event: event, Msg: msg}
+	if event != EventPurge {
+		tr.Status = append([]string(nil), dom.Status...)
+	}
+	t.transitions = append(t.transitions, tr)
+}
+
+func (r *Registry) logTransitions(list []Transition) {
+	var lines []byte
+	for _, tr := range list {
+		fmt.Println("lifecycle:", tr.Domain, tr.Event, tr.Status, tr.Msg)
+		line, _ := json.Marshal(tr)
+		lines = append(append(lines, line...), '\n')
+	}
+	file := r.cfg.Lifecycle.LogFile
+	if file == "" || len(lines) == 0 {
+		return
+	}
+	if err := gfile.Mkdir(filepath.Dir(file)); err != nil {
+		fmt.Println("Error write lifecycle log:", err)
+		return
+	}
+	if err := gfile.PutBytesAppend(file, lines); err != nil {
+		fmt.Println("Error write lifecycle log:", err)
+	}
+}
+
+// 批次中有域名或申请出错时放弃整个批次，去掉出错的部分后重新执行
+var errRetryBatch = errors.New("retry batch")
+
+// 处理到期和各阶段结束的域名，每batchSize个变化提交一次zone，返回全部变化
+func (r *Registry) RunLifecycle(now time.Time) ([]Transition, error) {
+	now = now.UTC()
+	var all []Transition
+	// 本轮出错的域名不再重试，避免一个域名卡住整个批次
+	failed := map[string]bool{}
+	for {
+		var batch []Transition
+		err := r.update(func(t *tx) error {
+			var names []string
+			for name := range t.d.Domains {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if len(t.transitions) >= r.cfg.Lifecycle.BatchSize {
+					break
+				}
+				if failed[name] {
+					continue
+				}
+				// 出错前的修改可能涉及其他域名、主机、转移、账本和zone，只恢复这个域名不够，
+				// 返回错误使update放弃整个批次的数据和zone修改
+				if err := r.advance(t, t.d.Domains[name], now); err != nil {
+					failed[name] = true
+					fmt.Println("Error lifecycle:", name, err)
+					return errRetryBatch
+				}
+			}
+			batch = t.transitions
+			return nil
+		})
+		if err == errRetryBatch {
+			continue
+		}
+		if err != nil {
+			return all, err
+		}
+		all = append(all, batch...)
+		if len(batch) < r.cfg.Lifecycle.BatchSize {
+			return all, nil
+		}
+	}
+}
+
+// 推进一个域名的生命周期，没有变化时什么也不做
+func (r *Registry) advance(t *tx, dom *Domain, now time.Time) error {
+	cfg := r.cfg.Lifecycle
+	t.pruneGrace(dom.Name, now)
+	switch {
+	case dom.HasStatus(StatusPendingDelete):
+		if now.Before(dom.PhaseEndsAt) {
+			return nil
+		}
+		if err := r.purgeDomain(t, dom); err != nil {
+			return err
+		}
+		t.addTransition(dom, EventPurge, now, "")
+		return nil
+	case dom.HasStatus(StatusRedemptionPeriod):
+		if now.Before(dom.PhaseEndsAt) {
+			return nil
+		}
+		dom.removeStatus(StatusRedemptionPeriod)
+		dom.Status = append(dom.Status, StatusPendingDelete)
+		dom.PhaseEndsAt = now.Add(cfg.pendingDelete)
+		dom.UpdatedAt = now
+		dom.normalizeStatus()
+		t.addTransition(dom, EventRedemptionEnd, now, "")
+		return nil
+	case dom.HasStatus(StatusAutoRenewPeriod):
+		if now.Before(dom.PhaseEndsAt) {
+			return nil
+		}
+		dom.removeStatus(StatusAutoRenewPeriod)
+		dom.PhaseEndsAt = time.Time{}
+		dom.normalizeStatus()
+		t.addTransition(dom, EventAutoRenewGraceEnd, now, "")
+		return nil
+	case now.Before(dom.ExpiresAt):
+		return nil
+	case cfg.AutoRenew:
+		// 自动续费不检查余额，可能透支；宽限期内删除时退回
+		if _, err := r.charge(t, dom.RegistrarID, OpAutoRenew, dom.Name, 1, now, true, now.Add(cfg.autoRenewGrace)); err != nil {
+			return err
+		}
+		dom.ExpiresAt = dom.ExpiresAt.AddDate(1, 0, 0)
+		dom.Status = append(dom.Status, StatusAutoRenewPeriod)
+		dom.PhaseEndsAt = now.Add(cfg.autoRenewGrace)
+		dom.UpdatedAt = now
+		dom.normalizeStatus()
+		t.addTransition(dom, EventAutoRenew, now, "到期日 "+dom.ExpiresAt.Format("2006-01-02"))
+		return nil
+	default:
+		if err := r.startRedemption(t, dom, now); err != nil {
+			return err
+		}
+		t.addTransition(dom, EventExpire, now, "")
+		return nil
+	}
+}
+
+// 进入赎回期并撤下委派。自动续费宽限期内删除时退回自动续费的一年，进行中的转移由注册局取消
+func (r *Registry) startRedemption(t *tx, dom *Domain, now time.Time) error {
+	if dom.HasStatus(StatusAutoRenewPeriod) {
+		dom.ExpiresAt = dom.ExpiresAt.AddDate(-1, 0, 0)
+		dom.removeStatus(StatusAutoRenewPeriod)
+	}
+	if transfer := t.d.Transfers[dom.Name]; transfer != nil && transfer.Status == TransferPending {
+		r.completeTransfer(t, dom, transfer, TransferServerCancelled, now)
+	}
+	dom.Status = append(dom.Status, StatusRedemptionPeriod)
+	dom.PhaseEndsAt = now.Add(r.cfg.Lifecycle.redemptionPeriod)
+	dom.UpdatedAt = now
+	dom.normalizeStatus()
+	return r.publish(t, dom)
+}
+
+// 赎回期内恢复域名，已过期的续费一年，委派重新发布
+func (r *Registry) RestoreDomain(name string, registrarID string) (*Domain, error) {
+	name = normalizeName(name)
+	var res Domain
+	err := r.update(func(t *tx) error {
+		dom := t.d.Domains[name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", name)
+		}
+		if err := checkSponsor(registrarID, dom.RegistrarID, "域名 "+name); err != nil {
+			return err
+		}
+		if !dom.HasStatus(StatusRedemptionPeriod) {
+			return errorf(ErrProhibited, "域名 %s 不在赎回期，不能恢复", name)
+		}
+		now := time.Now().UTC()
+		if _, err := r.charge(t, dom.RegistrarID, OpRestore, name, 1, now, false, time.Time{}); err != nil {
+			return err
+		}
+		msg := ""
+		if dom.ExpiresAt.Before(now) {
+			if _, err := r.charge(t, dom.RegistrarID, OpRenew, name, 1, now, false, time.Time{}); err != nil {
+				return err
+			}
+			dom.ExpiresAt = dom.ExpiresAt.AddDate(1, 0, 0)
+			msg = "到期日 " + dom.ExpiresAt.Format("2006-01-02")
+		}
+		dom.removeStatus(StatusRedemptionPeriod)
+		dom.PhaseEndsAt = time.Time{}
+		dom.UpdatedAt = now
+		dom.normalizeStatus()
+		t.addTransition(dom, EventRestore, now, msg)
+		res = *dom
+		return r.publish(t, dom)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 域名下被其他域名用作NS的从属主机
+func (r *Registry) subordinateHostsInUse(t *tx, name string) error {
+	for hostName := range t.d.Hosts {
+		if !strings.HasSuffix(hostName, "."+name) {
+			continue
+		}
+		for _, other := range r.domainsUsingHost(t, hostName) {
+			if other.Name != name {
+				return errorf(ErrInUse, "主机 %s 仍被域名 %s 使用，不能删除 %s", hostName, other.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// 清除域名、从属主机和zone中该域名下的所有记录。
+// 赎回期间其他域名新引用的从属主机会从这些域名的NS中去掉
+func (r *Registry) purgeDomain(t *tx, dom *Domain) error {
+	t.zoneChanged = true
+	if err := r.zone.PurgeDomain(dom.Name + "."); err != nil {
+		return err
+	}
+	for hostName := range t.d.Hosts {
+		if !strings.HasSuffix(hostName, "."+dom.Name) {
+			continue
+		}
+		for _, other := range r.domainsUsingHost(t, hostName) {
+			if other.Name == dom.Name {
+				continue
+			}
+			var list []string
+			for _, ns := range other.NameServers {
+				if ns != hostName {
+					list = append(list, ns)
+				}
+			}
+			other.NameServers = list
+			other.normalizeStatus()
+			if err := r.publish(t, other); err != nil {
+				return err
+			}
+		}
+		delete(t.d.Hosts, hostName)
+	}
+	delete(t.d.Transfers, dom.Name)
+	delete(t.d.Grace, dom.Name)
+	delete(t.d.Domains, dom.Name)
+	return nil
+}
@@ -0,0 +1,242 @@
+package registry
+
+import (
+	"testing"
+	"time"
+)
+
+var lifecycleNow = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// 直接放入内存数据的域名，有一个zone外的NS，委派已发布
+func testDomain(name string, registrarID string, expiresAt time.Time, status ...string) *Domain {
+	dom := &Domain{Name: name, RegistrarID: registrarID, NameServers: []string{"ns.example.net"}, Status: status, ExpiresAt: expiresAt}
+	dom.normalizeStatus()
+	return dom
+}
+
+func TestRunLifecycle(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name      string
+		autoRenew bool
+		dom       *Domain
+		phaseEnds time.Time
+		// 期望的事件和之后的状态，event为空时没有变化
+		event       string
+		wantStatus  string
+		wantExpires time.Time
+		wantBalance int64
+		wantZone    int
+	}{
+		{
+			name:        "not expired",
+			autoRenew:   true,
+			dom:         testDomain("a.chn", "reg1", lifecycleNow.Add(day)),
+			wantStatus:  StatusOK,
+			wantExpires: lifecycleNow.Add(day),
+			wantBalance: 5000,
+		},
+		{
+			name:        "auto renew",
+			autoRenew:   true,
+			dom:         testDomain("a.chn", "reg1", lifecycleNow.Add(-day)),
+			event:       EventAutoRenew,
+			wantStatus:  StatusAutoRenewPeriod,
+			wantExpires: lifecycleNow.Add(-day).AddDate(1, 0, 0),
+			wantBalance: 4000,
+		},
+		{
+			name:        "auto renew overdraws",
+			autoRenew:   true,
+			dom:         testDomain("b.chn", "reg2", lifecycleNow.Add(-day)),
+			event:       EventAutoRenew,
+			wantStatus:  StatusAutoRenewPeriod,
+			wantExpires: lifecycleNow.Add(-day).AddDate(1, 0, 0),
+			wantBalance: -1000,
+		},
+		{
+			name:        "auto renew grace end",
+			autoRenew:   true,
+			dom:         testDomain("a.chn", "reg1", lifecycleNow.AddDate(1, 0, 0), StatusAutoRenewPeriod),
+			phaseEnds:   lifecycleNow.Add(-time.Minute),
+			event:       EventAutoRenewGraceEnd,
+			wantStatus:  StatusOK,
+			wantExpires: lifecycleNow.AddDate(1, 0, 0),
+			wantBalance: 5000,
+		},
+		{
+			name:        "expire",
+			dom:         testDomain("a.chn", "reg1", lifecycleNow.Add(-day)),
+			event:       EventExpire,
+			wantStatus:  StatusRedemptionPeriod,
+			wantExpires: lifecycleNow.Add(-day),
+			wantBalance: 5000,
+			wantZone:    1,
+		},
+		{
+			name:        "redemption not over",
+			dom:         testDomain("a.chn", "reg1", lifecycleNow.Add(-day), StatusRedemptionPeriod),
+			phaseEnds:   lifecycleNow.Add(time.Minute),
+			wantStatus:  StatusRedemptionPeriod,
+			wantExpires: lifecycleNow.Add(-day),
+			wantBalance: 5000,
+		},
+		{
+			name:        "redemption end",
+			dom:         testDomain("a.chn", "reg1", lifecycleNow.Add(-day), StatusRedemptionPeriod),
+			phaseEnds:   lifecycleNow,
+			event:       EventRedemptionEnd,
+			wantStatus:  StatusPendingDelete,
+			wantExpires: lifecycleNow.Add(-day),
+			wantBalance: 5000,
+		},
+		{
+			name:        "purge",
+			dom:         testDomain("a.chn", "reg1", lifecycleNow.Add(-day), StatusPendingDelete),
+			phaseEnds:   lifecycleNow,
+			event:       EventPurge,
+			wantBalance: 5000,
+			wantZone:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := &fakeZone{}
+			r := newTestRegistryWith(t, zone, func(cfg *Config) {
+				cfg.Lifecycle.Enabled = true
+				cfg.Lifecycle.AutoRenew = tt.autoRenew
+				cfg.Billing.Enabled = true
+				cfg.Billing.Prices = map[string]PriceList{TierStandard: {Create: 1000, Renew: 1000, Transfer: 800, Restore: 3000}}
+			})
+			addTestRegistrar(t, r, "reg1", 5000)
+			addTestRegistrar(t, r, "reg2", 0)
+			tt.dom.PhaseEndsAt = tt.phaseEnds
+			r.data.Domains[tt.dom.Name] = tt.dom
+			list, err := r.RunLifecycle(lifecycleNow)
+			if err != nil {
+				t.Fatalf("RunLifecycle: %v", err)
+			}
+			if tt.event == "" {
+				if len(list) != 0 {
+					t.Errorf("不应有变化: %+v", list)
+				}
+			} else if len(list) != 1 || list[0].Event != tt.event {
+				t.Errorf("变化为 %+v，应为%s", list, tt.event)
+			}
+			dom := r.data.Domains[tt.dom.Name]
+			if tt.event == EventPurge {
+				if dom != nil {
+					t.Error("域名应已清除")
+				}
+			} else if !dom.HasStatus(tt.wantStatus) || !dom.ExpiresAt.Equal(tt.wantExpires) {
+				t.Errorf("状态 %v 到期 %v，应有%s 到期 %v", dom.Status, dom.ExpiresAt, tt.wantStatus, tt.wantExpires)
+			}
+			if balance := r.data.Registrars[tt.dom.RegistrarID].Balance; balance != tt.wantBalance {
+				t.Errorf("余额为%d，应为%d", balance, tt.wantBalance)
+			}
+			if zone.committed != tt.wantZone {
+				t.Errorf("zone提交了%d次修改，应为%d次", zone.committed, tt.wantZone)
+			}
+		})
+	}
+}
+
+// 自动续费宽限期内删除时退回续费，到期日恢复
+func TestDeleteDomainInAutoRenewGrace(t *testing.T) {
+	r := newTestRegistryWith(t, &fakeZone{}, func(cfg *Config) {
+		cfg.Lifecycle.Enabled = true
+		cfg.Billing.Enabled = true
+		cfg.Billing.Prices = map[string]PriceList{TierStandard: {Create: 1000, Renew: 1000}}
+	})
+	addTestRegistrar(t, r, "reg1", 5000)
+	now := time.Now().UTC()
+	expires := now.Add(-time.Hour)
+	r.data.Domains["a.chn"] = testDomain("a.chn", "reg1", expires)
+	if _, err := r.RunLifecycle(now); err != nil {
+		t.Fatalf("RunLifecycle: %v", err)
+	}
+	if balance := r.data.Registrars["reg1"].Balance; balance != 4000 {
+		t.Fatalf("自动续费后余额为%d，应为4000", balance)
+	}
+	if err := r.DeleteDomain("a.chn", "reg1"); err != nil {
+		t.Fatalf("DeleteDomain: %v", err)
+	}
+	dom := r.data.Domains["a.chn"]
+	if balance := r.data.Registrars["reg1"].Balance; balance != 5000 {
+		t.Errorf("删除后余额为%d，应退回到5000", balance)
+	}
+	if !dom.ExpiresAt.Equal(expires) || !dom.HasStatus(StatusRedemptionPeriod) || dom.HasStatus(StatusAutoRenewPeriod) {
+		t.Errorf("删除后状态 %v 到期 %v", dom.Status, dom.ExpiresAt)
+	}
+}
+
+// 一个域名的zone操作失败时，它在批次中已做的修改（取消转移、退款、消息）全部放弃，其他域名照常处理
+func TestRunLifecycleFailureDiscardsSideEffects(t *testing.T) {
+	zone := &fakeZone{fail: map[string]bool{"a.chn.": true}}
+	r := newTestRegistryWith(t, zone, func(cfg *Config) {
+		cfg.Lifecycle.Enabled = true
+		cfg.Lifecycle.AutoRenew = false
+		cfg.Billing.Enabled = true
+		cfg.Billing.Prices = map[string]PriceList{TierStandard: {Transfer: 800}}
+	})
+	addTestRegistrar(t, r, "reg1", 0)
+	addTestRegistrar(t, r, "reg2", 5000)
+	past := lifecycleNow.Add(-time.Hour)
+	r.data.Domains["a.chn"] = testDomain("a.chn", "reg1", past, StatusPendingTransfer)
+	r.data.Domains["b.chn"] = testDomain("b.chn", "reg1", past)
+	r.data.Registrars["reg2"].Balance = 4200
+	r.data.Transfers["a.chn"] = &Transfer{Domain: "a.chn", Status: TransferPending, GainingID: "reg2", LosingID: "reg1", Years: 1, Charged: 800, ChargeID: 1}
+	sequence := r.data.Sequence
+
+	list, err := r.RunLifecycle(lifecycleNow)
+	if err != nil {
+		t.Fatalf("RunLifecycle: %v", err)
+	}
+	if len(list) != 1 || list[0].Domain != "b.chn" || list[0].Event != EventExpire {
+		t.Fatalf("变化为 %+v，应只有b.chn到期", list)
+	}
+	if !r.data.Domains["b.chn"].HasStatus(StatusRedemptionPeriod) {
+		t.Error("b.chn应进入赎回期")
+	}
+	a := r.data.Domains["a.chn"]
+	if a.HasStatus(StatusRedemptionPeriod) || !a.HasStatus(StatusPendingTransfer) {
+		t.Errorf("a.chn的状态变为 %v", a.Status)
+	}
+	if transfer := r.data.Transfers["a.chn"]; transfer.Status != TransferPending {
+		t.Errorf("a.chn的转移变为%s", transfer.Status)
+	}
+	if balance := r.data.Registrars["reg2"].Balance; balance != 4200 {
+		t.Errorf("转入注册商余额为%d，不应退款", balance)
+	}
+	if len(r.data.Messages) != 0 || r.data.Sequence != sequence {
+		t.Errorf("不应留下消息或账本记录: messages=%d sequence=%d", len(r.data.Messages), r.data.Sequence)
+	}
+	if zone.committed != 1 || zone.pending != 0 {
+		t.Errorf("zone committed=%d pending=%d，应只提交b.chn", zone.committed, zone.pending)
+	}
+	saved, err := loadData(r.cfg.DataFile)
+	if err != nil || saved.Transfers["a.chn"].Status != TransferPending {
+		t.Errorf("数据文件中a.chn的转移应仍在进行: %v", err)
+	}
+}
+
+// 每批最多batchSize个变化，批次之间分别提交
+func TestRunLifecycleBatches(t *testing.T) {
+	zone := &fakeZone{}
+	r := newTestRegistryWith(t, zone, func(cfg *Config) {
+		cfg.Lifecycle.Enabled = true
+		cfg.Lifecycle.AutoRenew = false
+		cfg.Lifecycle.BatchSize = 2
+	})
+	addTestRegistrar(t, r, "reg1", 0)
+	for _, name := range []string{"a.chn", "b.chn", "c.chn", "d.chn", "e.chn"} {
+		r.data.Domains[name] = testDomain(name, "reg1", lifecycleNow.Add(-time.Hour))
+	}
+	list, err := r.RunLifecycle(lifecycleNow)
+	if err != nil {
+		t.Fatalf("RunLifecycle: %v", err)
+	}
+	if len(list) != 5 || zone.committed != 5 {
+		t.Errorf("处理了%d个域名，zone提交%d次修改，应均为5", len(list), zone.committed)
+	}
+}
@@ -0,0 +1,190 @@
+package registry
+
+import (
+	"time"
+
+	"newCHNTLDManager/dns/eppstatus"
+)
+
+// 域名状态，取值和含义见eppstatus
+const (
+	StatusOK                       = eppstatus.OK
+	StatusServerHold               = eppstatus.ServerHold
+	StatusInactive                 = eppstatus.Inactive
+	StatusPendingTransfer          = eppstatus.PendingTransfer
+	StatusAutoRenewPeriod          = eppstatus.AutoRenewPeriod
+	StatusRedemptionPeriod         = eppstatus.RedemptionPeriod
+	StatusPendingDelete            = eppstatus.PendingDelete
+	StatusClientHold               = eppstatus.ClientHold
+	StatusClientUpdateProhibited   = eppstatus.ClientUpdateProhibited
+	StatusClientDeleteProhibited   = eppstatus.ClientDeleteProhibited
+	StatusClientTransferProhibited = eppstatus.ClientTransferProhibited
+	StatusClientRenewProhibited    = eppstatus.ClientRenewProhibited
+	StatusServerUpdateProhibited   = eppstatus.ServerUpdateProhibited
+	StatusServerDeleteProhibited   = eppstatus.ServerDeleteProhibited
+	StatusServerTransferProhibited = eppstatus.ServerTransferProhibited
+	StatusServerRenewProhibited    = eppstatus.ServerRenewProhibited
+)
+
+// 注册商可以自行设置的状态
+var clientStatuses = []string{
+	StatusClientHold,
+	StatusClientUpdateProhibited,
+	StatusClientDeleteProhibited,
+	StatusClientTransferProhibited,
+	StatusClientRenewProhibited,
+}
+
+// 注册局锁定的状态
+var lockStatuses = []string{
+	StatusServerUpdateProhibited,
+	StatusServerDeleteProhibited,
+	StatusServerTransferProhibited,
+}
+
+// 注册商
+type Registrar struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Phone  string `json:"phone,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Status string `json:"status"`
+	// 预付余额，单位分，只能通过充值和计费修改
+	Balance   int64     `json:"balance"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// 联系人，由注册商创建和维护
+type Contact struct {
+	ID          string    `json:"id"`
+	ROID        string    `json:"roid"`
+	RegistrarID string    `json:"registrarId"`
+	Name        string    `json:"name"`
+	Org         string    `json:"org,omitempty"`
+	Street      []string  `json:"street,omitempty"`
+	City        string    `json:"city,omitempty"`
+	Province    string    `json:"province,omitempty"`
+	PostalCode  string    `json:"postalCode,omitempty"`
+	Country     string    `json:"country"`
+	Voice       string    `json:"voice,omitempty"`
+	Fax         string    `json:"fax,omitempty"`
+	Email       string    `json:"email"`
+	AuthInfo    string    `json:"authInfo,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// 名称服务器主机，zone内的主机需要地址作为胶水
+type Host struct {
+	Name        string    `json:"name"`
+	ROID        string    `json:"roid"`
+	RegistrarID string    `json:"registrarId"`
+	Addresses   []string  `json:"addresses,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// 注册的域名，Name为不带末尾点的小写全名，如xyz.chn
+type Domain struct {
+	Name         string   `json:"name"`
+	ROID         string   `json:"roid"`
+	RegistrarID  string   `json:"registrarId"`
+	RegistrantID string   `json:"registrantId"`
+	AdminID      string   `json:"adminId,omitempty"`
+	TechID       string   `json:"techId,omitempty"`
+	BillingID    string   `json:"billingId,omitempty"`
+	NameServers  []string `json:"nameServers,omitempty"`
+	DS           []string `json:"ds,omitempty"`
+	Status       []string `json:"status"`
+	// 转移密码，由管理注册商设置
+	AuthInfo  string    `json:"authInfo,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// 最近一次转移完成的时间
+	TransferredAt time.Time `json:"transferredAt,omitempty"`
+	// 当前生命周期阶段（自动续费宽限期、赎回期、等待删除）结束的时间
+	PhaseEndsAt time.Time `json:"phaseEndsAt,omitempty"`
+	// 注册局锁定的解锁码哈希
+	UnlockHash string `json:"unlockHash,omitempty"`
+}
+
+func (d *Domain) HasStatus(status string) bool {
+	return eppstatus.Contains(d.Status, status)
+}
+
+// 是否应当发布到zone：有NS，没有hold状态，也不在删除流程中
+func (d *Domain) Published() bool {
+	return len(d.NameServers) > 0 && !d.HasStatus(StatusServerHold) && !d.HasStatus(StatusClientHold) && !d.Deleting()
+}
+
+// 是否禁止修改，zone据此拒绝对域名下记录的直接修改
+func (d *Domain) Locked() bool {
+	return d.HasStatus(StatusClientUpdateProhibited) || d.HasStatus(StatusServerUpdateProhibited)
+}
+
+// server或client状态之一存在时返回ErrProhibited
+func (d *Domain) checkProhibited(server string, client string) error {
+	for _, s := range []string{server, client} {
+		if d.HasStatus(s) {
+			return errorf(ErrProhibited, "域名 %s 处于%s状态", d.Name, s)
+		}
+	}
+	return nil
+}
+
+// 是否处于删除后的赎回期或等待删除阶段
+func (d *Domain) Deleting() bool {
+	return d.HasStatus(StatusRedemptionPeriod) || d.HasStatus(StatusPendingDelete)
+}
+
+func (d *Domain) removeStatus(status string) {
+	var list []string
+	for _, s := range d.Status {
+		if s != status {
+			list = append(list, s)
+		}
+	}
+	d.Status = list
+}
+
+// 根据NS和hold状态重新计算ok/inactive
+func (d *Domain) normalizeStatus() {
+	var list []string
+	for _, s := range d.Status {
+		if s != StatusOK && s != StatusInactive {
+			list = append(list, s)
+		}
+	}
+	if len(d.NameServers) == 0 {
+		list = append(list, StatusInactive)
+	}
+	if len(list) == 0 {
+		list = append(list, StatusOK)
+	}
+	d.Status = list
+}
+
+// 持久化的全部数据
+type data struct {
+	// 生成ROID用的序号
+	Sequence   uint64                `json:"sequence"`
+	Registrars map[string]*Registrar `json:"registrars"`
+	Contacts   map[string]*Contact   `json:"contacts"`
+	Hosts      map[string]*Host      `json:"hosts"`
+	Domains    map[string]*Domain    `json:"domains"`
+	// 注册商登录密码的哈希
+	Credentials map[string]string `json:"credentials"`
+	// 进行中和已结束的转移，key为域名
+	Transfers map[string]*Transfer `json:"transfers"`
+	// 注册商的轮询消息队列
+	Messages []*Message `json:"messages"`
+	// 宽限期内可以退回的扣费，key为域名
+	Grace map[string][]*graceCharge `json:"grace"`
+	// 商标库，key为商标ID
+	Marks map[string]*Mark `json:"marks"`
+	// 开放注册前的域名申请，key为申请ID
+	Applications map[string]*Application `json:"applications"`
+}
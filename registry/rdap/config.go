@@ -0,0 +1,45 @@
+package rdap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// RDAP配置，对应config.yaml中的rdap节点
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// 路由前缀，如/rdap，对应/rdap/domain/xyz.chn
+	Prefix string `json:"prefix"`
+	// 响应中链接使用的外部地址，如https://rdap.example/rdap，为空时按请求的Host生成
+	BaseURL string `json:"baseURL"`
+	// 服务条款的链接，放在notices中
+	TermsURL string `json:"termsURL"`
+	// 搜索最多返回的结果数
+	SearchLimit int `json:"searchLimit"`
+}
+
+// 读取rdap配置并补齐默认值
+func LoadConfig(ctx context.Context) (Config, error) {
+	cfg := Config{
+		Prefix:      "/rdap",
+		SearchLimit: 100,
+	}
+	v, err := g.Cfg().Get(ctx, "rdap")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	cfg.Prefix = "/" + strings.Trim(cfg.Prefix, "/")
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	if cfg.SearchLimit < 1 {
+		return cfg, fmt.Errorf("rdap.searchLimit 必须大于0")
+	}
+	return cfg, nil
+}
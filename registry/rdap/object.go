@@ -0,0 +1,236 @@
+package rdap
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"newCHNTLDManager/registry"
+
+	"golang.org/x/net/idna"
+)
+
+// RFC 9083定义的响应对象，只包含本注册局用到的成员
+
+type link struct {
+	Value string `json:"value,omitempty"`
+	Rel   string `json:"rel"`
+	Href  string `json:"href"`
+	Type  string `json:"type,omitempty"`
+}
+
+type notice struct {
+	Title       string   `json:"title,omitempty"`
+	Description []string `json:"description"`
+	Links       []link   `json:"links,omitempty"`
+}
+
+type event struct {
+	Action string `json:"eventAction"`
+	Actor  string `json:"eventActor,omitempty"`
+	Date   string `json:"eventDate"`
+}
+
+type publicID struct {
+	Type       string `json:"type"`
+	Identifier string `json:"identifier"`
+}
+
+type entity struct {
+	ObjectClassName string        `json:"objectClassName"`
+	Handle          string        `json:"handle"`
+	VCardArray      []interface{} `json:"vcardArray,omitempty"`
+	Roles           []string      `json:"roles,omitempty"`
+	PublicIDs       []publicID    `json:"publicIds,omitempty"`
+	Status          []string      `json:"status,omitempty"`
+	Events          []event       `json:"events,omitempty"`
+	Links           []link        `json:"links,omitempty"`
+}
+
+type ipAddresses struct {
+	V4 []string `json:"v4,omitempty"`
+	V6 []string `json:"v6,omitempty"`
+}
+
+type nameserver struct {
+	ObjectClassName string       `json:"objectClassName"`
+	Handle          string       `json:"handle,omitempty"`
+	LDHName         string       `json:"ldhName"`
+	UnicodeName     string       `json:"unicodeName,omitempty"`
+	IPAddresses     *ipAddresses `json:"ipAddresses,omitempty"`
+	Status          []string     `json:"status,omitempty"`
+	Entities        []entity     `json:"entities,omitempty"`
+	Events          []event      `json:"events,omitempty"`
+	Links           []link       `json:"links,omitempty"`
+}
+
+type dsData struct {
+	KeyTag     int    `json:"keyTag"`
+	Algorithm  int    `json:"algorithm"`
+	DigestType int    `json:"digestType"`
+	Digest     string `json:"digest"`
+}
+
+type secureDNS struct {
+	DelegationSigned bool     `json:"delegationSigned"`
+	DSData           []dsData `json:"dsData,omitempty"`
+}
+
+type domain struct {
+	ObjectClassName string       `json:"objectClassName"`
+	Handle          string       `json:"handle"`
+	LDHName         string       `json:"ldhName"`
+	UnicodeName     string       `json:"unicodeName,omitempty"`
+	Status          []string     `json:"status"`
+	Entities        []entity     `json:"entities,omitempty"`
+	Nameservers     []nameserver `json:"nameservers,omitempty"`
+	SecureDNS       *secureDNS   `json:"secureDNS,omitempty"`
+	Events          []event      `json:"events"`
+	Links           []link       `json:"links"`
+}
+
+// RFC 9537：说明响应中被隐藏的字段
+type redactedField struct {
+	Name   redactedName `json:"name"`
+	Reason redactedName `json:"reason"`
+	Method string       `json:"method"`
+}
+
+type redactedName struct {
+	Description string `json:"description"`
+}
+
+type errorResponse struct {
+	Conformance []string `json:"rdapConformance"`
+	ErrorCode   int      `json:"errorCode"`
+	Title       string   `json:"title"`
+	Description []string `json:"description,omitempty"`
+}
+
+// EPP状态到RDAP状态(RFC 8056)，未列出的按驼峰拆成小写单词，如pendingDelete为pending delete
+var statusNames = map[string]string{
+	registry.StatusOK: "active",
+}
+
+func mapStatus(list []string) []string {
+	var res []string
+	for _, s := range list {
+		if name, ok := statusNames[s]; ok {
+			res = append(res, name)
+			continue
+		}
+		var b strings.Builder
+		for i, c := range s {
+			if unicode.IsUpper(c) && i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(unicode.ToLower(c))
+		}
+		res = append(res, b.String())
+	}
+	return res
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// 返回名字的A-label和U-label形式，U-label与A-label相同时为空
+func idnNames(name string) (string, string) {
+	ldh, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		ldh = name
+	}
+	unicodeName, err := idna.Lookup.ToUnicode(ldh)
+	if err != nil || unicodeName == ldh {
+		unicodeName = ""
+	}
+	return ldh, unicodeName
+}
+
+// 查询时可能匹配的写法：原样、A-label、U-label，注册数据中两种形式都可能出现
+func lookupNames(name string) []string {
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	names := []string{name}
+	if ldh, err := idna.Lookup.ToASCII(name); err == nil && ldh != name {
+		names = append(names, ldh)
+	}
+	if u, err := idna.Lookup.ToUnicode(name); err == nil && u != name {
+		names = append(names, u)
+	}
+	return names
+}
+
+// DS记录文本"keytag alg digesttype digest"
+func parseDS(ds string) (dsData, bool) {
+	items := strings.Fields(ds)
+	if len(items) < 4 {
+		return dsData{}, false
+	}
+	keyTag, err1 := strconv.Atoi(items[0])
+	alg, err2 := strconv.Atoi(items[1])
+	digestType, err3 := strconv.Atoi(items[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return dsData{}, false
+	}
+	return dsData{KeyTag: keyTag, Algorithm: alg, DigestType: digestType, Digest: strings.Join(items[3:], "")}, true
+}
+
+// jCard(RFC 7095)格式的联系信息，值为RedactedText的字段不输出
+func contactVCard(c registry.Contact) []interface{} {
+	props := []interface{}{[]interface{}{"version", map[string]string{}, "text", "4.0"}}
+	add := func(name string, params map[string]string, typ string, value interface{}) {
+		if s, ok := value.(string); ok && (s == "" || s == registry.RedactedText) {
+			return
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		props = append(props, []interface{}{name, params, typ, value})
+	}
+	redacted := func(s string) string {
+		if s == registry.RedactedText {
+			return ""
+		}
+		return s
+	}
+	// vCard必须有fn，隐藏时输出空值
+	props = append(props, []interface{}{"fn", map[string]string{}, "text", redacted(c.Name)})
+	add("org", nil, "text", c.Org)
+	street := strings.Join(c.Street, "\n")
+	if len(c.Street) == 1 && c.Street[0] == registry.RedactedText {
+		street = ""
+	}
+	// adr的七个部分：邮箱、扩展地址、街道、城市、省份、邮编、国家
+	props = append(props, []interface{}{"adr", map[string]string{"cc": c.Country}, "text",
+		[]string{"", "", street, redacted(c.City), c.Province, redacted(c.PostalCode), ""}})
+	add("tel", map[string]string{"type": "voice"}, "uri", telURI(c.Voice))
+	add("tel", map[string]string{"type": "fax"}, "uri", telURI(c.Fax))
+	add("email", nil, "text", c.Email)
+	return []interface{}{"vcard", props}
+}
+
+func registrarVCard(r registry.Registrar) []interface{} {
+	props := []interface{}{
+		[]interface{}{"version", map[string]string{}, "text", "4.0"},
+		[]interface{}{"fn", map[string]string{}, "text", r.Name},
+	}
+	if r.Email != "" {
+		props = append(props, []interface{}{"email", map[string]string{}, "text", r.Email})
+	}
+	if r.Phone != "" {
+		props = append(props, []interface{}{"tel", map[string]string{"type": "voice"}, "uri", telURI(r.Phone)})
+	}
+	if r.URL != "" {
+		props = append(props, []interface{}{"url", map[string]string{}, "uri", r.URL})
+	}
+	return []interface{}{"vcard", props}
+}
+
+func telURI(number string) string {
+	if number == "" || number == registry.RedactedText {
+		return number
+	}
+	return "tel:" + number
+}
@@ -0,0 +1,521 @@
+package rdap
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"newCHNTLDManager/registry"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+const conformance = "rdap_level_0"
+
+// RFC 9537的redacted扩展
+const conformanceRedacted = "redacted"
+
+// 注册数据的RDAP查询服务（RFC 7480-7484），挂在GoFrame的HTTP服务上
+type Server struct {
+	cfg Config
+	reg *registry.Registry
+}
+
+func NewServer(cfg Config, reg *registry.Registry) *Server {
+	return &Server{cfg: cfg, reg: reg}
+}
+
+// 顶级响应共有的成员
+type response struct {
+	Conformance []string        `json:"rdapConformance"`
+	Notices     []notice        `json:"notices,omitempty"`
+	Redacted    []redactedField `json:"redacted,omitempty"`
+}
+
+type domainResponse struct {
+	response
+	domain
+}
+
+type nameserverResponse struct {
+	response
+	nameserver
+}
+
+type entityResponse struct {
+	response
+	entity
+}
+
+type domainSearchResponse struct {
+	response
+	Results []domain `json:"domainSearchResults"`
+}
+
+type nameserverSearchResponse struct {
+	response
+	Results []nameserver `json:"nameserverSearchResults"`
+}
+
+type entitySearchResponse struct {
+	response
+	Results []entity `json:"entitySearchResults"`
+}
+
+// 注册路由
+func (s *Server) Bind(server *ghttp.Server) {
+	p := s.cfg.Prefix
+	server.BindHandler("GET:"+p+"/domain/{name}", s.domain)
+	server.BindHandler("GET:"+p+"/nameserver/{name}", s.nameserver)
+	server.BindHandler("GET:"+p+"/entity/{handle}", s.entity)
+	server.BindHandler("GET:"+p+"/help", s.help)
+	server.BindHandler("GET:"+p+"/domains", s.searchDomains)
+	server.BindHandler("GET:"+p+"/nameservers", s.searchNameservers)
+	server.BindHandler("GET:"+p+"/entities", s.searchEntities)
+}
+
+func (s *Server) write(r *ghttp.Request, status int, body interface{}) {
+	content, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		content, _ = json.Marshal(errorResponse{Conformance: []string{conformance}, ErrorCode: status, Title: "Internal Server Error"})
+	}
+	r.Response.Header().Set("Content-Type", "application/rdap+json")
+	r.Response.Header().Set("Access-Control-Allow-Origin", "*")
+	r.Response.WriteHeader(status)
+	r.Response.Write(content)
+}
+
+func (s *Server) writeError(r *ghttp.Request, status int, description string) {
+	res := errorResponse{
+		Conformance: []string{conformance},
+		ErrorCode:   status,
+		Title:       http.StatusText(status),
+	}
+	if description != "" {
+		res.Description = []string{description}
+	}
+	s.write(r, status, res)
+}
+
+func (s *Server) newResponse(redacted []redactedField) response {
+	res := response{Conformance: []string{conformance}, Notices: s.notices(), Redacted: redacted}
+	if s.reg.Config().Redact {
+		res.Conformance = append(res.Conformance, conformanceRedacted)
+	}
+	return res
+}
+
+func (s *Server) notices() []notice {
+	terms := notice{
+		Title:       "Terms of Use",
+		Description: []string{"The data is provided for information purposes only. Personal data of contacts may be redacted."},
+	}
+	if s.cfg.TermsURL != "" {
+		terms.Links = []link{{Rel: "terms-of-service", Href: s.cfg.TermsURL, Type: "text/html"}}
+	}
+	return []notice{terms}
+}
+
+// 响应中链接的前缀
+func (s *Server) baseURL(r *ghttp.Request) string {
+	if s.cfg.BaseURL != "" {
+		return s.cfg.BaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.cfg.Prefix
+}
+
+// ---------- 查询 ----------
+
+func (s *Server) domain(r *ghttp.Request) {
+	name := r.Get("name").String()
+	for _, candidate := range lookupNames(name) {
+		if dom, err := s.reg.GetDomain(candidate); err == nil {
+			obj, redacted := s.domainObject(s.baseURL(r), *dom)
+			s.write(r, http.StatusOK, domainResponse{response: s.newResponse(redacted), domain: obj})
+			return
+		}
+	}
+	s.writeError(r, http.StatusNotFound, "domain "+name+" not found")
+}
+
+func (s *Server) nameserver(r *ghttp.Request) {
+	name := r.Get("name").String()
+	for _, candidate := range lookupNames(name) {
+		if host, err := s.reg.GetHost(candidate); err == nil {
+			obj := s.nameserverObject(s.baseURL(r), host.Name, host)
+			s.write(r, http.StatusOK, nameserverResponse{response: s.newResponse(nil), nameserver: obj})
+			return
+		}
+	}
+	s.writeError(r, http.StatusNotFound, "nameserver "+name+" not found")
+}
+
+// handle可以是注册商ID或联系人ID
+func (s *Server) entity(r *ghttp.Request) {
+	handle := r.Get("handle").String()
+	base := s.baseURL(r)
+	if registrar, err := s.reg.GetRegistrar(handle); err == nil {
+		obj := s.registrarEntity(base, *registrar)
+		s.write(r, http.StatusOK, entityResponse{response: s.newResponse(nil), entity: obj})
+		return
+	}
+	if contact, err := s.reg.PublicContact(handle); err == nil {
+		obj := s.contactEntity(base, *contact, nil)
+		s.write(r, http.StatusOK, entityResponse{response: s.newResponse(redactedFields("", *contact)), entity: obj})
+		return
+	}
+	s.writeError(r, http.StatusNotFound, "entity "+handle+" not found")
+}
+
+func (s *Server) help(r *ghttp.Request) {
+	res := s.newResponse(nil)
+	res.Notices = append(res.Notices, notice{
+		Title: "Supported Queries",
+		Description: []string{
+			"domain/<name>, nameserver/<name>, entity/<handle>",
+			"domains?name=<pattern>, domains?nsLdhName=<pattern>, domains?nsIp=<ip>",
+			"nameservers?name=<pattern>, nameservers?ip=<ip>",
+			"entities?handle=<pattern>, entities?fn=<pattern>",
+			"Patterns may contain * to match any characters. Internationalized names may be given as U-labels or A-labels.",
+		},
+	})
+	s.write(r, http.StatusOK, res)
+}
+
+// ---------- 搜索 ----------
+
+func (s *Server) searchDomains(r *ghttp.Request) {
+	name, nsName, nsIP := r.GetQuery("name").String(), r.GetQuery("nsLdhName").String(), r.GetQuery("nsIp").String()
+	var match func(dom registry.Domain) bool
+	switch {
+	case name != "":
+		match = func(dom registry.Domain) bool {
+			return matchName(name, dom.Name)
+		}
+	case nsName != "":
+		match = func(dom registry.Domain) bool {
+			for _, ns := range dom.NameServers {
+				if matchName(nsName, ns) {
+					return true
+				}
+			}
+			return false
+		}
+	case nsIP != "":
+		ip := net.ParseIP(nsIP)
+		if ip == nil {
+			s.writeError(r, http.StatusBadRequest, "invalid nsIp "+nsIP)
+			return
+		}
+		hosts := map[string]bool{}
+		for _, host := range s.reg.ListHosts("") {
+			if hasAddress(host, ip) {
+				hosts[host.Name] = true
+			}
+		}
+		match = func(dom registry.Domain) bool {
+			for _, ns := range dom.NameServers {
+				if hosts[ns] {
+					return true
+				}
+			}
+			return false
+		}
+	default:
+		s.writeError(r, http.StatusBadRequest, "one of name, nsLdhName or nsIp is required")
+		return
+	}
+	base := s.baseURL(r)
+	res := domainSearchResponse{Results: []domain{}}
+	var redacted []redactedField
+	truncated := false
+	for _, dom := range s.reg.ListDomains("") {
+		if !match(dom) {
+			continue
+		}
+		if len(res.Results) == s.cfg.SearchLimit {
+			truncated = true
+			break
+		}
+		obj, fields := s.domainObject(base, dom)
+		res.Results = append(res.Results, obj)
+		redacted = append(redacted, fields...)
+	}
+	res.response = s.searchResponse(truncated, dedupRedacted(redacted))
+	s.write(r, http.StatusOK, res)
+}
+
+func (s *Server) searchNameservers(r *ghttp.Request) {
+	name, ipText := r.GetQuery("name").String(), r.GetQuery("ip").String()
+	var match func(host registry.Host) bool
+	switch {
+	case name != "":
+		match = func(host registry.Host) bool {
+			return matchName(name, host.Name)
+		}
+	case ipText != "":
+		ip := net.ParseIP(ipText)
+		if ip == nil {
+			s.writeError(r, http.StatusBadRequest, "invalid ip "+ipText)
+			return
+		}
+		match = func(host registry.Host) bool {
+			return hasAddress(host, ip)
+		}
+	default:
+		s.writeError(r, http.StatusBadRequest, "one of name or ip is required")
+		return
+	}
+	base := s.baseURL(r)
+	res := nameserverSearchResponse{Results: []nameserver{}}
+	truncated := false
+	for _, host := range s.reg.ListHosts("") {
+		if !match(host) {
+			continue
+		}
+		if len(res.Results) == s.cfg.SearchLimit {
+			truncated = true
+			break
+		}
+		h := host
+		res.Results = append(res.Results, s.nameserverObject(base, host.Name, &h))
+	}
+	res.response = s.searchResponse(truncated, nil)
+	s.write(r, http.StatusOK, res)
+}
+
+// 只搜索注册商，联系人属于个人信息，不提供搜索
+func (s *Server) searchEntities(r *ghttp.Request) {
+	handle, fn := r.GetQuery("handle").String(), r.GetQuery("fn").String()
+	if handle == "" && fn == "" {
+		s.writeError(r, http.StatusBadRequest, "one of handle or fn is required")
+		return
+	}
+	base := s.baseURL(r)
+	res := entitySearchResponse{Results: []entity{}}
+	truncated := false
+	for _, registrar := range s.reg.ListRegistrars() {
+		if handle != "" && !matchPattern(handle, registrar.ID) || fn != "" && !matchPattern(fn, registrar.Name) {
+			continue
+		}
+		if len(res.Results) == s.cfg.SearchLimit {
+			truncated = true
+			break
+		}
+		res.Results = append(res.Results, s.registrarEntity(base, registrar))
+	}
+	res.response = s.searchResponse(truncated, nil)
+	s.write(r, http.StatusOK, res)
+}
+
+func (s *Server) searchResponse(truncated bool, redacted []redactedField) response {
+	res := s.newResponse(redacted)
+	if truncated {
+		res.Notices = append(res.Notices, notice{
+			Title:       "Search Policy",
+			Description: []string{"Search results are limited to " + strconv.Itoa(s.cfg.SearchLimit) + " objects."},
+		})
+	}
+	return res
+}
+
+// 名字匹配，pattern可以是U-label或A-label，*匹配任意字符
+func matchName(pattern string, name string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	ldh, unicodeName := idnNames(name)
+	return matchPattern(pattern, name) || matchPattern(pattern, ldh) || unicodeName != "" && matchPattern(pattern, unicodeName)
+}
+
+func matchPattern(pattern string, value string) bool {
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return err == nil && ok
+}
+
+func hasAddress(host registry.Host, ip net.IP) bool {
+	for _, a := range host.Addresses {
+		if addr := net.ParseIP(a); addr != nil && addr.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------- 对象 ----------
+
+func (s *Server) domainObject(base string, dom registry.Domain) (domain, []redactedField) {
+	ldh, unicodeName := idnNames(dom.Name)
+	obj := domain{
+		ObjectClassName: "domain",
+		Handle:          dom.ROID,
+		LDHName:         ldh,
+		UnicodeName:     unicodeName,
+		Status:          mapStatus(dom.Status),
+		Links:           []link{{Value: base + "/domain/" + ldh, Rel: "self", Href: base + "/domain/" + ldh, Type: "application/rdap+json"}},
+		Events: []event{
+			{Action: "registration", Date: formatTime(dom.CreatedAt)},
+			{Action: "expiration", Date: formatTime(dom.ExpiresAt)},
+			{Action: "last changed", Date: formatTime(dom.UpdatedAt)},
+			{Action: "last update of RDAP database", Date: formatTime(time.Now())},
+		},
+	}
+	if !dom.TransferredAt.IsZero() {
+		obj.Events = append(obj.Events, event{Action: "transfer", Date: formatTime(dom.TransferredAt)})
+	}
+	if registrar, err := s.reg.GetRegistrar(dom.RegistrarID); err == nil {
+		obj.Entities = append(obj.Entities, s.registrarEntity(base, *registrar))
+	}
+
+	// 同一联系人担任多个角色时合并为一个实体
+	var redacted []redactedField
+	var order []string
+	roles := map[string][]string{}
+	for _, item := range []struct{ role, id string }{
+		{"registrant", dom.RegistrantID},
+		{"administrative", dom.AdminID},
+		{"technical", dom.TechID},
+		{"billing", dom.BillingID},
+	} {
+		if item.id == "" {
+			continue
+		}
+		if roles[item.id] == nil {
+			order = append(order, item.id)
+		}
+		roles[item.id] = append(roles[item.id], item.role)
+	}
+	for _, id := range order {
+		contact, err := s.reg.PublicContact(id)
+		if err != nil {
+			continue
+		}
+		obj.Entities = append(obj.Entities, s.contactEntity(base, *contact, roles[id]))
+		for _, role := range roles[id] {
+			redacted = append(redacted, redactedFields(role, *contact)...)
+		}
+	}
+
+	for _, ns := range dom.NameServers {
+		host, err := s.reg.GetHost(ns)
+		if err != nil {
+			host = nil
+		}
+		obj.Nameservers = append(obj.Nameservers, s.nameserverObject(base, ns, host))
+	}
+	obj.SecureDNS = &secureDNS{DelegationSigned: len(dom.DS) > 0}
+	for _, ds := range dom.DS {
+		if d, ok := parseDS(ds); ok {
+			obj.SecureDNS.DSData = append(obj.SecureDNS.DSData, d)
+		}
+	}
+	return obj, redacted
+}
+
+// host为nil时只输出名字
+func (s *Server) nameserverObject(base string, name string, host *registry.Host) nameserver {
+	ldh, unicodeName := idnNames(name)
+	obj := nameserver{
+		ObjectClassName: "nameserver",
+		LDHName:         ldh,
+		UnicodeName:     unicodeName,
+		Links:           []link{{Value: base + "/nameserver/" + ldh, Rel: "self", Href: base + "/nameserver/" + ldh, Type: "application/rdap+json"}},
+	}
+	if host == nil {
+		return obj
+	}
+	obj.Handle = host.ROID
+	obj.Status = []string{"active"}
+	for _, a := range host.Addresses {
+		if obj.IPAddresses == nil {
+			obj.IPAddresses = &ipAddresses{}
+		}
+		if ip := net.ParseIP(a); ip != nil && ip.To4() != nil {
+			obj.IPAddresses.V4 = append(obj.IPAddresses.V4, a)
+		} else {
+			obj.IPAddresses.V6 = append(obj.IPAddresses.V6, a)
+		}
+	}
+	obj.Events = []event{
+		{Action: "registration", Date: formatTime(host.CreatedAt)},
+		{Action: "last changed", Date: formatTime(host.UpdatedAt)},
+	}
+	return obj
+}
+
+func (s *Server) registrarEntity(base string, registrar registry.Registrar) entity {
+	status := "active"
+	if registrar.Status != registry.StatusOK {
+		status = "inactive"
+	}
+	return entity{
+		ObjectClassName: "entity",
+		Handle:          registrar.ID,
+		VCardArray:      registrarVCard(registrar),
+		Roles:           []string{"registrar"},
+		Status:          []string{status},
+		Links:           []link{{Value: base + "/entity/" + registrar.ID, Rel: "self", Href: base + "/entity/" + registrar.ID, Type: "application/rdap+json"}},
+	}
+}
+
+// contact应是PublicContact返回的已按配置隐藏个人信息的副本
+func (s *Server) contactEntity(base string, contact registry.Contact, roles []string) entity {
+	return entity{
+		ObjectClassName: "entity",
+		Handle:          contact.ID,
+		VCardArray:      contactVCard(contact),
+		Roles:           roles,
+		Events: []event{
+			{Action: "registration", Date: formatTime(contact.CreatedAt)},
+			{Action: "last changed", Date: formatTime(contact.UpdatedAt)},
+		},
+		Links: []link{{Value: base + "/entity/" + contact.ID, Rel: "self", Href: base + "/entity/" + contact.ID, Type: "application/rdap+json"}},
+	}
+}
+
+// 列出联系人中被隐藏的字段，role为空时表示单独查询的联系人
+func redactedFields(role string, c registry.Contact) []redactedField {
+	prefix := "Contact"
+	if role != "" {
+		prefix = strings.ToUpper(role[:1]) + role[1:]
+	}
+	var res []redactedField
+	add := func(field string, value string, method string) {
+		if value == registry.RedactedText {
+			res = append(res, redactedField{
+				Name:   redactedName{Description: prefix + " " + field},
+				Reason: redactedName{Description: "Server policy"},
+				Method: method,
+			})
+		}
+	}
+	add("Name", c.Name, "emptyValue")
+	if len(c.Street) > 0 {
+		add("Street", c.Street[0], "removal")
+	}
+	add("City", c.City, "removal")
+	add("Postal Code", c.PostalCode, "removal")
+	add("Phone", c.Voice, "removal")
+	add("Fax", c.Fax, "removal")
+	add("Email", c.Email, "removal")
+	return res
+}
+
+func dedupRedacted(list []redactedField) []redactedField {
+	seen := map[string]bool{}
+	var res []redactedField
+	for _, f := range list {
+		if !seen[f.Name.Description] {
+			seen[f.Name.Description] = true
+			res = append(res, f)
+		}
+	}
+	return res
+}
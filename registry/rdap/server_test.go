@@ -0,0 +1,224 @@
+package rdap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"newCHNTLDManager/registry"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+type nopZone struct{}
+
+func (nopZone) PublishDelegation(string, []string, map[string][]string, []string) error { return nil }
+func (nopZone) WithdrawDelegation(string) error                                         { return nil }
+func (nopZone) PurgeDomain(string) error                                                { return nil }
+func (nopZone) Commit() error                                                           { return nil }
+func (nopZone) Rollback()                                                               {}
+func (nopZone) SetDomainLock(string, bool) error                                        { return nil }
+
+// reg1管理example.chn和中国.chn，注册人C001，NS为ns1.example.net
+func newTestRegistry(t *testing.T, redact bool) *registry.Registry {
+	t.Helper()
+	reg, err := registry.New(registry.Config{DataFile: filepath.Join(t.TempDir(), "registry.json"), TLD: "chn", DefaultPeriod: 1, MaxPeriod: 10, Redact: redact}, nopZone{})
+	if err != nil {
+		t.Fatalf("registry.New: %v", err)
+	}
+	if _, err = reg.CreateRegistrar(registry.Registrar{ID: "reg1", Name: "Example Registrar", Email: "abuse@registrar.example"}); err != nil {
+		t.Fatalf("CreateRegistrar: %v", err)
+	}
+	contact := registry.Contact{ID: "C001", RegistrarID: "reg1", Name: "Zhang San", Org: "Example Org", Street: []string{"1 Main St"}, City: "Beijing", Country: "cn", Voice: "+86.1012345678", Email: "zhang@example.com", AuthInfo: "contact-secret"}
+	if _, err = reg.CreateContact(contact); err != nil {
+		t.Fatalf("CreateContact: %v", err)
+	}
+	if _, err = reg.CreateHost(registry.Host{Name: "ns1.example.net", RegistrarID: "reg1"}); err != nil {
+		t.Fatalf("CreateHost: %v", err)
+	}
+	for _, name := range []string{"example.chn", "中国.chn"} {
+		dom := registry.Domain{Name: name, RegistrarID: "reg1", RegistrantID: "C001", TechID: "C001", NameServers: []string{"ns1.example.net"}}
+		if _, err = reg.CreateDomain(dom, 1, false, ""); err != nil {
+			t.Fatalf("CreateDomain %s: %v", name, err)
+		}
+	}
+	return reg
+}
+
+// GoFrame按名字复用server，每次测试使用新的名字
+var testServers int32
+
+// 在随机端口上启动RDAP服务，返回地址前缀
+func startTestServer(t *testing.T, reg *registry.Registry) string {
+	t.Helper()
+	server := g.Server(fmt.Sprint("rdap-test-", atomic.AddInt32(&testServers, 1)))
+	server.SetAddr("127.0.0.1:0")
+	server.SetDumpRouterMap(false)
+	NewServer(Config{Prefix: "/rdap", SearchLimit: 1}, reg).Bind(server)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return fmt.Sprintf("http://127.0.0.1:%d/rdap", server.GetListenedPort())
+}
+
+func get(t *testing.T, url string) (int, map[string]interface{}) {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer res.Body.Close()
+	content, _ := io.ReadAll(res.Body)
+	var body map[string]interface{}
+	if err = json.Unmarshal(content, &body); err != nil {
+		t.Fatalf("GET %s 返回的不是JSON: %s", url, content)
+	}
+	return res.StatusCode, body
+}
+
+// U-label、A-label、大小写和末尾点都能查到同一个域名
+func TestDomainLookup(t *testing.T) {
+	base := startTestServer(t, newTestRegistry(t, true))
+	tests := []struct {
+		path        string
+		status      int
+		ldhName     string
+		unicodeName string
+	}{
+		{"/domain/example.chn", http.StatusOK, "example.chn", ""},
+		{"/domain/EXAMPLE.CHN.", http.StatusOK, "example.chn", ""},
+		{"/domain/xn--fiqs8s.chn", http.StatusOK, "xn--fiqs8s.chn", "中国.chn"},
+		{"/domain/中国.chn", http.StatusOK, "xn--fiqs8s.chn", "中国.chn"},
+		{"/domain/XN--FIQS8S.CHN", http.StatusOK, "xn--fiqs8s.chn", "中国.chn"},
+		{"/domain/other.chn", http.StatusNotFound, "", ""},
+		{"/nameserver/NS1.example.net", http.StatusOK, "ns1.example.net", ""},
+		{"/nameserver/ns2.example.net", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		status, body := get(t, base+tt.path)
+		if status != tt.status {
+			t.Errorf("%s 返回%d，应为%d: %v", tt.path, status, tt.status, body)
+			continue
+		}
+		if status != http.StatusOK {
+			if body["errorCode"] != float64(tt.status) {
+				t.Errorf("%s 的errorCode为%v", tt.path, body["errorCode"])
+			}
+			continue
+		}
+		if body["ldhName"] != tt.ldhName || (body["unicodeName"] != nil || tt.unicodeName != "") && body["unicodeName"] != tt.unicodeName {
+			t.Errorf("%s 返回 ldhName=%v unicodeName=%v，应为 %s %s", tt.path, body["ldhName"], body["unicodeName"], tt.ldhName, tt.unicodeName)
+		}
+	}
+}
+
+// 隐藏个人信息时，联系人的vCard中没有这些字段，redacted中列出被隐藏的字段，authInfo总是不输出
+func TestDomainRedaction(t *testing.T) {
+	tests := []struct {
+		redact       bool
+		wantRedacted []string
+		notWant      []string
+		want         []string
+	}{
+		{
+			redact:       true,
+			wantRedacted: []string{"Registrant Name", "Registrant Street", "Registrant City", "Registrant Phone", "Registrant Email", "Technical Name", "Technical Street", "Technical City", "Technical Phone", "Technical Email"},
+			notWant:      []string{"Zhang San", "zhang@example.com", "Beijing", "1 Main St", "+86.1012345678", "secret"},
+			want:         []string{"Example Org", conformanceRedacted},
+		},
+		{
+			redact:  false,
+			notWant: []string{registry.RedactedText, "secret"},
+			want:    []string{"Zhang San", "zhang@example.com", "Beijing", "tel:+86.1012345678"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint("redact=", tt.redact), func(t *testing.T) {
+			s := NewServer(Config{}, newTestRegistry(t, tt.redact))
+			dom, err := s.reg.GetDomain("example.chn")
+			if err != nil {
+				t.Fatalf("GetDomain: %v", err)
+			}
+			obj, redacted := s.domainObject("https://rdap.example", *dom)
+			content, _ := json.Marshal(domainResponse{response: s.newResponse(dedupRedacted(redacted)), domain: obj})
+			for _, want := range tt.want {
+				if !strings.Contains(string(content), want) {
+					t.Errorf("响应中没有 %q", want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(string(content), notWant) {
+					t.Errorf("响应中不应有 %q", notWant)
+				}
+			}
+			var got []string
+			for _, f := range dedupRedacted(redacted) {
+				got = append(got, f.Name.Description)
+			}
+			if !reflect.DeepEqual(got, tt.wantRedacted) {
+				t.Errorf("redacted为 %v，应为 %v", got, tt.wantRedacted)
+			}
+			// 同一联系人担任注册人和技术联系人时合并为一个实体
+			if len(obj.Entities) != 2 || !reflect.DeepEqual(obj.Entities[1].Roles, []string{"registrant", "technical"}) {
+				t.Errorf("实体为 %+v", obj.Entities)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	base := startTestServer(t, newTestRegistry(t, true))
+	tests := []struct {
+		path    string
+		status  int
+		results string
+		count   int
+		// 超过searchLimit时有Search Policy说明
+		truncated bool
+	}{
+		{"/domains?name=exam*", http.StatusOK, "domainSearchResults", 1, false},
+		{"/domains?name=中*.chn", http.StatusOK, "domainSearchResults", 1, false},
+		{"/domains?name=xn--fiqs8s.chn", http.StatusOK, "domainSearchResults", 1, false},
+		{"/domains?name=*.chn", http.StatusOK, "domainSearchResults", 1, true},
+		{"/domains?name=none*", http.StatusOK, "domainSearchResults", 0, false},
+		{"/domains?nsIp=bad", http.StatusBadRequest, "", 0, false},
+		{"/domains", http.StatusBadRequest, "", 0, false},
+		{"/nameservers?name=ns1.*", http.StatusOK, "nameserverSearchResults", 1, false},
+		{"/entities?fn=example*", http.StatusOK, "entitySearchResults", 1, false},
+		// 联系人不能搜索
+		{"/entities?handle=C001", http.StatusOK, "entitySearchResults", 0, false},
+	}
+	for _, tt := range tests {
+		status, body := get(t, base+tt.path)
+		if status != tt.status {
+			t.Errorf("%s 返回%d，应为%d", tt.path, status, tt.status)
+			continue
+		}
+		if tt.results == "" {
+			continue
+		}
+		results, _ := body[tt.results].([]interface{})
+		if len(results) != tt.count {
+			t.Errorf("%s 返回%d个结果，应为%d个", tt.path, len(results), tt.count)
+		}
+		notices, _ := json.Marshal(body["notices"])
+		if strings.Contains(string(notices), "Search Policy") != tt.truncated {
+			t.Errorf("%s 的notices为 %s", tt.path, notices)
+		}
+	}
+}
+
+func TestMapStatus(t *testing.T) {
+	got := mapStatus([]string{registry.StatusOK, registry.StatusPendingDelete, registry.StatusClientTransferProhibited})
+	want := []string{"active", "pending delete", "client transfer prohibited"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mapStatus = %v，应为 %v", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package registry
+
+// 公开查询中替代被隐藏字段的文字
+const RedactedText = "REDACTED FOR PRIVACY"
+
+// 隐藏个人信息后的联系人副本，只保留组织、省份和国家，供WHOIS、RDAP共用
+func (c Contact) Redacted() Contact {
+	res := Contact{
+		ID:          c.ID,
+		ROID:        c.ROID,
+		RegistrarID: c.RegistrarID,
+		Name:        RedactedText,
+		Org:         c.Org,
+		Province:    c.Province,
+		Country:     c.Country,
+		Email:       RedactedText,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+	}
+	if len(c.Street) > 0 {
+		res.Street = []string{RedactedText}
+	}
+	if c.City != "" {
+		res.City = RedactedText
+	}
+	if c.PostalCode != "" {
+		res.PostalCode = RedactedText
+	}
+	if c.Voice != "" {
+		res.Voice = RedactedText
+	}
+	if c.Fax != "" {
+		res.Fax = RedactedText
+	}
+	return res
+}
+
+// 公开查询使用的联系人信息，按配置隐藏个人信息，authInfo总是去掉
+func (r *Registry) PublicContact(id string) (*Contact, error) {
+	c, err := r.GetContact(id)
+	if err != nil {
+		return nil, err
+	}
+	c.AuthInfo = ""
+	if r.cfg.Redact {
+		redacted := c.Redacted()
+		c = &redacted
+	}
+	return c, nil
+}
@@ -0,0 +1,945 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"newCHNTLDManager/dns/idn"
+	"newCHNTLDManager/dns/policy"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 注册局配置，对应config.yaml中的registry节点
+type Config struct {
+	// 注册数据文件
+	DataFile string `json:"dataFile"`
+	// 顶级域，不带点
+	TLD string `json:"tld"`
+	// 注册年限，单位年
+	DefaultPeriod int `json:"defaultPeriod"`
+	MaxPeriod     int `json:"maxPeriod"`
+	// WHOIS、RDAP等公开查询是否隐藏联系人的个人信息
+	Redact bool `json:"redact"`
+	// 到期和删除的处理
+	Lifecycle LifecycleConfig `json:"lifecycle"`
+	// 注册商之间的转移
+	Transfer TransferConfig `json:"transfer"`
+	// 注册商余额和计费
+	Billing BillingConfig `json:"billing"`
+	// 开放注册前的sunrise、landrush阶段和商标声明
+	Launch LaunchConfig `json:"launch"`
+}
+
+// 读取registry配置并补齐默认值
+func LoadConfig(ctx context.Context) (Config, error) {
+	cfg := defaultConfig()
+	v, err := g.Cfg().Get(ctx, "registry")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, cfg.parse()
+}
+
+// 默认配置，配置文件中没有的项使用这些值
+func defaultConfig() Config {
+	return Config{
+		DataFile:      "/var/named/registry/registry.json",
+		TLD:           "chn",
+		DefaultPeriod: 1,
+		MaxPeriod:     10,
+		Redact:        true,
+		Lifecycle: LifecycleConfig{
+			AutoRenew:        true,
+			AutoRenewGrace:   "1080h",
+			RedemptionPeriod: "720h",
+			PendingDelete:    "120h",
+			CheckInterval:    "1h",
+			BatchSize:        100,
+			LogFile:          "/var/named/registry/lifecycle.log",
+		},
+		Transfer: TransferConfig{
+			AutoApprove:      "120h",
+			LockPeriod:       "1440h",
+			CheckInterval:    "10m",
+			AuthInfoLength:   16,
+			AuthInfoAttempts: 10,
+		},
+		Billing: BillingConfig{
+			Currency:      "CNY",
+			LedgerFile:    "/var/named/registry/ledger.jsonl",
+			AddGrace:      "120h",
+			RenewGrace:    "120h",
+			TransferGrace: "120h",
+		},
+		Launch: LaunchConfig{
+			ClaimsPeriod:  "2160h",
+			CheckInterval: "10m",
+		},
+	}
+}
+
+// 检查配置并解析各节点的时长
+func (cfg *Config) parse() error {
+	cfg.TLD = strings.ToLower(strings.Trim(cfg.TLD, "."))
+	if cfg.TLD == "" {
+		return fmt.Errorf("registry.tld 不能为空")
+	}
+	if cfg.DefaultPeriod < 1 || cfg.DefaultPeriod > cfg.MaxPeriod {
+		return fmt.Errorf("registry.defaultPeriod 必须在1到maxPeriod之间")
+	}
+	if err := cfg.Lifecycle.parse(); err != nil {
+		return err
+	}
+	if err := cfg.Transfer.parse(); err != nil {
+		return err
+	}
+	if err := cfg.Billing.parse(); err != nil {
+		return err
+	}
+	return cfg.Launch.parse()
+}
+
+// 注册数据决定zone中发布哪些委派，Zone由zonefile.ChnZone实现。
+// 这些方法只修改内存，Commit后才写入zone文件，Commit失败时zone文件保持不变，Rollback放弃未提交的修改
+type Zone interface {
+	PublishDelegation(domainName string, nameServers []string, glue map[string][]string, ds []string) error
+	WithdrawDelegation(domainName string) error
+	PurgeDomain(domainName string) error
+	Commit() error
+	Rollback()
+	// 同步域名的锁定状态，立即生效，不需要Commit
+	SetDomainLock(domainName string, locked bool) error
+}
+
+// 注册局，所有修改都通过update完成，修改zone的调用方需持有mLock
+type Registry struct {
+	cfg  Config
+	zone Zone
+	lock sync.RWMutex
+	data *data
+	// 保留、禁止、溢价名字，为nil时不限制
+	policy *policy.Table
+	// IDN字符表和变体，为nil时只按IDNA2008检查
+	idn *idn.Table
+	// authInfo校验失败的统计
+	authInfoFailures authInfoLimiter
+}
+
+func New(cfg Config, zone Zone) (*Registry, error) {
+	d, err := loadData(cfg.DataFile)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{cfg: cfg, zone: zone, data: d}
+	if err = r.repairLedger(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Registry) Config() Config {
+	return r.cfg
+}
+
+func (r *Registry) SetPolicy(table *policy.Table) {
+	r.policy = table
+}
+
+func (r *Registry) SetIDN(table *idn.Table) {
+	r.idn = table
+}
+
+// 一次修改中的数据副本，zoneChanged表示需要提交zone
+type tx struct {
+	d           *data
+	zoneChanged bool
+	// 提交成功后写入生命周期日志
+	transitions []Transition
+	// 保存数据之前追加到账本，任何一步失败时截断
+	ledger []LedgerEntry
+}
+
+// 在数据副本上执行fn，成功后追加账本、保存数据并提交zone；任何一步失败时账本、数据文件、内存数据和zone都保持原样
+func (r *Registry) update(fn func(t *tx) error) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	t := &tx{d: r.data.clone()}
+	ledgerSize := int64(-1)
+	err := fn(t)
+	if err == nil {
+		ledgerSize, err = r.appendLedger(t.ledger)
+	}
+	if err == nil {
+		err = saveData(r.cfg.DataFile, t.d)
+	}
+	if err != nil {
+		if t.zoneChanged {
+			r.zone.Rollback()
+		}
+		r.truncateLedger(ledgerSize)
+		return err
+	}
+	// 数据文件已写入，zone提交失败时放弃zone的修改并写回原来的数据
+	if t.zoneChanged {
+		if err = r.zone.Commit(); err != nil {
+			r.zone.Rollback()
+			if saveErr := saveData(r.cfg.DataFile, r.data); saveErr != nil {
+				fmt.Println("Error restore registry data:", saveErr)
+			}
+			r.truncateLedger(ledgerSize)
+			return err
+		}
+	}
+	r.data = t.d
+	r.logTransitions(t.transitions)
+	logLedger(t.ledger)
+	return nil
+}
+
+func (t *tx) nextROID(prefix string, tld string) string {
+	t.d.Sequence++
+	return fmt.Sprintf("%s%d-%s", prefix, t.d.Sequence, strings.ToUpper(tld))
+}
+
+// 根据域名当前状态发布或撤下委派
+func (r *Registry) publish(t *tx, dom *Domain) error {
+	t.zoneChanged = true
+	if !dom.Published() {
+		return r.zone.WithdrawDelegation(dom.Name + ".")
+	}
+	glue := map[string][]string{}
+	for _, ns := range dom.NameServers {
+		host := t.d.Hosts[ns]
+		if host == nil {
+			return errorf(ErrNotFound, "NS主机 %s 不存在", ns)
+		}
+		if r.inTLD(ns) {
+			glue[ns] = host.Addresses
+		}
+	}
+	return r.zone.PublishDelegation(dom.Name+".", dom.NameServers, glue, dom.DS)
+}
+
+// 名字是否在本顶级域之下
+func (r *Registry) inTLD(name string) bool {
+	return strings.HasSuffix(name, "."+r.cfg.TLD)
+}
+
+// 规范化为不带末尾点的小写名字
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// 检查主机名的每个label
+func checkHostName(name string) error {
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 || len(name) > 253 {
+		return errorf(ErrInvalid, "主机名 %s 不合法", name)
+	}
+	for _, label := range labels {
+		if err := checkLabel(label); err != nil {
+			return errorf(ErrInvalid, "主机名 %s 不合法: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// LDH规则：字母、数字、连字符，不以连字符开头或结尾，1-63个字符。UTF-8的label暂按原样接受
+func checkLabel(label string) error {
+	if len(label) == 0 || len(label) > 63 {
+		return errorf(ErrInvalid, "label长度必须在1-63之间")
+	}
+	if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+		return errorf(ErrInvalid, "label %s 不能以连字符开头或结尾", label)
+	}
+	for _, c := range label {
+		if c < 0x80 && !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return errorf(ErrInvalid, "label %s 含有非法字符 %q", label, c)
+		}
+	}
+	return nil
+}
+
+// 注册商必须存在且状态正常
+func (t *tx) checkRegistrar(id string) error {
+	registrar := t.d.Registrars[id]
+	if registrar == nil {
+		return errorf(ErrNotFound, "注册商 %s 不存在", id)
+	}
+	if registrar.Status != StatusOK {
+		return errorf(ErrForbidden, "注册商 %s 已停用", id)
+	}
+	return nil
+}
+
+// registrarID为空表示注册局运维操作，否则必须是对象的管理注册商
+func checkSponsor(registrarID string, sponsorID string, object string) error {
+	if registrarID != "" && registrarID != sponsorID {
+		return errorf(ErrForbidden, "%s 不属于注册商 %s", object, registrarID)
+	}
+	return nil
+}
+
+// ---------- 注册商 ----------
+
+func (r *Registry) CreateRegistrar(req Registrar) (*Registrar, error) {
+	req.ID = strings.TrimSpace(req.ID)
+	if req.ID == "" || req.Name == "" || req.Email == "" {
+		return nil, errorf(ErrInvalid, "注册商的id、name、email不能为空")
+	}
+	now := time.Now().UTC()
+	req.Status = StatusOK
+	req.Balance = 0
+	req.CreatedAt = now
+	req.UpdatedAt = now
+	err := r.update(func(t *tx) error {
+		if t.d.Registrars[req.ID] != nil {
+			return errorf(ErrExists, "注册商 %s 已存在", req.ID)
+		}
+		registrar := req
+		t.d.Registrars[req.ID] = &registrar
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// 启用或停用注册商，停用后不能再创建或修改对象
+func (r *Registry) SetRegistrarStatus(id string, enabled bool) error {
+	return r.update(func(t *tx) error {
+		registrar := t.d.Registrars[id]
+		if registrar == nil {
+			return errorf(ErrNotFound, "注册商 %s 不存在", id)
+		}
+		registrar.Status = StatusOK
+		if !enabled {
+			registrar.Status = "disabled"
+		}
+		registrar.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+func (r *Registry) GetRegistrar(id string) (*Registrar, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	registrar := r.data.Registrars[id]
+	if registrar == nil {
+		return nil, errorf(ErrNotFound, "注册商 %s 不存在", id)
+	}
+	c := *registrar
+	return &c, nil
+}
+
+func (r *Registry) ListRegistrars() []Registrar {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var list []Registrar
+	for _, registrar := range r.data.Registrars {
+		list = append(list, *registrar)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// ---------- 联系人 ----------
+
+func checkContact(c *Contact) error {
+	if len(c.ID) < 3 || len(c.ID) > 16 {
+		return errorf(ErrInvalid, "联系人id长度必须在3-16之间")
+	}
+	if c.Name == "" || c.Email == "" || c.Country == "" {
+		return errorf(ErrInvalid, "联系人的name、email、country不能为空")
+	}
+	if !strings.Contains(c.Email, "@") {
+		return errorf(ErrInvalid, "联系人email %s 格式错误", c.Email)
+	}
+	c.Country = strings.ToUpper(c.Country)
+	if len(c.Country) != 2 {
+		return errorf(ErrInvalid, "country必须是两位国家代码")
+	}
+	return nil
+}
+
+func (r *Registry) CreateContact(req Contact) (*Contact, error) {
+	req.ID = strings.TrimSpace(req.ID)
+	if err := checkContact(&req); err != nil {
+		return nil, err
+	}
+	err := r.update(func(t *tx) error {
+		if err := t.checkRegistrar(req.RegistrarID); err != nil {
+			return err
+		}
+		if t.d.Contacts[req.ID] != nil {
+			return errorf(ErrExists, "联系人 %s 已存在", req.ID)
+		}
+		now := time.Now().UTC()
+		req.ROID = t.nextROID("C", r.cfg.TLD)
+		req.CreatedAt = now
+		req.UpdatedAt = now
+		contact := req
+		t.d.Contacts[req.ID] = &contact
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// 修改联系人信息，id、roid、注册商和创建时间不变
+func (r *Registry) UpdateContact(req Contact) (*Contact, error) {
+	if err := checkContact(&req); err != nil {
+		return nil, err
+	}
+	err := r.update(func(t *tx) error {
+		old := t.d.Contacts[req.ID]
+		if old == nil {
+			return errorf(ErrNotFound, "联系人 %s 不存在", req.ID)
+		}
+		if err := checkSponsor(req.RegistrarID, old.RegistrarID, "联系人 "+req.ID); err != nil {
+			return err
+		}
+		req.ROID = old.ROID
+		req.RegistrarID = old.RegistrarID
+		req.CreatedAt = old.CreatedAt
+		req.UpdatedAt = time.Now().UTC()
+		contact := req
+		t.d.Contacts[req.ID] = &contact
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// 删除联系人，仍被域名引用时不能删除
+func (r *Registry) DeleteContact(id string, registrarID string) error {
+	return r.update(func(t *tx) error {
+		contact := t.d.Contacts[id]
+		if contact == nil {
+			return errorf(ErrNotFound, "联系人 %s 不存在", id)
+		}
+		if err := checkSponsor(registrarID, contact.RegistrarID, "联系人 "+id); err != nil {
+			return err
+		}
+		for _, dom := range t.d.Domains {
+			if dom.RegistrantID == id || dom.AdminID == id || dom.TechID == id || dom.BillingID == id {
+				return errorf(ErrInUse, "联系人 %s 仍被域名 %s 使用", id, dom.Name)
+			}
+		}
+		delete(t.d.Contacts, id)
+		return nil
+	})
+}
+
+func (r *Registry) GetContact(id string) (*Contact, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	contact := r.data.Contacts[id]
+	if contact == nil {
+		return nil, errorf(ErrNotFound, "联系人 %s 不存在", id)
+	}
+	c := *contact
+	return &c, nil
+}
+
+// ---------- 主机 ----------
+
+// zone内的主机必须从属于已注册的域名并提供地址，zone外的主机不能有地址
+func (r *Registry) checkHost(t *tx, h *Host) error {
+	if err := checkHostName(h.Name); err != nil {
+		return err
+	}
+	if !r.inTLD(h.Name) {
+		if len(h.Addresses) > 0 {
+			return errorf(ErrPolicy, "主机 %s 不在.%s下，不能设置地址", h.Name, r.cfg.TLD)
+		}
+		return nil
+	}
+	if r.superordinate(t, h.Name) == nil {
+		return errorf(ErrPolicy, "主机 %s 所属的域名没有注册", h.Name)
+	}
+	if len(h.Addresses) == 0 {
+		return errorf(ErrPolicy, "主机 %s 在.%s下，必须设置地址", h.Name, r.cfg.TLD)
+	}
+	return nil
+}
+
+// 主机所属的已注册域名
+func (r *Registry) superordinate(t *tx, hostName string) *Domain {
+	labels := strings.Split(hostName, ".")
+	if len(labels) < 3 {
+		return nil
+	}
+	return t.d.Domains[strings.Join(labels[len(labels)-2:], ".")]
+}
+
+func (r *Registry) CreateHost(req Host) (*Host, error) {
+	req.Name = normalizeName(req.Name)
+	err := r.update(func(t *tx) error {
+		if err := t.checkRegistrar(req.RegistrarID); err != nil {
+			return err
+		}
+		if err := r.checkHost(t, &req); err != nil {
+			return err
+		}
+		if t.d.Hosts[req.Name] != nil {
+			return errorf(ErrExists, "主机 %s 已存在", req.Name)
+		}
+		now := time.Now().UTC()
+		req.ROID = t.nextROID("H", r.cfg.TLD)
+		req.CreatedAt = now
+		req.UpdatedAt = now
+		host := req
+		t.d.Hosts[req.Name] = &host
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// 修改主机地址，同时更新所有使用该主机的域名的胶水
+func (r *Registry) UpdateHost(req Host) (*Host, error) {
+	req.Name = normalizeName(req.Name)
+	err := r.update(func(t *tx) error {
+		host := t.d.Hosts[req.Name]
+		if host == nil {
+			return errorf(ErrNotFound, "主机 %s 不存在", req.Name)
+		}
+		if err := checkSponsor(req.RegistrarID, host.RegistrarID, "主机 "+req.Name); err != nil {
+			return err
+		}
+		if err := r.checkHost(t, &req); err != nil {
+			return err
+		}
+		host.Addresses = req.Addresses
+		host.UpdatedAt = time.Now().UTC()
+		req = *host
+		for _, dom := range r.domainsUsingHost(t, host.Name) {
+			if err := r.publish(t, dom); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// 删除主机，仍被域名用作NS时不能删除
+func (r *Registry) DeleteHost(name string, registrarID string) error {
+	name = normalizeName(name)
+	return r.update(func(t *tx) error {
+		host := t.d.Hosts[name]
+		if host == nil {
+			return errorf(ErrNotFound, "主机 %s 不存在", name)
+		}
+		if err := checkSponsor(registrarID, host.RegistrarID, "主机 "+name); err != nil {
+			return err
+		}
+		if doms := r.domainsUsingHost(t, name); len(doms) > 0 {
+			return errorf(ErrInUse, "主机 %s 仍被域名 %s 使用", name, doms[0].Name)
+		}
+		delete(t.d.Hosts, name)
+		return nil
+	})
+}
+
+func (r *Registry) domainsUsingHost(t *tx, hostName string) []*Domain {
+	var list []*Domain
+	for _, dom := range t.d.Domains {
+		for _, ns := range dom.NameServers {
+			if ns == hostName {
+				list = append(list, dom)
+				break
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (r *Registry) GetHost(name string) (*Host, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	host := r.data.Hosts[normalizeName(name)]
+	if host == nil {
+		return nil, errorf(ErrNotFound, "主机 %s 不存在", name)
+	}
+	c := *host
+	return &c, nil
+}
+
+// ---------- 域名 ----------
+
+// 检查域名引用的联系人和主机
+func (r *Registry) checkDomainRefs(t *tx, dom *Domain) error {
+	if t.d.Contacts[dom.RegistrantID] == nil {
+		return errorf(ErrNotFound, "注册人 %s 不存在", dom.RegistrantID)
+	}
+	for _, id := range []string{dom.AdminID, dom.TechID, dom.BillingID} {
+		if id != "" && t.d.Contacts[id] == nil {
+			return errorf(ErrNotFound, "联系人 %s 不存在", id)
+		}
+	}
+	seen := map[string]bool{}
+	for i, ns := range dom.NameServers {
+		ns = normalizeName(ns)
+		if seen[ns] {
+			return errorf(ErrInvalid, "NS主机 %s 重复", ns)
+		}
+		seen[ns] = true
+		if t.d.Hosts[ns] == nil {
+			return errorf(ErrNotFound, "NS主机 %s 不存在，请先创建主机", ns)
+		}
+		dom.NameServers[i] = ns
+	}
+	if len(dom.DS) > 0 && len(dom.NameServers) == 0 {
+		return errorf(ErrPolicy, "没有NS的域名不能设置DS")
+	}
+	return nil
+}
+
+// 注册域名，years为0时使用默认年限。override为true时是注册局人员操作，可以注册保留和禁止的名字，
+// 也可以在开放注册前的阶段直接注册。商标声明期内名字与商标匹配时，noticeID必须是已确认的声明ID
+func (r *Registry) CreateDomain(req Domain, years int, override bool, noticeID string) (*Domain, error) {
+	req.Name = normalizeName(req.Name)
+	// IDN统一保存为A-label
+	label, err := r.domainLabel(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	req.Name = label + "." + r.cfg.TLD
+	if years == 0 {
+		years = r.cfg.DefaultPeriod
+	}
+	if years < 1 || years > r.cfg.MaxPeriod {
+		return nil, errorf(ErrRange, "注册年限必须在1-%d年之间", r.cfg.MaxPeriod)
+	}
+	// 没有提供authInfo时自动生成
+	if req.AuthInfo == "" {
+		req.AuthInfo = r.newAuthInfo()
+	} else if err := checkAuthInfo(req.AuthInfo); err != nil {
+		return nil, err
+	}
+	err = r.update(func(t *tx) error {
+		if err := t.checkRegistrar(req.RegistrarID); err != nil {
+			return err
+		}
+		if err := r.checkCreatable(t, req.Name, override); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if err := r.checkLaunch(t, req.Name, noticeID, override, now); err != nil {
+			return err
+		}
+		if err := r.checkDomainRefs(t, &req); err != nil {
+			return err
+		}
+		if _, err := r.charge(t, req.RegistrarID, OpCreate, req.Name, years, now, false, now.Add(r.cfg.Billing.addGrace)); err != nil {
+			return err
+		}
+		return r.createDomain(t, &req, years, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// 同时检查A-label、U-label两种写法和保留、禁止名单，override时不检查保留和禁止名单
+func (r *Registry) checkCreatable(t *tx, name string, override bool) error {
+	if t.d.Domains[name] != nil {
+		return errorf(ErrExists, "域名 %s 已注册", name)
+	}
+	if a := r.checkAvailability(name); !a.Available {
+		switch {
+		case a.Reason == ReasonRegistered:
+			return errorf(ErrExists, "域名 %s 已注册", name)
+		case a.Reason == ReasonInvalid:
+			return errorf(ErrInvalid, "%s", a.Msg)
+		case !override:
+			return errorf(ErrPolicy, "域名 %s %s", name, a.Msg)
+		}
+	}
+	return nil
+}
+
+// 保存新域名并发布委派，调用方已完成检查和计费
+func (r *Registry) createDomain(t *tx, req *Domain, years int, now time.Time) error {
+	req.ROID = t.nextROID("D", r.cfg.TLD)
+	req.Status = nil
+	req.CreatedAt = now
+	req.UpdatedAt = now
+	req.ExpiresAt = now.AddDate(years, 0, 0)
+	req.normalizeStatus()
+	dom := *req
+	t.d.Domains[req.Name] = &dom
+	if !dom.Published() {
+		return nil
+	}
+	return r.publish(t, &dom)
+}
+
+// 修改域名的联系人、NS和DS，其余字段不变
+func (r *Registry) UpdateDomain(req Domain) (*Domain, error) {
+	req.Name = normalizeName(req.Name)
+	var res Domain
+	err := r.update(func(t *tx) error {
+		dom := t.d.Domains[req.Name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", req.Name)
+		}
+		if err := checkSponsor(req.RegistrarID, dom.RegistrarID, "域名 "+req.Name); err != nil {
+			return err
+		}
+		if err := t.checkRegistrar(dom.RegistrarID); err != nil {
+			return err
+		}
+		if dom.HasStatus(StatusPendingTransfer) {
+			return errorf(ErrProhibited, "域名 %s 正在转移中", req.Name)
+		}
+		if dom.Deleting() {
+			return errorf(ErrProhibited, "域名 %s 已在删除流程中", req.Name)
+		}
+		if err := dom.checkProhibited(StatusServerUpdateProhibited, StatusClientUpdateProhibited); err != nil {
+			return err
+		}
+		if err := r.checkDomainRefs(t, &req); err != nil {
+			return err
+		}
+		if req.AuthInfo != "" && req.AuthInfo != dom.AuthInfo {
+			if err := checkAuthInfo(req.AuthInfo); err != nil {
+				return err
+			}
+		}
+		dom.RegistrantID = req.RegistrantID
+		dom.AdminID = req.AdminID
+		dom.TechID = req.TechID
+		dom.BillingID = req.BillingID
+		dom.NameServers = req.NameServers
+		dom.DS = req.DS
+		if req.AuthInfo != "" {
+			dom.AuthInfo = req.AuthInfo
+		}
+		dom.UpdatedAt = time.Now().UTC()
+		dom.normalizeStatus()
+		res = *dom
+		return r.publish(t, dom)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 续费，curExpDate必须与当前到期日相同（按日比较），防止重复提交
+func (r *Registry) RenewDomain(name string, registrarID string, curExpDate time.Time, years int) (*Domain, error) {
+	name = normalizeName(name)
+	var res Domain
+	err := r.update(func(t *tx) error {
+		dom := t.d.Domains[name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", name)
+		}
+		if err := checkSponsor(registrarID, dom.RegistrarID, "域名 "+name); err != nil {
+			return err
+		}
+		if dom.HasStatus(StatusPendingTransfer) {
+			return errorf(ErrProhibited, "域名 %s 正在转移中", name)
+		}
+		if dom.Deleting() {
+			return errorf(ErrProhibited, "域名 %s 已在删除流程中", name)
+		}
+		if err := dom.checkProhibited(StatusServerRenewProhibited, StatusClientRenewProhibited); err != nil {
+			return err
+		}
+		if !curExpDate.IsZero() && curExpDate.Format("2006-01-02") != dom.ExpiresAt.Format("2006-01-02") {
+			return errorf(ErrRange, "curExpDate %s 与到期日 %s 不符", curExpDate.Format("2006-01-02"), dom.ExpiresAt.Format("2006-01-02"))
+		}
+		if years == 0 {
+			years = r.cfg.DefaultPeriod
+		}
+		expires := dom.ExpiresAt.AddDate(years, 0, 0)
+		if years < 1 || expires.After(time.Now().UTC().AddDate(r.cfg.MaxPeriod, 0, 0)) {
+			return errorf(ErrRange, "续费后注册期限不能超过%d年", r.cfg.MaxPeriod)
+		}
+		now := time.Now().UTC()
+		if _, err := r.charge(t, dom.RegistrarID, OpRenew, name, years, now, false, now.Add(r.cfg.Billing.renewGrace)); err != nil {
+			return err
+		}
+		dom.ExpiresAt = expires
+		dom.UpdatedAt = now
+		res = *dom
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 暂停解析：设置serverHold并从zone中撤下委派，注册数据保留
+func (r *Registry) SuspendDomain(name string) error {
+	return r.setHold(normalizeName(name), true)
+}
+
+func (r *Registry) UnsuspendDomain(name string) error {
+	return r.setHold(normalizeName(name), false)
+}
+
+func (r *Registry) setHold(name string, hold bool) error {
+	return r.update(func(t *tx) error {
+		dom := t.d.Domains[name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", name)
+		}
+		if dom.HasStatus(StatusServerHold) == hold {
+			return nil
+		}
+		if hold {
+			dom.Status = append(dom.Status, StatusServerHold)
+		} else {
+			var list []string
+			for _, s := range dom.Status {
+				if s != StatusServerHold {
+					list = append(list, s)
+				}
+			}
+			dom.Status = list
+		}
+		dom.UpdatedAt = time.Now().UTC()
+		dom.normalizeStatus()
+		return r.publish(t, dom)
+	})
+}
+
+// 删除域名。启用生命周期时先进入赎回期，委派撤下但数据保留，由RunLifecycle到期清除；
+// 否则立即删除域名及zone中该域名下的所有记录。域名下还有被其他域名使用的主机时不能删除
+func (r *Registry) DeleteDomain(name string, registrarID string) error {
+	name = normalizeName(name)
+	return r.update(func(t *tx) error {
+		dom := t.d.Domains[name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", name)
+		}
+		if err := checkSponsor(registrarID, dom.RegistrarID, "域名 "+name); err != nil {
+			return err
+		}
+		if dom.HasStatus(StatusPendingTransfer) {
+			return errorf(ErrProhibited, "域名 %s 正在转移中", name)
+		}
+		if dom.Deleting() {
+			return errorf(ErrProhibited, "域名 %s 已在删除流程中", name)
+		}
+		if err := dom.checkProhibited(StatusServerDeleteProhibited, StatusClientDeleteProhibited); err != nil {
+			return err
+		}
+		if err := r.subordinateHostsInUse(t, name); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		// 注册、续费、转移的宽限期内删除退回费用
+		msg := ""
+		if refund := r.refundGrace(t, dom, now); refund > 0 {
+			msg = "退款 " + formatAmount(refund)
+		}
+		if r.cfg.Lifecycle.Enabled {
+			if err := r.startRedemption(t, dom, now); err != nil {
+				return err
+			}
+			t.addTransition(dom, EventDelete, now, msg)
+			return nil
+		}
+		if err := r.purgeDomain(t, dom); err != nil {
+			return err
+		}
+		t.addTransition(dom, EventPurge, now, msg)
+		return nil
+	})
+}
+
+func (r *Registry) GetDomain(name string) (*Domain, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	dom := r.data.Domains[normalizeName(name)]
+	if dom == nil {
+		return nil, errorf(ErrNotFound, "域名 %s 没有注册", name)
+	}
+	c := *dom
+	return &c, nil
+}
+
+// 列出域名，registrarID为空时列出全部
+func (r *Registry) ListDomains(registrarID string) []Domain {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var list []Domain
+	for _, dom := range r.data.Domains {
+		if registrarID == "" || dom.RegistrarID == registrarID {
+			list = append(list, *dom)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// 域名是否可以注册，不可注册时返回原因
+func (r *Registry) DomainAvailable(name string) (bool, string) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	a := r.checkAvailability(name)
+	return a.Available, a.Msg
+}
+
+// 列出主机，suffix不为空时只列出以其结尾的主机，如某域名的从属主机
+func (r *Registry) ListHosts(suffix string) []Host {
+	suffix = normalizeName(suffix)
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var list []Host
+	for _, host := range r.data.Hosts {
+		if suffix == "" || strings.HasSuffix(host.Name, "."+suffix) {
+			list = append(list, *host)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// 主机是否被域名用作NS
+func (r *Registry) HostInUse(name string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.domainsUsingHost(&tx{d: r.data}, normalizeName(name))) > 0
+}
+
+// 联系人是否被域名引用
+func (r *Registry) ContactInUse(id string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, dom := range r.data.Domains {
+		if dom.RegistrantID == id || dom.AdminID == id || dom.TechID == id || dom.BillingID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package registry
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// 记录调用的Zone替身，commitErr不为nil时Commit失败，lockErr不为nil时SetDomainLock失败，
+// 对fail中的域名（带末尾点）的修改失败
+type fakeZone struct {
+	commitErr error
+	lockErr   error
+	fail      map[string]bool
+	pending   int
+	committed int
+	rollbacks int
+}
+
+func (z *fakeZone) change(domainName string) error {
+	if z.fail[domainName] {
+		return fmt.Errorf("zone拒绝修改 %s", domainName)
+	}
+	z.pending++
+	return nil
+}
+
+func (z *fakeZone) PublishDelegation(domainName string, nameServers []string, glue map[string][]string, ds []string) error {
+	return z.change(domainName)
+}
+
+func (z *fakeZone) WithdrawDelegation(domainName string) error {
+	return z.change(domainName)
+}
+
+func (z *fakeZone) PurgeDomain(domainName string) error {
+	return z.change(domainName)
+}
+
+func (z *fakeZone) Commit() error {
+	if z.commitErr != nil {
+		return z.commitErr
+	}
+	z.committed += z.pending
+	z.pending = 0
+	return nil
+}
+
+func (z *fakeZone) Rollback() {
+	z.pending = 0
+	z.rollbacks++
+}
+
+func (z *fakeZone) SetDomainLock(domainName string, locked bool) error {
+	return z.lockErr
+}
+
+func newTestRegistry(t *testing.T, zone Zone) *Registry {
+	t.Helper()
+	return newTestRegistryWith(t, zone, nil)
+}
+
+// 按默认配置创建注册局，数据、账本和日志写在临时目录，mutate在解析配置前修改配置
+func newTestRegistryWith(t *testing.T, zone Zone, mutate func(cfg *Config)) *Registry {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.DataFile = filepath.Join(dir, "registry.json")
+	cfg.Lifecycle.LogFile = filepath.Join(dir, "lifecycle.log")
+	cfg.Billing.LedgerFile = filepath.Join(dir, "ledger.jsonl")
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	if err := cfg.parse(); err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	r, err := New(cfg, zone)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return r
+}
+
+// 创建注册商并充值，amount为0时不充值
+func addTestRegistrar(t *testing.T, r *Registry, id string, amount int64) {
+	t.Helper()
+	if _, err := r.CreateRegistrar(Registrar{ID: id, Name: id, Email: id + "@example.com"}); err != nil {
+		t.Fatalf("CreateRegistrar: %v", err)
+	}
+	if amount != 0 {
+		if _, err := r.Deposit(id, amount, "test"); err != nil {
+			t.Fatalf("Deposit: %v", err)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		fnErr       error
+		commitErr   error
+		zoneChanged bool
+		wantErr     bool
+		// 修改后内存和数据文件中的Sequence
+		wantSeq       uint64
+		wantCommitted int
+		wantRollbacks int
+	}{
+		{name: "data only", wantSeq: 1},
+		{name: "data and zone", zoneChanged: true, wantSeq: 1, wantCommitted: 1},
+		{name: "fn fails", fnErr: fmt.Errorf("fail"), zoneChanged: true, wantErr: true, wantRollbacks: 1},
+		{name: "commit fails", commitErr: fmt.Errorf("disk full"), zoneChanged: true, wantErr: true, wantRollbacks: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := &fakeZone{commitErr: tt.commitErr}
+			r := newTestRegistry(t, zone)
+			err := r.update(func(t *tx) error {
+				t.d.Sequence++
+				if tt.zoneChanged {
+					t.zoneChanged = true
+					_ = zone.WithdrawDelegation("a.chn.")
+				}
+				return tt.fnErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("update error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if r.data.Sequence != tt.wantSeq {
+				t.Errorf("内存中的Sequence为%d，应为%d", r.data.Sequence, tt.wantSeq)
+			}
+			saved, err := loadData(r.cfg.DataFile)
+			if err != nil {
+				t.Fatalf("loadData: %v", err)
+			}
+			if saved.Sequence != tt.wantSeq {
+				t.Errorf("数据文件中的Sequence为%d，应为%d", saved.Sequence, tt.wantSeq)
+			}
+			if zone.committed != tt.wantCommitted || zone.rollbacks != tt.wantRollbacks || zone.pending != 0 {
+				t.Errorf("zone committed=%d rollbacks=%d pending=%d，应为%d、%d、0", zone.committed, zone.rollbacks, zone.pending, tt.wantCommitted, tt.wantRollbacks)
+			}
+		})
+	}
+}
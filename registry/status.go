@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"fmt"
+	"time"
+
+	"newCHNTLDManager/dns/eppstatus"
+)
+
+// 修改域名状态。registrarID不为空时是注册商操作，只能修改client状态；为空时是注册局操作，
+// 还可以修改serverHold和serverRenewProhibited。锁定期间只允许去掉clientUpdateProhibited，
+// 注册局锁定使用LockDomain和UnlockDomain
+func (r *Registry) SetDomainStatus(name string, registrarID string, add []string, rem []string) (*Domain, error) {
+	name = normalizeName(name)
+	for _, s := range append(append([]string{}, add...), rem...) {
+		switch {
+		case eppstatus.Contains(clientStatuses, s):
+		case eppstatus.Contains(lockStatuses, s):
+			return nil, errorf(ErrPolicy, "%s 请使用LockDomain和UnlockDomain", s)
+		case s == StatusServerHold || s == StatusServerRenewProhibited:
+			if registrarID != "" {
+				return nil, errorf(ErrForbidden, "只有注册局可以设置%s", s)
+			}
+		default:
+			return nil, errorf(ErrInvalid, "不支持的状态 %s", s)
+		}
+	}
+	var res Domain
+	err := r.update(func(t *tx) error {
+		dom := t.d.Domains[name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", name)
+		}
+		if registrarID != "" {
+			if err := checkSponsor(registrarID, dom.RegistrarID, "域名 "+name); err != nil {
+				return err
+			}
+			if err := t.checkRegistrar(dom.RegistrarID); err != nil {
+				return err
+			}
+		}
+		if dom.Deleting() {
+			return errorf(ErrProhibited, "域名 %s 已在删除流程中", name)
+		}
+		if dom.HasStatus(StatusServerUpdateProhibited) {
+			return errorf(ErrProhibited, "域名 %s 已被注册局锁定", name)
+		}
+		if dom.HasStatus(StatusClientUpdateProhibited) && !eppstatus.Contains(rem, StatusClientUpdateProhibited) {
+			return errorf(ErrProhibited, "域名 %s 处于%s状态，只能去掉该状态", name, StatusClientUpdateProhibited)
+		}
+		published := dom.Published()
+		for _, s := range rem {
+			dom.removeStatus(s)
+		}
+		for _, s := range add {
+			if !dom.HasStatus(s) {
+				dom.Status = append(dom.Status, s)
+			}
+		}
+		dom.UpdatedAt = time.Now().UTC()
+		dom.normalizeStatus()
+		res = *dom
+		if dom.Published() != published {
+			return r.publish(t, dom)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, r.zone.SetDomainLock(res.Name+".", res.Locked())
+}
+
+// 注册局锁定：设置serverUpdateProhibited、serverDeleteProhibited、serverTransferProhibited，
+// 返回只显示一次的解锁码，由注册局通过带外方式交给域名持有人。zone同步失败时撤销锁定并返回错误，
+// 无法撤销时解锁码和错误同时返回
+func (r *Registry) LockDomain(name string) (string, error) {
+	name = normalizeName(name)
+	code := eppstatus.NewUnlockCode()
+	hash, err := eppstatus.HashUnlockCode(code)
+	if err != nil {
+		return "", fmt.Errorf("生成解锁码哈希失败: %v", err)
+	}
+	err = r.update(func(t *tx) error {
+		dom := t.d.Domains[name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", name)
+		}
+		if dom.Deleting() {
+			return errorf(ErrProhibited, "域名 %s 已在删除流程中", name)
+		}
+		if dom.HasStatus(StatusServerUpdateProhibited) {
+			return errorf(ErrProhibited, "域名 %s 已经锁定", name)
+		}
+		for _, s := range lockStatuses {
+			if !dom.HasStatus(s) {
+				dom.Status = append(dom.Status, s)
+			}
+		}
+		dom.UnlockHash = hash
+		dom.UpdatedAt = time.Now().UTC()
+		dom.normalizeStatus()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if err = r.zone.SetDomainLock(name+".", true); err != nil {
+		// zone没有同步时撤销数据中的锁定；撤销也失败时域名仍被锁定，解锁码随错误一起返回，不能丢失
+		undoErr := r.update(func(t *tx) error {
+			dom := t.d.Domains[name]
+			if dom == nil || dom.UnlockHash != hash {
+				return nil
+			}
+			for _, s := range lockStatuses {
+				dom.removeStatus(s)
+			}
+			dom.UnlockHash = ""
+			dom.UpdatedAt = time.Now().UTC()
+			dom.normalizeStatus()
+			return nil
+		})
+		if undoErr != nil {
+			fmt.Println("Error undo lock:", name, undoErr)
+			return code, err
+		}
+		return "", err
+	}
+	return code, nil
+}
+
+// 凭LockDomain返回的解锁码解除注册局锁定
+func (r *Registry) UnlockDomain(name string, code string) error {
+	name = normalizeName(name)
+	var locked bool
+	err := r.update(func(t *tx) error {
+		dom := t.d.Domains[name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", name)
+		}
+		if !dom.HasStatus(StatusServerUpdateProhibited) {
+			return errorf(ErrProhibited, "域名 %s 没有锁定", name)
+		}
+		if !eppstatus.CheckUnlockCode(dom.UnlockHash, code) {
+			return errorf(ErrAuthInfo, "域名 %s 的解锁码不正确", name)
+		}
+		for _, s := range lockStatuses {
+			dom.removeStatus(s)
+		}
+		dom.UnlockHash = ""
+		dom.UpdatedAt = time.Now().UTC()
+		dom.normalizeStatus()
+		locked = dom.Locked()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.zone.SetDomainLock(name+".", locked)
+}
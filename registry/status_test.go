@@ -0,0 +1,54 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLockDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		lockErr error
+		// 锁定后数据中的状态和是否返回解锁码
+		wantLocked bool
+		wantCode   bool
+		wantErr    bool
+	}{
+		{name: "lock", wantLocked: true, wantCode: true},
+		{name: "zone sync fails", lockErr: fmt.Errorf("disk full"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := &fakeZone{lockErr: tt.lockErr}
+			r := newTestRegistry(t, zone)
+			addTestRegistrar(t, r, "reg1", 0)
+			r.data.Domains["a.chn"] = testDomain("a.chn", "reg1", time.Now().UTC().AddDate(1, 0, 0))
+			code, err := r.LockDomain("a.chn")
+			if (err != nil) != tt.wantErr || (code != "") != tt.wantCode {
+				t.Fatalf("LockDomain = %q, %v", code, err)
+			}
+			dom := r.data.Domains["a.chn"]
+			for _, s := range lockStatuses {
+				if dom.HasStatus(s) != tt.wantLocked {
+					t.Errorf("状态 %v，锁定应为%v", dom.Status, tt.wantLocked)
+				}
+			}
+			if (dom.UnlockHash != "") != tt.wantLocked {
+				t.Errorf("解锁码哈希为 %q", dom.UnlockHash)
+			}
+			if !tt.wantLocked {
+				return
+			}
+			if err := r.UnlockDomain("a.chn", "WRONGCODE"); KindOf(err) != ErrAuthInfo {
+				t.Errorf("错误的解锁码 error = %v，应为ErrAuthInfo", err)
+			}
+			if err := r.UnlockDomain("a.chn", " "+code+" "); err != nil {
+				t.Fatalf("UnlockDomain: %v", err)
+			}
+			if dom := r.data.Domains["a.chn"]; dom.HasStatus(StatusServerUpdateProhibited) || dom.UnlockHash != "" {
+				t.Errorf("解锁后状态 %v", dom.Status)
+			}
+		})
+	}
+}
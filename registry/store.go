@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// 读取数据文件，文件不存在时返回空数据
+func loadData(file string) (*data, error) {
+	d := &data{}
+	if gfile.Exists(file) {
+		if err := json.Unmarshal(gfile.GetBytes(file), d); err != nil {
+			return nil, fmt.Errorf("读取注册数据%s失败: %v", file, err)
+		}
+	}
+	d.init()
+	return d, nil
+}
+
+// 补齐为nil的map
+func (d *data) init() {
+	if d.Registrars == nil {
+		d.Registrars = map[string]*Registrar{}
+	}
+	if d.Contacts == nil {
+		d.Contacts = map[string]*Contact{}
+	}
+	if d.Hosts == nil {
+		d.Hosts = map[string]*Host{}
+	}
+	if d.Domains == nil {
+		d.Domains = map[string]*Domain{}
+	}
+	if d.Credentials == nil {
+		d.Credentials = map[string]string{}
+	}
+	if d.Transfers == nil {
+		d.Transfers = map[string]*Transfer{}
+	}
+	if d.Grace == nil {
+		d.Grace = map[string][]*graceCharge{}
+	}
+	if d.Marks == nil {
+		d.Marks = map[string]*Mark{}
+	}
+	if d.Applications == nil {
+		d.Applications = map[string]*Application{}
+	}
+}
+
+// 先写临时文件再改名，避免写到一半时留下损坏的数据文件
+func saveData(file string, d *data) error {
+	content, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = gfile.Mkdir(filepath.Dir(file)); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err = gfile.PutBytes(tmp, content); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// 深拷贝，修改失败时用于回滚
+func (d *data) clone() *data {
+	content, _ := json.Marshal(d)
+	c := &data{}
+	_ = json.Unmarshal(content, c)
+	c.init()
+	return c
+}
@@ -0,0 +1,505 @@
+package registry
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 转移状态，取值与EPP一致
+const (
+	TransferPending         = "pending"
+	TransferClientApproved  = "clientApproved"
+	TransferClientRejected  = "clientRejected"
+	TransferClientCancelled = "clientCancelled"
+	TransferServerApproved  = "serverApproved"
+	TransferServerCancelled = "serverCancelled"
+)
+
+// 域名转移配置，对应registry.transfer节点
+type TransferConfig struct {
+	// 原注册商未处理时自动批准的等待时间，EPP惯例为5天
+	AutoApprove string `json:"autoApprove"`
+	// 注册或转移完成后多久之内不能再转出，ICANN惯例为60天，为0时不限制
+	LockPeriod string `json:"lockPeriod"`
+	// 检查到期转移申请的间隔
+	CheckInterval string `json:"checkInterval"`
+	// 自动生成的authInfo长度
+	AuthInfoLength int `json:"authInfoLength"`
+	// 每个域名一小时内允许authInfo校验失败的次数，超过后暂停校验，为0时不限制
+	AuthInfoAttempts int `json:"authInfoAttempts"`
+
+	autoApprove   time.Duration
+	lockPeriod    time.Duration
+	checkInterval time.Duration
+}
+
+func (c *TransferConfig) parse() error {
+	items := []struct {
+		name  string
+		value string
+		d     *time.Duration
+	}{
+		{"autoApprove", c.AutoApprove, &c.autoApprove},
+		{"lockPeriod", c.LockPeriod, &c.lockPeriod},
+		{"checkInterval", c.CheckInterval, &c.checkInterval},
+	}
+	for _, item := range items {
+		d, err := time.ParseDuration(item.value)
+		if err != nil {
+			return fmt.Errorf("registry.transfer.%s 格式错误: %v", item.name, err)
+		}
+		*item.d = d
+	}
+	if c.AuthInfoLength < minAuthInfoLength || c.AuthInfoLength > maxAuthInfoLength {
+		return fmt.Errorf("registry.transfer.authInfoLength 必须在%d-%d之间", minAuthInfoLength, maxAuthInfoLength)
+	}
+	if c.AuthInfoAttempts < 0 {
+		return fmt.Errorf("registry.transfer.authInfoAttempts 不能为负数")
+	}
+	return nil
+}
+
+func (c TransferConfig) CheckIntervalDuration() time.Duration {
+	return c.checkInterval
+}
+
+// authInfo的长度限制
+const (
+	minAuthInfoLength = 8
+	maxAuthInfoLength = 32
+)
+
+// authInfo校验失败次数的统计窗口
+const authInfoWindow = time.Hour
+
+// 按域名统计authInfo校验失败的次数，防止逐个猜测
+type authInfoLimiter struct {
+	lock     sync.Mutex
+	failures map[string]*authInfoFailures
+}
+
+type authInfoFailures struct {
+	start time.Time
+	count int
+}
+
+// 域名在当前窗口内的失败次数是否已达到limit
+func (l *authInfoLimiter) blocked(name string, limit int, now time.Time) bool {
+	if limit == 0 {
+		return false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	f := l.failures[name]
+	return f != nil && now.Sub(f.start) < authInfoWindow && f.count >= limit
+}
+
+// 记录一次校验失败
+func (l *authInfoLimiter) fail(name string, now time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.failures == nil {
+		l.failures = map[string]*authInfoFailures{}
+	}
+	f := l.failures[name]
+	if f == nil || now.Sub(f.start) >= authInfoWindow {
+		// 顺便清理已过期的记录，避免map无限增长
+		if len(l.failures) > 10000 {
+			for key, old := range l.failures {
+				if now.Sub(old.start) >= authInfoWindow {
+					delete(l.failures, key)
+				}
+			}
+		}
+		f = &authInfoFailures{start: now}
+		l.failures[name] = f
+	}
+	f.count++
+}
+
+// 执行包含authInfo校验的操作check，authInfo不正确时计数，失败次数过多时不再校验
+func (r *Registry) limitAuthInfo(name string, check func() error) error {
+	now := time.Now()
+	if r.authInfoFailures.blocked(name, r.cfg.Transfer.AuthInfoAttempts, now) {
+		return errorf(ErrAuthInfo, "域名 %s 的authInfo校验失败次数过多，请稍后再试", name)
+	}
+	err := check()
+	if KindOf(err) == ErrAuthInfo {
+		r.authInfoFailures.fail(name, now)
+	}
+	return err
+}
+
+// 生成authInfo使用的字符，去掉了容易混淆的0、O、1、l、I
+const authInfoChars = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789!@#$%^*-_+="
+
+// 域名在注册商之间的转移
+type Transfer struct {
+	Domain string `json:"domain"`
+	Status string `json:"status"`
+	// 转入注册商
+	GainingID   string    `json:"gainingId"`
+	RequestedAt time.Time `json:"requestedAt"`
+	// 原注册商
+	LosingID string `json:"losingId"`
+	// pending时为自动处理的时间，结束后为实际处理时间
+	ActionAt time.Time `json:"actionAt"`
+	// 转移成功后续费的年数
+	Years int `json:"years"`
+	// 转移成功后的到期时间，pending时为预计值
+	ExpiresAt time.Time `json:"expiresAt"`
+	// 申请时向转入注册商收取的转移费及账本记录，拒绝或撤回时退回
+	Charged  int64  `json:"charged,omitempty"`
+	ChargeID uint64 `json:"chargeId,omitempty"`
+}
+
+// 注册商的轮询消息
+type Message struct {
+	ID          uint64    `json:"id"`
+	RegistrarID string    `json:"registrarId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Text        string    `json:"text"`
+	// 消息相关的域名转移，没有时为nil
+	Transfer *Transfer `json:"transfer,omitempty"`
+}
+
+func (t *tx) addMessage(registrarID string, text string, transfer *Transfer) {
+	t.d.Sequence++
+	msg := &Message{
+		ID:          t.d.Sequence,
+		RegistrarID: registrarID,
+		CreatedAt:   time.Now().UTC(),
+		Text:        text,
+	}
+	if transfer != nil {
+		c := *transfer
+		msg.Transfer = &c
+	}
+	t.d.Messages = append(t.d.Messages, msg)
+}
+
+// 申请把域名转入registrarID，authInfo必须与域名的转移密码一致
+func (r *Registry) RequestTransfer(name string, registrarID string, authInfo string, years int) (*Transfer, error) {
+	name = normalizeName(name)
+	if years == 0 {
+		years = 1
+	}
+	var res Transfer
+	err := r.limitAuthInfo(name, func() error {
+		return r.update(func(t *tx) error {
+			if err := t.checkRegistrar(registrarID); err != nil {
+				return err
+			}
+			dom := t.d.Domains[name]
+			if dom == nil {
+				return errorf(ErrNotFound, "域名 %s 没有注册", name)
+			}
+			if dom.RegistrarID == registrarID {
+				return errorf(ErrPolicy, "域名 %s 已属于注册商 %s", name, registrarID)
+			}
+			if dom.HasStatus(StatusPendingTransfer) {
+				return errorf(ErrPendingTransfer, "域名 %s 已有转移申请", name)
+			}
+			if dom.Deleting() {
+				return errorf(ErrProhibited, "域名 %s 已在删除流程中", name)
+			}
+			if err := dom.checkProhibited(StatusServerTransferProhibited, StatusClientTransferProhibited); err != nil {
+				return err
+			}
+			if until := r.transferLockedUntil(dom); time.Now().UTC().Before(until) {
+				return errorf(ErrProhibited, "域名 %s 在%s之前不能转移", name, until.Format("2006-01-02 15:04:05"))
+			}
+			if dom.AuthInfo == "" || subtle.ConstantTimeCompare([]byte(authInfo), []byte(dom.AuthInfo)) != 1 {
+				return errorf(ErrAuthInfo, "域名 %s 的authInfo不正确", name)
+			}
+			expires := dom.ExpiresAt.AddDate(years, 0, 0)
+			if years < 1 || expires.After(time.Now().UTC().AddDate(r.cfg.MaxPeriod, 0, 0)) {
+				return errorf(ErrRange, "转移后注册期限不能超过%d年", r.cfg.MaxPeriod)
+			}
+			now := time.Now().UTC()
+			charged, err := r.charge(t, registrarID, OpTransfer, name, years, now, false, time.Time{})
+			if err != nil {
+				return err
+			}
+			transfer := &Transfer{
+				Domain:      name,
+				Status:      TransferPending,
+				GainingID:   registrarID,
+				RequestedAt: now,
+				LosingID:    dom.RegistrarID,
+				ActionAt:    now.Add(r.cfg.Transfer.autoApprove),
+				Years:       years,
+				ExpiresAt:   expires,
+			}
+			if charged != nil {
+				transfer.Charged = -charged.Amount
+				transfer.ChargeID = charged.ID
+			}
+			t.d.Transfers[name] = transfer
+			dom.Status = append(dom.Status, StatusPendingTransfer)
+			dom.normalizeStatus()
+			// 通知双方，原注册商需要在ActionAt之前处理
+			t.addMessage(dom.RegistrarID, fmt.Sprintf("Transfer requested for %s", name), transfer)
+			t.addMessage(registrarID, fmt.Sprintf("Transfer pending for %s", name), transfer)
+			res = *transfer
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 原注册商批准转移
+func (r *Registry) ApproveTransfer(name string, registrarID string) (*Transfer, error) {
+	return r.finishTransfer(normalizeName(name), registrarID, TransferClientApproved)
+}
+
+// 原注册商拒绝转移
+func (r *Registry) RejectTransfer(name string, registrarID string) (*Transfer, error) {
+	return r.finishTransfer(normalizeName(name), registrarID, TransferClientRejected)
+}
+
+// 转入注册商撤回申请
+func (r *Registry) CancelTransfer(name string, registrarID string) (*Transfer, error) {
+	return r.finishTransfer(normalizeName(name), registrarID, TransferClientCancelled)
+}
+
+func (r *Registry) finishTransfer(name string, registrarID string, status string) (*Transfer, error) {
+	var res Transfer
+	err := r.update(func(t *tx) error {
+		transfer := t.d.Transfers[name]
+		dom := t.d.Domains[name]
+		if transfer == nil || transfer.Status != TransferPending || dom == nil {
+			return errorf(ErrNoPendingTransfer, "域名 %s 没有待处理的转移", name)
+		}
+		actor := transfer.LosingID
+		if status == TransferClientCancelled {
+			actor = transfer.GainingID
+		}
+		if err := checkSponsor(registrarID, actor, "域名 "+name+" 的转移"); err != nil {
+			return err
+		}
+		r.completeTransfer(t, dom, transfer, status, time.Now().UTC())
+		res = *transfer
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 结束转移并通知双方，批准时变更管理注册商并续费，否则退回转移费
+func (r *Registry) completeTransfer(t *tx, dom *Domain, transfer *Transfer, status string, now time.Time) {
+	transfer.Status = status
+	transfer.ActionAt = now
+	var list []string
+	for _, s := range dom.Status {
+		if s != StatusPendingTransfer {
+			list = append(list, s)
+		}
+	}
+	dom.Status = list
+	approved := status == TransferClientApproved || status == TransferServerApproved
+	r.settleTransfer(t, transfer, approved, now)
+	if approved {
+		dom.RegistrarID = transfer.GainingID
+		dom.ExpiresAt = dom.ExpiresAt.AddDate(transfer.Years, 0, 0)
+		transfer.ExpiresAt = dom.ExpiresAt
+		// 转移后原密码作废，由新注册商重新设置
+		dom.AuthInfo = ""
+		dom.TransferredAt = now
+	}
+	dom.UpdatedAt = now
+	dom.normalizeStatus()
+	text := fmt.Sprintf("Transfer %s for %s", status, dom.Name)
+	t.addMessage(transfer.GainingID, text, transfer)
+	t.addMessage(transfer.LosingID, text, transfer)
+}
+
+// 自动批准超过等待时间仍未处理的转移申请，返回本次批准的转移
+func (r *Registry) RunTransfers(now time.Time) ([]Transfer, error) {
+	now = now.UTC()
+	if !r.transfersDue(now) {
+		return nil, nil
+	}
+	var res []Transfer
+	err := r.update(func(t *tx) error {
+		for name, transfer := range t.d.Transfers {
+			dom := t.d.Domains[name]
+			if transfer.Status != TransferPending || dom == nil || now.Before(transfer.ActionAt) {
+				continue
+			}
+			r.completeTransfer(t, dom, transfer, TransferServerApproved, now)
+			res = append(res, *transfer)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Domain < res[j].Domain })
+	for _, transfer := range res {
+		fmt.Println("transfer", transfer.Domain, transfer.Status, transfer.LosingID, "->", transfer.GainingID)
+	}
+	return res, nil
+}
+
+// 是否有到期需要自动批准的转移，没有时不写数据文件
+func (r *Registry) transfersDue(now time.Time) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, transfer := range r.data.Transfers {
+		if transfer.Status == TransferPending && !now.Before(transfer.ActionAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// 注册或上次转移之后的转移锁定期结束时间
+func (r *Registry) transferLockedUntil(dom *Domain) time.Time {
+	since := dom.CreatedAt
+	if dom.TransferredAt.After(since) {
+		since = dom.TransferredAt
+	}
+	return since.Add(r.cfg.Transfer.lockPeriod)
+}
+
+// 管理注册商为域名生成新的authInfo，原authInfo作废
+func (r *Registry) GenerateAuthInfo(name string, registrarID string) (string, error) {
+	name = normalizeName(name)
+	code := r.newAuthInfo()
+	err := r.update(func(t *tx) error {
+		dom := t.d.Domains[name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", name)
+		}
+		if err := checkSponsor(registrarID, dom.RegistrarID, "域名 "+name); err != nil {
+			return err
+		}
+		if dom.Deleting() {
+			return errorf(ErrProhibited, "域名 %s 已在删除流程中", name)
+		}
+		dom.AuthInfo = code
+		dom.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// 校验域名的authInfo，供转入前确认
+func (r *Registry) VerifyAuthInfo(name string, authInfo string) error {
+	name = normalizeName(name)
+	return r.limitAuthInfo(name, func() error {
+		r.lock.RLock()
+		defer r.lock.RUnlock()
+		dom := r.data.Domains[name]
+		if dom == nil {
+			return errorf(ErrNotFound, "域名 %s 没有注册", name)
+		}
+		if dom.AuthInfo == "" || subtle.ConstantTimeCompare([]byte(authInfo), []byte(dom.AuthInfo)) != 1 {
+			return errorf(ErrAuthInfo, "域名 %s 的authInfo不正确", name)
+		}
+		return nil
+	})
+}
+
+func (r *Registry) newAuthInfo() string {
+	length := r.cfg.Transfer.AuthInfoLength
+	if length < minAuthInfoLength {
+		length = minAuthInfoLength
+	}
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(authInfoChars)))
+	for {
+		for i := range b {
+			n, _ := rand.Int(rand.Reader, max)
+			b[i] = authInfoChars[n.Int64()]
+		}
+		if checkAuthInfo(string(b)) == nil {
+			return string(b)
+		}
+	}
+}
+
+// 注册商设置的authInfo长度在8-32之间，并且同时含有字母和数字
+func checkAuthInfo(authInfo string) error {
+	if len(authInfo) < minAuthInfoLength || len(authInfo) > maxAuthInfoLength {
+		return errorf(ErrPolicy, "authInfo长度必须在%d-%d之间", minAuthInfoLength, maxAuthInfoLength)
+	}
+	if !strings.ContainsAny(authInfo, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") || !strings.ContainsAny(authInfo, "0123456789") {
+		return errorf(ErrPolicy, "authInfo必须同时含有字母和数字")
+	}
+	return nil
+}
+
+// 查询转移状态，registrarID不为空时必须是转移的一方
+func (r *Registry) QueryTransfer(name string, registrarID string) (*Transfer, error) {
+	name = normalizeName(name)
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	transfer := r.data.Transfers[name]
+	if transfer == nil {
+		return nil, errorf(ErrNoPendingTransfer, "域名 %s 没有转移记录", name)
+	}
+	if registrarID != "" && registrarID != transfer.GainingID && registrarID != transfer.LosingID {
+		return nil, errorf(ErrForbidden, "注册商 %s 不是域名 %s 转移的一方", registrarID, name)
+	}
+	c := *transfer
+	return &c, nil
+}
+
+// 取注册商最早的一条消息及队列中的消息数，队列为空时返回nil
+func (r *Registry) Poll(registrarID string) (*Message, int) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var first *Message
+	count := 0
+	for _, msg := range r.data.Messages {
+		if msg.RegistrarID == registrarID {
+			if first == nil {
+				c := *msg
+				first = &c
+			}
+			count++
+		}
+	}
+	return first, count
+}
+
+// 确认并删除消息，返回队列中剩余的消息数
+func (r *Registry) AckMessage(registrarID string, id uint64) (int, error) {
+	count := 0
+	err := r.update(func(t *tx) error {
+		found := false
+		var list []*Message
+		for _, msg := range t.d.Messages {
+			if msg.ID == id && msg.RegistrarID == registrarID {
+				found = true
+				continue
+			}
+			if msg.RegistrarID == registrarID {
+				count++
+			}
+			list = append(list, msg)
+		}
+		if !found {
+			return errorf(ErrNotFound, "消息 %d 不存在", id)
+		}
+		t.d.Messages = list
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,192 @@
+package registry
+
+import (
+	"testing"
+	"time"
+)
+
+const testAuthInfo = "secret123"
+
+// reg1管理a.chn，reg2有余额可以转入，转移费800
+func newTransferRegistry(t *testing.T, mutate func(cfg *Config)) *Registry {
+	t.Helper()
+	r := newTestRegistryWith(t, &fakeZone{}, func(cfg *Config) {
+		cfg.Billing.Enabled = true
+		cfg.Billing.Prices = map[string]PriceList{TierStandard: {Create: 1000, Renew: 1000, Transfer: 800}}
+		if mutate != nil {
+			mutate(cfg)
+		}
+	})
+	addTestRegistrar(t, r, "reg1", 0)
+	addTestRegistrar(t, r, "reg2", 5000)
+	now := time.Now().UTC()
+	dom := testDomain("a.chn", "reg1", now.AddDate(1, 0, 0))
+	dom.CreatedAt = now.AddDate(-1, 0, 0)
+	dom.AuthInfo = testAuthInfo
+	r.data.Domains[dom.Name] = dom
+	return r
+}
+
+func TestRequestTransfer(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(dom *Domain)
+		registrarID string
+		authInfo    string
+		wantErr     ErrorKind
+	}{
+		{name: "ok", registrarID: "reg2", authInfo: testAuthInfo},
+		{name: "wrong authInfo", registrarID: "reg2", authInfo: "wrong123", wantErr: ErrAuthInfo},
+		{name: "authInfo not set", mutate: func(dom *Domain) { dom.AuthInfo = "" }, registrarID: "reg2", wantErr: ErrAuthInfo},
+		{name: "own domain", registrarID: "reg1", authInfo: testAuthInfo, wantErr: ErrPolicy},
+		{name: "unknown registrar", registrarID: "reg3", authInfo: testAuthInfo, wantErr: ErrNotFound},
+		{name: "created recently", mutate: func(dom *Domain) { dom.CreatedAt = time.Now().UTC().AddDate(0, 0, -10) }, registrarID: "reg2", authInfo: testAuthInfo, wantErr: ErrProhibited},
+		{name: "transferred recently", mutate: func(dom *Domain) { dom.TransferredAt = time.Now().UTC().AddDate(0, 0, -59) }, registrarID: "reg2", authInfo: testAuthInfo, wantErr: ErrProhibited},
+		{name: "prohibited", mutate: func(dom *Domain) { dom.Status = []string{StatusClientTransferProhibited} }, registrarID: "reg2", authInfo: testAuthInfo, wantErr: ErrProhibited},
+		{name: "pending", mutate: func(dom *Domain) { dom.Status = []string{StatusPendingTransfer} }, registrarID: "reg2", authInfo: testAuthInfo, wantErr: ErrPendingTransfer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTransferRegistry(t, nil)
+			dom := r.data.Domains["a.chn"]
+			if tt.mutate != nil {
+				tt.mutate(dom)
+			}
+			transfer, err := r.RequestTransfer("A.chn", tt.registrarID, tt.authInfo, 1)
+			if tt.wantErr != ErrUnknown {
+				if KindOf(err) != tt.wantErr {
+					t.Fatalf("RequestTransfer error = %v，类别应为%d", err, tt.wantErr)
+				}
+				if balance := r.data.Registrars["reg2"].Balance; balance != 5000 {
+					t.Errorf("失败时余额变为%d", balance)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RequestTransfer: %v", err)
+			}
+			if transfer.Status != TransferPending || transfer.LosingID != "reg1" || transfer.Charged != 800 {
+				t.Errorf("转移为 %+v", transfer)
+			}
+			if !r.data.Domains["a.chn"].HasStatus(StatusPendingTransfer) {
+				t.Error("域名应有pendingTransfer状态")
+			}
+			if balance := r.data.Registrars["reg2"].Balance; balance != 4200 {
+				t.Errorf("余额为%d，应为4200", balance)
+			}
+			if len(r.data.Messages) != 2 {
+				t.Errorf("应通知双方，消息数为%d", len(r.data.Messages))
+			}
+		})
+	}
+}
+
+func TestFinishTransfer(t *testing.T) {
+	tests := []struct {
+		name        string
+		op          func(r *Registry, name string, registrarID string) (*Transfer, error)
+		registrarID string
+		wantErr     ErrorKind
+		wantStatus  string
+		// 完成后的管理注册商和转入注册商的余额
+		wantOwner   string
+		wantBalance int64
+	}{
+		{name: "approve", op: (*Registry).ApproveTransfer, registrarID: "reg1", wantStatus: TransferClientApproved, wantOwner: "reg2", wantBalance: 4200},
+		{name: "approve by gaining", op: (*Registry).ApproveTransfer, registrarID: "reg2", wantErr: ErrForbidden},
+		{name: "reject", op: (*Registry).RejectTransfer, registrarID: "reg1", wantStatus: TransferClientRejected, wantOwner: "reg1", wantBalance: 5000},
+		{name: "cancel", op: (*Registry).CancelTransfer, registrarID: "reg2", wantStatus: TransferClientCancelled, wantOwner: "reg1", wantBalance: 5000},
+		{name: "cancel by losing", op: (*Registry).CancelTransfer, registrarID: "reg1", wantErr: ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTransferRegistry(t, nil)
+			expires := r.data.Domains["a.chn"].ExpiresAt
+			if _, err := r.RequestTransfer("a.chn", "reg2", testAuthInfo, 1); err != nil {
+				t.Fatalf("RequestTransfer: %v", err)
+			}
+			transfer, err := tt.op(r, "a.chn", tt.registrarID)
+			if tt.wantErr != ErrUnknown {
+				if KindOf(err) != tt.wantErr {
+					t.Fatalf("error = %v，类别应为%d", err, tt.wantErr)
+				}
+				if r.data.Transfers["a.chn"].Status != TransferPending {
+					t.Error("失败时转移应仍在进行")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			dom := r.data.Domains["a.chn"]
+			if transfer.Status != tt.wantStatus || dom.RegistrarID != tt.wantOwner || dom.HasStatus(StatusPendingTransfer) {
+				t.Errorf("转移 %s 管理注册商 %s 状态 %v", transfer.Status, dom.RegistrarID, dom.Status)
+			}
+			if balance := r.data.Registrars["reg2"].Balance; balance != tt.wantBalance {
+				t.Errorf("转入注册商余额为%d，应为%d", balance, tt.wantBalance)
+			}
+			approved := tt.wantOwner == "reg2"
+			if approved != dom.ExpiresAt.Equal(expires.AddDate(1, 0, 0)) || approved != (dom.AuthInfo == "") {
+				t.Errorf("到期 %v authInfo %q，批准时应续费一年并清除authInfo", dom.ExpiresAt, dom.AuthInfo)
+			}
+		})
+	}
+}
+
+// 原注册商在autoApprove之内没有处理时自动批准，之后进入转移锁定期
+func TestRunTransfersAutoApprove(t *testing.T) {
+	r := newTransferRegistry(t, nil)
+	transfer, err := r.RequestTransfer("a.chn", "reg2", testAuthInfo, 1)
+	if err != nil {
+		t.Fatalf("RequestTransfer: %v", err)
+	}
+	if res, err := r.RunTransfers(transfer.ActionAt.Add(-time.Second)); err != nil || len(res) != 0 {
+		t.Fatalf("到期前不应批准: %v %v", res, err)
+	}
+	res, err := r.RunTransfers(transfer.ActionAt)
+	if err != nil || len(res) != 1 || res[0].Status != TransferServerApproved {
+		t.Fatalf("RunTransfers = %+v, %v", res, err)
+	}
+	dom := r.data.Domains["a.chn"]
+	if dom.RegistrarID != "reg2" || dom.TransferredAt.IsZero() {
+		t.Errorf("自动批准后管理注册商为%s，转移时间 %v", dom.RegistrarID, dom.TransferredAt)
+	}
+	code, err := r.GenerateAuthInfo("a.chn", "reg2")
+	if err != nil {
+		t.Fatalf("GenerateAuthInfo: %v", err)
+	}
+	if _, err := r.RequestTransfer("a.chn", "reg1", code, 1); KindOf(err) != ErrProhibited {
+		t.Errorf("锁定期内转回 error = %v，应为ErrProhibited", err)
+	}
+}
+
+// authInfo校验失败次数达到上限后，正确的authInfo也被拒绝，其他域名不受影响，窗口过后恢复
+func TestAuthInfoAttempts(t *testing.T) {
+	r := newTransferRegistry(t, func(cfg *Config) {
+		cfg.Transfer.AuthInfoAttempts = 3
+	})
+	b := testDomain("b.chn", "reg1", time.Now().UTC().AddDate(1, 0, 0))
+	b.AuthInfo = testAuthInfo
+	r.data.Domains["b.chn"] = b
+	for i := 0; i < 2; i++ {
+		if err := r.VerifyAuthInfo("a.chn", "wrong123"); KindOf(err) != ErrAuthInfo {
+			t.Fatalf("第%d次错误校验 error = %v", i+1, err)
+		}
+	}
+	if _, err := r.RequestTransfer("a.chn", "reg2", "wrong123", 1); KindOf(err) != ErrAuthInfo {
+		t.Fatalf("转移申请 error = %v，应为ErrAuthInfo", err)
+	}
+	if err := r.VerifyAuthInfo("a.chn", testAuthInfo); err == nil {
+		t.Error("失败次数过多后应拒绝校验")
+	}
+	if _, err := r.RequestTransfer("a.chn", "reg2", testAuthInfo, 1); err == nil {
+		t.Error("失败次数过多后应拒绝转移申请")
+	}
+	if err := r.VerifyAuthInfo("b.chn", testAuthInfo); err != nil {
+		t.Errorf("其他域名不应受影响: %v", err)
+	}
+	r.authInfoFailures.failures["a.chn"].start = time.Now().Add(-authInfoWindow)
+	if err := r.VerifyAuthInfo("a.chn", testAuthInfo); err != nil {
+		t.Errorf("窗口过后应恢复: %v", err)
+	}
+}
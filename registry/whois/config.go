@@ -0,0 +1,47 @@
+package whois
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// WHOIS服务配置，对应config.yaml中的whois节点
+type Config struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+	// text/template格式的输出模板，为空时使用内置模板
+	TemplateFile string `json:"templateFile"`
+	// 每个IP每分钟最多查询次数，0表示不限制
+	RateLimit int    `json:"rateLimit"`
+	Timeout   string `json:"timeout"`
+
+	timeout time.Duration
+}
+
+// 读取whois配置并补齐默认值
+func LoadConfig(ctx context.Context) (Config, error) {
+	cfg := Config{
+		Listen:    ":43",
+		RateLimit: 60,
+		Timeout:   "10s",
+	}
+	v, err := g.Cfg().Get(ctx, "whois")
+	if err != nil {
+		return cfg, err
+	}
+	if !v.IsNil() {
+		if err = v.Scan(&cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+		return cfg, fmt.Errorf("whois.timeout 格式错误: %v", err)
+	}
+	if cfg.RateLimit < 0 {
+		return cfg, fmt.Errorf("whois.rateLimit 不能小于0")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,46 @@
+package whois
+
+import (
+	"sync"
+	"time"
+)
+
+// 按IP统计每分钟的查询次数
+type rateLimiter struct {
+	lock    sync.Mutex
+	limit   int
+	windows map[string]*window
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int) *rateLimiter {
+	return &rateLimiter{limit: limit, windows: map[string]*window{}}
+}
+
+// 记录一次查询，超过限制时返回false
+func (l *rateLimiter) allow(ip string, now time.Time) bool {
+	if l.limit == 0 {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	w := l.windows[ip]
+	if w == nil || now.Sub(w.start) >= time.Minute {
+		// 顺便清理已过期的记录，避免map无限增长
+		if len(l.windows) > 10000 {
+			for key, old := range l.windows {
+				if now.Sub(old.start) >= time.Minute {
+					delete(l.windows, key)
+				}
+			}
+		}
+		w = &window{start: now}
+		l.windows[ip] = w
+	}
+	w.count++
+	return w.count <= l.limit
+}
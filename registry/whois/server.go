@@ -0,0 +1,172 @@
+package whois
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"text/template"
+	"time"
+
+	"newCHNTLDManager/registry"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// 查询的最大长度
+const maxQuerySize = 512
+
+// 公开的WHOIS查询服务（RFC 3912），数据来自registry
+type Server struct {
+	cfg      Config
+	reg      *registry.Registry
+	tmpl     *template.Template
+	limiter  *rateLimiter
+	listener net.Listener
+}
+
+func NewServer(cfg Config, reg *registry.Registry) (*Server, error) {
+	tmpl, err := template.New("whois").Funcs(templateFuncs(reg)).Parse(defaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TemplateFile != "" {
+		if !gfile.Exists(cfg.TemplateFile) {
+			return nil, fmt.Errorf("WHOIS模板 %s 不存在", cfg.TemplateFile)
+		}
+		if tmpl, err = tmpl.Parse(gfile.GetContents(cfg.TemplateFile)); err != nil {
+			return nil, fmt.Errorf("解析WHOIS模板 %s 失败: %v", cfg.TemplateFile, err)
+		}
+	}
+	return &Server{cfg: cfg, reg: reg, tmpl: tmpl, limiter: newRateLimiter(cfg.RateLimit)}, nil
+}
+
+// 开始监听，返回后在后台处理连接
+func (s *Server) Start() error {
+	var err error
+	s.listener, err = net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return err
+	}
+	fmt.Println("whois: listening on", s.listener.Addr())
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				fmt.Println("whois: accept error:", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			go s.serve(conn)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// 每个连接只处理一条查询，回复后关闭连接
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(s.cfg.timeout))
+	line, err := bufio.NewReader(io.LimitReader(conn, maxQuerySize)).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return
+	}
+	ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	var name string
+	var view interface{}
+	if s.limiter.allow(ip, time.Now()) {
+		name, view = s.lookup(strings.TrimSpace(line))
+	} else {
+		fmt.Println("whois: rate limit exceeded:", ip)
+		name, view = "error", errorView{Msg: "query rate limit exceeded, please try again later"}
+	}
+	var buf bytes.Buffer
+	if err = s.tmpl.ExecuteTemplate(&buf, name, view); err != nil {
+		fmt.Println("whois: template error:", err)
+		buf.Reset()
+		buf.WriteString("Error: internal error\n")
+	}
+	// RFC 3912要求以CRLF换行
+	out := strings.ReplaceAll(strings.ReplaceAll(buf.String(), "\r\n", "\n"), "\n", "\r\n")
+	_, _ = io.WriteString(conn, out)
+}
+
+// 解析查询，返回使用的模板名和数据。
+// 支持"domain 名称"、"nameserver 名称"、"registrar ID或名称"，
+// 不带关键字时依次按域名、主机、注册商查找
+func (s *Server) lookup(query string) (string, interface{}) {
+	now := time.Now()
+	if query == "" {
+		return "error", errorView{Msg: "empty query"}
+	}
+	kind, arg := "", query
+	if fields := strings.SplitN(query, " ", 2); len(fields) == 2 {
+		switch strings.ToLower(fields[0]) {
+		case "domain", "nameserver", "ns", "host", "registrar":
+			kind, arg = strings.ToLower(fields[0]), strings.TrimSpace(fields[1])
+		}
+	}
+	if kind == "" || kind == "domain" {
+		if view := s.domainView(arg, now); view != nil {
+			return "domain", view
+		}
+	}
+	if kind == "" || kind == "nameserver" || kind == "ns" || kind == "host" {
+		if host, err := s.reg.GetHost(arg); err == nil {
+			view := hostView{Host: *host, QueriedAt: now}
+			if registrar, err := s.reg.GetRegistrar(host.RegistrarID); err == nil {
+				view.Registrar = *registrar
+			}
+			return "nameserver", view
+		}
+	}
+	if kind == "" || kind == "registrar" {
+		for _, registrar := range s.reg.ListRegistrars() {
+			if strings.EqualFold(registrar.ID, arg) || strings.EqualFold(registrar.Name, arg) {
+				return "registrar", registrarView{Registrar: registrar, QueriedAt: now}
+			}
+		}
+	}
+	return "notFound", notFoundView{Query: arg, QueriedAt: now}
+}
+
+func (s *Server) domainView(name string, now time.Time) *domainView {
+	dom, err := s.reg.GetDomain(name)
+	if err != nil {
+		return nil
+	}
+	dom.AuthInfo = ""
+	view := &domainView{Domain: *dom, QueriedAt: now}
+	if registrar, err := s.reg.GetRegistrar(dom.RegistrarID); err == nil {
+		view.Registrar = *registrar
+	}
+	roles := []struct{ role, id string }{
+		{"Registrant", dom.RegistrantID},
+		{"Admin", dom.AdminID},
+		{"Tech", dom.TechID},
+		{"Billing", dom.BillingID},
+	}
+	for _, item := range roles {
+		if item.id == "" {
+			continue
+		}
+		if c, err := s.reg.PublicContact(item.id); err == nil {
+			view.Contacts = append(view.Contacts, contactView{Role: item.role, Contact: *c})
+		}
+	}
+	return view
+}
@@ -0,0 +1,183 @@
+package whois
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"newCHNTLDManager/registry"
+)
+
+type nopZone struct{}
+
+func (nopZone) PublishDelegation(string, []string, map[string][]string, []string) error { return nil }
+func (nopZone) WithdrawDelegation(string) error                                         { return nil }
+func (nopZone) PurgeDomain(string) error                                                { return nil }
+func (nopZone) Commit() error                                                           { return nil }
+func (nopZone) Rollback()                                                               {}
+func (nopZone) SetDomainLock(string, bool) error                                        { return nil }
+
+// reg1管理example.chn，注册人C001，NS为ns1.example.net
+func newTestServer(t *testing.T, redact bool, rateLimit int) *Server {
+	t.Helper()
+	reg, err := registry.New(registry.Config{DataFile: filepath.Join(t.TempDir(), "registry.json"), TLD: "chn", DefaultPeriod: 1, MaxPeriod: 10, Redact: redact}, nopZone{})
+	if err != nil {
+		t.Fatalf("registry.New: %v", err)
+	}
+	if _, err = reg.CreateRegistrar(registry.Registrar{ID: "reg1", Name: "Example Registrar", Email: "abuse@registrar.example"}); err != nil {
+		t.Fatalf("CreateRegistrar: %v", err)
+	}
+	contact := registry.Contact{ID: "C001", RegistrarID: "reg1", Name: "Zhang San", Org: "Example Org", Street: []string{"1 Main St"}, City: "Beijing", Country: "cn", Voice: "+86.1012345678", Email: "zhang@example.com", AuthInfo: "contact-secret"}
+	if _, err = reg.CreateContact(contact); err != nil {
+		t.Fatalf("CreateContact: %v", err)
+	}
+	if _, err = reg.CreateHost(registry.Host{Name: "ns1.example.net", RegistrarID: "reg1"}); err != nil {
+		t.Fatalf("CreateHost: %v", err)
+	}
+	if _, err = reg.CreateDomain(registry.Domain{Name: "example.chn", RegistrarID: "reg1", RegistrantID: "C001", TechID: "C001", NameServers: []string{"ns1.example.net"}}, 1, false, ""); err != nil {
+		t.Fatalf("CreateDomain: %v", err)
+	}
+	s, err := NewServer(Config{RateLimit: rateLimit, timeout: time.Second}, reg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return s
+}
+
+func TestLookup(t *testing.T) {
+	s := newTestServer(t, true, 0)
+	tests := []struct {
+		query string
+		// 使用的模板和输出中应包含的文字
+		tmpl string
+		want string
+	}{
+		{"example.chn", "domain", "Domain Name: EXAMPLE.CHN"},
+		{"EXAMPLE.CHN.", "domain", "Domain Name: EXAMPLE.CHN"},
+		{"domain example.chn", "domain", "Name Server: NS1.EXAMPLE.NET"},
+		{"DOMAIN example.chn", "domain", "Registrar: Example Registrar"},
+		{"ns1.example.net", "nameserver", "Server Name: NS1.EXAMPLE.NET"},
+		{"nameserver ns1.example.net", "nameserver", "Registrar ID: reg1"},
+		{"host ns1.example.net", "nameserver", "Server Name: NS1.EXAMPLE.NET"},
+		{"registrar reg1", "registrar", "Registrar: Example Registrar"},
+		{"registrar example registrar", "registrar", "Registrar ID: reg1"},
+		{"reg1", "registrar", "Registrar ID: reg1"},
+		// 带关键字时只按该类对象查找
+		{"domain ns1.example.net", "notFound", `No match for "ns1.example.net".`},
+		{"nameserver example.chn", "notFound", `No match for "example.chn".`},
+		{"other.chn", "notFound", `No match for "other.chn".`},
+		{"", "error", "Error: empty query"},
+	}
+	for _, tt := range tests {
+		name, view := s.lookup(tt.query)
+		if name != tt.tmpl {
+			t.Errorf("lookup(%q) 使用模板%s，应为%s", tt.query, name, tt.tmpl)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := s.tmpl.ExecuteTemplate(&buf, name, view); err != nil {
+			t.Fatalf("模板%s: %v", name, err)
+		}
+		if !strings.Contains(buf.String(), tt.want) {
+			t.Errorf("lookup(%q) 的输出中没有 %q:\n%s", tt.query, tt.want, buf.String())
+		}
+	}
+}
+
+// 按配置隐藏联系人的个人信息，authInfo总是不输出
+func TestLookupRedaction(t *testing.T) {
+	tests := []struct {
+		redact  bool
+		want    []string
+		notWant []string
+	}{
+		{
+			redact:  true,
+			want:    []string{"Registrant Name: " + registry.RedactedText, "Registrant Email: " + registry.RedactedText, "Registrant Organization: Example Org", "Tech Country: CN", "Personal data of contacts is redacted"},
+			notWant: []string{"Zhang San", "zhang@example.com", "Beijing", "1 Main St", "+86.1012345678", "secret"},
+		},
+		{
+			redact:  false,
+			want:    []string{"Registrant Name: Zhang San", "Registrant Email: zhang@example.com", "Registrant City: Beijing", "Tech Phone: +86.1012345678"},
+			notWant: []string{registry.RedactedText, "Personal data of contacts is redacted", "secret"},
+		},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t, tt.redact, 0)
+		name, view := s.lookup("example.chn")
+		var buf bytes.Buffer
+		if err := s.tmpl.ExecuteTemplate(&buf, name, view); err != nil {
+			t.Fatalf("模板%s: %v", name, err)
+		}
+		out := buf.String()
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("redact=%v 输出中没有 %q", tt.redact, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(out, notWant) {
+				t.Errorf("redact=%v 输出中不应有 %q", tt.redact, notWant)
+			}
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(2)
+	steps := []struct {
+		ip     string
+		offset time.Duration
+		want   bool
+	}{
+		{"192.0.2.1", 0, true},
+		{"192.0.2.1", time.Second, true},
+		{"192.0.2.1", 2 * time.Second, false},
+		// 其他IP单独计数
+		{"192.0.2.2", 3 * time.Second, true},
+		{"192.0.2.1", time.Minute - time.Nanosecond, false},
+		// 一分钟后重新计数
+		{"192.0.2.1", time.Minute, true},
+	}
+	for i, step := range steps {
+		if got := l.allow(step.ip, now.Add(step.offset)); got != step.want {
+			t.Errorf("第%d次 allow(%s) = %v，应为%v", i+1, step.ip, got, step.want)
+		}
+	}
+	unlimited := newRateLimiter(0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.allow("192.0.2.1", now) {
+			t.Fatal("rateLimit为0时不应限制")
+		}
+	}
+}
+
+// 每个连接一条查询，以CRLF换行，超过频率限制时返回错误
+func TestServe(t *testing.T) {
+	s := newTestServer(t, true, 1)
+	query := func(line string) string {
+		client, server := net.Pipe()
+		defer client.Close()
+		go s.serve(server)
+		if _, err := io.WriteString(client, line); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		out, err := io.ReadAll(client)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return string(out)
+	}
+	out := query("example.chn\r\n")
+	if !strings.HasPrefix(out, "Domain Name: EXAMPLE.CHN\r\n") || strings.Contains(strings.ReplaceAll(out, "\r\n", ""), "\n") {
+		t.Errorf("输出应以CRLF换行:\n%q", out)
+	}
+	if out = query("example.chn\r\n"); !strings.Contains(out, "rate limit exceeded") {
+		t.Errorf("超过频率限制后输出为 %q", out)
+	}
+}
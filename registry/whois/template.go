@@ -0,0 +1,124 @@
+package whois
+
+import (
+	"strings"
+	"text/template"
+	"time"
+
+	"newCHNTLDManager/registry"
+)
+
+// 内置输出模板，templateFile中定义的同名模板会覆盖这里的定义。
+// 需要的模板：domain、nameserver、registrar、notFound、error
+const defaultTemplate = `
+{{- define "domain" -}}
+Domain Name: {{upper .Domain.Name}}
+Registry Domain ID: {{.Domain.ROID}}
+Updated Date: {{date .Domain.UpdatedAt}}
+Creation Date: {{date .Domain.CreatedAt}}
+Registry Expiry Date: {{date .Domain.ExpiresAt}}
+Registrar: {{.Registrar.Name}}
+Registrar ID: {{.Registrar.ID}}
+{{with .Registrar.Email}}Registrar Abuse Contact Email: {{.}}
+{{end}}{{with .Registrar.Phone}}Registrar Abuse Contact Phone: {{.}}
+{{end}}{{range .Domain.Status}}Domain Status: {{.}} https://icann.org/epp#{{.}}
+{{end}}{{range .Contacts}}{{template "contact" .}}{{end}}{{range .Domain.NameServers}}Name Server: {{upper .}}
+{{end}}DNSSEC: {{if .Domain.DS}}signedDelegation{{else}}unsigned{{end}}
+{{template "footer" .}}
+{{- end}}
+
+{{- define "contact" -}}
+Registry {{.Role}} ID: {{.Contact.ID}}
+{{.Role}} Name: {{.Contact.Name}}
+{{with .Contact.Org}}{{$.Role}} Organization: {{.}}
+{{end}}{{range .Contact.Street}}{{$.Role}} Street: {{.}}
+{{end}}{{with .Contact.City}}{{$.Role}} City: {{.}}
+{{end}}{{with .Contact.Province}}{{$.Role}} State/Province: {{.}}
+{{end}}{{with .Contact.PostalCode}}{{$.Role}} Postal Code: {{.}}
+{{end}}{{$.Role}} Country: {{.Contact.Country}}
+{{with .Contact.Voice}}{{$.Role}} Phone: {{.}}
+{{end}}{{with .Contact.Fax}}{{$.Role}} Fax: {{.}}
+{{end}}{{$.Role}} Email: {{.Contact.Email}}
+{{end}}
+
+{{- define "nameserver" -}}
+Server Name: {{upper .Host.Name}}
+{{range .Host.Addresses}}IP Address: {{.}}
+{{end}}Registrar: {{.Registrar.Name}}
+Registrar ID: {{.Registrar.ID}}
+{{template "footer" .}}
+{{- end}}
+
+{{- define "registrar" -}}
+Registrar: {{.Registrar.Name}}
+Registrar ID: {{.Registrar.ID}}
+Registrar Status: {{.Registrar.Status}}
+{{with .Registrar.URL}}Registrar URL: {{.}}
+{{end}}{{with .Registrar.Email}}Email: {{.}}
+{{end}}{{with .Registrar.Phone}}Phone: {{.}}
+{{end}}{{template "footer" .}}
+{{- end}}
+
+{{- define "notFound" -}}
+No match for "{{.Query}}".
+{{template "footer" .}}
+{{- end}}
+
+{{- define "error" -}}
+Error: {{.Msg}}
+{{end}}
+
+{{- define "footer" -}}
+>>> Last update of WHOIS database: {{date .QueriedAt}} <<<
+{{if redacted}}
+Personal data of contacts is redacted for privacy.{{end}}
+The data is provided for information purposes only.
+{{end}}`
+
+type domainView struct {
+	Domain    registry.Domain
+	Registrar registry.Registrar
+	Contacts  []contactView
+	QueriedAt time.Time
+}
+
+type contactView struct {
+	// Registrant、Admin、Tech或Billing
+	Role    string
+	Contact registry.Contact
+}
+
+type hostView struct {
+	Host      registry.Host
+	Registrar registry.Registrar
+	QueriedAt time.Time
+}
+
+type registrarView struct {
+	Registrar registry.Registrar
+	QueriedAt time.Time
+}
+
+type notFoundView struct {
+	Query     string
+	QueriedAt time.Time
+}
+
+type errorView struct {
+	Msg string
+}
+
+func templateFuncs(reg *registry.Registry) template.FuncMap {
+	return template.FuncMap{
+		"upper": strings.ToUpper,
+		"date": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.UTC().Format(time.RFC3339)
+		},
+		"redacted": func() bool {
+			return reg.Config().Redact
+		},
+	}
+}